@@ -3,17 +3,30 @@ package archive
 import (
 	"archive/tar"
 	"archive/zip"
+	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/dryrun"
+	"github.com/gaspardpetit/mcp-shell/internal/quota"
 )
 
-const LogPath = "/logs/mcp-shell.log"
+const (
+	// DefaultInlineMax caps member content returned inline by archive.extract_file.
+	DefaultInlineMax = 1 << 20 // 1 MiB
+)
 
 func workspaceRoot() string {
 	if ws := os.Getenv("WORKSPACE"); ws != "" {
@@ -46,19 +59,8 @@ func normalizePath(p string) (string, error) {
 	return p, nil
 }
 
-func audit(rec any) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-	_ = json.NewEncoder(f).Encode(rec)
+func audit(ctx context.Context, rec any) {
+	auditlog.Write(ctx, rec)
 }
 
 func shouldInclude(name string, include, exclude []string) bool {
@@ -78,6 +80,158 @@ func shouldInclude(name string, include, exclude []string) bool {
 	return false
 }
 
+// expectedHash looks up the sha256 expected for an archive entry, accepting
+// keys written with or without a leading "./".
+func expectedHash(expected map[string]string, name string) (string, bool) {
+	if h, ok := expected[name]; ok {
+		return h, true
+	}
+	h, ok := expected[strings.TrimPrefix(name, "./")]
+	return h, ok
+}
+
+// copyVerified copies r to w, hashing the content when expected lists name.
+// checked reports whether a hash was compared; a mismatch is an error.
+func copyVerified(w io.Writer, r io.Reader, name string, expected map[string]string) (checked bool, err error) {
+	want, ok := expectedHash(expected, name)
+	if !ok {
+		_, err := io.Copy(w, r)
+		return false, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), r); err != nil {
+		return true, err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+		return true, fmt.Errorf("sha256 mismatch for %s: got %s", name, got)
+	}
+	return true, nil
+}
+
+// staging holds the files of an extraction under temporary names beside
+// their targets, so that a failed run (hash mismatch, missing entry, quota)
+// leaves dest as it was. commit renames them into place; discard removes
+// them along with any directories the run created.
+type staging struct {
+	files [][2]string // temp, final
+	dirs  []string
+}
+
+// mkdirAll is os.MkdirAll that remembers the top directory it created.
+func (s *staging) mkdirAll(dir string, mode os.FileMode) error {
+	top := ""
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Lstat(d); err == nil {
+			break
+		}
+		top = d
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	if top != "" {
+		s.dirs = append(s.dirs, top)
+	}
+	return nil
+}
+
+// create opens a temp file that commit will rename to path.
+func (s *staging) create(path string, mode os.FileMode) (*os.File, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".part*")
+	if err != nil {
+		return nil, err
+	}
+	s.files = append(s.files, [2]string{f.Name(), path})
+	if err := f.Chmod(mode.Perm()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *staging) commit() error {
+	for i, f := range s.files {
+		if err := os.Rename(f[0], f[1]); err != nil {
+			s.files = s.files[i:]
+			s.discard()
+			return err
+		}
+	}
+	s.files = nil
+	return nil
+}
+
+func (s *staging) discard() {
+	for _, f := range s.files {
+		_ = os.Remove(f[0])
+	}
+	for i := len(s.dirs) - 1; i >= 0; i-- {
+		_ = os.RemoveAll(s.dirs[i])
+	}
+	if len(s.files) > 0 {
+		quota.Invalidate()
+	}
+	s.files, s.dirs = nil, nil
+}
+
+// missingEntries lists, comma-separated, the expected entries that were not
+// verified.
+func missingEntries(expected map[string]string, verified []string) string {
+	seen := map[string]bool{}
+	for _, v := range verified {
+		seen[v] = true
+		seen[strings.TrimPrefix(v, "./")] = true
+	}
+	var missing []string
+	for name := range expected {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return strings.Join(missing, ", ")
+}
+
+// planArchive walks src with the same filtering as Zip (skipDirs false) or
+// Tar (skipDirs true, where an excluded directory prunes its subtree) and
+// returns the files that would be archived with their total size.
+func planArchive(src string, include, exclude []string, skipDirs bool) ([]string, int64, error) {
+	paths := []string{}
+	var total int64
+	err := filepath.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if !shouldInclude(rel, include, exclude) {
+			if d.IsDir() && skipDirs {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		paths = append(paths, rel)
+		total += info.Size()
+		return nil
+	})
+	return paths, total, err
+}
+
 // ---- archive.zip
 
 type ZipRequest struct {
@@ -85,17 +239,21 @@ type ZipRequest struct {
 	Dest    string   `json:"dest"`
 	Include []string `json:"include,omitempty"`
 	Exclude []string `json:"exclude,omitempty"`
+	DryRun  bool     `json:"dry_run,omitempty"`
 }
 
 type ZipResponse struct {
-	ArchivePath string `json:"archive_path"`
-	Files       int    `json:"files"`
-	DurationMs  int64  `json:"duration_ms"`
-	Error       string `json:"error,omitempty"`
+	ArchivePath string   `json:"archive_path"`
+	Files       int      `json:"files"`
+	Paths       []string `json:"paths,omitempty"`
+	TotalBytes  int64    `json:"total_bytes,omitempty"`
+	DurationMs  int64    `json:"duration_ms"`
+	Error       string   `json:"error,omitempty"`
 }
 
 func Zip(ctx context.Context, in ZipRequest) ZipResponse {
 	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
 	src, err := normalizePath(in.Src)
 	if err != nil {
 		return ZipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
@@ -104,6 +262,24 @@ func Zip(ctx context.Context, in ZipRequest) ZipResponse {
 	if err != nil {
 		return ZipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
+	if in.DryRun {
+		paths, total, err := planArchive(src, in.Include, in.Exclude, false)
+		if err != nil {
+			return ZipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		resp := ZipResponse{ArchivePath: dest, Files: len(paths), Paths: paths, TotalBytes: total}
+		resp.DurationMs = time.Since(start).Milliseconds()
+		audit(ctx, struct {
+			TS         string `json:"ts"`
+			Tool       string `json:"tool"`
+			Src        string `json:"src"`
+			Dest       string `json:"dest"`
+			Files      int    `json:"files"`
+			DurationMs int64  `json:"duration_ms"`
+			DryRun     bool   `json:"dry_run"`
+		}{time.Now().UTC().Format(time.RFC3339), "archive.zip", src, dest, resp.Files, resp.DurationMs, true})
+		return resp
+	}
 	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
 		return ZipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
@@ -162,7 +338,7 @@ func Zip(ctx context.Context, in ZipRequest) ZipResponse {
 	}
 	resp := ZipResponse{ArchivePath: dest, Files: count}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Src        string `json:"src"`
@@ -176,17 +352,19 @@ func Zip(ctx context.Context, in ZipRequest) ZipResponse {
 // ---- archive.unzip
 
 type UnzipRequest struct {
-	Src     string   `json:"src"`
-	Dest    string   `json:"dest"`
-	Include []string `json:"include,omitempty"`
-	Exclude []string `json:"exclude,omitempty"`
+	Src            string            `json:"src"`
+	Dest           string            `json:"dest"`
+	Include        []string          `json:"include,omitempty"`
+	Exclude        []string          `json:"exclude,omitempty"`
+	ExpectedHashes map[string]string `json:"expected_hashes,omitempty"`
 }
 
 type UnzipResponse struct {
-	Extracted  bool   `json:"extracted"`
-	Files      int    `json:"files"`
-	DurationMs int64  `json:"duration_ms"`
-	Error      string `json:"error,omitempty"`
+	Extracted  bool     `json:"extracted"`
+	Files      int      `json:"files"`
+	Verified   []string `json:"verified,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+	Error      string   `json:"error,omitempty"`
 }
 
 func Unzip(ctx context.Context, in UnzipRequest) UnzipResponse {
@@ -204,10 +382,16 @@ func Unzip(ctx context.Context, in UnzipRequest) UnzipResponse {
 		return UnzipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
 	defer r.Close()
-	if err := os.MkdirAll(dest, 0o755); err != nil {
+	var stage staging
+	if err := stage.mkdirAll(dest, 0o755); err != nil {
 		return UnzipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
+	fail := func(err string) UnzipResponse {
+		stage.discard()
+		return UnzipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err}
+	}
 	var count int
+	var verified []string
 	for _, f := range r.File {
 		if !shouldInclude(f.Name, in.Include, in.Exclude) {
 			continue
@@ -216,39 +400,47 @@ func Unzip(ctx context.Context, in UnzipRequest) UnzipResponse {
 		if !allowOutside() {
 			rel, err := filepath.Rel(workspaceRoot(), fp)
 			if err != nil || strings.HasPrefix(rel, "..") {
-				return UnzipResponse{DurationMs: time.Since(start).Milliseconds(), Error: "path escapes workspace"}
+				return fail("path escapes workspace")
 			}
 		}
 		if f.FileInfo().IsDir() {
-			if err := os.MkdirAll(fp, 0o755); err != nil {
-				return UnzipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			if err := stage.mkdirAll(fp, 0o755); err != nil {
+				return fail(err.Error())
 			}
 			continue
 		}
-		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
-			return UnzipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		if err := stage.mkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			return fail(err.Error())
 		}
 		rc, err := f.Open()
 		if err != nil {
-			return UnzipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			return fail(err.Error())
 		}
-		out, err := os.OpenFile(fp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode())
+		out, err := stage.create(fp, f.Mode())
 		if err != nil {
 			rc.Close()
-			return UnzipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
-		}
-		if _, err := io.Copy(out, rc); err != nil {
-			out.Close()
-			rc.Close()
-			return UnzipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			return fail(err.Error())
 		}
+		ok, err := copyVerified(quota.NewWriter(out), rc, f.Name, in.ExpectedHashes)
 		out.Close()
 		rc.Close()
+		if err != nil {
+			return fail(err.Error())
+		}
+		if ok {
+			verified = append(verified, f.Name)
+		}
 		count++
 	}
-	resp := UnzipResponse{Extracted: true, Files: count}
+	if missing := missingEntries(in.ExpectedHashes, verified); missing != "" {
+		return fail("expected entries not extracted: " + missing)
+	}
+	if err := stage.commit(); err != nil {
+		return UnzipResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	resp := UnzipResponse{Extracted: true, Files: count, Verified: verified}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Src        string `json:"src"`
@@ -266,17 +458,21 @@ type TarRequest struct {
 	Dest    string   `json:"dest"`
 	Include []string `json:"include,omitempty"`
 	Exclude []string `json:"exclude,omitempty"`
+	DryRun  bool     `json:"dry_run,omitempty"`
 }
 
 type TarResponse struct {
-	ArchivePath string `json:"archive_path"`
-	Files       int    `json:"files"`
-	DurationMs  int64  `json:"duration_ms"`
-	Error       string `json:"error,omitempty"`
+	ArchivePath string   `json:"archive_path"`
+	Files       int      `json:"files"`
+	Paths       []string `json:"paths,omitempty"`
+	TotalBytes  int64    `json:"total_bytes,omitempty"`
+	DurationMs  int64    `json:"duration_ms"`
+	Error       string   `json:"error,omitempty"`
 }
 
 func Tar(ctx context.Context, in TarRequest) TarResponse {
 	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
 	src, err := normalizePath(in.Src)
 	if err != nil {
 		return TarResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
@@ -285,6 +481,24 @@ func Tar(ctx context.Context, in TarRequest) TarResponse {
 	if err != nil {
 		return TarResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
+	if in.DryRun {
+		paths, total, err := planArchive(src, in.Include, in.Exclude, true)
+		if err != nil {
+			return TarResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		resp := TarResponse{ArchivePath: dest, Files: len(paths), Paths: paths, TotalBytes: total}
+		resp.DurationMs = time.Since(start).Milliseconds()
+		audit(ctx, struct {
+			TS         string `json:"ts"`
+			Tool       string `json:"tool"`
+			Src        string `json:"src"`
+			Dest       string `json:"dest"`
+			Files      int    `json:"files"`
+			DurationMs int64  `json:"duration_ms"`
+			DryRun     bool   `json:"dry_run"`
+		}{time.Now().UTC().Format(time.RFC3339), "archive.tar", src, dest, resp.Files, resp.DurationMs, true})
+		return resp
+	}
 	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
 		return TarResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
@@ -347,7 +561,7 @@ func Tar(ctx context.Context, in TarRequest) TarResponse {
 	}
 	resp := TarResponse{ArchivePath: dest, Files: count}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Src        string `json:"src"`
@@ -361,17 +575,19 @@ func Tar(ctx context.Context, in TarRequest) TarResponse {
 // ---- archive.untar
 
 type UntarRequest struct {
-	Src     string   `json:"src"`
-	Dest    string   `json:"dest"`
-	Include []string `json:"include,omitempty"`
-	Exclude []string `json:"exclude,omitempty"`
+	Src            string            `json:"src"`
+	Dest           string            `json:"dest"`
+	Include        []string          `json:"include,omitempty"`
+	Exclude        []string          `json:"exclude,omitempty"`
+	ExpectedHashes map[string]string `json:"expected_hashes,omitempty"`
 }
 
 type UntarResponse struct {
-	Extracted  bool   `json:"extracted"`
-	Files      int    `json:"files"`
-	DurationMs int64  `json:"duration_ms"`
-	Error      string `json:"error,omitempty"`
+	Extracted  bool     `json:"extracted"`
+	Files      int      `json:"files"`
+	Verified   []string `json:"verified,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+	Error      string   `json:"error,omitempty"`
 }
 
 func Untar(ctx context.Context, in UntarRequest) UntarResponse {
@@ -390,17 +606,23 @@ func Untar(ctx context.Context, in UntarRequest) UntarResponse {
 	}
 	defer f.Close()
 	tr := tar.NewReader(f)
-	if err := os.MkdirAll(dest, 0o755); err != nil {
+	var stage staging
+	if err := stage.mkdirAll(dest, 0o755); err != nil {
 		return UntarResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
+	fail := func(err string) UntarResponse {
+		stage.discard()
+		return UntarResponse{DurationMs: time.Since(start).Milliseconds(), Error: err}
+	}
 	var count int
+	var verified []string
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return UntarResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			return fail(err.Error())
 		}
 		if !shouldInclude(hdr.Name, in.Include, in.Exclude) {
 			continue
@@ -409,32 +631,41 @@ func Untar(ctx context.Context, in UntarRequest) UntarResponse {
 		if !allowOutside() {
 			rel, err := filepath.Rel(workspaceRoot(), fp)
 			if err != nil || strings.HasPrefix(rel, "..") {
-				return UntarResponse{DurationMs: time.Since(start).Milliseconds(), Error: "path escapes workspace"}
+				return fail("path escapes workspace")
 			}
 		}
 		if hdr.FileInfo().IsDir() {
-			if err := os.MkdirAll(fp, hdr.FileInfo().Mode()); err != nil {
-				return UntarResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			if err := stage.mkdirAll(fp, hdr.FileInfo().Mode()); err != nil {
+				return fail(err.Error())
 			}
 			continue
 		}
-		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
-			return UntarResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		if err := stage.mkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			return fail(err.Error())
 		}
-		out, err := os.OpenFile(fp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode())
+		out, err := stage.create(fp, hdr.FileInfo().Mode())
 		if err != nil {
-			return UntarResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
-		}
-		if _, err := io.Copy(out, tr); err != nil {
-			out.Close()
-			return UntarResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			return fail(err.Error())
 		}
+		ok, err := copyVerified(quota.NewWriter(out), tr, hdr.Name, in.ExpectedHashes)
 		out.Close()
+		if err != nil {
+			return fail(err.Error())
+		}
+		if ok {
+			verified = append(verified, hdr.Name)
+		}
 		count++
 	}
-	resp := UntarResponse{Extracted: true, Files: count}
+	if missing := missingEntries(in.ExpectedHashes, verified); missing != "" {
+		return fail("expected entries not extracted: " + missing)
+	}
+	if err := stage.commit(); err != nil {
+		return UntarResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	resp := UntarResponse{Extracted: true, Files: count, Verified: verified}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Src        string `json:"src"`
@@ -444,3 +675,147 @@ func Untar(ctx context.Context, in UntarRequest) UntarResponse {
 	}{time.Now().UTC().Format(time.RFC3339), "archive.untar", src, dest, count, resp.DurationMs})
 	return resp
 }
+
+// ---- archive.extract_file
+
+type ExtractFileRequest struct {
+	Src      string `json:"src"`
+	Member   string `json:"member"`
+	Dest     string `json:"dest,omitempty"`
+	MaxBytes int64  `json:"max_bytes,omitempty"`
+}
+
+type ExtractFileResponse struct {
+	Path       string `json:"path,omitempty"`
+	Size       int64  `json:"size"`
+	Content    string `json:"content,omitempty"`
+	ContentB64 string `json:"content_b64,omitempty"`
+	Truncated  bool   `json:"truncated"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// cleanMember rejects member names that would escape the extraction root.
+func cleanMember(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("member is required")
+	}
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", errors.New("member path escapes archive root")
+	}
+	return clean, nil
+}
+
+// openMember locates a single entry in a zip or tar archive. The returned
+// cleanup func must be called once the reader is no longer needed.
+func openMember(src, member string) (io.Reader, int64, func(), error) {
+	if zr, err := zip.OpenReader(src); err == nil {
+		for _, f := range zr.File {
+			if filepath.Clean(filepath.FromSlash(f.Name)) != member || f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				zr.Close()
+				return nil, 0, nil, err
+			}
+			return rc, int64(f.UncompressedSize64), func() { rc.Close(); zr.Close() }, nil
+		}
+		zr.Close()
+		return nil, 0, nil, errors.New("member not found")
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, 0, nil, err
+		}
+		if filepath.Clean(filepath.FromSlash(hdr.Name)) != member || hdr.FileInfo().IsDir() {
+			continue
+		}
+		return tr, hdr.Size, func() { f.Close() }, nil
+	}
+	f.Close()
+	return nil, 0, nil, errors.New("member not found")
+}
+
+// ExtractFile reads a single member out of a zip or tar archive, writing it to
+// dest when provided or returning it inline otherwise.
+func ExtractFile(ctx context.Context, in ExtractFileRequest) ExtractFileResponse {
+	start := time.Now()
+	src, err := normalizePath(in.Src)
+	if err != nil {
+		return ExtractFileResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	member, err := cleanMember(in.Member)
+	if err != nil {
+		return ExtractFileResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	r, size, cleanup, err := openMember(src, member)
+	if err != nil {
+		return ExtractFileResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	defer cleanup()
+	resp := ExtractFileResponse{Size: size}
+	if in.Dest != "" {
+		dest, err := normalizePath(in.Dest)
+		if err != nil {
+			return ExtractFileResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return ExtractFileResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		out, err := os.Create(dest)
+		if err != nil {
+			return ExtractFileResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		n, err := io.Copy(quota.NewWriter(out), r)
+		out.Close()
+		if err != nil {
+			os.Remove(dest)
+			quota.Invalidate()
+			return ExtractFileResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		resp.Path = dest
+		resp.Size = n
+	} else {
+		limit := int64(DefaultInlineMax)
+		if in.MaxBytes > 0 {
+			limit = in.MaxBytes
+		}
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, io.LimitReader(r, limit+1)); err != nil {
+			return ExtractFileResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		data := buf.Bytes()
+		if int64(len(data)) > limit {
+			data = data[:limit]
+			resp.Truncated = true
+		}
+		if utf8.Valid(data) {
+			resp.Content = string(data)
+		} else {
+			resp.ContentB64 = base64.StdEncoding.EncodeToString(data)
+		}
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Src        string `json:"src"`
+		Member     string `json:"member"`
+		Dest       string `json:"dest,omitempty"`
+		Size       int64  `json:"size"`
+		DurationMs int64  `json:"duration_ms"`
+	}{time.Now().UTC().Format(time.RFC3339), "archive.extract_file", src, member, resp.Path, resp.Size, resp.DurationMs})
+	return resp
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -60,3 +61,168 @@ func TestTarUntar(t *testing.T) {
 		t.Fatalf("stat a.txt: %v", err)
 	}
 }
+
+func TestExtractFile(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	srcDir := filepath.Join(ws, "src", "sub")
+	if err := os.MkdirAll(srcDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "manifest.json"), []byte(`{"v":1}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	zipPath := filepath.Join(ws, "out.zip")
+	if resp := Zip(ctx, ZipRequest{Src: filepath.Join(ws, "src"), Dest: zipPath}); resp.Error != "" {
+		t.Fatalf("zip resp %+v", resp)
+	}
+	tarPath := filepath.Join(ws, "out.tar")
+	if resp := Tar(ctx, TarRequest{Src: filepath.Join(ws, "src"), Dest: tarPath}); resp.Error != "" {
+		t.Fatalf("tar resp %+v", resp)
+	}
+	for _, src := range []string{zipPath, tarPath} {
+		resp := ExtractFile(ctx, ExtractFileRequest{Src: src, Member: "sub/manifest.json"})
+		if resp.Error != "" || resp.Content != `{"v":1}` {
+			t.Fatalf("extract inline from %s: %+v", src, resp)
+		}
+	}
+	resp := ExtractFile(ctx, ExtractFileRequest{Src: zipPath, Member: "sub/manifest.json", Dest: "out/manifest.json"})
+	if resp.Error != "" || resp.Size != 7 {
+		t.Fatalf("extract to dest: %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "out", "manifest.json")); err != nil {
+		t.Fatalf("stat dest: %v", err)
+	}
+	if resp := ExtractFile(ctx, ExtractFileRequest{Src: zipPath, Member: "../etc/passwd"}); resp.Error == "" {
+		t.Fatalf("expected zip-slip rejection")
+	}
+	if resp := ExtractFile(ctx, ExtractFileRequest{Src: zipPath, Member: "missing.txt"}); resp.Error == "" {
+		t.Fatalf("expected missing member error")
+	}
+}
+
+func TestExtractFileQuota(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	srcDir := filepath.Join(ws, "src")
+	if err := os.MkdirAll(srcDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "big.txt"), []byte(strings.Repeat("a", 64<<10)), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	zipPath := filepath.Join(ws, "out.zip")
+	if resp := Zip(ctx, ZipRequest{Src: srcDir, Dest: zipPath}); resp.Error != "" {
+		t.Fatalf("zip resp %+v", resp)
+	}
+	if err := os.RemoveAll(srcDir); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	t.Setenv("WORKSPACE_QUOTA_BYTES", "8192")
+	resp := ExtractFile(ctx, ExtractFileRequest{Src: zipPath, Member: "big.txt", Dest: "big.txt"})
+	if !strings.Contains(resp.Error, "quota exceeded") {
+		t.Fatalf("expected quota error, got %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "big.txt")); !os.IsNotExist(err) {
+		t.Fatalf("partial extract left behind: %v", err)
+	}
+}
+
+func TestExtractExpectedHashes(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	srcDir := filepath.Join(ws, "src")
+	if err := os.MkdirAll(srcDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	const helloSHA = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	zipPath := filepath.Join(ws, "out.zip")
+	tarPath := filepath.Join(ws, "out.tar")
+	if resp := Zip(ctx, ZipRequest{Src: srcDir, Dest: zipPath}); resp.Error != "" {
+		t.Fatalf("zip resp %+v", resp)
+	}
+	if resp := Tar(ctx, TarRequest{Src: srcDir, Dest: tarPath}); resp.Error != "" {
+		t.Fatalf("tar resp %+v", resp)
+	}
+
+	good := map[string]string{"a.txt": helloSHA}
+	if resp := Unzip(ctx, UnzipRequest{Src: zipPath, Dest: filepath.Join(ws, "z1"), ExpectedHashes: good}); resp.Error != "" || len(resp.Verified) != 1 {
+		t.Fatalf("unzip resp %+v", resp)
+	}
+	if resp := Untar(ctx, UntarRequest{Src: tarPath, Dest: filepath.Join(ws, "t1"), ExpectedHashes: good}); resp.Error != "" || len(resp.Verified) != 1 {
+		t.Fatalf("untar resp %+v", resp)
+	}
+
+	bad := map[string]string{"a.txt": "00"}
+	if resp := Unzip(ctx, UnzipRequest{Src: zipPath, Dest: filepath.Join(ws, "z2"), ExpectedHashes: bad}); resp.Extracted || !strings.Contains(resp.Error, "sha256 mismatch") {
+		t.Fatalf("expected mismatch, got %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "z2", "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("mismatched entry should be removed")
+	}
+	missing := map[string]string{"nope.txt": helloSHA}
+	if resp := Untar(ctx, UntarRequest{Src: tarPath, Dest: filepath.Join(ws, "t2"), ExpectedHashes: missing}); !strings.Contains(resp.Error, "nope.txt") {
+		t.Fatalf("expected missing entry error, got %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "t2")); !os.IsNotExist(err) {
+		t.Fatalf("failed untar should leave no output: %v", err)
+	}
+
+	// a later mismatch undoes the entries already extracted and keeps
+	// existing files as they were
+	if err := os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("world"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if resp := Zip(ctx, ZipRequest{Src: srcDir, Dest: zipPath}); resp.Error != "" {
+		t.Fatalf("zip resp %+v", resp)
+	}
+	z3 := filepath.Join(ws, "z3")
+	if err := os.MkdirAll(z3, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(z3, "a.txt"), []byte("old"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	partial := map[string]string{"a.txt": helloSHA, "b.txt": "00"}
+	if resp := Unzip(ctx, UnzipRequest{Src: zipPath, Dest: z3, ExpectedHashes: partial}); !strings.Contains(resp.Error, "sha256 mismatch for b.txt") {
+		t.Fatalf("expected mismatch, got %+v", resp)
+	}
+	entries, _ := os.ReadDir(z3)
+	got, _ := os.ReadFile(filepath.Join(z3, "a.txt"))
+	if len(entries) != 1 || string(got) != "old" {
+		t.Fatalf("partial extraction left behind: %v %q", entries, got)
+	}
+}
+
+func TestArchiveDryRun(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	srcDir := filepath.Join(ws, "src")
+	if err := os.MkdirAll(filepath.Join(srcDir, "logs"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for name, data := range map[string]string{"a.txt": "hello", "b.md": "hi", "logs/c.txt": "x"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte(data), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	zipPath := filepath.Join(ws, "out.zip")
+	resp := Zip(ctx, ZipRequest{Src: srcDir, Dest: zipPath, Exclude: []string{"*.md"}, DryRun: true})
+	if resp.Error != "" || strings.Join(resp.Paths, ",") != "a.txt,logs/c.txt" || resp.TotalBytes != 6 {
+		t.Fatalf("zip dry run %+v", resp)
+	}
+	if _, err := os.Stat(zipPath); !os.IsNotExist(err) {
+		t.Fatalf("dry run should not create the archive")
+	}
+	tresp := Tar(ctx, TarRequest{Src: srcDir, Dest: filepath.Join(ws, "out.tar"), Exclude: []string{"logs"}, DryRun: true})
+	if tresp.Error != "" || strings.Join(tresp.Paths, ",") != "a.txt,b.md" || tresp.Files != 2 {
+		t.Fatalf("tar dry run %+v", tresp)
+	}
+}
@@ -0,0 +1,111 @@
+// Package auditlog is the shared JSONL sink for the per-tool audit records.
+//
+// The destination is read once from MCP_AUDIT_LOG: unset means the default
+// path, "-" writes to stdout and an empty value disables auditing. When the
+// file grows past MCP_AUDIT_LOG_MAX_BYTES it is renamed to <path>.1 and a new
+// file is started.
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const (
+	DefaultPath           = "/logs/mcp-shell.log"
+	DefaultMaxBytes int64 = 10 << 20 // 10 MiB
+)
+
+var (
+	once     sync.Once
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	stdout   io.Writer = os.Stdout
+)
+
+func load() {
+	path = DefaultPath
+	if v, ok := os.LookupEnv("MCP_AUDIT_LOG"); ok {
+		path = v
+	}
+	maxBytes = DefaultMaxBytes
+	if v := os.Getenv("MCP_AUDIT_LOG_MAX_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+			maxBytes = n
+		}
+	}
+}
+
+// Path returns the configured destination: a file path, "-" for stdout or
+// "" when auditing is disabled.
+func Path() string {
+	once.Do(load)
+	return path
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose audit records carry id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Write appends rec as one JSON line, prefixed with the request_id from ctx
+// when there is one. Failures are ignored by design so that auditing never
+// breaks a tool call.
+func Write(ctx context.Context, rec any) {
+	p := Path()
+	if p == "" {
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	if id := RequestID(ctx); id != "" && len(line) > 2 && line[0] == '{' {
+		idJSON, _ := json.Marshal(id)
+		line = append([]byte(`{"request_id":`+string(idJSON)+`,`), line[1:]...)
+	}
+	line = append(line, '\n')
+	mu.Lock()
+	defer mu.Unlock()
+	if p == "-" {
+		_, _ = stdout.Write(line)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return
+	}
+	rotate(p, int64(len(line)))
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, _ = f.Write(line)
+}
+
+// rotate moves p to p.1 when appending n more bytes would exceed maxBytes.
+// A zero maxBytes disables rotation. Callers hold mu.
+func rotate(p string, n int64) {
+	if maxBytes <= 0 {
+		return
+	}
+	info, err := os.Stat(p)
+	if err != nil || info.Size() == 0 || info.Size()+n <= maxBytes {
+		return
+	}
+	_ = os.Rename(p, p+".1")
+}
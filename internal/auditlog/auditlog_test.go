@@ -0,0 +1,82 @@
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func reload(t *testing.T) {
+	t.Helper()
+	once = sync.Once{}
+	t.Cleanup(func() { once = sync.Once{} })
+}
+
+func TestWriteAndRotate(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "logs", "audit.log")
+	t.Setenv("MCP_AUDIT_LOG", log)
+	t.Setenv("MCP_AUDIT_LOG_MAX_BYTES", "40")
+	reload(t)
+
+	rec := struct {
+		Tool string `json:"tool"`
+	}{"fs.read"}
+	Write(context.Background(), rec)
+	Write(context.Background(), rec)
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if string(data) != "{\"tool\":\"fs.read\"}\n{\"tool\":\"fs.read\"}\n" {
+		t.Fatalf("unexpected log %q", data)
+	}
+	Write(context.Background(), rec)
+	if _, err := os.Stat(log + ".1"); err != nil {
+		t.Fatalf("expected rotated file: %v", err)
+	}
+	data, _ = os.ReadFile(log)
+	if strings.Count(string(data), "\n") != 1 {
+		t.Fatalf("expected fresh log after rotation, got %q", data)
+	}
+}
+
+func TestStdoutAndDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	old := stdout
+	stdout = &buf
+	defer func() { stdout = old }()
+
+	t.Setenv("MCP_AUDIT_LOG", "-")
+	reload(t)
+	Write(context.Background(), map[string]string{"tool": "x"})
+	if buf.String() != "{\"tool\":\"x\"}\n" {
+		t.Fatalf("unexpected stdout %q", buf.String())
+	}
+
+	t.Setenv("MCP_AUDIT_LOG", "")
+	reload(t)
+	Write(context.Background(), map[string]string{"tool": "y"})
+	if Path() != "" || strings.Contains(buf.String(), "y") {
+		t.Fatalf("expected auditing disabled")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	old := stdout
+	stdout = &buf
+	defer func() { stdout = old }()
+	t.Setenv("MCP_AUDIT_LOG", "-")
+	reload(t)
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	Write(ctx, map[string]string{"tool": "x"})
+	Write(ctx, struct{}{})
+	if buf.String() != "{\"request_id\":\"req-1\",\"tool\":\"x\"}\n{}\n" {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
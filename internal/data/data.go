@@ -0,0 +1,317 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+)
+
+func workspaceRoot() string {
+	if ws := os.Getenv("WORKSPACE"); ws != "" {
+		return filepath.Clean(ws)
+	}
+	return "/workspace"
+}
+
+func allowOutside() bool {
+	v := os.Getenv("FS_ALLOW_OUTSIDE_WORKSPACE")
+	return v == "1" || strings.EqualFold(v, "true")
+}
+
+func normalizePath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("path is required")
+	}
+	root := workspaceRoot()
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+	p = filepath.Clean(p)
+	if allowOutside() {
+		return p, nil
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", errors.New("path escapes workspace")
+	}
+	return p, nil
+}
+
+func audit(ctx context.Context, rec any) {
+	auditlog.Write(ctx, rec)
+}
+
+// ---- data.convert
+
+type DataConvertRequest struct {
+	Input string `json:"input,omitempty"`
+	Path  string `json:"path,omitempty"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+type DataConvertResponse struct {
+	Output     string `json:"output,omitempty"`
+	Valid      bool   `json:"valid"`
+	ParseError string `json:"parse_error,omitempty"`
+	Line       int    `json:"line,omitempty"`
+	Column     int    `json:"column,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// parseError is invalid input, as opposed to a failure of the tool itself.
+type parseError struct {
+	msg          string
+	line, column int
+}
+
+func (e *parseError) Error() string { return e.msg }
+
+// lineCol converts a byte offset into a 1-based line and column.
+func lineCol(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// checkJSON validates data as a single JSON value, locating any error.
+func checkJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var v any
+	err := dec.Decode(&v)
+	if err == nil {
+		off := dec.InputOffset()
+		if _, err := dec.Token(); err != io.EOF {
+			line, col := lineCol(data, off)
+			return &parseError{fmt.Sprintf("line %d, column %d: unexpected data after top-level value", line, col), line, col}
+		}
+		return nil
+	}
+	var syn *json.SyntaxError
+	switch {
+	case errors.As(err, &syn):
+		// Offset is just past the offending byte
+		line, col := lineCol(data, max(syn.Offset-1, 0))
+		return &parseError{fmt.Sprintf("line %d, column %d: %v", line, col, err), line, col}
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		line, col := lineCol(data, int64(len(data)))
+		return &parseError{fmt.Sprintf("line %d, column %d: unexpected end of JSON input", line, col), line, col}
+	}
+	return &parseError{msg: err.Error()}
+}
+
+var yamlLine = regexp.MustCompile(`line (\d+)`)
+
+// parseYAML reads every document in a "---" separated stream.
+func parseYAML(data []byte) ([]*yaml.Node, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var docs []*yaml.Node
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			pe := &parseError{msg: err.Error()}
+			if m := yamlLine.FindStringSubmatch(err.Error()); m != nil {
+				pe.line, _ = strconv.Atoi(m[1])
+			}
+			return nil, pe
+		}
+		docs = append(docs, &doc)
+	}
+}
+
+// toJSONValue turns YAML mappings with non-string keys into string-keyed maps
+// so the result can be marshalled as JSON.
+func toJSONValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			t[k] = toJSONValue(e)
+		}
+		return t
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = toJSONValue(e)
+		}
+		return m
+	case []any:
+		for i, e := range t {
+			t[i] = toJSONValue(e)
+		}
+		return t
+	}
+	return v
+}
+
+// jsonNode reads one JSON value from dec as a YAML node. Walking the tokens
+// keeps the key order, and decoding with encoding/json rather than the YAML
+// parser keeps JSON escapes such as \/ and number forms YAML reads
+// differently. The encoder quotes strings that would otherwise change type.
+func jsonNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if t == '{' {
+			n.Kind, n.Tag = yaml.MappingNode, "!!map"
+		}
+		for dec.More() {
+			if n.Kind == yaml.MappingNode {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+			c, err := jsonNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, c)
+		}
+		// closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: t}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(t.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: t.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(t)}, nil
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+}
+
+func convert(data []byte, from, to string) (string, error) {
+	switch from {
+	case "json":
+		if err := checkJSON(data); err != nil || to == "json" {
+			return "", err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		root, err := jsonNode(dec)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}); err != nil {
+			return "", err
+		}
+		return buf.String(), enc.Close()
+	case "yaml":
+		docs, err := parseYAML(data)
+		if err != nil || to == "yaml" {
+			return "", err
+		}
+		vals := make([]any, len(docs))
+		for i, doc := range docs {
+			if err := doc.Decode(&vals[i]); err != nil {
+				return "", &parseError{msg: err.Error(), line: doc.Line}
+			}
+			vals[i] = toJSONValue(vals[i])
+		}
+		// a stream of several documents becomes a JSON array of them
+		var v any = vals
+		switch len(vals) {
+		case 0:
+			v = nil
+		case 1:
+			v = vals[0]
+		}
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out) + "\n", nil
+	}
+	return "", nil
+}
+
+func validFormat(f string) bool { return f == "json" || f == "yaml" }
+
+// Convert translates between JSON and YAML. With From equal to To it only
+// validates the input. Invalid input is reported through Valid and
+// ParseError rather than Error.
+func Convert(ctx context.Context, in DataConvertRequest) DataConvertResponse {
+	start := time.Now()
+	from, to := strings.ToLower(in.From), strings.ToLower(in.To)
+	if from == "yml" {
+		from = "yaml"
+	}
+	if to == "yml" {
+		to = "yaml"
+	}
+	if !validFormat(from) || !validFormat(to) {
+		return DataConvertResponse{DurationMs: time.Since(start).Milliseconds(), Error: "from and to must be json or yaml"}
+	}
+	if in.Path != "" && in.Input != "" {
+		return DataConvertResponse{DurationMs: time.Since(start).Milliseconds(), Error: "set either input or path, not both"}
+	}
+	data := []byte(in.Input)
+	var path string
+	if in.Path != "" {
+		var err error
+		if path, err = normalizePath(in.Path); err != nil {
+			return DataConvertResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		if data, err = os.ReadFile(path); err != nil {
+			return DataConvertResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+	}
+	var resp DataConvertResponse
+	out, err := convert(data, from, to)
+	var pe *parseError
+	switch {
+	case errors.As(err, &pe):
+		resp = DataConvertResponse{ParseError: pe.msg, Line: pe.line, Column: pe.column}
+	case err != nil:
+		return DataConvertResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	default:
+		resp = DataConvertResponse{Output: out, Valid: true}
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path,omitempty"`
+		From       string `json:"from"`
+		To         string `json:"to"`
+		DurationMs int64  `json:"duration_ms"`
+		Valid      bool   `json:"valid"`
+	}{time.Now().UTC().Format(time.RFC3339), "data.convert", path, from, to, resp.DurationMs, resp.Valid})
+	return resp
+}
@@ -0,0 +1,63 @@
+package data
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+
+	resp := Convert(ctx, DataConvertRequest{Input: `{"name":"svc","ports":[80,443],"tls":{"enabled":true}}`, From: "json", To: "yaml"})
+	want := "name: svc\nports:\n  - 80\n  - 443\ntls:\n  enabled: true\n"
+	if resp.Error != "" || !resp.Valid || resp.Output != want {
+		t.Fatalf("json->yaml %+v", resp)
+	}
+
+	// decoded as JSON, not YAML: the \/ escape, key order, and strings that
+	// look like other types
+	resp = Convert(ctx, DataConvertRequest{Input: `{"z":"a\/b","a\/b":"true","n":1.50,"e":1e3,"x":null,"s":"","l":[]}`, From: "json", To: "yaml"})
+	want = "z: a/b\na/b: \"true\"\nn: 1.50\ne: 1e3\nx: null\ns: \"\"\nl: []\n"
+	if resp.Error != "" || !resp.Valid || resp.Output != want {
+		t.Fatalf("json->yaml escapes %q %+v", resp.Output, resp)
+	}
+
+	os.WriteFile(filepath.Join(ws, "c.yml"), []byte("a: 1\nb:\n  - x\n  - 2.5\n3: three\n"), 0o644)
+	resp = Convert(ctx, DataConvertRequest{Path: "c.yml", From: "yml", To: "json"})
+	want = "{\n  \"3\": \"three\",\n  \"a\": 1,\n  \"b\": [\n    \"x\",\n    2.5\n  ]\n}\n"
+	if resp.Error != "" || !resp.Valid || resp.Output != want {
+		t.Fatalf("yaml->json %+v", resp)
+	}
+
+	resp = Convert(ctx, DataConvertRequest{Input: "a: 1\n---\n- x\n---\nb: 2\n", From: "yaml", To: "json"})
+	want = "[\n  {\n    \"a\": 1\n  },\n  [\n    \"x\"\n  ],\n  {\n    \"b\": 2\n  }\n]\n"
+	if resp.Error != "" || !resp.Valid || resp.Output != want {
+		t.Fatalf("multi-document yaml->json %q %+v", resp.Output, resp)
+	}
+	if resp = Convert(ctx, DataConvertRequest{Input: "a: 1\n---\nb: [\n", From: "yaml", To: "yaml"}); resp.Valid {
+		t.Fatalf("expected error in second document to be reported %+v", resp)
+	}
+
+	resp = Convert(ctx, DataConvertRequest{Input: "{\n  \"a\": 1,\n  \"b\": }\n", From: "json", To: "json"})
+	if resp.Valid || resp.Line != 3 || resp.Column != 8 || resp.Output != "" || resp.Error != "" {
+		t.Fatalf("invalid json %+v", resp)
+	}
+	if resp = Convert(ctx, DataConvertRequest{Input: `{} x`, From: "json", To: "json"}); resp.Valid {
+		t.Fatalf("expected trailing data to be invalid")
+	}
+	resp = Convert(ctx, DataConvertRequest{Input: "a: 1\n b: 2\n", From: "yaml", To: "yaml"})
+	if resp.Valid || resp.Line != 2 || !strings.Contains(resp.ParseError, "line 2") {
+		t.Fatalf("invalid yaml %+v", resp)
+	}
+	if resp = Convert(ctx, DataConvertRequest{Input: "a: 1", From: "yaml", To: "yaml"}); !resp.Valid || resp.Output != "" {
+		t.Fatalf("validate-only %+v", resp)
+	}
+	if resp = Convert(ctx, DataConvertRequest{Input: "x", From: "toml", To: "json"}); resp.Error == "" {
+		t.Fatalf("expected unsupported format error")
+	}
+}
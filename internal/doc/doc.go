@@ -1,23 +1,31 @@
 package doc
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/execx"
 )
 
 const (
-	LogPath         = "/logs/mcp-shell.log"
 	defaultMaxBytes = 1 << 20 // 1 MiB
+	// DefaultTimeout bounds a single conversion when timeout_ms is not set.
+	DefaultTimeout = 5 * time.Minute
 )
 
 func workspaceRoot() string {
@@ -51,19 +59,8 @@ func normalizePath(p string) (string, error) {
 	return p, nil
 }
 
-func audit(rec any) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-	_ = json.NewEncoder(f).Encode(rec)
+func audit(ctx context.Context, rec any) {
+	auditlog.Write(ctx, rec)
 }
 
 // ---- doc.convert ----
@@ -72,11 +69,13 @@ type ConvertRequest struct {
 	SrcPath    string            `json:"src_path"`
 	DestFormat string            `json:"dest_format"`
 	Options    map[string]string `json:"options,omitempty"`
+	TimeoutMs  int               `json:"timeout_ms,omitempty"`
 }
 
 type ConvertResponse struct {
 	DestPath   string `json:"dest_path"`
 	Size       int64  `json:"size"`
+	ExitCode   int    `json:"exit_code,omitempty"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
 }
@@ -94,6 +93,8 @@ func Convert(ctx context.Context, in ConvertRequest) ConvertResponse {
 	dir := filepath.Dir(src)
 	base := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
 	dest := filepath.Join(dir, base+"."+destFormat)
+	ctx, cancel := execx.WithTimeout(ctx, in.TimeoutMs, DefaultTimeout)
+	defer cancel()
 
 	var cmd *exec.Cmd
 	switch destFormat {
@@ -106,8 +107,8 @@ func Convert(ctx context.Context, in ConvertRequest) ConvertResponse {
 	var stderr bytes.Buffer
 	cmd.Stdout = io.Discard
 	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return ConvertResponse{DurationMs: time.Since(start).Milliseconds(), Error: stderr.String()}
+	if exit, err := execx.Run(ctx, cmd); err != nil {
+		return ConvertResponse{ExitCode: exit, DurationMs: time.Since(start).Milliseconds(), Error: execx.ErrorText(err, &stderr)}
 	}
 	info, err := os.Stat(dest)
 	if err != nil {
@@ -115,7 +116,7 @@ func Convert(ctx context.Context, in ConvertRequest) ConvertResponse {
 	}
 	resp := ConvertResponse{DestPath: dest, Size: info.Size()}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Src        string `json:"src"`
@@ -129,14 +130,18 @@ func Convert(ctx context.Context, in ConvertRequest) ConvertResponse {
 // ---- pdf.extract_text ----
 
 type PDFExtractRequest struct {
-	Path     string `json:"path"`
-	Layout   string `json:"layout,omitempty"`
-	MaxBytes int64  `json:"max_bytes,omitempty"`
+	Path      string `json:"path"`
+	Layout    string `json:"layout,omitempty"`
+	FirstPage int    `json:"first_page,omitempty"`
+	LastPage  int    `json:"last_page,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
 }
 
 type PDFExtractResponse struct {
 	Text       string `json:"text"`
 	Truncated  bool   `json:"truncated"`
+	ExitCode   int    `json:"exit_code,omitempty"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
 }
@@ -147,31 +152,48 @@ func ExtractText(ctx context.Context, in PDFExtractRequest) PDFExtractResponse {
 	if err != nil {
 		return PDFExtractResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
+	if in.FirstPage < 0 || in.LastPage < 0 {
+		return PDFExtractResponse{DurationMs: time.Since(start).Milliseconds(), Error: "page numbers must be positive"}
+	}
+	if in.FirstPage > 0 && in.LastPage > 0 && in.FirstPage > in.LastPage {
+		return PDFExtractResponse{DurationMs: time.Since(start).Milliseconds(), Error: "first_page must not exceed last_page"}
+	}
 	limit := defaultMaxBytes
 	if in.MaxBytes > 0 {
 		limit = int(in.MaxBytes)
 	}
+	var pages []string
+	if in.FirstPage > 0 {
+		pages = append(pages, "-f", strconv.Itoa(in.FirstPage))
+	}
+	if in.LastPage > 0 {
+		pages = append(pages, "-l", strconv.Itoa(in.LastPage))
+	}
 	layout := strings.ToLower(in.Layout)
+	ctx, cancel := execx.WithTimeout(ctx, in.TimeoutMs, DefaultTimeout)
+	defer cancel()
 	var cmd *exec.Cmd
 	switch layout {
 	case "layout":
-		cmd = exec.CommandContext(ctx, "pdftotext", "-layout", path, "-")
+		args := append([]string{"-layout"}, pages...)
+		cmd = exec.CommandContext(ctx, "pdftotext", append(args, path, "-")...)
 	case "html":
-		cmd = exec.CommandContext(ctx, "pdftohtml", "-i", "-stdout", "-noframes", path, "-")
+		args := append([]string{"-i", "-stdout", "-noframes"}, pages...)
+		cmd = exec.CommandContext(ctx, "pdftohtml", append(args, path, "-")...)
 	default:
-		cmd = exec.CommandContext(ctx, "pdftotext", path, "-")
+		cmd = exec.CommandContext(ctx, "pdftotext", append(pages, path, "-")...)
 	}
 	var stdout bytes.Buffer
 	lw := &limitedWriter{buf: &stdout, limit: limit}
 	var stderr bytes.Buffer
 	cmd.Stdout = lw
 	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return PDFExtractResponse{DurationMs: time.Since(start).Milliseconds(), Error: stderr.String()}
+	if exit, err := execx.Run(ctx, cmd); err != nil {
+		return PDFExtractResponse{ExitCode: exit, DurationMs: time.Since(start).Milliseconds(), Error: execx.ErrorText(err, &stderr)}
 	}
 	resp := PDFExtractResponse{Text: stdout.String(), Truncated: lw.truncated}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Path       string `json:"path"`
@@ -181,44 +203,371 @@ func ExtractText(ctx context.Context, in PDFExtractRequest) PDFExtractResponse {
 	return resp
 }
 
-// ---- spreadsheet.to_csv ----
+// ---- pdf.split ----
 
-type ToCSVRequest struct {
-	Path     string          `json:"path"`
-	Sheet    json.RawMessage `json:"sheet,omitempty"`
-	MaxBytes int64           `json:"max_bytes,omitempty"`
+type SplitRequest struct {
+	Path    string   `json:"path"`
+	Ranges  []string `json:"ranges,omitempty"`
+	DestDir string   `json:"dest_dir,omitempty"`
 }
 
-type ToCSVResponse struct {
-	Csv        string `json:"csv"`
-	Truncated  bool   `json:"truncated"`
+type PDFFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+type SplitResponse struct {
+	Files      []PDFFile `json:"files"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type pageRange struct{ first, last int }
+
+// parsePageRanges accepts entries like "3" or "2-5" (1-based, inclusive).
+func parsePageRanges(ranges []string) ([]pageRange, error) {
+	out := make([]pageRange, 0, len(ranges))
+	for _, r := range ranges {
+		a, b, found := strings.Cut(strings.TrimSpace(r), "-")
+		first, err := strconv.Atoi(strings.TrimSpace(a))
+		if err != nil || first < 1 {
+			return nil, fmt.Errorf("invalid page range %q", r)
+		}
+		last := first
+		if found {
+			last, err = strconv.Atoi(strings.TrimSpace(b))
+			if err != nil || last < first {
+				return nil, fmt.Errorf("invalid page range %q", r)
+			}
+		}
+		out = append(out, pageRange{first, last})
+	}
+	return out, nil
+}
+
+func runPoppler(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// Split writes one PDF per requested page range into DestDir (defaults to
+// the source directory). Without ranges every page becomes its own file.
+func Split(ctx context.Context, in SplitRequest) SplitResponse {
+	start := time.Now()
+	src, err := normalizePath(in.Path)
+	if err != nil {
+		return SplitResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	ranges, err := parsePageRanges(in.Ranges)
+	if err != nil {
+		return SplitResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	destDir := filepath.Dir(src)
+	if in.DestDir != "" {
+		if destDir, err = normalizePath(in.DestDir); err != nil {
+			return SplitResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+	}
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return SplitResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	tmp, err := os.MkdirTemp(destDir, ".pdf-split-")
+	if err != nil {
+		return SplitResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	defer os.RemoveAll(tmp)
+	if err := runPoppler(ctx, "pdfseparate", src, filepath.Join(tmp, "page-%d.pdf")); err != nil {
+		return SplitResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	pagePath := func(n int) string { return filepath.Join(tmp, fmt.Sprintf("page-%d.pdf", n)) }
+	if len(ranges) == 0 {
+		for n := 1; ; n++ {
+			if _, err := os.Stat(pagePath(n)); err != nil {
+				break
+			}
+			ranges = append(ranges, pageRange{n, n})
+		}
+	}
+	base := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	resp := SplitResponse{Files: []PDFFile{}}
+	for _, r := range ranges {
+		pages := make([]string, 0, r.last-r.first+1)
+		for n := r.first; n <= r.last; n++ {
+			if _, err := os.Stat(pagePath(n)); err != nil {
+				return SplitResponse{Files: resp.Files, DurationMs: time.Since(start).Milliseconds(), Error: fmt.Sprintf("page %d out of range", n)}
+			}
+			pages = append(pages, pagePath(n))
+		}
+		name := fmt.Sprintf("%s-%d.pdf", base, r.first)
+		if r.last != r.first {
+			name = fmt.Sprintf("%s-%d-%d.pdf", base, r.first, r.last)
+		}
+		dest := filepath.Join(destDir, name)
+		if len(pages) == 1 {
+			err = os.Rename(pages[0], dest)
+		} else {
+			err = runPoppler(ctx, "pdfunite", append(pages, dest)...)
+		}
+		if err != nil {
+			return SplitResponse{Files: resp.Files, DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		info, err := os.Stat(dest)
+		if err != nil {
+			return SplitResponse{Files: resp.Files, DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		resp.Files = append(resp.Files, PDFFile{Path: dest, Size: info.Size()})
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string   `json:"ts"`
+		Tool       string   `json:"tool"`
+		Path       string   `json:"path"`
+		Ranges     []string `json:"ranges,omitempty"`
+		DurationMs int64    `json:"duration_ms"`
+		Files      int      `json:"files"`
+	}{time.Now().UTC().Format(time.RFC3339), "pdf.split", src, in.Ranges, resp.DurationMs, len(resp.Files)})
+	return resp
+}
+
+// ---- pdf.merge ----
+
+type MergeRequest struct {
+	Srcs []string `json:"srcs"`
+	Dest string   `json:"dest"`
+}
+
+type MergeResponse struct {
+	DestPath   string `json:"dest_path"`
+	Size       int64  `json:"size"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
 }
 
-func SpreadsheetToCSV(ctx context.Context, in ToCSVRequest) ToCSVResponse {
+func Merge(ctx context.Context, in MergeRequest) MergeResponse {
 	start := time.Now()
-	path, err := normalizePath(in.Path)
+	if len(in.Srcs) < 2 {
+		return MergeResponse{DurationMs: time.Since(start).Milliseconds(), Error: "at least two srcs are required"}
+	}
+	args := make([]string, 0, len(in.Srcs)+1)
+	for _, s := range in.Srcs {
+		p, err := normalizePath(s)
+		if err != nil {
+			return MergeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		args = append(args, p)
+	}
+	dest, err := normalizePath(in.Dest)
 	if err != nil {
-		return ToCSVResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return MergeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
-	limit := defaultMaxBytes
-	if in.MaxBytes > 0 {
-		limit = int(in.MaxBytes)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return MergeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	if err := runPoppler(ctx, "pdfunite", append(args, dest)...); err != nil {
+		return MergeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		return MergeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	resp := MergeResponse{DestPath: dest, Size: info.Size()}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string   `json:"ts"`
+		Tool       string   `json:"tool"`
+		Srcs       []string `json:"srcs"`
+		Dest       string   `json:"dest"`
+		DurationMs int64    `json:"duration_ms"`
+		Size       int64    `json:"size"`
+	}{time.Now().UTC().Format(time.RFC3339), "pdf.merge", args, dest, resp.DurationMs, resp.Size})
+	return resp
+}
+
+// ---- pdf.to_images ----
+
+type ToImagesRequest struct {
+	Path      string `json:"path"`
+	DestDir   string `json:"dest_dir,omitempty"`
+	Format    string `json:"format,omitempty"`
+	DPI       int    `json:"dpi,omitempty"`
+	FirstPage int    `json:"first_page,omitempty"`
+	LastPage  int    `json:"last_page,omitempty"`
+}
+
+type ToImagesResponse struct {
+	Images     []string `json:"images"`
+	DurationMs int64    `json:"duration_ms"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// ToImages rasterizes PDF pages with pdftoppm. Images are named
+// <base>-<page>.<ext> in DestDir (defaults to the source directory).
+func ToImages(ctx context.Context, in ToImagesRequest) ToImagesResponse {
+	start := time.Now()
+	src, err := normalizePath(in.Path)
+	if err != nil {
+		return ToImagesResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	var flag, ext string
+	switch strings.ToLower(in.Format) {
+	case "", "png":
+		flag, ext = "-png", ".png"
+	case "jpeg", "jpg":
+		flag, ext = "-jpeg", ".jpg"
+	default:
+		return ToImagesResponse{DurationMs: time.Since(start).Milliseconds(), Error: "format must be png or jpeg"}
+	}
+	if in.DPI < 0 || in.FirstPage < 0 || in.LastPage < 0 {
+		return ToImagesResponse{DurationMs: time.Since(start).Milliseconds(), Error: "dpi and page numbers must be positive"}
 	}
+	if in.FirstPage > 0 && in.LastPage > 0 && in.FirstPage > in.LastPage {
+		return ToImagesResponse{DurationMs: time.Since(start).Milliseconds(), Error: "first_page must not exceed last_page"}
+	}
+	destDir := filepath.Dir(src)
+	if in.DestDir != "" {
+		if destDir, err = normalizePath(in.DestDir); err != nil {
+			return ToImagesResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+	}
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return ToImagesResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	// render into a scratch dir so only this run's pages are reported
+	tmp, err := os.MkdirTemp(destDir, ".pdf-images-")
+	if err != nil {
+		return ToImagesResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	defer os.RemoveAll(tmp)
+	args := []string{flag}
+	if in.DPI > 0 {
+		args = append(args, "-r", strconv.Itoa(in.DPI))
+	}
+	if in.FirstPage > 0 {
+		args = append(args, "-f", strconv.Itoa(in.FirstPage))
+	}
+	if in.LastPage > 0 {
+		args = append(args, "-l", strconv.Itoa(in.LastPage))
+	}
+	base := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	args = append(args, src, filepath.Join(tmp, base))
+	if err := runPoppler(ctx, "pdftoppm", args...); err != nil {
+		return ToImagesResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		return ToImagesResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	resp := ToImagesResponse{Images: []string{}}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ext {
+			continue
+		}
+		dest := filepath.Join(destDir, e.Name())
+		if err := os.Rename(filepath.Join(tmp, e.Name()), dest); err != nil {
+			return ToImagesResponse{Images: resp.Images, DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		resp.Images = append(resp.Images, dest)
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path"`
+		DurationMs int64  `json:"duration_ms"`
+		Pages      int    `json:"pages"`
+	}{time.Now().UTC().Format(time.RFC3339), "pdf.to_images", src, resp.DurationMs, len(resp.Images)})
+	return resp
+}
+
+// ---- spreadsheet.to_csv ----
+
+type ToCSVRequest struct {
+	Path      string          `json:"path"`
+	Sheet     json.RawMessage `json:"sheet,omitempty"`
+	AllSheets bool            `json:"all_sheets,omitempty"`
+	MaxBytes  int64           `json:"max_bytes,omitempty"`
+	TimeoutMs int             `json:"timeout_ms,omitempty"`
+}
+
+type ToCSVResponse struct {
+	Csv        string            `json:"csv"`
+	Sheets     map[string]string `json:"sheets,omitempty"`
+	Truncated  bool              `json:"truncated"`
+	ExitCode   int               `json:"exit_code,omitempty"`
+	DurationMs int64             `json:"duration_ms"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// allSheetsFilter is LibreOffice's CSV filter with the sheet token set to -1,
+// which writes one <base>-<sheet>.csv per sheet (LibreOffice 7.2+).
+const allSheetsFilter = "csv:Text - txt - csv (StarCalc):44,34,UTF8,1,,0,false,true,false,false,false,-1"
+
+func allSheetsToCSV(ctx context.Context, path string, limit int) (map[string]string, bool, error) {
+	tmp, err := os.MkdirTemp("", "mcp-sheets-")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.RemoveAll(tmp)
+	cmd := exec.CommandContext(ctx, "libreoffice", "--headless", "--convert-to", allSheetsFilter, "--outdir", tmp, path)
+	var stderr bytes.Buffer
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+	if _, err := execx.Run(ctx, cmd); err != nil {
+		return nil, false, errors.New(execx.ErrorText(err, &stderr))
+	}
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		return nil, false, err
+	}
+	prefix := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "-"
+	sheets := map[string]string{}
+	truncated := false
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || filepath.Ext(name) != ".csv" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(tmp, name))
+		if err != nil {
+			return nil, false, err
+		}
+		if len(data) > limit {
+			data = data[:limit]
+			truncated = true
+		}
+		sheets[strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".csv")] = string(data)
+	}
+	if len(sheets) == 0 {
+		return nil, false, errors.New("no sheets produced")
+	}
+	return sheets, truncated, nil
+}
+
+// sheetToCSV converts one sheet with LibreOffice, writing <base>.csv next
+// to the workbook, and returns its contents.
+func sheetToCSV(ctx context.Context, path string, sheet json.RawMessage) ([]byte, error) {
 	dir := filepath.Dir(path)
 	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
 	dest := filepath.Join(dir, base+".csv")
 	args := []string{"--headless", "--convert-to", "csv", "--outdir", dir}
-	if len(in.Sheet) > 0 {
+	if len(sheet) > 0 {
 		var name string
-		if err := json.Unmarshal(in.Sheet, &name); err == nil {
+		if err := json.Unmarshal(sheet, &name); err == nil {
 			if name != "" {
 				args = append(args, "--calc-sheets", name)
 			}
 		} else {
 			var idx int
-			if err := json.Unmarshal(in.Sheet, &idx); err == nil && idx > 0 {
+			if err := json.Unmarshal(sheet, &idx); err == nil && idx > 0 {
 				args = append(args, "--calc-sheets", strconv.Itoa(idx))
 			}
 		}
@@ -228,13 +577,57 @@ func SpreadsheetToCSV(ctx context.Context, in ToCSVRequest) ToCSVResponse {
 	var stderr bytes.Buffer
 	cmd.Stdout = io.Discard
 	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return ToCSVResponse{DurationMs: time.Since(start).Milliseconds(), Error: stderr.String()}
+	if _, err := execx.Run(ctx, cmd); err != nil {
+		return nil, errors.New(execx.ErrorText(err, &stderr))
+	}
+	return os.ReadFile(dest)
+}
+
+// csvExit reports 124 when a spreadsheet conversion failed on its deadline.
+func csvExit(ctx context.Context) int {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return 124
 	}
-	data, err := os.ReadFile(dest)
+	return 0
+}
+
+func SpreadsheetToCSV(ctx context.Context, in ToCSVRequest) ToCSVResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
 	if err != nil {
 		return ToCSVResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
+	limit := defaultMaxBytes
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	ctx, cancel := execx.WithTimeout(ctx, in.TimeoutMs, DefaultTimeout)
+	defer cancel()
+	if in.AllSheets {
+		sheets, truncated, err := allSheetsToCSV(ctx, path, limit)
+		if err != nil {
+			return ToCSVResponse{ExitCode: csvExit(ctx), DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		resp := ToCSVResponse{Sheets: sheets, Truncated: truncated}
+		resp.DurationMs = time.Since(start).Milliseconds()
+		bytesOut := 0
+		for _, csv := range sheets {
+			bytesOut += len(csv)
+		}
+		audit(ctx, struct {
+			TS         string `json:"ts"`
+			Tool       string `json:"tool"`
+			Path       string `json:"path"`
+			DurationMs int64  `json:"duration_ms"`
+			BytesOut   int    `json:"bytes_out"`
+			Sheets     int    `json:"sheets"`
+		}{time.Now().UTC().Format(time.RFC3339), "spreadsheet.to_csv", path, resp.DurationMs, bytesOut, len(sheets)})
+		return resp
+	}
+	data, err := sheetToCSV(ctx, path, in.Sheet)
+	if err != nil {
+		return ToCSVResponse{ExitCode: csvExit(ctx), DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
 	truncated := false
 	if len(data) > limit {
 		data = data[:limit]
@@ -242,7 +635,7 @@ func SpreadsheetToCSV(ctx context.Context, in ToCSVRequest) ToCSVResponse {
 	}
 	resp := ToCSVResponse{Csv: string(data), Truncated: truncated}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string          `json:"ts"`
 		Tool       string          `json:"tool"`
 		Path       string          `json:"path"`
@@ -253,6 +646,105 @@ func SpreadsheetToCSV(ctx context.Context, in ToCSVRequest) ToCSVResponse {
 	return resp
 }
 
+// ---- spreadsheet.to_json ----
+
+type ToJSONRequest struct {
+	Path  string          `json:"path"`
+	Sheet json.RawMessage `json:"sheet,omitempty"`
+}
+
+type ToJSONResponse struct {
+	Rows       []map[string]any `json:"rows"`
+	RowCount   int              `json:"row_count"`
+	DurationMs int64            `json:"duration_ms"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// csvToRows turns CSV records into objects keyed by the header row. Blank
+// headers become column_<n>; numeric and boolean cells are typed.
+func csvToRows(data []byte) ([]map[string]any, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	rows := []map[string]any{}
+	if len(records) == 0 {
+		return rows, nil
+	}
+	header := records[0]
+	for i, h := range header {
+		if h = strings.TrimSpace(h); h == "" {
+			h = fmt.Sprintf("column_%d", i+1)
+		}
+		header[i] = h
+	}
+	for _, rec := range records[1:] {
+		row := make(map[string]any, len(header))
+		for i, h := range header {
+			if i < len(rec) {
+				row[h] = csvValue(rec[i])
+			} else {
+				row[h] = nil
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func csvValue(v string) any {
+	if v == "" {
+		return nil
+	}
+	// keep identifiers such as zip codes intact
+	if len(v) > 1 && v[0] == '0' && v[1] != '.' {
+		return v
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n
+	}
+	// NaN and Inf cannot be encoded as JSON numbers, so they stay text
+	if f, err := strconv.ParseFloat(v, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return f
+	}
+	switch strings.ToUpper(v) {
+	case "TRUE":
+		return true
+	case "FALSE":
+		return false
+	}
+	return v
+}
+
+func SpreadsheetToJSON(ctx context.Context, in ToJSONRequest) ToJSONResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return ToJSONResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	data, err := sheetToCSV(ctx, path, in.Sheet)
+	if err != nil {
+		return ToJSONResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	rows, err := csvToRows(data)
+	if err != nil {
+		return ToJSONResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	resp := ToJSONResponse{Rows: rows, RowCount: len(rows)}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string          `json:"ts"`
+		Tool       string          `json:"tool"`
+		Path       string          `json:"path"`
+		DurationMs int64           `json:"duration_ms"`
+		Rows       int             `json:"rows"`
+		Sheet      json.RawMessage `json:"sheet,omitempty"`
+	}{time.Now().UTC().Format(time.RFC3339), "spreadsheet.to_json", path, resp.DurationMs, resp.RowCount, in.Sheet})
+	return resp
+}
+
 // ---- doc.metadata ----
 
 type MetadataRequest struct {
@@ -261,6 +753,8 @@ type MetadataRequest struct {
 
 type MetadataResponse struct {
 	Mime       string `json:"mime"`
+	Title      string `json:"title,omitempty"`
+	Creator    string `json:"creator,omitempty"`
 	Pages      int    `json:"pages,omitempty"`
 	Words      int    `json:"words,omitempty"`
 	Created    string `json:"created,omitempty"`
@@ -304,9 +798,11 @@ func Metadata(ctx context.Context, in MetadataRequest) MetadataResponse {
 		txtCmd.Stdout = &txtBuf
 		_ = txtCmd.Run()
 		resp.Words = len(strings.Fields(txtBuf.String()))
+	} else if isOOXML(mime, path) {
+		ooxmlMetadata(path, &resp)
 	}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Path       string `json:"path"`
@@ -316,6 +812,75 @@ func Metadata(ctx context.Context, in MetadataRequest) MetadataResponse {
 	return resp
 }
 
+// isOOXML reports whether the file is a docx/xlsx/pptx package. file(1)
+// sometimes reports these as plain zip, so the extension is checked too.
+func isOOXML(mime, path string) bool {
+	if strings.Contains(mime, "openxmlformats") {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".docx", ".xlsx", ".pptx":
+		return mime == "application/zip" || mime == "application/octet-stream"
+	}
+	return false
+}
+
+type ooxmlCore struct {
+	Title    string `xml:"title"`
+	Creator  string `xml:"creator"`
+	Created  string `xml:"created"`
+	Modified string `xml:"modified"`
+}
+
+type ooxmlApp struct {
+	Pages  int `xml:"Pages"`
+	Words  int `xml:"Words"`
+	Slides int `xml:"Slides"`
+}
+
+// ooxmlMetadata fills resp from docProps/core.xml and docProps/app.xml.
+// Missing or malformed parts are skipped.
+func ooxmlMetadata(path string, resp *MetadataResponse) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		var target any
+		switch f.Name {
+		case "docProps/core.xml":
+			target = &ooxmlCore{}
+		case "docProps/app.xml":
+			target = &ooxmlApp{}
+		default:
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		err = xml.NewDecoder(io.LimitReader(rc, defaultMaxBytes)).Decode(target)
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		switch v := target.(type) {
+		case *ooxmlCore:
+			resp.Title = strings.TrimSpace(v.Title)
+			resp.Creator = strings.TrimSpace(v.Creator)
+			resp.Created = strings.TrimSpace(v.Created)
+			resp.Modified = strings.TrimSpace(v.Modified)
+		case *ooxmlApp:
+			resp.Words = v.Words
+			resp.Pages = v.Pages
+			if resp.Pages == 0 {
+				resp.Pages = v.Slides
+			}
+		}
+	}
+}
+
 type limitedWriter struct {
 	buf       *bytes.Buffer
 	limit     int
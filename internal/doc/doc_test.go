@@ -1,6 +1,7 @@
 package doc
 
 import (
+	"archive/zip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -86,4 +87,150 @@ func TestSpreadsheetToCSV(t *testing.T) {
 	if !strings.Contains(respIdx.Csv, "A,B") {
 		t.Fatalf("expected first sheet, got %q", respIdx.Csv)
 	}
+	// every sheet at once
+	respAll := SpreadsheetToCSV(ctx, ToCSVRequest{Path: xlsx, AllSheets: true})
+	if respAll.Error != "" {
+		t.Fatalf("to_csv all: %v", respAll.Error)
+	}
+	if !strings.Contains(respAll.Sheets["Sheet1"], "A,B") || !strings.Contains(respAll.Sheets["Data"], "C,D") {
+		t.Fatalf("unexpected sheets %v", respAll.Sheets)
+	}
+}
+
+func TestExtractTextPageRange(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	resp := ExtractText(context.Background(), PDFExtractRequest{Path: "a.pdf", FirstPage: 3, LastPage: 2})
+	if !strings.Contains(resp.Error, "first_page") {
+		t.Fatalf("expected range error, got %+v", resp)
+	}
+	if _, err := exec.LookPath("pdftotext"); err != nil {
+		t.Skip("pdftotext not available", err)
+	}
+	if _, err := exec.LookPath("pandoc"); err != nil {
+		t.Skip("pandoc not available", err)
+	}
+	pdf := filepath.Join(root, "pages.pdf")
+	cmd := exec.Command("pandoc", "-o", pdf)
+	cmd.Stdin = strings.NewReader("First page\n\n\\newpage\n\nSecond page\n")
+	if err := cmd.Run(); err != nil {
+		t.Skip("pandoc pdf engine unavailable", err)
+	}
+	ext := ExtractText(context.Background(), PDFExtractRequest{Path: pdf, FirstPage: 2, LastPage: 2})
+	if ext.Error != "" {
+		t.Fatalf("extract: %v", ext.Error)
+	}
+	if strings.Contains(ext.Text, "First page") || !strings.Contains(ext.Text, "Second page") {
+		t.Fatalf("unexpected text %q", ext.Text)
+	}
+}
+
+func TestSplitMergeValidation(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	ranges, err := parsePageRanges([]string{"1-3", " 5 "})
+	if err != nil || len(ranges) != 2 || ranges[0] != (pageRange{1, 3}) || ranges[1] != (pageRange{5, 5}) {
+		t.Fatalf("unexpected ranges %v %v", ranges, err)
+	}
+	for _, bad := range []string{"0", "4-2", "a-b", ""} {
+		if _, err := parsePageRanges([]string{bad}); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+	if resp := Split(context.Background(), SplitRequest{Path: "a.pdf", Ranges: []string{"3-1"}}); !strings.Contains(resp.Error, "invalid page range") {
+		t.Fatalf("expected range error, got %+v", resp)
+	}
+	if resp := Merge(context.Background(), MergeRequest{Srcs: []string{"a.pdf"}, Dest: "out.pdf"}); resp.Error == "" {
+		t.Fatalf("expected error for single src")
+	}
+	if resp := Merge(context.Background(), MergeRequest{Srcs: []string{"a.pdf", "/etc/passwd"}, Dest: "out.pdf"}); !strings.Contains(resp.Error, "escapes workspace") {
+		t.Fatalf("expected workspace error, got %+v", resp)
+	}
+}
+
+func TestToImagesValidation(t *testing.T) {
+	t.Setenv("WORKSPACE", t.TempDir())
+	if resp := ToImages(context.Background(), ToImagesRequest{Path: "a.pdf", Format: "gif"}); !strings.Contains(resp.Error, "format") {
+		t.Fatalf("expected format error, got %+v", resp)
+	}
+	if resp := ToImages(context.Background(), ToImagesRequest{Path: "a.pdf", FirstPage: 4, LastPage: 1}); !strings.Contains(resp.Error, "first_page") {
+		t.Fatalf("expected range error, got %+v", resp)
+	}
+	if resp := ToImages(context.Background(), ToImagesRequest{Path: "a.pdf", DestDir: "/etc"}); !strings.Contains(resp.Error, "escapes workspace") {
+		t.Fatalf("expected workspace error, got %+v", resp)
+	}
+}
+
+func TestOOXMLMetadata(t *testing.T) {
+	dir := t.TempDir()
+	docx := filepath.Join(dir, "report.docx")
+	f, err := os.Create(docx)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	zw := zip.NewWriter(f)
+	parts := map[string]string{
+		"docProps/core.xml": `<?xml version="1.0"?><cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/"><dc:title>Quarterly</dc:title><dc:creator>Ana</dc:creator><dcterms:created>2024-01-02T03:04:05Z</dcterms:created><dcterms:modified>2024-02-03T04:05:06Z</dcterms:modified></cp:coreProperties>`,
+		"docProps/app.xml":  `<?xml version="1.0"?><Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties"><Pages>3</Pages><Words>420</Words></Properties>`,
+	}
+	for name, body := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip: %v", err)
+		}
+		w.Write([]byte(body))
+	}
+	zw.Close()
+	f.Close()
+	if !isOOXML("application/zip", docx) || isOOXML("application/zip", "a.zip") {
+		t.Fatalf("unexpected ooxml detection")
+	}
+	var resp MetadataResponse
+	ooxmlMetadata(docx, &resp)
+	if resp.Title != "Quarterly" || resp.Creator != "Ana" || resp.Created != "2024-01-02T03:04:05Z" || resp.Modified != "2024-02-03T04:05:06Z" || resp.Pages != 3 || resp.Words != 420 {
+		t.Fatalf("unexpected metadata %+v", resp)
+	}
+	// a package without docProps leaves the response untouched
+	bare := filepath.Join(dir, "bare.xlsx")
+	f, _ = os.Create(bare)
+	zip.NewWriter(f).Close()
+	f.Close()
+	var empty MetadataResponse
+	ooxmlMetadata(bare, &empty)
+	if empty != (MetadataResponse{}) {
+		t.Fatalf("expected empty metadata, got %+v", empty)
+	}
+}
+
+func TestCSVToRows(t *testing.T) {
+	rows, err := csvToRows([]byte("name,qty,,ok\nwidget,3,x,TRUE\ngear,2.5\nzip,007,,false\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	if rows[0]["name"] != "widget" || rows[0]["qty"] != int64(3) || rows[0]["column_3"] != "x" || rows[0]["ok"] != true {
+		t.Fatalf("unexpected first row %v", rows[0])
+	}
+	if rows[1]["qty"] != 2.5 || rows[1]["ok"] != nil {
+		t.Fatalf("unexpected short row %v", rows[1])
+	}
+	if rows[2]["qty"] != "007" || rows[2]["ok"] != false {
+		t.Fatalf("unexpected typed row %v", rows[2])
+	}
+
+	// NaN and Inf are not JSON numbers, so they must stay strings
+	rows, err = csvToRows([]byte("v\nNaN\nInf\n-infinity\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for i, want := range []string{"NaN", "Inf", "-infinity"} {
+		if rows[i]["v"] != want {
+			t.Fatalf("row %d: expected %q to stay a string, got %#v", i, want, rows[i]["v"])
+		}
+	}
+	if _, err := json.Marshal(rows); err != nil {
+		t.Fatalf("rows not encodable: %v", err)
+	}
 }
@@ -0,0 +1,24 @@
+// Package dryrun holds the server-wide dry-run switch set with --dry-run or
+// MCP_DRY_RUN=true. While it is on, every tool that has a dry_run argument
+// behaves as if the caller had set it, whatever the request says.
+package dryrun
+
+import "sync/atomic"
+
+var forced atomic.Bool
+
+// Force turns the server-wide dry-run mode on or off.
+func Force(on bool) {
+	forced.Store(on)
+}
+
+// Forced reports whether the server-wide dry-run mode is on.
+func Forced() bool {
+	return forced.Load()
+}
+
+// Apply returns the effective dry-run setting for a request that asked for
+// requested.
+func Apply(requested bool) bool {
+	return requested || forced.Load()
+}
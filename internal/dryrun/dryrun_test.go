@@ -0,0 +1,14 @@
+package dryrun
+
+import "testing"
+
+func TestApply(t *testing.T) {
+	defer Force(false)
+	if Apply(false) || !Apply(true) {
+		t.Fatalf("requests should pass through when not forced")
+	}
+	Force(true)
+	if !Forced() || !Apply(false) {
+		t.Fatalf("forced mode should override the request")
+	}
+}
@@ -0,0 +1,111 @@
+// Package egress implements the host allow-list shared by every tool that
+// reaches the network.
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+)
+
+// ErrHostNotAllowed is returned when a destination is outside EGRESS_ALLOW_HOSTS.
+var ErrHostNotAllowed = errors.New("host not allowed")
+
+// patterns returns the lower-cased host globs from EGRESS_ALLOW_HOSTS.
+func patterns() []string {
+	var out []string
+	for _, p := range strings.Split(os.Getenv("EGRESS_ALLOW_HOSTS"), ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Restricted reports whether an allow-list is configured.
+func Restricted() bool {
+	return len(patterns()) > 0
+}
+
+// HostAllowed reports whether host matches EGRESS_ALLOW_HOSTS. An empty
+// allow-list permits every host.
+func HostAllowed(host string) bool {
+	pats := patterns()
+	if len(pats) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, p := range pats {
+		if ok, _ := path.Match(p, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Host extracts the host name from a URL or an scp-style git address
+// (user@host:path). Local paths yield "".
+func Host(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.Scheme != "" && u.Host != "" {
+		return u.Hostname()
+	}
+	if strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, ".") || strings.HasPrefix(raw, "file:") {
+		return ""
+	}
+	// scp-like syntax: [user@]host:path, where the colon precedes any slash
+	colon := strings.Index(raw, ":")
+	if colon <= 0 {
+		return ""
+	}
+	if slash := strings.Index(raw, "/"); slash >= 0 && slash < colon {
+		return ""
+	}
+	host := raw[:colon]
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	return host
+}
+
+// Check returns an error wrapping ErrHostNotAllowed when target resolves to a
+// host outside the allow-list, auditing the denial under tool.
+func Check(ctx context.Context, tool, target string) error {
+	host := Host(target)
+	if host == "" || HostAllowed(host) {
+		return nil
+	}
+	audit(ctx, tool, host)
+	return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+}
+
+// CheckRedirect is an http.Client CheckRedirect hook that applies Check to
+// every redirect target and otherwise keeps net/http's 10-hop default.
+func CheckRedirect(tool string) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if err := Check(req.Context(), tool, req.URL.String()); err != nil {
+			return err
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+func audit(ctx context.Context, tool, host string) {
+	rec := struct {
+		TS    string `json:"ts"`
+		Tool  string `json:"tool"`
+		Host  string `json:"host"`
+		Event string `json:"event"`
+	}{time.Now().UTC().Format(time.RFC3339), tool, host, "egress_denied"}
+	auditlog.Write(ctx, rec)
+}
@@ -0,0 +1,45 @@
+package egress
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHostAllowed(t *testing.T) {
+	t.Setenv("EGRESS_ALLOW_HOSTS", "")
+	if !HostAllowed("anything.test") {
+		t.Fatalf("empty allow-list should permit all hosts")
+	}
+	t.Setenv("EGRESS_ALLOW_HOSTS", "github.com, *.example.com")
+	cases := map[string]bool{
+		"github.com":       true,
+		"GitHub.com":       true,
+		"api.example.com":  true,
+		"example.com":      false,
+		"evil.com":         false,
+		"github.com.evil":  false,
+		"a.b.example.com":  true,
+		"api.example.com.": true,
+	}
+	for host, want := range cases {
+		if got := HostAllowed(host); got != want {
+			t.Errorf("HostAllowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Setenv("EGRESS_ALLOW_HOSTS", "github.com")
+	for target, allowed := range map[string]bool{
+		"https://github.com/org/repo.git": true,
+		"git@github.com:org/repo.git":     true,
+		"https://gitlab.com/org/repo.git": false,
+		"ssh://git@gitlab.com/org/repo":   false,
+		"/srv/repos/local.git":            true,
+	} {
+		err := Check(context.Background(), "test", target)
+		if (err == nil) != allowed {
+			t.Errorf("Check(%q) = %v, want allowed=%v", target, err, allowed)
+		}
+	}
+}
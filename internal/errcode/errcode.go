@@ -0,0 +1,84 @@
+// Package errcode gives tool failures a stable, machine-readable code that is
+// returned as error_code next to the human-readable error message, so clients
+// can branch on the kind of failure without parsing text.
+package errcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/gaspardpetit/mcp-shell/internal/egress"
+	"github.com/gaspardpetit/mcp-shell/internal/quota"
+)
+
+const (
+	EgressDisabled   = "EGRESS_DISABLED"
+	PathEscape       = "PATH_ESCAPE"
+	NotFound         = "NOT_FOUND"
+	AlreadyExists    = "ALREADY_EXISTS"
+	PermissionDenied = "PERMISSION_DENIED"
+	Timeout          = "TIMEOUT"
+	PolicyBlocked    = "POLICY_BLOCKED"
+	QuotaExceeded    = "QUOTA_EXCEEDED"
+	InvalidArgument  = "INVALID_ARGUMENT"
+	Failed           = "FAILED"
+)
+
+type coded struct {
+	code string
+	err  error
+}
+
+func (c *coded) Error() string { return c.err.Error() }
+func (c *coded) Unwrap() error { return c.err }
+
+// Wrap tags err with code without changing its message.
+func Wrap(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &coded{code: code, err: err}
+}
+
+// Errorf is fmt.Errorf with a code attached.
+func Errorf(code, format string, args ...any) error {
+	return Wrap(code, fmt.Errorf(format, args...))
+}
+
+// Of returns the code for err: the one attached with Wrap or Errorf if any,
+// otherwise one inferred from well-known sentinel errors, otherwise Failed.
+// A nil error has no code.
+func Of(err error) string {
+	if err == nil {
+		return ""
+	}
+	var c *coded
+	switch {
+	case errors.As(err, &c):
+		return c.code
+	case errors.Is(err, egress.ErrHostNotAllowed):
+		return PolicyBlocked
+	case errors.Is(err, quota.ErrExceeded):
+		return QuotaExceeded
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case errors.Is(err, fs.ErrNotExist):
+		return NotFound
+	case errors.Is(err, fs.ErrExist):
+		return AlreadyExists
+	case errors.Is(err, fs.ErrPermission):
+		return PermissionDenied
+	}
+	return Failed
+}
+
+// ForExit returns the code for a failed command: Timeout for the conventional
+// exit status 124, Failed otherwise.
+func ForExit(exit int) string {
+	if exit == 124 {
+		return Timeout
+	}
+	return Failed
+}
@@ -0,0 +1,35 @@
+package errcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/gaspardpetit/mcp-shell/internal/egress"
+)
+
+func TestOf(t *testing.T) {
+	_, statErr := os.Stat("/definitely/missing")
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{Errorf(PathEscape, "path %q escapes workspace", "/etc"), PathEscape},
+		{fmt.Errorf("outer: %w", Wrap(EgressDisabled, errors.New("no egress"))), EgressDisabled},
+		{fmt.Errorf("%w: evil.com", egress.ErrHostNotAllowed), PolicyBlocked},
+		{context.DeadlineExceeded, Timeout},
+		{statErr, NotFound},
+		{errors.New("boom"), Failed},
+	}
+	for _, c := range cases {
+		if got := Of(c.err); got != c.want {
+			t.Errorf("Of(%v) = %q, want %q", c.err, got, c.want)
+		}
+	}
+	if Wrap(Failed, nil) != nil {
+		t.Errorf("Wrap(nil) should stay nil")
+	}
+}
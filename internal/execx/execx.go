@@ -0,0 +1,62 @@
+// Package execx runs the external converters behind the document and media
+// tools (libreoffice, pandoc, ffmpeg, ImageMagick and the like) under a
+// deadline, killing their whole process group when it expires.
+package execx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// ErrTimedOut is reported when a command outlives its deadline.
+var ErrTimedOut = errors.New("timed out")
+
+// WithTimeout derives the deadline for one external command, using def
+// unless the request sets timeoutMs.
+func WithTimeout(ctx context.Context, timeoutMs int, def time.Duration) (context.Context, context.CancelFunc) {
+	timeout := def
+	if timeoutMs > 0 {
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Run runs cmd in its own process group and returns its exit code. If ctx
+// expires the whole group is killed, not just the direct child, since
+// libreoffice and ffmpeg fork helpers that would otherwise linger and keep
+// the output pipes open; 124 is returned with ErrTimedOut.
+func Run(ctx context.Context, cmd *exec.Cmd) (int, error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	if err == nil {
+		return 0, nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		if cmd.Process != nil {
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		return 124, ErrTimedOut
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitCode(), err
+	}
+	return 1, err
+}
+
+// ErrorText describes a failed run: the timeout, or whatever the command
+// printed.
+func ErrorText(err error, stderr *bytes.Buffer) string {
+	if errors.Is(err, ErrTimedOut) {
+		return err.Error()
+	}
+	return stderr.String()
+}
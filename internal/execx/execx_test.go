@@ -0,0 +1,68 @@
+package execx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTimeout(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), 100, time.Minute)
+	defer cancel()
+	exit, err := Run(ctx, exec.CommandContext(ctx, "sleep", "5"))
+	if exit != 124 || err != ErrTimedOut {
+		t.Fatalf("got exit %d, err %v; want 124, timed out", exit, err)
+	}
+}
+
+// groupMembers lists live (non-zombie) processes in process group pgid.
+func groupMembers(t *testing.T, pgid int) []string {
+	t.Helper()
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+	var live []string
+	for _, p := range stats {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		// fields after the parenthesised command: state ppid pgrp ...
+		fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+		if len(fields) > 2 && fields[0] != "Z" && fields[2] == fmt.Sprint(pgid) {
+			live = append(live, p)
+		}
+	}
+	return live
+}
+
+func TestRunTimeoutKillsGroup(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc")
+	}
+	ctx, cancel := WithTimeout(context.Background(), 200, time.Minute)
+	defer cancel()
+	// a stand-in for a converter that forks a helper holding stdout open
+	cmd := exec.CommandContext(ctx, "sh", "-c", "sleep 30 & sleep 30")
+	var out strings.Builder
+	cmd.Stdout = &out
+	start := time.Now()
+	exit, _ := Run(ctx, cmd)
+	if exit != 124 {
+		t.Fatalf("exit = %d, want 124", exit)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Run took %v after the deadline", d)
+	}
+	pgid := cmd.Process.Pid
+	deadline := time.Now().Add(2 * time.Second)
+	for len(groupMembers(t, pgid)) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("orphaned processes remain: %v", groupMembers(t, pgid))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
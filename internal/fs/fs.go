@@ -20,12 +20,22 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 	"unicode/utf8"
-)
 
-const LogPath = "/logs/mcp-shell.log"
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/gogs/chardet"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/dryrun"
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
+	"github.com/gaspardpetit/mcp-shell/internal/quota"
+)
 
 // workspaceRoot returns the root directory for filesystem operations.
 func workspaceRoot() string {
@@ -44,7 +54,7 @@ func allowOutside() bool {
 // unless FS_ALLOW_OUTSIDE_WORKSPACE is set.
 func normalizePath(p string) (string, error) {
 	if p == "" {
-		return "", errors.New("path is required")
+		return "", errcode.Wrap(errcode.InvalidArgument, errors.New("path is required"))
 	}
 	root := workspaceRoot()
 	if !filepath.IsAbs(p) {
@@ -56,25 +66,14 @@ func normalizePath(p string) (string, error) {
 	}
 	rel, err := filepath.Rel(root, p)
 	if err != nil || strings.HasPrefix(rel, "..") {
-		return "", fmt.Errorf("path %q escapes workspace", p)
+		return "", errcode.Errorf(errcode.PathEscape, "path %q escapes workspace", p)
 	}
 	return p, nil
 }
 
-// audit writes a JSONL record to LogPath; failures are ignored.
-func audit(rec any) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-	_ = json.NewEncoder(f).Encode(rec)
+// audit writes a JSONL record to the audit log; failures are ignored.
+func audit(ctx context.Context, rec any) {
+	auditlog.Write(ctx, rec)
 }
 
 // ---- fs.list
@@ -98,17 +97,18 @@ type ListResponse struct {
 	Entries    []ListEntry `json:"entries"`
 	DurationMs int64       `json:"duration_ms"`
 	Error      string      `json:"error,omitempty"`
+	ErrorCode  string      `json:"error_code,omitempty"`
 }
 
 func List(ctx context.Context, in ListRequest) ListResponse {
 	start := time.Now()
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return ListResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return ListResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	entries, err := os.ReadDir(path)
 	if err != nil {
-		return ListResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return ListResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	resp := ListResponse{}
 	for _, e := range entries {
@@ -144,7 +144,7 @@ func List(ctx context.Context, in ListRequest) ListResponse {
 		}
 	}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Path       string `json:"path"`
@@ -170,17 +170,18 @@ type StatResponse struct {
 	Target     string `json:"symlink_target,omitempty"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
 }
 
 func Stat(ctx context.Context, in StatRequest) StatResponse {
 	start := time.Now()
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return StatResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return StatResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	info, err := os.Lstat(path)
 	if err != nil {
-		return StatResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return StatResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	typ := "file"
 	if info.IsDir() {
@@ -207,7 +208,7 @@ func Stat(ctx context.Context, in StatRequest) StatResponse {
 		}
 	}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Path       string `json:"path"`
@@ -222,33 +223,37 @@ type ReadRequest struct {
 	Path        string `json:"path"`
 	MaxBytes    int64  `json:"max_bytes,omitempty"`
 	StartOffset int64  `json:"start_offset,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
 }
 
 type ReadResponse struct {
 	Content    string `json:"content"`
+	Encoding   string `json:"encoding,omitempty"`
 	Truncated  bool   `json:"truncated"`
+	NextOffset int64  `json:"next_offset,omitempty"` // start_offset for the next chunk when truncated
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
 }
 
 func Read(ctx context.Context, in ReadRequest) ReadResponse {
 	start := time.Now()
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	f, err := os.Open(path)
 	if err != nil {
-		return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	defer f.Close()
 	info, err := f.Stat()
 	if err != nil {
-		return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	if in.StartOffset > 0 {
 		if _, err := f.Seek(in.StartOffset, io.SeekStart); err != nil {
-			return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 		}
 	}
 	limit := in.MaxBytes
@@ -257,15 +262,33 @@ func Read(ctx context.Context, in ReadRequest) ReadResponse {
 	}
 	data, err := io.ReadAll(io.LimitReader(f, limit))
 	if err != nil {
-		return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	truncated := in.StartOffset+int64(len(data)) < info.Size()
-	if !utf8.Valid(data) {
-		return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: "file is not valid UTF-8"}
+	name := strings.ToLower(strings.TrimSpace(in.Encoding))
+	if name == "auto" {
+		name = detectEncoding(data)
+	}
+	if n := partialTail(data, name); truncated && n < len(data) {
+		// leave a character cut by the chunk boundary for the next read,
+		// unless it is all there is and the caller would never advance
+		data = data[:len(data)-n]
+	}
+	var content, enc string
+	if in.Encoding == "" {
+		if !utf8.Valid(data) {
+			return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: "file is not valid UTF-8", ErrorCode: errcode.InvalidArgument}
+		}
+		content = string(data)
+	} else if content, enc, err = decodeText(data, name); err != nil {
+		return ReadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	resp := ReadResponse{Content: content, Encoding: enc, Truncated: truncated}
+	if truncated {
+		resp.NextOffset = in.StartOffset + int64(len(data))
 	}
-	resp := ReadResponse{Content: string(data), Truncated: truncated}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Path       string `json:"path"`
@@ -275,6 +298,88 @@ func Read(ctx context.Context, in ReadRequest) ReadResponse {
 	return resp
 }
 
+// detectEncoding picks an encoding name for data: a BOM wins, then valid
+// UTF-8, then the best guess of the charset detector.
+func detectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8"
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return "utf-16le"
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return "utf-16be"
+	case utf8.Valid(data):
+		return "utf-8"
+	}
+	if res, err := chardet.NewTextDetector().DetectBest(data); err == nil && res.Charset != "" {
+		return strings.ToLower(res.Charset)
+	}
+	return "windows-1252"
+}
+
+// partialTail returns how many trailing bytes of data form an incomplete
+// character in the named encoding ("" is UTF-8): an odd byte or a lone high
+// surrogate in UTF-16, or a cut multi-byte sequence in UTF-8.
+func partialTail(data []byte, name string) int {
+	switch name {
+	case "", "utf-8":
+		for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					return len(data) - i
+				}
+				break
+			}
+		}
+	case "utf-16le", "utf-16be":
+		n := len(data) % 2
+		if body := data[:len(data)-n]; len(body) >= 2 {
+			u := uint16(body[len(body)-2])<<8 | uint16(body[len(body)-1])
+			if name == "utf-16le" {
+				u = uint16(body[len(body)-1])<<8 | uint16(body[len(body)-2])
+			}
+			if u >= 0xD800 && u < 0xDC00 {
+				n += 2
+			}
+		}
+		return n
+	}
+	return 0
+}
+
+// decodeText converts data from the named encoding (any WHATWG label, or
+// "auto") to UTF-8 and returns the text along with the encoding used. A
+// leading BOM is dropped.
+func decodeText(data []byte, name string) (string, string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "auto" {
+		name = detectEncoding(data)
+	}
+	var e encoding.Encoding
+	switch name {
+	case "utf-16le":
+		e = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case "utf-16be":
+		e = unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+	default:
+		var err error
+		if e, err = htmlindex.Get(name); err != nil {
+			return "", "", fmt.Errorf("unsupported encoding %q", name)
+		}
+	}
+	if name == "utf-8" {
+		if !utf8.Valid(data) {
+			return "", "", errors.New("file is not valid UTF-8")
+		}
+		return string(bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})), name, nil
+	}
+	out, err := e.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", "", fmt.Errorf("decode %s: %w", name, err)
+	}
+	return string(out), name, nil
+}
+
 // ---- fs.read_b64
 
 type ReadB64Response struct {
@@ -282,26 +387,27 @@ type ReadB64Response struct {
 	Truncated  bool   `json:"truncated"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
 }
 
 func ReadB64(ctx context.Context, in ReadRequest) ReadB64Response {
 	start := time.Now()
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return ReadB64Response{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return ReadB64Response{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	f, err := os.Open(path)
 	if err != nil {
-		return ReadB64Response{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return ReadB64Response{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	defer f.Close()
 	info, err := f.Stat()
 	if err != nil {
-		return ReadB64Response{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return ReadB64Response{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	if in.StartOffset > 0 {
 		if _, err := f.Seek(in.StartOffset, io.SeekStart); err != nil {
-			return ReadB64Response{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			return ReadB64Response{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 		}
 	}
 	limit := in.MaxBytes
@@ -310,12 +416,12 @@ func ReadB64(ctx context.Context, in ReadRequest) ReadB64Response {
 	}
 	data, err := io.ReadAll(io.LimitReader(f, limit))
 	if err != nil {
-		return ReadB64Response{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return ReadB64Response{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	truncated := in.StartOffset+int64(len(data)) < info.Size()
 	resp := ReadB64Response{ContentB64: base64.StdEncoding.EncodeToString(data), Truncated: truncated}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Path       string `json:"path"`
@@ -325,6 +431,147 @@ func ReadB64(ctx context.Context, in ReadRequest) ReadB64Response {
 	return resp
 }
 
+// ---- fs.read_lines
+
+const (
+	DefaultReadLines      = 1000
+	DefaultReadLinesBytes = 1 << 20 // 1 MiB
+	MaxLineBytes          = 1 << 20 // 1 MiB
+)
+
+type ReadLinesRequest struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line,omitempty"` // 1-based, default 1
+	Count     int    `json:"count,omitempty"`      // default 1000
+	MaxBytes  int    `json:"max_bytes,omitempty"`  // total text returned, default 1 MiB
+}
+
+type Line struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+}
+
+type ReadLinesResponse struct {
+	Lines      []Line `json:"lines"`
+	HasMore    bool   `json:"has_more"`
+	Truncated  bool   `json:"truncated"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
+}
+
+// errLineTooLong is returned by nextLine for a kept line over MaxLineBytes.
+var errLineTooLong = errors.New("line too long")
+
+// nextLine reads one line without its LF or CRLF terminator. Unless keep is
+// set the line is discarded as it is read, so skipped lines of any length
+// cost no memory. io.EOF means there was no line left.
+func nextLine(br *bufio.Reader, keep bool) ([]byte, error) {
+	var line []byte
+	read := false
+	for {
+		chunk, err := br.ReadSlice('\n')
+		read = read || len(chunk) > 0
+		if keep {
+			// leave room for the terminator, trimmed below
+			if len(line)+len(chunk) > MaxLineBytes+2 {
+				return nil, errLineTooLong
+			}
+			line = append(line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && (err != io.EOF || !read) {
+			return nil, err
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) > MaxLineBytes {
+			return nil, errLineTooLong
+		}
+		return line, nil
+	}
+}
+
+// ReadLines streams a file line by line and returns Count lines starting at
+// StartLine, so large files can be paged without loading them. The text
+// returned is capped at MaxBytes; when the cap cuts the page short Truncated
+// and HasMore are set. Returned lines longer than MaxLineBytes are an error
+// rather than being split, while skipped lines may be any length.
+func ReadLines(ctx context.Context, in ReadLinesRequest) ReadLinesResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return ReadLinesResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	if in.StartLine < 0 || in.Count < 0 || in.MaxBytes < 0 {
+		return ReadLinesResponse{DurationMs: time.Since(start).Milliseconds(), Error: "start_line, count and max_bytes must not be negative", ErrorCode: errcode.InvalidArgument}
+	}
+	first := in.StartLine
+	if first == 0 {
+		first = 1
+	}
+	count := in.Count
+	if count == 0 {
+		count = DefaultReadLines
+	}
+	maxBytes := in.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultReadLinesBytes
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ReadLinesResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	defer f.Close()
+	br := bufio.NewReaderSize(f, 64*1024)
+	resp := ReadLinesResponse{Lines: []Line{}}
+	total := 0
+	for n := 1; ; n++ {
+		if len(resp.Lines) == count {
+			_, err := br.Peek(1)
+			resp.HasMore = err == nil
+			break
+		}
+		line, err := nextLine(br, n >= first)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			resp = ReadLinesResponse{Error: err.Error(), ErrorCode: errcode.Of(err)}
+			if errors.Is(err, errLineTooLong) {
+				resp.Error = fmt.Sprintf("line %d exceeds %d bytes", n, MaxLineBytes)
+				resp.ErrorCode = errcode.InvalidArgument
+			}
+			resp.DurationMs = time.Since(start).Milliseconds()
+			return resp
+		}
+		if n < first {
+			continue
+		}
+		if total+len(line) > maxBytes {
+			if len(resp.Lines) == 0 {
+				return ReadLinesResponse{DurationMs: time.Since(start).Milliseconds(), Error: fmt.Sprintf("line %d exceeds max_bytes (%d)", n, maxBytes), ErrorCode: errcode.InvalidArgument}
+			}
+			resp.Truncated, resp.HasMore = true, true
+			break
+		}
+		total += len(line)
+		resp.Lines = append(resp.Lines, Line{Number: n, Text: string(line)})
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path"`
+		StartLine  int    `json:"start_line"`
+		Lines      int    `json:"lines"`
+		DurationMs int64  `json:"duration_ms"`
+	}{time.Now().UTC().Format(time.RFC3339), "fs.read_lines", path, first, len(resp.Lines), resp.DurationMs})
+	return resp
+}
+
 // ---- fs.write
 
 type WriteRequest struct {
@@ -335,46 +582,48 @@ type WriteRequest struct {
 	CreateParents bool   `json:"create_parents,omitempty"`
 	Append        bool   `json:"append,omitempty"`
 	DryRun        bool   `json:"dry_run,omitempty"`
+	UID           *int   `json:"uid,omitempty"`
+	GID           *int   `json:"gid,omitempty"`
 }
 
 type WriteResponse struct {
 	BytesWritten int    `json:"bytes_written"`
 	DurationMs   int64  `json:"duration_ms"`
 	Error        string `json:"error,omitempty"`
+	ErrorCode    string `json:"error_code,omitempty"`
 }
 
 func Write(ctx context.Context, in WriteRequest) WriteResponse {
 	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return WriteResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return WriteResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	var data []byte
 	switch {
 	case in.ContentB64 != "":
 		b, err := base64.StdEncoding.DecodeString(in.ContentB64)
 		if err != nil {
-			return WriteResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			return WriteResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 		}
 		data = b
 	default:
 		data = []byte(in.Content)
 	}
+	if err := checkChown(in.UID, in.GID); err != nil {
+		return WriteResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
 	perm := os.FileMode(0o644)
 	if in.Mode != "" {
 		if v, err := strconv.ParseUint(in.Mode, 8, 32); err == nil {
 			perm = os.FileMode(v)
 		}
 	}
-	if in.CreateParents {
-		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-			return WriteResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
-		}
-	}
 	if in.DryRun {
 		resp := WriteResponse{BytesWritten: len(data)}
 		resp.DurationMs = time.Since(start).Milliseconds()
-		audit(struct {
+		audit(ctx, struct {
 			TS           string `json:"ts"`
 			Tool         string `json:"tool"`
 			Path         string `json:"path"`
@@ -384,6 +633,18 @@ func Write(ctx context.Context, in WriteRequest) WriteResponse {
 		}{time.Now().UTC().Format(time.RFC3339), "fs.write", path, resp.DurationMs, resp.BytesWritten, true})
 		return resp
 	}
+	if in.CreateParents {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return WriteResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+	}
+	growth := int64(len(data))
+	if info, err := os.Stat(path); err == nil && !in.Append {
+		growth -= info.Size()
+	}
+	if err := quota.Reserve(growth); err != nil {
+		return WriteResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
 	flags := os.O_CREATE | os.O_WRONLY
 	if in.Append {
 		flags |= os.O_APPEND
@@ -392,43 +653,222 @@ func Write(ctx context.Context, in WriteRequest) WriteResponse {
 	}
 	f, err := os.OpenFile(path, flags, perm)
 	if err != nil {
-		return WriteResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		quota.Invalidate()
+		return WriteResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	defer f.Close()
 	n, err := f.Write(data)
 	if err != nil {
-		return WriteResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		quota.Invalidate()
+		return WriteResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	if in.UID != nil || in.GID != nil {
+		uid, gid := ownerIDs(in.UID, in.GID)
+		if err := f.Chown(uid, gid); err != nil {
+			return WriteResponse{BytesWritten: n, DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
 	}
 	resp := WriteResponse{BytesWritten: n}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS           string `json:"ts"`
 		Tool         string `json:"tool"`
 		Path         string `json:"path"`
 		DurationMs   int64  `json:"duration_ms"`
 		BytesWritten int    `json:"bytes_written"`
-	}{time.Now().UTC().Format(time.RFC3339), "fs.write", path, resp.DurationMs, n})
+		UID          *int   `json:"uid,omitempty"`
+		GID          *int   `json:"gid,omitempty"`
+	}{time.Now().UTC().Format(time.RFC3339), "fs.write", path, resp.DurationMs, n, in.UID, in.GID})
+	return resp
+}
+
+// ---- fs.chown
+
+// canChown reports whether the process may give files away; only root can
+// change a file's owner. It is a variable so tests can simulate either case.
+var canChown = func() bool { return os.Geteuid() == 0 }
+
+// checkChown rejects an ownership change up front when it cannot succeed, so
+// that fs.write fails before touching the file.
+func checkChown(uid, gid *int) error {
+	if uid == nil && gid == nil {
+		return nil
+	}
+	if (uid != nil && *uid < 0) || (gid != nil && *gid < 0) {
+		return errcode.Wrap(errcode.InvalidArgument, errors.New("uid and gid must not be negative"))
+	}
+	if !canChown() {
+		return errcode.Wrap(errcode.PermissionDenied, errors.New("changing ownership requires running as root"))
+	}
+	return nil
+}
+
+// ownerIDs maps unset ids to -1, which chown leaves unchanged.
+func ownerIDs(uid, gid *int) (int, int) {
+	u, g := -1, -1
+	if uid != nil {
+		u = *uid
+	}
+	if gid != nil {
+		g = *gid
+	}
+	return u, g
+}
+
+type ChownRequest struct {
+	Path      string `json:"path"`
+	UID       *int   `json:"uid,omitempty"`
+	GID       *int   `json:"gid,omitempty"`
+	Recursive bool   `json:"recursive,omitempty"`
+}
+
+type ChownResponse struct {
+	Changed    int    `json:"changed"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
+}
+
+// Chown changes the owner of path, and with Recursive of everything below it.
+// Symlinks are changed themselves rather than followed, so a link cannot be
+// used to reach files outside the workspace.
+func Chown(ctx context.Context, in ChownRequest) ChownResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return ChownResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	if in.UID == nil && in.GID == nil {
+		return ChownResponse{DurationMs: time.Since(start).Milliseconds(), Error: "uid or gid is required", ErrorCode: errcode.InvalidArgument}
+	}
+	if err := checkChown(in.UID, in.GID); err != nil {
+		return ChownResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	uid, gid := ownerIDs(in.UID, in.GID)
+	var resp ChownResponse
+	if in.Recursive {
+		err = filepath.WalkDir(path, func(p string, d stdfs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := os.Lchown(p, uid, gid); err != nil {
+				return err
+			}
+			resp.Changed++
+			return nil
+		})
+	} else if err = os.Lchown(path, uid, gid); err == nil {
+		resp.Changed = 1
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		resp.ErrorCode = errcode.Of(err)
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path"`
+		DurationMs int64  `json:"duration_ms"`
+		UID        *int   `json:"uid,omitempty"`
+		GID        *int   `json:"gid,omitempty"`
+		Recursive  bool   `json:"recursive"`
+		Changed    int    `json:"changed"`
+	}{time.Now().UTC().Format(time.RFC3339), "fs.chown", path, resp.DurationMs, in.UID, in.GID, in.Recursive, resp.Changed})
 	return resp
 }
 
 // ---- fs.remove
 
+// removePreviewLimit caps the paths listed by a dry run; Count and
+// TotalBytes still cover the whole tree.
+const removePreviewLimit = 1000
+
 type RemoveRequest struct {
 	Path      string `json:"path"`
 	Recursive bool   `json:"recursive,omitempty"`
+	DryRun    bool   `json:"dry_run,omitempty"`
 }
 
 type RemoveResponse struct {
-	Removed    bool   `json:"removed"`
-	DurationMs int64  `json:"duration_ms"`
-	Error      string `json:"error,omitempty"`
+	Removed    bool     `json:"removed"`
+	Paths      []string `json:"paths,omitempty"`
+	Count      int      `json:"count,omitempty"`
+	TotalBytes int64    `json:"total_bytes,omitempty"`
+	Truncated  bool     `json:"truncated,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+	Error      string   `json:"error,omitempty"`
+	ErrorCode  string   `json:"error_code,omitempty"`
+}
+
+// removePreview lists what Remove would delete without touching anything.
+// Symlinks are reported but not followed, matching os.RemoveAll.
+func removePreview(ctx context.Context, path string, recursive bool) (RemoveResponse, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return RemoveResponse{}, err
+	}
+	resp := RemoveResponse{Paths: []string{}}
+	if !recursive || !info.IsDir() {
+		if info.IsDir() {
+			if entries, err := os.ReadDir(path); err != nil {
+				return RemoveResponse{}, err
+			} else if len(entries) > 0 {
+				return RemoveResponse{}, errcode.Errorf(errcode.InvalidArgument, "directory %s is not empty; set recursive", path)
+			}
+		}
+		resp.Paths, resp.Count = []string{path}, 1
+		if info.Mode().IsRegular() {
+			resp.TotalBytes = info.Size()
+		}
+		return resp, nil
+	}
+	err = filepath.WalkDir(path, func(p string, d stdfs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		resp.Count++
+		if len(resp.Paths) < removePreviewLimit {
+			resp.Paths = append(resp.Paths, p)
+		} else {
+			resp.Truncated = true
+		}
+		if d.Type().IsRegular() {
+			if fi, err := d.Info(); err == nil {
+				resp.TotalBytes += fi.Size()
+			}
+		}
+		return nil
+	})
+	return resp, err
 }
 
 func Remove(ctx context.Context, in RemoveRequest) RemoveResponse {
 	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return RemoveResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return RemoveResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	if in.DryRun {
+		resp, err := removePreview(ctx, path, in.Recursive)
+		if err != nil {
+			resp = RemoveResponse{Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+		resp.DurationMs = time.Since(start).Milliseconds()
+		audit(ctx, struct {
+			TS         string `json:"ts"`
+			Tool       string `json:"tool"`
+			Path       string `json:"path"`
+			DurationMs int64  `json:"duration_ms"`
+			Count      int    `json:"count"`
+			TotalBytes int64  `json:"total_bytes"`
+			DryRun     bool   `json:"dry_run"`
+		}{time.Now().UTC().Format(time.RFC3339), "fs.remove", path, resp.DurationMs, resp.Count, resp.TotalBytes, true})
+		return resp
 	}
 	var rerr error
 	if in.Recursive {
@@ -439,9 +879,10 @@ func Remove(ctx context.Context, in RemoveRequest) RemoveResponse {
 	resp := RemoveResponse{Removed: rerr == nil}
 	if rerr != nil {
 		resp.Error = rerr.Error()
+		resp.ErrorCode = errcode.Of(rerr)
 	}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Path       string `json:"path"`
@@ -463,13 +904,14 @@ type MkdirResponse struct {
 	Created    bool   `json:"created"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
 }
 
 func Mkdir(ctx context.Context, in MkdirRequest) MkdirResponse {
 	start := time.Now()
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return MkdirResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return MkdirResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	perm := os.FileMode(0o755)
 	if in.Mode != "" {
@@ -486,9 +928,10 @@ func Mkdir(ctx context.Context, in MkdirRequest) MkdirResponse {
 	resp := MkdirResponse{Created: merr == nil}
 	if merr != nil {
 		resp.Error = merr.Error()
+		resp.ErrorCode = errcode.Of(merr)
 	}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Path       string `json:"path"`
@@ -511,35 +954,39 @@ type MoveResponse struct {
 	Moved      bool   `json:"moved"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
 }
 
 func Move(ctx context.Context, in MoveRequest) MoveResponse {
 	start := time.Now()
 	src, err := normalizePath(in.Src)
 	if err != nil {
-		return MoveResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return MoveResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	dest, err := normalizePath(in.Dest)
 	if err != nil {
-		return MoveResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return MoveResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	if !in.Overwrite {
 		if _, err := os.Stat(dest); err == nil {
-			return MoveResponse{DurationMs: time.Since(start).Milliseconds(), Error: "destination exists"}
+			return MoveResponse{DurationMs: time.Since(start).Milliseconds(), Error: "destination exists", ErrorCode: errcode.AlreadyExists}
 		}
 	}
 	if in.Parents {
 		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-			return MoveResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			return MoveResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 		}
 	}
+	// Both paths are inside the workspace, so a rename never changes its
+	// size and needs no quota check; a cross-device rename fails with EXDEV.
 	err = os.Rename(src, dest)
 	resp := MoveResponse{Moved: err == nil}
 	if err != nil {
 		resp.Error = err.Error()
+		resp.ErrorCode = errcode.Of(err)
 	}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Src        string `json:"src"`
@@ -564,35 +1011,36 @@ type CopyResponse struct {
 	Copied     bool   `json:"copied"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
 }
 
 func Copy(ctx context.Context, in CopyRequest) CopyResponse {
 	start := time.Now()
 	src, err := normalizePath(in.Src)
 	if err != nil {
-		return CopyResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return CopyResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	dest, err := normalizePath(in.Dest)
 	if err != nil {
-		return CopyResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return CopyResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	if !in.Overwrite {
 		if _, err := os.Stat(dest); err == nil {
-			return CopyResponse{DurationMs: time.Since(start).Milliseconds(), Error: "destination exists"}
+			return CopyResponse{DurationMs: time.Since(start).Milliseconds(), Error: "destination exists", ErrorCode: errcode.AlreadyExists}
 		}
 	}
 	if in.Parents {
 		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-			return CopyResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			return CopyResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 		}
 	}
 	info, err := os.Lstat(src)
 	if err != nil {
-		return CopyResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return CopyResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	if info.IsDir() {
 		if !in.Recursive {
-			return CopyResponse{DurationMs: time.Since(start).Milliseconds(), Error: "source is a directory"}
+			return CopyResponse{DurationMs: time.Since(start).Milliseconds(), Error: "source is a directory", ErrorCode: errcode.InvalidArgument}
 		}
 		err = filepath.WalkDir(src, func(path string, d stdfs.DirEntry, err error) error {
 			if err != nil {
@@ -621,9 +1069,10 @@ func Copy(ctx context.Context, in CopyRequest) CopyResponse {
 	resp := CopyResponse{Copied: err == nil}
 	if err != nil {
 		resp.Error = err.Error()
+		resp.ErrorCode = errcode.Of(err)
 	}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Src        string `json:"src"`
@@ -634,6 +1083,8 @@ func Copy(ctx context.Context, in CopyRequest) CopyResponse {
 	return resp
 }
 
+// copyFile copies src to dest, counting the bytes against the workspace
+// quota. A copy that fails part way is removed.
 func copyFile(src, dest string, mode os.FileMode) error {
 	in, err := os.Open(src)
 	if err != nil {
@@ -644,11 +1095,13 @@ func copyFile(src, dest string, mode os.FileMode) error {
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-	if _, err := io.Copy(out, in); err != nil {
+	if _, err := io.Copy(quota.NewWriter(out), in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		quota.Invalidate()
 		return err
 	}
-	return nil
+	return out.Close()
 }
 
 // ---- fs.search
@@ -673,19 +1126,20 @@ type SearchResponse struct {
 	Matches    []SearchMatch `json:"matches"`
 	DurationMs int64         `json:"duration_ms"`
 	Error      string        `json:"error,omitempty"`
+	ErrorCode  string        `json:"error_code,omitempty"`
 }
 
 func Search(ctx context.Context, in SearchRequest) SearchResponse {
 	start := time.Now()
 	if in.Query == "" {
-		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "query is required"}
+		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "query is required", ErrorCode: errcode.InvalidArgument}
 	}
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	if _, err := exec.LookPath("rg"); err != nil {
-		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "ripgrep (rg) not found"}
+		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "ripgrep (rg) not found", ErrorCode: errcode.Failed}
 	}
 	args := []string{"--json"}
 	if !in.Regex {
@@ -705,12 +1159,12 @@ func Search(ctx context.Context, in SearchRequest) SearchResponse {
 	cmd := exec.CommandContext(ctx, "rg", args...)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 	if err := cmd.Start(); err != nil {
-		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	scanner := bufio.NewScanner(stdout)
 	resp := SearchResponse{}
@@ -748,9 +1202,10 @@ func Search(ctx context.Context, in SearchRequest) SearchResponse {
 	_ = cmd.Wait()
 	if err := scanner.Err(); err != nil {
 		resp.Error = err.Error()
+		resp.ErrorCode = errcode.Of(err)
 	}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Path       string `json:"path"`
@@ -762,6 +1217,7 @@ func Search(ctx context.Context, in SearchRequest) SearchResponse {
 		if exitErr, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
 			if exitErr.ExitStatus() > 1 {
 				resp.Error = stderr.String()
+				resp.ErrorCode = errcode.Failed
 			}
 		}
 	}
@@ -770,6 +1226,19 @@ func Search(ctx context.Context, in SearchRequest) SearchResponse {
 
 // ---- fs.hash
 
+// newHash returns the hash for algo, or nil when it is not supported.
+func newHash(algo string) hash.Hash {
+	switch strings.ToLower(algo) {
+	case "", "sha256":
+		return sha256.New()
+	case "sha1":
+		return sha1.New()
+	case "md5":
+		return md5.New()
+	}
+	return nil
+}
+
 type HashRequest struct {
 	Path string `json:"path"`
 	Algo string `json:"algo"`
@@ -779,37 +1248,31 @@ type HashResponse struct {
 	Hash       string `json:"hash"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
 }
 
 func Hash(ctx context.Context, in HashRequest) HashResponse {
 	start := time.Now()
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return HashResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return HashResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	f, err := os.Open(path)
 	if err != nil {
-		return HashResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return HashResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	defer f.Close()
-	var h hash.Hash
-	switch strings.ToLower(in.Algo) {
-	case "", "sha256":
-		h = sha256.New()
-	case "sha1":
-		h = sha1.New()
-	case "md5":
-		h = md5.New()
-	default:
-		return HashResponse{DurationMs: time.Since(start).Milliseconds(), Error: "unsupported algo"}
+	h := newHash(in.Algo)
+	if h == nil {
+		return HashResponse{DurationMs: time.Since(start).Milliseconds(), Error: "unsupported algo", ErrorCode: errcode.InvalidArgument}
 	}
 	if _, err := io.Copy(h, f); err != nil {
-		return HashResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return HashResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	hashStr := hex.EncodeToString(h.Sum(nil))
 	resp := HashResponse{Hash: hashStr}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Path       string `json:"path"`
@@ -818,3 +1281,362 @@ func Hash(ctx context.Context, in HashRequest) HashResponse {
 	}{time.Now().UTC().Format(time.RFC3339), "fs.hash", path, in.Algo, resp.DurationMs})
 	return resp
 }
+
+// ---- fs.hash_many
+
+const (
+	defaultHashConcurrency = 4
+	maxHashConcurrency     = 32
+	maxHashManyFiles       = 10000
+)
+
+type HashManyRequest struct {
+	Path           string `json:"path"`
+	Glob           string `json:"glob,omitempty"`
+	Algo           string `json:"algo,omitempty"`
+	MaxConcurrency int    `json:"max_concurrency,omitempty"`
+}
+
+type HashManyResponse struct {
+	Hashes     map[string]string `json:"hashes"`
+	Errors     map[string]string `json:"errors,omitempty"`
+	DurationMs int64             `json:"duration_ms"`
+	Error      string            `json:"error,omitempty"`
+	ErrorCode  string            `json:"error_code,omitempty"`
+}
+
+// ctxReader fails reads once ctx is done so long copies stop promptly.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+func hashFile(ctx context.Context, path, algo string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := newHash(algo)
+	if _, err := io.Copy(h, ctxReader{ctx, f}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashMany hashes the regular files under Path whose slash-separated relative
+// path matches Glob (all files when empty, ** spans directories) using a pool
+// of MaxConcurrency workers. Files that cannot be read are reported in Errors
+// rather than failing the call; symlinks are not followed.
+func HashMany(ctx context.Context, in HashManyRequest) HashManyResponse {
+	start := time.Now()
+	fail := func(err error) HashManyResponse {
+		return HashManyResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	root, err := normalizePath(in.Path)
+	if err != nil {
+		return fail(err)
+	}
+	if newHash(in.Algo) == nil {
+		return fail(errcode.Errorf(errcode.InvalidArgument, "unsupported algo"))
+	}
+	if in.Glob != "" && !doublestar.ValidatePattern(in.Glob) {
+		return fail(errcode.Errorf(errcode.InvalidArgument, "invalid glob"))
+	}
+	workers := in.MaxConcurrency
+	if workers <= 0 {
+		workers = defaultHashConcurrency
+	}
+	workers = min(workers, maxHashConcurrency)
+
+	var files []string
+	err = filepath.WalkDir(root, func(p string, d stdfs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if in.Glob != "" {
+			if ok, _ := doublestar.Match(in.Glob, rel); !ok {
+				return nil
+			}
+		}
+		if len(files) == maxHashManyFiles {
+			return errcode.Errorf(errcode.InvalidArgument, "more than %d files match; narrow path or glob", maxHashManyFiles)
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	resp := HashManyResponse{Hashes: map[string]string{}}
+	var mu sync.Mutex
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(files)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range jobs {
+				sum, err := hashFile(ctx, filepath.Join(root, filepath.FromSlash(rel)), in.Algo)
+				mu.Lock()
+				if err != nil {
+					if resp.Errors == nil {
+						resp.Errors = map[string]string{}
+					}
+					resp.Errors[rel] = err.Error()
+				} else {
+					resp.Hashes[rel] = sum
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, rel := range files {
+		select {
+		case jobs <- rel:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return fail(err)
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path"`
+		Glob       string `json:"glob,omitempty"`
+		Algo       string `json:"algo"`
+		Files      int    `json:"files"`
+		Errors     int    `json:"errors"`
+		DurationMs int64  `json:"duration_ms"`
+	}{time.Now().UTC().Format(time.RFC3339), "fs.hash_many", root, in.Glob, in.Algo, len(resp.Hashes), len(resp.Errors), resp.DurationMs})
+	return resp
+}
+
+// ---- fs.compare
+
+type CompareRequest struct {
+	PathA string `json:"path_a"`
+	PathB string `json:"path_b"`
+}
+
+type CompareResponse struct {
+	Identical  bool   `json:"identical"`
+	SizeA      int64  `json:"size_a"`
+	SizeB      int64  `json:"size_b"`
+	Offset     *int64 `json:"offset,omitempty"` // first differing byte; omitted when sizes differ
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
+}
+
+// Compare reports whether two files hold the same bytes. Files of different
+// sizes are reported as different without reading them.
+func Compare(ctx context.Context, in CompareRequest) CompareResponse {
+	start := time.Now()
+	fail := func(err error) CompareResponse {
+		return CompareResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	pathA, err := normalizePath(in.PathA)
+	if err != nil {
+		return fail(err)
+	}
+	pathB, err := normalizePath(in.PathB)
+	if err != nil {
+		return fail(err)
+	}
+	fa, err := os.Open(pathA)
+	if err != nil {
+		return fail(err)
+	}
+	defer fa.Close()
+	fb, err := os.Open(pathB)
+	if err != nil {
+		return fail(err)
+	}
+	defer fb.Close()
+	infoA, err := fa.Stat()
+	if err != nil {
+		return fail(err)
+	}
+	infoB, err := fb.Stat()
+	if err != nil {
+		return fail(err)
+	}
+	if infoA.IsDir() || infoB.IsDir() {
+		return fail(errcode.Errorf(errcode.InvalidArgument, "cannot compare directories"))
+	}
+	resp := CompareResponse{SizeA: infoA.Size(), SizeB: infoB.Size()}
+	if resp.SizeA == resp.SizeB {
+		off, err := firstDiff(fa, fb)
+		if err != nil {
+			return fail(err)
+		}
+		if off < 0 {
+			resp.Identical = true
+		} else {
+			resp.Offset = &off
+		}
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		PathA      string `json:"path_a"`
+		PathB      string `json:"path_b"`
+		Identical  bool   `json:"identical"`
+		DurationMs int64  `json:"duration_ms"`
+	}{time.Now().UTC().Format(time.RFC3339), "fs.compare", pathA, pathB, resp.Identical, resp.DurationMs})
+	return resp
+}
+
+// firstDiff returns the offset of the first byte where a and b differ, or -1
+// when they are equal up to the end of the shorter one.
+func firstDiff(a, b io.Reader) (int64, error) {
+	bufA := make([]byte, 64*1024)
+	bufB := make([]byte, 64*1024)
+	var off int64
+	for {
+		na, errA := io.ReadFull(a, bufA)
+		nb, errB := io.ReadFull(b, bufB)
+		n := min(na, nb)
+		if i := indexDiff(bufA[:n], bufB[:n]); i >= 0 {
+			return off + int64(i), nil
+		}
+		if na != nb {
+			return off + int64(n), nil
+		}
+		off += int64(n)
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return -1, nil
+		}
+		if errA != nil {
+			return 0, errA
+		}
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return 0, errB
+		}
+	}
+}
+
+func indexDiff(a, b []byte) int {
+	if bytes.Equal(a, b) {
+		return -1
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// ---- fs.glob
+
+const defaultGlobMaxResults = 1000
+
+type GlobRequest struct {
+	Path          string `json:"path"`
+	Pattern       string `json:"pattern"`
+	MaxResults    int    `json:"max_results,omitempty"`
+	IncludeHidden bool   `json:"include_hidden,omitempty"`
+}
+
+type GlobResponse struct {
+	Matches    []string `json:"matches"`
+	Truncated  bool     `json:"truncated"`
+	DurationMs int64    `json:"duration_ms"`
+	Error      string   `json:"error,omitempty"`
+	ErrorCode  string   `json:"error_code,omitempty"`
+}
+
+// Glob walks the tree under Path and returns the slash-separated relative
+// paths matching Pattern, where ** spans directories. Hidden files and
+// directories are skipped unless IncludeHidden is set; symlinks are not
+// followed.
+func Glob(ctx context.Context, in GlobRequest) GlobResponse {
+	start := time.Now()
+	root, err := normalizePath(in.Path)
+	if err != nil {
+		return GlobResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	if in.Pattern == "" {
+		return GlobResponse{DurationMs: time.Since(start).Milliseconds(), Error: "pattern is required", ErrorCode: errcode.InvalidArgument}
+	}
+	if !doublestar.ValidatePattern(in.Pattern) {
+		return GlobResponse{DurationMs: time.Since(start).Milliseconds(), Error: "invalid pattern", ErrorCode: errcode.InvalidArgument}
+	}
+	max := in.MaxResults
+	if max <= 0 {
+		max = defaultGlobMaxResults
+	}
+	resp := GlobResponse{Matches: []string{}}
+	errStop := errors.New("stop")
+	err = filepath.WalkDir(root, func(p string, d stdfs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if p == root {
+			return nil
+		}
+		if !in.IncludeHidden && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if ok, _ := doublestar.Match(in.Pattern, rel); ok {
+			if len(resp.Matches) >= max {
+				resp.Truncated = true
+				return errStop
+			}
+			resp.Matches = append(resp.Matches, rel)
+		}
+		return nil
+	})
+	if err != nil && err != errStop {
+		return GlobResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path"`
+		Pattern    string `json:"pattern"`
+		DurationMs int64  `json:"duration_ms"`
+		Count      int    `json:"count"`
+	}{time.Now().UTC().Format(time.RFC3339), "fs.glob", root, in.Pattern, resp.DurationMs, len(resp.Matches)})
+	return resp
+}
@@ -1,12 +1,17 @@
 package fs
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/gaspardpetit/mcp-shell/internal/dryrun"
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
 )
 
 func TestFSRoundTrip(t *testing.T) {
@@ -75,8 +80,11 @@ func TestPathEscapeDenied(t *testing.T) {
 	ws := t.TempDir()
 	t.Setenv("WORKSPACE", ws)
 	outside := filepath.Join(ws, "..", "haxx")
-	if resp := Write(ctx, WriteRequest{Path: outside, Content: "hi"}); resp.Error == "" {
-		t.Fatalf("expected error for outside path")
+	if resp := Write(ctx, WriteRequest{Path: outside, Content: "hi"}); resp.Error == "" || resp.ErrorCode != errcode.PathEscape {
+		t.Fatalf("expected PATH_ESCAPE for outside path, got %q (%s)", resp.ErrorCode, resp.Error)
+	}
+	if resp := Read(ctx, ReadRequest{Path: "missing.txt"}); resp.ErrorCode != errcode.NotFound {
+		t.Fatalf("expected NOT_FOUND, got %q (%s)", resp.ErrorCode, resp.Error)
 	}
 }
 
@@ -133,3 +141,282 @@ func TestHash(t *testing.T) {
 		t.Fatalf("expected error for unsupported algo")
 	}
 }
+
+func TestCompare(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	big := bytes.Repeat([]byte("a"), 100_000)
+	changed := append([]byte(nil), big...)
+	changed[70_000] = 'b'
+	for name, data := range map[string][]byte{"a.bin": big, "b.bin": big, "c.bin": changed, "short.bin": big[:10]} {
+		if err := os.WriteFile(filepath.Join(ws, name), data, 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if resp := Compare(ctx, CompareRequest{PathA: "a.bin", PathB: "b.bin"}); resp.Error != "" || !resp.Identical {
+		t.Fatalf("expected identical, got %+v", resp)
+	}
+	resp := Compare(ctx, CompareRequest{PathA: "a.bin", PathB: "c.bin"})
+	if resp.Identical || resp.Offset == nil || *resp.Offset != 70_000 {
+		t.Fatalf("expected difference at 70000, got %+v", resp)
+	}
+	resp = Compare(ctx, CompareRequest{PathA: "a.bin", PathB: "short.bin"})
+	if resp.Identical || resp.Offset != nil || resp.SizeA != 100_000 || resp.SizeB != 10 {
+		t.Fatalf("expected size mismatch, got %+v", resp)
+	}
+	if resp := Compare(ctx, CompareRequest{PathA: "a.bin", PathB: "missing.bin"}); resp.ErrorCode != errcode.NotFound {
+		t.Fatalf("expected not found, got %+v", resp)
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	if err := os.WriteFile(filepath.Join(ws, "log.txt"), []byte("one\ntwo\r\nthree\nfour"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp := ReadLines(ctx, ReadLinesRequest{Path: "log.txt", StartLine: 2, Count: 2})
+	if resp.Error != "" || len(resp.Lines) != 2 || !resp.HasMore {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if resp.Lines[0] != (Line{Number: 2, Text: "two"}) || resp.Lines[1] != (Line{Number: 3, Text: "three"}) {
+		t.Fatalf("unexpected lines %+v", resp.Lines)
+	}
+	if tail := ReadLines(ctx, ReadLinesRequest{Path: "log.txt", StartLine: 4}); len(tail.Lines) != 1 || tail.HasMore {
+		t.Fatalf("unexpected tail %+v", tail)
+	}
+	long := bytes.Repeat([]byte("x"), MaxLineBytes+1)
+	if err := os.WriteFile(filepath.Join(ws, "long.txt"), append([]byte("ok\n"), long...), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if resp := ReadLines(ctx, ReadLinesRequest{Path: "long.txt"}); resp.ErrorCode != errcode.InvalidArgument || !strings.Contains(resp.Error, "line 2") {
+		t.Fatalf("expected long line error, got %+v", resp.Error)
+	}
+	// a long line that is skipped is fine
+	if err := os.WriteFile(filepath.Join(ws, "skip.txt"), append(append(long, "\nafter\r\n"...), "last"...), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if resp := ReadLines(ctx, ReadLinesRequest{Path: "skip.txt", StartLine: 2}); resp.Error != "" || len(resp.Lines) != 2 || resp.Lines[0] != (Line{Number: 2, Text: "after"}) {
+		t.Fatalf("expected to skip the long line, got %+v", resp.Lines)
+	}
+	// the total returned is capped by max_bytes
+	capped := ReadLines(ctx, ReadLinesRequest{Path: "log.txt", MaxBytes: 7})
+	if capped.Error != "" || len(capped.Lines) != 2 || !capped.Truncated || !capped.HasMore {
+		t.Fatalf("expected two lines within max_bytes, got %+v", capped)
+	}
+	if resp := ReadLines(ctx, ReadLinesRequest{Path: "log.txt", StartLine: 3, MaxBytes: 2}); resp.ErrorCode != errcode.InvalidArgument {
+		t.Fatalf("expected a line over max_bytes to fail, got %+v", resp)
+	}
+}
+
+func TestReadEncoding(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	// "héllo" as UTF-16LE with a BOM
+	utf16 := []byte{0xFF, 0xFE, 'h', 0, 0xE9, 0, 'l', 0, 'l', 0, 'o', 0}
+	if err := os.WriteFile(filepath.Join(ws, "u16.txt"), utf16, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if resp := Read(ctx, ReadRequest{Path: "u16.txt"}); resp.Error == "" {
+		t.Fatalf("expected strict utf-8 error, got %+v", resp)
+	}
+	for _, enc := range []string{"utf-16le", "auto"} {
+		resp := Read(ctx, ReadRequest{Path: "u16.txt", Encoding: enc})
+		if resp.Error != "" || resp.Content != "héllo" || resp.Encoding != "utf-16le" {
+			t.Fatalf("%s: unexpected read %+v", enc, resp)
+		}
+	}
+	// "a😀b" as UTF-16LE: chunks must not split the surrogate pair or a unit
+	pair := []byte{0xFF, 0xFE, 'a', 0, 0x3D, 0xD8, 0x00, 0xDE, 'b', 0}
+	if err := os.WriteFile(filepath.Join(ws, "pair.txt"), pair, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	for _, max := range []int64{5, 6, 7} {
+		var got string
+		for off := int64(0); ; {
+			resp := Read(ctx, ReadRequest{Path: "pair.txt", Encoding: "utf-16le", StartOffset: off, MaxBytes: max})
+			if resp.Error != "" || strings.ContainsRune(resp.Content, '\uFFFD') {
+				t.Fatalf("max %d offset %d: %+v", max, off, resp)
+			}
+			got += resp.Content
+			if !resp.Truncated {
+				break
+			}
+			off = resp.NextOffset
+		}
+		if got != "a😀b" {
+			t.Fatalf("max %d: chunks joined to %q", max, got)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(ws, "u8.txt"), []byte("aé"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if resp := Read(ctx, ReadRequest{Path: "u8.txt", MaxBytes: 2}); resp.Error != "" || resp.Content != "a" || resp.NextOffset != 1 {
+		t.Fatalf("expected the cut utf-8 sequence to be left for the next chunk, got %+v", resp)
+	}
+	if err := os.WriteFile(filepath.Join(ws, "latin1.txt"), []byte("caf\xe9"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if resp := Read(ctx, ReadRequest{Path: "latin1.txt", Encoding: "latin1"}); resp.Error != "" || resp.Content != "café" {
+		t.Fatalf("unexpected latin1 read %+v", resp)
+	}
+	if resp := Read(ctx, ReadRequest{Path: "latin1.txt", Encoding: "klingon"}); resp.Error == "" {
+		t.Fatalf("expected unsupported encoding error")
+	}
+}
+
+func TestGlob(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	for _, p := range []string{"a.go", "pkg/b.go", "pkg/sub/c.go", "pkg/sub/c.txt", ".hidden/d.go"} {
+		if resp := Write(ctx, WriteRequest{Path: p, Content: "x", CreateParents: true}); resp.Error != "" {
+			t.Fatalf("write %s: %v", p, resp.Error)
+		}
+	}
+	resp := Glob(ctx, GlobRequest{Path: ".", Pattern: "**/*.go"})
+	if resp.Error != "" || strings.Join(resp.Matches, ",") != "a.go,pkg/b.go,pkg/sub/c.go" {
+		t.Fatalf("unexpected matches %+v", resp)
+	}
+	if resp := Glob(ctx, GlobRequest{Path: ".", Pattern: "**/*.go", IncludeHidden: true}); len(resp.Matches) != 4 {
+		t.Fatalf("expected hidden match, got %+v", resp)
+	}
+	if resp := Glob(ctx, GlobRequest{Path: ".", Pattern: "**/*.go", MaxResults: 2}); len(resp.Matches) != 2 || !resp.Truncated {
+		t.Fatalf("expected truncation, got %+v", resp)
+	}
+	if resp := Glob(ctx, GlobRequest{Path: "..", Pattern: "*"}); resp.Error == "" {
+		t.Fatalf("expected workspace escape error")
+	}
+}
+
+func TestChown(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	old := canChown
+	defer func() { canChown = old }()
+	uid, gid := os.Getuid(), os.Getgid()
+
+	canChown = func() bool { return false }
+	if resp := Write(ctx, WriteRequest{Path: "a.txt", Content: "x", UID: &uid}); resp.ErrorCode != errcode.PermissionDenied {
+		t.Fatalf("expected PERMISSION_DENIED, got %q (%s)", resp.ErrorCode, resp.Error)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "a.txt")); err == nil {
+		t.Fatalf("file should not be written when chown is refused")
+	}
+
+	// chown to our own ids is permitted for any user, so this runs unprivileged
+	canChown = func() bool { return true }
+	if resp := Write(ctx, WriteRequest{Path: "d/a.txt", Content: "x", CreateParents: true, UID: &uid, GID: &gid}); resp.Error != "" {
+		t.Fatalf("write with owner: %s", resp.Error)
+	}
+	if err := os.Symlink("/etc/passwd", filepath.Join(ws, "d", "link")); err != nil {
+		t.Fatal(err)
+	}
+	resp := Chown(ctx, ChownRequest{Path: "d", GID: &gid, Recursive: true})
+	if resp.Error != "" || resp.Changed != 3 {
+		t.Fatalf("recursive chown: changed %d, error %q", resp.Changed, resp.Error)
+	}
+	if resp := Chown(ctx, ChownRequest{Path: "d"}); resp.ErrorCode != errcode.InvalidArgument {
+		t.Fatalf("expected INVALID_ARGUMENT without ids, got %q", resp.ErrorCode)
+	}
+}
+
+func TestRemoveDryRun(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	os.MkdirAll(filepath.Join(ws, "tree", "sub"), 0o755)
+	os.WriteFile(filepath.Join(ws, "tree", "a.txt"), []byte("12345"), 0o644)
+	os.WriteFile(filepath.Join(ws, "tree", "sub", "b.txt"), []byte("123"), 0o644)
+
+	resp := Remove(ctx, RemoveRequest{Path: "tree", Recursive: true, DryRun: true})
+	if resp.Error != "" || resp.Removed || resp.Count != 4 || resp.TotalBytes != 8 || len(resp.Paths) != 4 {
+		t.Fatalf("unexpected preview %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "tree", "sub", "b.txt")); err != nil {
+		t.Fatalf("dry run removed files: %v", err)
+	}
+	if resp := Remove(ctx, RemoveRequest{Path: "tree/a.txt", DryRun: true}); resp.Error != "" || resp.Count != 1 || resp.TotalBytes != 5 {
+		t.Fatalf("unexpected single-file preview %+v", resp)
+	}
+	if resp := Remove(ctx, RemoveRequest{Path: "tree", DryRun: true}); resp.ErrorCode != errcode.InvalidArgument {
+		t.Fatalf("expected non-recursive preview of a full directory to fail %+v", resp)
+	}
+	if resp := Remove(ctx, RemoveRequest{Path: "missing", DryRun: true}); resp.ErrorCode != errcode.NotFound {
+		t.Fatalf("expected NOT_FOUND %+v", resp)
+	}
+}
+
+func TestHashMany(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	os.MkdirAll(filepath.Join(ws, "d", "sub"), 0o755)
+	os.WriteFile(filepath.Join(ws, "d", "a.txt"), []byte("hello"), 0o644)
+	os.WriteFile(filepath.Join(ws, "d", "sub", "b.txt"), []byte("world"), 0o644)
+	os.WriteFile(filepath.Join(ws, "d", "c.bin"), []byte("x"), 0o644)
+
+	resp := HashMany(ctx, HashManyRequest{Path: "d", Glob: "**/*.txt", MaxConcurrency: 2})
+	if resp.Error != "" || len(resp.Hashes) != 2 {
+		t.Fatalf("unexpected resp %+v", resp)
+	}
+	if want := Hash(ctx, HashRequest{Path: "d/sub/b.txt"}).Hash; resp.Hashes["sub/b.txt"] != want {
+		t.Fatalf("hash mismatch %q != %q", resp.Hashes["sub/b.txt"], want)
+	}
+	if all := HashMany(ctx, HashManyRequest{Path: "d", Algo: "md5"}); len(all.Hashes) != 3 || all.Hashes["a.txt"] != "5d41402abc4b2a76b9719d911017c592" {
+		t.Fatalf("unexpected md5 resp %+v", all)
+	}
+	if bad := HashMany(ctx, HashManyRequest{Path: "d", Algo: "crc"}); bad.ErrorCode != errcode.InvalidArgument {
+		t.Fatalf("expected invalid algo %+v", bad)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if resp := HashMany(cancelled, HashManyRequest{Path: "d"}); resp.Error == "" {
+		t.Fatalf("expected cancellation error")
+	}
+}
+
+func TestForcedDryRun(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	dryrun.Force(true)
+	defer dryrun.Force(false)
+	if resp := Write(ctx, WriteRequest{Path: "new/file.txt", Content: "hi", CreateParents: true}); resp.Error != "" || resp.BytesWritten != 2 {
+		t.Fatalf("unexpected write resp %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "new")); !os.IsNotExist(err) {
+		t.Fatalf("forced dry run created parents: %v", err)
+	}
+	os.WriteFile(filepath.Join(ws, "keep.txt"), []byte("x"), 0o644)
+	if resp := Remove(ctx, RemoveRequest{Path: "keep.txt"}); resp.Removed || resp.Count != 1 {
+		t.Fatalf("unexpected remove resp %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "keep.txt")); err != nil {
+		t.Fatalf("forced dry run removed file: %v", err)
+	}
+}
+
+func TestCopyQuota(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	if err := os.WriteFile(filepath.Join(ws, "big.bin"), bytes.Repeat([]byte("x"), 4096), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	t.Setenv("WORKSPACE_QUOTA_BYTES", "6000")
+	resp := Copy(ctx, CopyRequest{Src: "big.bin", Dest: "copy.bin"})
+	if resp.Copied || resp.ErrorCode != errcode.QuotaExceeded {
+		t.Fatalf("expected quota error, got %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "copy.bin")); !os.IsNotExist(err) {
+		t.Fatalf("partial copy left behind: %v", err)
+	}
+	if resp := Write(ctx, WriteRequest{Path: "small.txt", Content: "hello"}); resp.Error != "" {
+		t.Fatalf("write after failed copy: %+v", resp)
+	}
+}
@@ -3,23 +3,28 @@ package git
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
-)
 
-const (
-	DefaultTimeout = 60 * time.Second
-	DefaultMaxIO   = 1 << 20
-	LogPath        = "/logs/mcp-shell.log"
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/dryrun"
+	"github.com/gaspardpetit/mcp-shell/internal/egress"
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
+	"github.com/gaspardpetit/mcp-shell/internal/iolimit"
 )
 
+const DefaultTimeout = 60 * time.Second
+
+// DefaultMaxIO caps each output stream when a request sets no max_bytes.
+var DefaultMaxIO = iolimit.Default()
+
 func workspaceRoot() string {
 	if ws := os.Getenv("WORKSPACE"); ws != "" {
 		return filepath.Clean(ws)
@@ -29,7 +34,7 @@ func workspaceRoot() string {
 
 func normalizePath(p string) (string, error) {
 	if p == "" {
-		return "", errors.New("path is required")
+		return "", errcode.Wrap(errcode.InvalidArgument, errors.New("path is required"))
 	}
 	root := workspaceRoot()
 	if !filepath.IsAbs(p) {
@@ -38,7 +43,7 @@ func normalizePath(p string) (string, error) {
 	p = filepath.Clean(p)
 	rel, err := filepath.Rel(root, p)
 	if err != nil || strings.HasPrefix(rel, "..") {
-		return "", fmt.Errorf("path %q escapes workspace", p)
+		return "", errcode.Errorf(errcode.PathEscape, "path %q escapes workspace", p)
 	}
 	return p, nil
 }
@@ -51,6 +56,58 @@ func pushAllowed() bool {
 	return os.Getenv("GIT_ALLOW_PUSH") == "1"
 }
 
+// remoteTargets resolves the URLs git will contact for remote, defaulting to
+// the current branch's configured remote (or origin). With push set they are
+// the push URLs, which pushurl or pushInsteadOf may point elsewhere; a remote
+// with several of them is pushed to each. It returns nil when the remote
+// cannot be resolved.
+func remoteTargets(ctx context.Context, path, remote string, push bool) []string {
+	if remote == "" {
+		branch, _, _, _, _, _ := run(ctx, path, []string{"rev-parse", "--abbrev-ref", "HEAD"}, DefaultTimeout, DefaultMaxIO)
+		configured, _, _, _, _, _ := run(ctx, path, []string{"config", "--get", "branch." + strings.TrimSpace(branch) + ".remote"}, DefaultTimeout, DefaultMaxIO)
+		remote = strings.TrimSpace(configured)
+		if remote == "" {
+			remote = "origin"
+		}
+	}
+	if egress.Host(remote) != "" {
+		return []string{remote}
+	}
+	args := []string{"remote", "get-url", "--all", remote}
+	if push {
+		args = []string{"remote", "get-url", "--push", "--all", remote}
+	}
+	out, _, exit, _, _, _ := run(ctx, path, args, DefaultTimeout, DefaultMaxIO)
+	if exit != 0 {
+		return nil
+	}
+	var targets []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			targets = append(targets, line)
+		}
+	}
+	return targets
+}
+
+// checkRemoteHost applies EGRESS_ALLOW_HOSTS to every URL a command will
+// contact. Unresolvable remotes are denied only when an allow-list is set.
+func checkRemoteHost(ctx context.Context, tool, path, remote string, push bool) error {
+	if !egress.Restricted() {
+		return nil
+	}
+	targets := remoteTargets(ctx, path, remote, push)
+	if len(targets) == 0 {
+		return fmt.Errorf("%w: cannot resolve remote %q", egress.ErrHostNotAllowed, remote)
+	}
+	for _, target := range targets {
+		if err := egress.Check(ctx, tool, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type limitedWriter struct {
 	buf       *bytes.Buffer
 	limit     int
@@ -108,18 +165,7 @@ func run(ctx context.Context, cwd string, args []string, timeout time.Duration,
 	return
 }
 
-func audit(tool, path string, args []string, exit int, durationMs int64, bytesOut int, stdoutTrunc, stderrTrunc bool) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
+func audit(ctx context.Context, tool, path string, args []string, exit int, durationMs int64, bytesOut int, stdoutTrunc, stderrTrunc bool) {
 	rec := struct {
 		TS              string   `json:"ts"`
 		Tool            string   `json:"tool"`
@@ -141,18 +187,34 @@ func audit(tool, path string, args []string, exit int, durationMs int64, bytesOu
 		stdoutTrunc,
 		stderrTrunc,
 	}
-	_ = json.NewEncoder(f).Encode(rec)
+	auditlog.Write(ctx, rec)
 }
 
 // ---- git.clone ----
 
 type CloneRequest struct {
-	Repo      string `json:"repo"`
-	Dir       string `json:"dir,omitempty"`
-	Depth     int    `json:"depth,omitempty"`
-	TimeoutMs int    `json:"timeout_ms,omitempty"`
-	MaxBytes  int64  `json:"max_bytes,omitempty"`
-	DryRun    bool   `json:"dry_run,omitempty"`
+	Repo         string   `json:"repo"`
+	Dir          string   `json:"dir,omitempty"`
+	Depth        int      `json:"depth,omitempty"`
+	Branch       string   `json:"branch,omitempty"`
+	SingleBranch bool     `json:"single_branch,omitempty"`
+	Sparse       []string `json:"sparse,omitempty"`
+	TimeoutMs    int      `json:"timeout_ms,omitempty"`
+	MaxBytes     int64    `json:"max_bytes,omitempty"`
+	DryRun       bool     `json:"dry_run,omitempty"`
+}
+
+// cloneDir mirrors git's default destination: the last path component of
+// the repository URL without a trailing .git.
+func cloneDir(repo, dir string) string {
+	if dir != "" {
+		return dir
+	}
+	repo = strings.TrimRight(repo, "/")
+	if i := strings.LastIndexAny(repo, "/:"); i >= 0 {
+		repo = repo[i+1:]
+	}
+	return strings.TrimSuffix(repo, ".git")
 }
 
 type CloneResponse struct {
@@ -163,15 +225,22 @@ type CloneResponse struct {
 	StdoutTruncated bool   `json:"stdout_truncated"`
 	StderrTruncated bool   `json:"stderr_truncated"`
 	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
 }
 
 func Clone(ctx context.Context, in CloneRequest) CloneResponse {
 	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
 	if in.Repo == "" {
-		return CloneResponse{ExitCode: 1, Error: "repo is required"}
+		return CloneResponse{ExitCode: 1, Error: "repo is required", ErrorCode: errcode.InvalidArgument}
 	}
 	if !egressAllowed() && !in.DryRun {
-		return CloneResponse{ExitCode: 1, Error: "git clone requires egress"}
+		return CloneResponse{ExitCode: 1, Error: "git clone requires egress", ErrorCode: errcode.EgressDisabled, DurationMs: time.Since(start).Milliseconds()}
+	}
+	if !in.DryRun {
+		if err := egress.Check(ctx, "git.clone", in.Repo); err != nil {
+			return CloneResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+		}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -186,13 +255,30 @@ func Clone(ctx context.Context, in CloneRequest) CloneResponse {
 	if in.Depth > 0 {
 		args = append(args, fmt.Sprintf("--depth=%d", in.Depth))
 	}
+	if in.Branch != "" {
+		args = append(args, "--branch", in.Branch)
+	}
+	if in.SingleBranch {
+		args = append(args, "--single-branch")
+	}
+	if len(in.Sparse) > 0 {
+		args = append(args, "--filter=blob:none", "--sparse")
+	}
 	args = append(args, in.Repo)
 	if in.Dir != "" {
 		args = append(args, in.Dir)
 	}
+	var sparseArgs []string
+	if len(in.Sparse) > 0 {
+		sparseArgs = append([]string{"sparse-checkout", "set"}, in.Sparse...)
+	}
 	if in.DryRun {
-		resp := CloneResponse{Stdout: fmt.Sprintf("[dry_run] git %s", strings.Join(args, " ")), ExitCode: 0, DurationMs: time.Since(start).Milliseconds()}
-		audit("git.clone", cwd, args, resp.ExitCode, resp.DurationMs, len(resp.Stdout)+len(resp.Stderr), false, false)
+		out := fmt.Sprintf("[dry_run] git %s", strings.Join(args, " "))
+		if sparseArgs != nil {
+			out += fmt.Sprintf("\n[dry_run] git %s", strings.Join(sparseArgs, " "))
+		}
+		resp := CloneResponse{Stdout: out, ExitCode: 0, DurationMs: time.Since(start).Milliseconds()}
+		audit(ctx, "git.clone", cwd, args, resp.ExitCode, resp.DurationMs, len(resp.Stdout)+len(resp.Stderr), false, false)
 		return resp
 	}
 	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, cwd, args, timeout, limit)
@@ -206,8 +292,28 @@ func Clone(ctx context.Context, in CloneRequest) CloneResponse {
 	}
 	if exit != 0 {
 		resp.Error = "git clone failed"
+		resp.ErrorCode = errcode.ForExit(exit)
+	}
+	audit(ctx, "git.clone", cwd, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	if exit != 0 || sparseArgs == nil {
+		return resp
 	}
-	audit("git.clone", cwd, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	repoDir := cloneDir(in.Repo, in.Dir)
+	if !filepath.IsAbs(repoDir) {
+		repoDir = filepath.Join(cwd, repoDir)
+	}
+	sOut, sErr, sExit, sDur, sOutTrunc, sErrTrunc := run(ctx, repoDir, sparseArgs, timeout, limit)
+	resp.Stdout += sOut
+	resp.Stderr += sErr
+	resp.ExitCode = sExit
+	resp.DurationMs += sDur
+	resp.StdoutTruncated = resp.StdoutTruncated || sOutTrunc
+	resp.StderrTruncated = resp.StderrTruncated || sErrTrunc
+	if sExit != 0 {
+		resp.Error = "git sparse-checkout failed"
+		resp.ErrorCode = errcode.ForExit(sExit)
+	}
+	audit(ctx, "git.clone", repoDir, sparseArgs, sExit, sDur, len(sOut)+len(sErr), sOutTrunc, sErrTrunc)
 	return resp
 }
 
@@ -219,21 +325,66 @@ type StatusRequest struct {
 	MaxBytes  int64  `json:"max_bytes,omitempty"`
 }
 
+type StatusEntry struct {
+	Path           string `json:"path"`
+	IndexStatus    string `json:"index_status"`
+	WorktreeStatus string `json:"worktree_status"`
+	Renamed        bool   `json:"renamed,omitempty"`
+	OrigPath       string `json:"orig_path,omitempty"`
+}
+
 type StatusResponse struct {
-	Stdout          string `json:"stdout"`
-	Stderr          string `json:"stderr"`
-	ExitCode        int    `json:"exit_code"`
-	DurationMs      int64  `json:"duration_ms"`
-	StdoutTruncated bool   `json:"stdout_truncated"`
-	StderrTruncated bool   `json:"stderr_truncated"`
-	Error           string `json:"error,omitempty"`
+	Stdout          string        `json:"stdout"`
+	Stderr          string        `json:"stderr"`
+	ExitCode        int           `json:"exit_code"`
+	DurationMs      int64         `json:"duration_ms"`
+	StdoutTruncated bool          `json:"stdout_truncated"`
+	StderrTruncated bool          `json:"stderr_truncated"`
+	Parsed          []StatusEntry `json:"parsed,omitempty"`
+	Error           string        `json:"error,omitempty"`
+	ErrorCode       string        `json:"error_code,omitempty"`
+}
+
+// parsePorcelain converts `git status --porcelain=v1` output into entries.
+func parsePorcelain(out string) []StatusEntry {
+	var entries []StatusEntry
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		e := StatusEntry{
+			IndexStatus:    string(line[0]),
+			WorktreeStatus: string(line[1]),
+			Path:           line[3:],
+		}
+		if e.IndexStatus == "R" || e.IndexStatus == "C" || e.WorktreeStatus == "R" {
+			if from, to, ok := strings.Cut(e.Path, " -> "); ok {
+				e.Renamed = true
+				e.OrigPath = unquotePath(from)
+				e.Path = to
+			}
+		}
+		e.Path = unquotePath(e.Path)
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// unquotePath strips the C-style quoting git applies to unusual file names.
+func unquotePath(p string) string {
+	if len(p) >= 2 && p[0] == '"' && p[len(p)-1] == '"' {
+		if s, err := strconv.Unquote(p); err == nil {
+			return s
+		}
+	}
+	return p
 }
 
 func Status(ctx context.Context, in StatusRequest) StatusResponse {
 	start := time.Now()
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return StatusResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		return StatusResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -243,7 +394,7 @@ func Status(ctx context.Context, in StatusRequest) StatusResponse {
 	if in.MaxBytes > 0 {
 		limit = int(in.MaxBytes)
 	}
-	args := []string{"status", "--porcelain"}
+	args := []string{"status", "--porcelain=v1"}
 	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
 	resp := StatusResponse{
 		Stdout:          stdout,
@@ -255,20 +406,25 @@ func Status(ctx context.Context, in StatusRequest) StatusResponse {
 	}
 	if exit != 0 {
 		resp.Error = "git status failed"
+		resp.ErrorCode = errcode.ForExit(exit)
+	} else {
+		resp.Parsed = parsePorcelain(stdout)
 	}
-	audit("git.status", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	audit(ctx, "git.status", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
 	return resp
 }
 
 // ---- git.commit ----
 
 type CommitRequest struct {
-	Path      string `json:"path"`
-	Message   string `json:"message"`
-	All       bool   `json:"all,omitempty"`
-	TimeoutMs int    `json:"timeout_ms,omitempty"`
-	MaxBytes  int64  `json:"max_bytes,omitempty"`
-	DryRun    bool   `json:"dry_run,omitempty"`
+	Path        string `json:"path"`
+	Message     string `json:"message"`
+	All         bool   `json:"all,omitempty"`
+	AuthorName  string `json:"author_name,omitempty"`
+	AuthorEmail string `json:"author_email,omitempty"`
+	TimeoutMs   int    `json:"timeout_ms,omitempty"`
+	MaxBytes    int64  `json:"max_bytes,omitempty"`
+	DryRun      bool   `json:"dry_run,omitempty"`
 }
 
 type CommitResponse struct {
@@ -280,16 +436,18 @@ type CommitResponse struct {
 	StderrTruncated bool   `json:"stderr_truncated"`
 	Commit          string `json:"commit,omitempty"`
 	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
 }
 
 func Commit(ctx context.Context, in CommitRequest) CommitResponse {
 	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return CommitResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		return CommitResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
 	}
 	if in.Message == "" {
-		return CommitResponse{ExitCode: 1, Error: "message is required", DurationMs: time.Since(start).Milliseconds()}
+		return CommitResponse{ExitCode: 1, Error: "message is required", ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -299,13 +457,29 @@ func Commit(ctx context.Context, in CommitRequest) CommitResponse {
 	if in.MaxBytes > 0 {
 		limit = int(in.MaxBytes)
 	}
-	args := []string{"commit", "-m", in.Message}
+	// identity is passed per invocation so global config is never touched
+	name := in.AuthorName
+	if name == "" {
+		name = os.Getenv("GIT_AUTHOR_NAME")
+	}
+	email := in.AuthorEmail
+	if email == "" {
+		email = os.Getenv("GIT_AUTHOR_EMAIL")
+	}
+	var args []string
+	if name != "" {
+		args = append(args, "-c", "user.name="+name)
+	}
+	if email != "" {
+		args = append(args, "-c", "user.email="+email)
+	}
+	args = append(args, "commit", "-m", in.Message)
 	if in.All {
 		args = append(args, "-a")
 	}
 	if in.DryRun {
 		resp := CommitResponse{Stdout: fmt.Sprintf("[dry_run] git %s", strings.Join(args, " ")), ExitCode: 0, DurationMs: time.Since(start).Milliseconds()}
-		audit("git.commit", path, args, resp.ExitCode, resp.DurationMs, len(resp.Stdout)+len(resp.Stderr), false, false)
+		audit(ctx, "git.commit", path, args, resp.ExitCode, resp.DurationMs, len(resp.Stdout)+len(resp.Stderr), false, false)
 		return resp
 	}
 	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
@@ -323,8 +497,9 @@ func Commit(ctx context.Context, in CommitRequest) CommitResponse {
 		resp.Commit = strings.TrimSpace(revStdout)
 	} else {
 		resp.Error = "git commit failed"
+		resp.ErrorCode = errcode.ForExit(exit)
 	}
-	audit("git.commit", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	audit(ctx, "git.commit", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
 	return resp
 }
 
@@ -346,16 +521,23 @@ type PullResponse struct {
 	StdoutTruncated bool   `json:"stdout_truncated"`
 	StderrTruncated bool   `json:"stderr_truncated"`
 	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
 }
 
 func Pull(ctx context.Context, in PullRequest) PullResponse {
 	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return PullResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		return PullResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
 	}
 	if !egressAllowed() && !in.DryRun {
-		return PullResponse{ExitCode: 1, Error: "git pull requires egress"}
+		return PullResponse{ExitCode: 1, Error: "git pull requires egress", ErrorCode: errcode.EgressDisabled, DurationMs: time.Since(start).Milliseconds()}
+	}
+	if !in.DryRun {
+		if err := checkRemoteHost(ctx, "git.pull", path, "", false); err != nil {
+			return PullResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+		}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -371,7 +553,7 @@ func Pull(ctx context.Context, in PullRequest) PullResponse {
 	}
 	if in.DryRun {
 		resp := PullResponse{Stdout: fmt.Sprintf("[dry_run] git %s", strings.Join(args, " ")), ExitCode: 0, DurationMs: time.Since(start).Milliseconds()}
-		audit("git.pull", path, args, resp.ExitCode, resp.DurationMs, len(resp.Stdout)+len(resp.Stderr), false, false)
+		audit(ctx, "git.pull", path, args, resp.ExitCode, resp.DurationMs, len(resp.Stdout)+len(resp.Stderr), false, false)
 		return resp
 	}
 	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
@@ -385,8 +567,87 @@ func Pull(ctx context.Context, in PullRequest) PullResponse {
 	}
 	if exit != 0 {
 		resp.Error = "git pull failed"
+		resp.ErrorCode = errcode.ForExit(exit)
 	}
-	audit("git.pull", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	audit(ctx, "git.pull", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- git.fetch ----
+
+type FetchRequest struct {
+	Path      string `json:"path"`
+	Remote    string `json:"remote,omitempty"`
+	Prune     bool   `json:"prune,omitempty"`
+	Tags      bool   `json:"tags,omitempty"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+	DryRun    bool   `json:"dry_run,omitempty"`
+}
+
+type FetchResponse struct {
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	ExitCode        int    `json:"exit_code"`
+	DurationMs      int64  `json:"duration_ms"`
+	StdoutTruncated bool   `json:"stdout_truncated"`
+	StderrTruncated bool   `json:"stderr_truncated"`
+	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
+}
+
+func Fetch(ctx context.Context, in FetchRequest) FetchResponse {
+	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return FetchResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	if !egressAllowed() && !in.DryRun {
+		return FetchResponse{ExitCode: 1, Error: "git fetch requires egress", ErrorCode: errcode.EgressDisabled, DurationMs: time.Since(start).Milliseconds()}
+	}
+	if !in.DryRun {
+		if err := checkRemoteHost(ctx, "git.fetch", path, in.Remote, false); err != nil {
+			return FetchResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+		}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	args := []string{"fetch"}
+	if in.Prune {
+		args = append(args, "--prune")
+	}
+	if in.Tags {
+		args = append(args, "--tags")
+	}
+	if in.Remote != "" {
+		args = append(args, in.Remote)
+	}
+	if in.DryRun {
+		resp := FetchResponse{Stdout: fmt.Sprintf("[dry_run] git %s", strings.Join(args, " ")), ExitCode: 0, DurationMs: time.Since(start).Milliseconds()}
+		audit(ctx, "git.fetch", path, args, resp.ExitCode, resp.DurationMs, len(resp.Stdout)+len(resp.Stderr), false, false)
+		return resp
+	}
+	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
+	resp := FetchResponse{
+		Stdout:          stdout,
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      dur,
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	if exit != 0 {
+		resp.Error = "git fetch failed"
+		resp.ErrorCode = errcode.ForExit(exit)
+	}
+	audit(ctx, "git.fetch", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
 	return resp
 }
 
@@ -409,19 +670,26 @@ type PushResponse struct {
 	StdoutTruncated bool   `json:"stdout_truncated"`
 	StderrTruncated bool   `json:"stderr_truncated"`
 	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
 }
 
 func Push(ctx context.Context, in PushRequest) PushResponse {
 	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return PushResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		return PushResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
 	}
 	if !pushAllowed() && !in.DryRun {
-		return PushResponse{ExitCode: 1, Error: "git push disabled"}
+		return PushResponse{ExitCode: 1, Error: "git push disabled", ErrorCode: errcode.PolicyBlocked}
 	}
 	if !egressAllowed() && !in.DryRun {
-		return PushResponse{ExitCode: 1, Error: "git push requires egress"}
+		return PushResponse{ExitCode: 1, Error: "git push requires egress", ErrorCode: errcode.EgressDisabled, DurationMs: time.Since(start).Milliseconds()}
+	}
+	if !in.DryRun {
+		if err := checkRemoteHost(ctx, "git.push", path, in.Remote, true); err != nil {
+			return PushResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+		}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -440,7 +708,7 @@ func Push(ctx context.Context, in PushRequest) PushResponse {
 	}
 	if in.DryRun {
 		resp := PushResponse{Stdout: fmt.Sprintf("[dry_run] git %s", strings.Join(args, " ")), ExitCode: 0, DurationMs: time.Since(start).Milliseconds()}
-		audit("git.push", path, args, resp.ExitCode, resp.DurationMs, len(resp.Stdout)+len(resp.Stderr), false, false)
+		audit(ctx, "git.push", path, args, resp.ExitCode, resp.DurationMs, len(resp.Stdout)+len(resp.Stderr), false, false)
 		return resp
 	}
 	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
@@ -454,8 +722,9 @@ func Push(ctx context.Context, in PushRequest) PushResponse {
 	}
 	if exit != 0 {
 		resp.Error = "git push failed"
+		resp.ErrorCode = errcode.ForExit(exit)
 	}
-	audit("git.push", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	audit(ctx, "git.push", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
 	return resp
 }
 
@@ -477,16 +746,17 @@ type CheckoutResponse struct {
 	StdoutTruncated bool   `json:"stdout_truncated"`
 	StderrTruncated bool   `json:"stderr_truncated"`
 	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
 }
 
 func Checkout(ctx context.Context, in CheckoutRequest) CheckoutResponse {
 	start := time.Now()
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return CheckoutResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		return CheckoutResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
 	}
 	if in.Ref == "" {
-		return CheckoutResponse{ExitCode: 1, Error: "ref is required", DurationMs: time.Since(start).Milliseconds()}
+		return CheckoutResponse{ExitCode: 1, Error: "ref is required", ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -512,38 +782,78 @@ func Checkout(ctx context.Context, in CheckoutRequest) CheckoutResponse {
 	}
 	if exit != 0 {
 		resp.Error = "git checkout failed"
+		resp.ErrorCode = errcode.ForExit(exit)
 	}
-	audit("git.checkout", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	audit(ctx, "git.checkout", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
 	return resp
 }
 
 // ---- git.branch ----
 
 type BranchRequest struct {
-	Path      string `json:"path"`
-	Name      string `json:"name,omitempty"`
-	Delete    bool   `json:"delete,omitempty"`
-	List      bool   `json:"list,omitempty"`
-	TimeoutMs int    `json:"timeout_ms,omitempty"`
-	MaxBytes  int64  `json:"max_bytes,omitempty"`
+	Path   string `json:"path"`
+	Name   string `json:"name,omitempty"`
+	Delete bool   `json:"delete,omitempty"`
+	List   bool   `json:"list,omitempty"`
+	// Verbose adds per-branch tracking details to a listing.
+	Verbose   bool  `json:"verbose,omitempty"`
+	TimeoutMs int   `json:"timeout_ms,omitempty"`
+	MaxBytes  int64 `json:"max_bytes,omitempty"`
+}
+
+type BranchInfo struct {
+	Name     string `json:"name"`
+	Current  bool   `json:"current"`
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
 }
 
 type BranchResponse struct {
-	Stdout          string   `json:"stdout"`
-	Stderr          string   `json:"stderr"`
-	ExitCode        int      `json:"exit_code"`
-	DurationMs      int64    `json:"duration_ms"`
-	StdoutTruncated bool     `json:"stdout_truncated"`
-	StderrTruncated bool     `json:"stderr_truncated"`
-	Branches        []string `json:"branches,omitempty"`
-	Error           string   `json:"error,omitempty"`
+	Stdout          string       `json:"stdout"`
+	Stderr          string       `json:"stderr"`
+	ExitCode        int          `json:"exit_code"`
+	DurationMs      int64        `json:"duration_ms"`
+	StdoutTruncated bool         `json:"stdout_truncated"`
+	StderrTruncated bool         `json:"stderr_truncated"`
+	Branches        []string     `json:"branches,omitempty"`
+	Details         []BranchInfo `json:"details,omitempty"`
+	Error           string       `json:"error,omitempty"`
+	ErrorCode       string       `json:"error_code,omitempty"`
+}
+
+// branchDetails reports each local branch with its upstream and how many
+// commits it is ahead of and behind it. Branches whose upstream is gone keep
+// the upstream name with zero counts.
+func branchDetails(ctx context.Context, path string, timeout time.Duration, limit int) ([]BranchInfo, error) {
+	stdout, stderr, exit, _, _, _ := run(ctx, path, []string{"for-each-ref", "--format=%(HEAD)%00%(refname:short)%00%(upstream:short)", "refs/heads"}, timeout, limit)
+	if exit != 0 {
+		return nil, fmt.Errorf("git for-each-ref: %s", strings.TrimSpace(stderr))
+	}
+	branches := []BranchInfo{}
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 3 {
+			continue
+		}
+		b := BranchInfo{Name: fields[1], Current: fields[0] == "*", Upstream: fields[2]}
+		if b.Upstream != "" {
+			out, _, exit, _, _, _ := run(ctx, path, []string{"rev-list", "--left-right", "--count", b.Name + "..." + b.Upstream}, timeout, limit)
+			if counts := strings.Fields(out); exit == 0 && len(counts) == 2 {
+				b.Ahead, _ = strconv.Atoi(counts[0])
+				b.Behind, _ = strconv.Atoi(counts[1])
+			}
+		}
+		branches = append(branches, b)
+	}
+	return branches, nil
 }
 
 func Branch(ctx context.Context, in BranchRequest) BranchResponse {
 	start := time.Now()
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return BranchResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		return BranchResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -580,11 +890,17 @@ func Branch(ctx context.Context, in BranchRequest) BranchResponse {
 				resp.Branches = append(resp.Branches, l)
 			}
 		}
+		if in.Verbose {
+			if resp.Details, err = branchDetails(ctx, path, timeout, limit); err != nil {
+				resp.Error = err.Error()
+			}
+		}
 	}
 	if exit != 0 {
 		resp.Error = "git branch failed"
+		resp.ErrorCode = errcode.ForExit(exit)
 	}
-	audit("git.branch", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	audit(ctx, "git.branch", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
 	return resp
 }
 
@@ -608,13 +924,14 @@ type TagResponse struct {
 	StderrTruncated bool     `json:"stderr_truncated"`
 	Tags            []string `json:"tags,omitempty"`
 	Error           string   `json:"error,omitempty"`
+	ErrorCode       string   `json:"error_code,omitempty"`
 }
 
 func Tag(ctx context.Context, in TagRequest) TagResponse {
 	start := time.Now()
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return TagResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		return TagResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -654,8 +971,193 @@ func Tag(ctx context.Context, in TagRequest) TagResponse {
 	}
 	if exit != 0 {
 		resp.Error = "git tag failed"
+		resp.ErrorCode = errcode.ForExit(exit)
 	}
-	audit("git.tag", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	audit(ctx, "git.tag", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- git.remote ----
+
+type RemoteRequest struct {
+	Path      string `json:"path"`
+	Action    string `json:"action,omitempty"`
+	Name      string `json:"name,omitempty"`
+	URL       string `json:"url,omitempty"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+}
+
+type RemoteInfo struct {
+	Name     string `json:"name"`
+	FetchURL string `json:"fetch_url,omitempty"`
+	PushURL  string `json:"push_url,omitempty"`
+}
+
+type RemoteResponse struct {
+	Stdout          string       `json:"stdout"`
+	Stderr          string       `json:"stderr"`
+	ExitCode        int          `json:"exit_code"`
+	DurationMs      int64        `json:"duration_ms"`
+	StdoutTruncated bool         `json:"stdout_truncated"`
+	StderrTruncated bool         `json:"stderr_truncated"`
+	Remotes         []RemoteInfo `json:"remotes,omitempty"`
+	Error           string       `json:"error,omitempty"`
+	ErrorCode       string       `json:"error_code,omitempty"`
+}
+
+// parseRemotes converts `git remote -v` output into one entry per remote.
+func parseRemotes(out string) []RemoteInfo {
+	var remotes []RemoteInfo
+	index := map[string]int{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		i, ok := index[fields[0]]
+		if !ok {
+			i = len(remotes)
+			index[fields[0]] = i
+			remotes = append(remotes, RemoteInfo{Name: fields[0]})
+		}
+		switch fields[2] {
+		case "(fetch)":
+			remotes[i].FetchURL = fields[1]
+		case "(push)":
+			remotes[i].PushURL = fields[1]
+		}
+	}
+	return remotes
+}
+
+func Remote(ctx context.Context, in RemoteRequest) RemoteResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return RemoteResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	action := in.Action
+	if action == "" {
+		action = "list"
+	}
+	var args []string
+	switch action {
+	case "list":
+		args = []string{"remote", "-v"}
+	case "add", "set-url":
+		if in.Name == "" || in.URL == "" {
+			return RemoteResponse{ExitCode: 1, Error: "name and url are required", ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+		}
+		args = []string{"remote", action, in.Name, in.URL}
+	case "remove":
+		if in.Name == "" {
+			return RemoteResponse{ExitCode: 1, Error: "name is required", ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+		}
+		args = []string{"remote", "remove", in.Name}
+	default:
+		return RemoteResponse{ExitCode: 1, Error: fmt.Sprintf("unsupported action %q", action), ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+	}
+	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
+	resp := RemoteResponse{
+		Stdout:          stdout,
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      dur,
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	if exit != 0 {
+		resp.Error = "git remote failed"
+		resp.ErrorCode = errcode.ForExit(exit)
+	} else if action == "list" {
+		resp.Remotes = parseRemotes(stdout)
+	}
+	audit(ctx, "git.remote", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- git.apply ----
+
+type GitApplyRequest struct {
+	Path        string `json:"path"`
+	UnifiedDiff string `json:"unified_diff"`
+	Check       bool   `json:"check,omitempty"`
+	Index       bool   `json:"index,omitempty"`
+	TimeoutMs   int    `json:"timeout_ms,omitempty"`
+	MaxBytes    int64  `json:"max_bytes,omitempty"`
+}
+
+type GitApplyResponse struct {
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	ExitCode        int    `json:"exit_code"`
+	DurationMs      int64  `json:"duration_ms"`
+	StdoutTruncated bool   `json:"stdout_truncated"`
+	StderrTruncated bool   `json:"stderr_truncated"`
+	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
+}
+
+func Apply(ctx context.Context, in GitApplyRequest) GitApplyResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return GitApplyResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	if in.UnifiedDiff == "" {
+		return GitApplyResponse{ExitCode: 1, Error: "unified_diff is required", ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	tmp, err := os.CreateTemp("", "git-apply-*.diff")
+	if err != nil {
+		return GitApplyResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(in.UnifiedDiff); err != nil {
+		tmp.Close()
+		return GitApplyResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	if err := tmp.Close(); err != nil {
+		return GitApplyResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	args := []string{"apply"}
+	if in.Check {
+		args = append(args, "--check")
+	}
+	if in.Index {
+		args = append(args, "--index")
+	}
+	args = append(args, tmp.Name())
+	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
+	resp := GitApplyResponse{
+		Stdout:          stdout,
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      dur,
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	if exit != 0 {
+		resp.Error = "git apply failed"
+		resp.ErrorCode = errcode.ForExit(exit)
+	}
+	audit(ctx, "git.apply", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
 	return resp
 }
 
@@ -676,13 +1178,15 @@ type LFSInstallResponse struct {
 	StdoutTruncated bool   `json:"stdout_truncated"`
 	StderrTruncated bool   `json:"stderr_truncated"`
 	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
 }
 
 func LFSInstall(ctx context.Context, in LFSInstallRequest) LFSInstallResponse {
 	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
 	path, err := normalizePath(in.Path)
 	if err != nil {
-		return LFSInstallResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		return LFSInstallResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -695,7 +1199,7 @@ func LFSInstall(ctx context.Context, in LFSInstallRequest) LFSInstallResponse {
 	args := []string{"lfs", "install"}
 	if in.DryRun {
 		resp := LFSInstallResponse{Stdout: fmt.Sprintf("[dry_run] git %s", strings.Join(args, " ")), ExitCode: 0, DurationMs: time.Since(start).Milliseconds()}
-		audit("git.lfs.install", path, args, resp.ExitCode, resp.DurationMs, len(resp.Stdout)+len(resp.Stderr), false, false)
+		audit(ctx, "git.lfs.install", path, args, resp.ExitCode, resp.DurationMs, len(resp.Stdout)+len(resp.Stderr), false, false)
 		return resp
 	}
 	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
@@ -709,7 +1213,576 @@ func LFSInstall(ctx context.Context, in LFSInstallRequest) LFSInstallResponse {
 	}
 	if exit != 0 {
 		resp.Error = "git lfs install failed"
+		resp.ErrorCode = errcode.ForExit(exit)
+	}
+	audit(ctx, "git.lfs.install", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- git.show ----
+
+type ShowRequest struct {
+	Path      string `json:"path"`
+	Ref       string `json:"ref,omitempty"`
+	File      string `json:"file,omitempty"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+}
+
+type ShowCommit struct {
+	Hash           string   `json:"hash"`
+	Parents        []string `json:"parents,omitempty"`
+	AuthorName     string   `json:"author_name"`
+	AuthorEmail    string   `json:"author_email"`
+	AuthorDate     string   `json:"author_date"`
+	CommitterName  string   `json:"committer_name"`
+	CommitterEmail string   `json:"committer_email"`
+	CommitDate     string   `json:"commit_date"`
+	Subject        string   `json:"subject"`
+	Body           string   `json:"body,omitempty"`
+}
+
+type ShowResponse struct {
+	Type            string      `json:"type"`
+	Target          string      `json:"target,omitempty"` // for a tag, the type of the object it points at
+	Commit          *ShowCommit `json:"commit,omitempty"`
+	Diff            string      `json:"diff,omitempty"`
+	Content         string      `json:"content,omitempty"`
+	Stderr          string      `json:"stderr"`
+	ExitCode        int         `json:"exit_code"`
+	DurationMs      int64       `json:"duration_ms"`
+	StdoutTruncated bool        `json:"stdout_truncated"`
+	StderrTruncated bool        `json:"stderr_truncated"`
+	Error           string      `json:"error,omitempty"`
+	ErrorCode       string      `json:"error_code,omitempty"`
+}
+
+// showFormat separates the commit fields with US and ends the header with RS
+// so the diff that follows can be split off reliably.
+const showFormat = "%H%x1f%P%x1f%an%x1f%ae%x1f%aI%x1f%cn%x1f%ce%x1f%cI%x1f%s%x1f%b%x1e"
+
+// parseShow splits `git show --format=showFormat` output into the commit and
+// its diff.
+func parseShow(out string) (*ShowCommit, string) {
+	header, diff, _ := strings.Cut(out, "\x1e")
+	f := strings.Split(header, "\x1f")
+	if len(f) < 10 {
+		return nil, out
+	}
+	return &ShowCommit{
+		Hash:           f[0],
+		Parents:        strings.Fields(f[1]),
+		AuthorName:     f[2],
+		AuthorEmail:    f[3],
+		AuthorDate:     f[4],
+		CommitterName:  f[5],
+		CommitterEmail: f[6],
+		CommitDate:     f[7],
+		Subject:        f[8],
+		Body:           strings.TrimSpace(f[9]),
+	}, strings.TrimLeft(diff, "\n")
+}
+
+// Show describes one object. Commits return the commit metadata and its
+// patch, limited to File when set; blobs and trees return their content. Tags
+// are peeled and shown as the object they point at, reported in Target.
+// A file as of a commit can be read with a ref such as "HEAD:path".
+func Show(ctx context.Context, in ShowRequest) ShowResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return ShowResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	ref := in.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if strings.HasPrefix(ref, "-") || strings.HasPrefix(in.File, "-") {
+		return ShowResponse{ExitCode: 1, Error: "ref and file must not start with '-'", ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	typ, typErr, exit, _, _, _ := run(ctx, path, []string{"cat-file", "-t", ref}, timeout, DefaultMaxIO)
+	if exit != 0 {
+		return ShowResponse{Stderr: typErr, ExitCode: exit, Error: "git show failed", ErrorCode: errcode.ForExit(exit), DurationMs: time.Since(start).Milliseconds()}
+	}
+	typ = strings.TrimSpace(typ)
+	// a tag may point at any object; peel it and show what it points at
+	kind, target := typ, ""
+	if typ == "tag" {
+		ref += "^{}"
+		out, peelErr, exit, _, _, _ := run(ctx, path, []string{"cat-file", "-t", ref}, timeout, DefaultMaxIO)
+		if exit != 0 {
+			return ShowResponse{Type: typ, Stderr: peelErr, ExitCode: exit, Error: "cannot resolve tag target", ErrorCode: errcode.ForExit(exit), DurationMs: time.Since(start).Milliseconds()}
+		}
+		kind = strings.TrimSpace(out)
+		target = kind
+	}
+	if in.File != "" && kind != "commit" {
+		return ShowResponse{Type: typ, Target: target, ExitCode: 1, Error: fmt.Sprintf("file only applies to commits, but %s is a %s", in.Ref, kind), ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+	}
+	var args []string
+	if kind == "commit" {
+		args = []string{"show", "--no-color", "--format=" + showFormat, ref}
+		if in.File != "" {
+			args = append(args, "--", in.File)
+		}
+	} else {
+		args = []string{"show", "--no-color", ref}
+	}
+	stdout, stderr, exit, _, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
+	resp := ShowResponse{
+		Type:            typ,
+		Target:          target,
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      time.Since(start).Milliseconds(),
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	switch {
+	case exit != 0:
+		resp.Error = "git show failed"
+		resp.ErrorCode = errcode.ForExit(exit)
+	case kind == "commit":
+		resp.Commit, resp.Diff = parseShow(stdout)
+	default:
+		resp.Content = stdout
+	}
+	audit(ctx, "git.show", path, args, exit, resp.DurationMs, len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- git.blame ----
+
+type BlameRequest struct {
+	Path      string `json:"path"`
+	File      string `json:"file"`
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	Ref       string `json:"ref,omitempty"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+}
+
+type BlameLine struct {
+	Line      int    `json:"line"`
+	Commit    string `json:"commit"`
+	Author    string `json:"author"`
+	Timestamp string `json:"timestamp"`
+	Content   string `json:"content"`
+}
+
+type BlameResponse struct {
+	Lines           []BlameLine `json:"lines"`
+	Stderr          string      `json:"stderr"`
+	ExitCode        int         `json:"exit_code"`
+	DurationMs      int64       `json:"duration_ms"`
+	StdoutTruncated bool        `json:"stdout_truncated"`
+	StderrTruncated bool        `json:"stderr_truncated"`
+	Error           string      `json:"error,omitempty"`
+	ErrorCode       string      `json:"error_code,omitempty"`
+}
+
+// parseBlame reads `git blame --line-porcelain` output. Each record is a
+// "<sha> <orig-line> <final-line>" header, key/value lines, and the content
+// prefixed with a tab; a record cut short by truncation is dropped.
+func parseBlame(out string) []BlameLine {
+	lines := []BlameLine{}
+	var cur BlameLine
+	inRecord := false
+	for _, l := range strings.Split(out, "\n") {
+		if !inRecord {
+			f := strings.Fields(l)
+			if len(f) < 3 || len(f[0]) < 40 {
+				continue
+			}
+			cur = BlameLine{Commit: f[0]}
+			cur.Line, _ = strconv.Atoi(f[2])
+			inRecord = true
+			continue
+		}
+		switch {
+		case strings.HasPrefix(l, "\t"):
+			cur.Content = l[1:]
+			lines = append(lines, cur)
+			inRecord = false
+		case strings.HasPrefix(l, "author "):
+			cur.Author = strings.TrimPrefix(l, "author ")
+		case strings.HasPrefix(l, "author-time "):
+			if sec, err := strconv.ParseInt(strings.TrimPrefix(l, "author-time "), 10, 64); err == nil {
+				cur.Timestamp = time.Unix(sec, 0).UTC().Format(time.RFC3339)
+			}
+		}
+	}
+	return lines
+}
+
+// repoFile resolves file relative to the repository and rejects paths that
+// leave it.
+func repoFile(repo, file string) (string, error) {
+	if file == "" {
+		return "", errcode.Wrap(errcode.InvalidArgument, errors.New("file is required"))
+	}
+	p := file
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(repo, p)
+	}
+	rel, err := filepath.Rel(repo, filepath.Clean(p))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errcode.Errorf(errcode.PathEscape, "file %q escapes repository", file)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func Blame(ctx context.Context, in BlameRequest) BlameResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return BlameResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	file, err := repoFile(path, in.File)
+	if err != nil {
+		return BlameResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	if in.StartLine < 0 || in.EndLine < 0 || (in.EndLine > 0 && in.StartLine > in.EndLine) {
+		return BlameResponse{ExitCode: 1, Error: "invalid line range", ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+	}
+	if strings.HasPrefix(in.Ref, "-") {
+		return BlameResponse{ExitCode: 1, Error: "ref must not start with '-'", ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	args := []string{"blame", "--line-porcelain"}
+	if in.StartLine > 0 || in.EndLine > 0 {
+		first := max(in.StartLine, 1)
+		rng := strconv.Itoa(first) + ","
+		if in.EndLine > 0 {
+			rng += strconv.Itoa(in.EndLine)
+		}
+		args = append(args, "-L", rng)
+	}
+	if in.Ref != "" {
+		args = append(args, in.Ref)
+	}
+	args = append(args, "--", file)
+	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
+	resp := BlameResponse{
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      dur,
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	if exit != 0 {
+		resp.Error = "git blame failed"
+		resp.ErrorCode = errcode.ForExit(exit)
+	} else {
+		resp.Lines = parseBlame(stdout)
+	}
+	audit(ctx, "git.blame", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- git.init ----
+
+type InitRequest struct {
+	Path          string `json:"path"`
+	Bare          bool   `json:"bare,omitempty"`
+	InitialBranch string `json:"initial_branch,omitempty"`
+	TimeoutMs     int    `json:"timeout_ms,omitempty"`
+	MaxBytes      int64  `json:"max_bytes,omitempty"`
+}
+
+type InitResponse struct {
+	Created         bool   `json:"created"`
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	ExitCode        int    `json:"exit_code"`
+	DurationMs      int64  `json:"duration_ms"`
+	StdoutTruncated bool   `json:"stdout_truncated"`
+	StderrTruncated bool   `json:"stderr_truncated"`
+	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
+}
+
+// isRepo reports whether dir already holds a repository of the requested
+// kind, in which case git init only reinitializes it.
+func isRepo(dir string, bare bool) bool {
+	if !bare {
+		_, err := os.Stat(filepath.Join(dir, ".git"))
+		return err == nil
+	}
+	_, headErr := os.Stat(filepath.Join(dir, "HEAD"))
+	_, objErr := os.Stat(filepath.Join(dir, "objects"))
+	return headErr == nil && objErr == nil
+}
+
+func Init(ctx context.Context, in InitRequest) InitResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return InitResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	if strings.HasPrefix(in.InitialBranch, "-") {
+		return InitResponse{ExitCode: 1, Error: "initial_branch must not start with '-'", ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return InitResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	existed := isRepo(path, in.Bare)
+	args := []string{"init"}
+	if in.Bare {
+		args = append(args, "--bare")
+	}
+	if in.InitialBranch != "" {
+		args = append(args, "--initial-branch="+in.InitialBranch)
+	}
+	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
+	resp := InitResponse{
+		Stdout:          stdout,
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      dur,
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	if exit != 0 {
+		resp.Error = "git init failed"
+		resp.ErrorCode = errcode.ForExit(exit)
+	} else {
+		resp.Created = !existed
+	}
+	audit(ctx, "git.init", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- git.config ----
+
+type ConfigRequest struct {
+	Path      string `json:"path"`
+	Action    string `json:"action,omitempty"`
+	Key       string `json:"key,omitempty"`
+	Value     string `json:"value,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+}
+
+type ConfigResponse struct {
+	Value           string            `json:"value,omitempty"`
+	Found           bool              `json:"found,omitempty"`
+	Entries         map[string]string `json:"entries,omitempty"`
+	Stderr          string            `json:"stderr"`
+	ExitCode        int               `json:"exit_code"`
+	DurationMs      int64             `json:"duration_ms"`
+	StdoutTruncated bool              `json:"stdout_truncated"`
+	StderrTruncated bool              `json:"stderr_truncated"`
+	Error           string            `json:"error,omitempty"`
+	ErrorCode       string            `json:"error_code,omitempty"`
+}
+
+// parseConfigList reads `git config --list -z` output, where each entry is
+// "key\nvalue" terminated by NUL. For multi-valued keys the last value wins,
+// as with git config --get.
+func parseConfigList(out string) map[string]string {
+	entries := map[string]string{}
+	for _, e := range strings.Split(out, "\x00") {
+		if e == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(e, "\n")
+		entries[k] = v
+	}
+	return entries
+}
+
+// settableConfigKeys are the only keys git.config may set. Most other keys
+// can name programs git runs (core.fsmonitor, core.sshCommand, filters,
+// aliases, credential helpers) or rewrite where it connects (insteadOf,
+// pushurl, http.proxy), which would sidestep the exec and egress policies.
+var settableConfigKeys = map[string]bool{
+	"user.name":          true,
+	"user.email":         true,
+	"commit.gpgsign":     true,
+	"tag.gpgsign":        true,
+	"init.defaultbranch": true,
+	"core.autocrlf":      true,
+	"core.eol":           true,
+	"core.filemode":      true,
+	"core.ignorecase":    true,
+	"core.safecrlf":      true,
+	"pull.rebase":        true,
+	"pull.ff":            true,
+	"merge.ff":           true,
+	"push.default":       true,
+	"fetch.prune":        true,
+}
+
+// Config reads or writes repository-local configuration only; the global and
+// system files are shared with everything else in the container.
+func Config(ctx context.Context, in ConfigRequest) ConfigResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return ConfigResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	if in.Scope != "" && in.Scope != "local" {
+		return ConfigResponse{ExitCode: 1, Error: fmt.Sprintf("scope %q is not supported; only local config can be used", in.Scope), ErrorCode: errcode.PolicyBlocked, DurationMs: time.Since(start).Milliseconds()}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	action := in.Action
+	if action == "" {
+		action = "list"
+	}
+	if action != "list" && (in.Key == "" || strings.HasPrefix(in.Key, "-") || !strings.Contains(in.Key, ".")) {
+		return ConfigResponse{ExitCode: 1, Error: "key must be of the form section.name", ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+	}
+	var args []string
+	switch action {
+	case "list":
+		args = []string{"config", "--local", "--list", "-z"}
+	case "get":
+		args = []string{"config", "--local", "--get", in.Key}
+	case "set":
+		// section and variable names are case-insensitive in git
+		if !settableConfigKeys[strings.ToLower(in.Key)] {
+			resp := ConfigResponse{ExitCode: 1, Error: fmt.Sprintf("setting %q is not allowed", in.Key), ErrorCode: errcode.PolicyBlocked, DurationMs: time.Since(start).Milliseconds()}
+			audit(ctx, "git.config", path, []string{"config", "--local", in.Key}, resp.ExitCode, resp.DurationMs, 0, false, false)
+			return resp
+		}
+		args = []string{"config", "--local", in.Key, in.Value}
+	default:
+		return ConfigResponse{ExitCode: 1, Error: fmt.Sprintf("unsupported action %q", action), ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+	}
+	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
+	resp := ConfigResponse{
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      dur,
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	switch {
+	case action == "get" && exit == 1 && stderr == "":
+		// git config exits 1 when the key is simply not set
+	case exit != 0:
+		resp.Error = "git config failed"
+		resp.ErrorCode = errcode.ForExit(exit)
+	case action == "get":
+		resp.Value = strings.TrimSuffix(stdout, "\n")
+		resp.Found = true
+	case action == "list":
+		resp.Entries = parseConfigList(stdout)
+	}
+	audit(ctx, "git.config", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- git.merge ----
+
+type MergeRequest struct {
+	Path      string `json:"path"`
+	Ref       string `json:"ref"`
+	FFOnly    bool   `json:"ff_only,omitempty"`
+	NoFF      bool   `json:"no_ff,omitempty"`
+	Message   string `json:"message,omitempty"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+}
+
+type MergeResponse struct {
+	Stdout          string   `json:"stdout"`
+	Stderr          string   `json:"stderr"`
+	ExitCode        int      `json:"exit_code"`
+	DurationMs      int64    `json:"duration_ms"`
+	StdoutTruncated bool     `json:"stdout_truncated"`
+	StderrTruncated bool     `json:"stderr_truncated"`
+	Conflicted      bool     `json:"conflicted,omitempty"`
+	Conflicts       []string `json:"conflicts,omitempty"`
+	Error           string   `json:"error,omitempty"`
+	ErrorCode       string   `json:"error_code,omitempty"`
+}
+
+func Merge(ctx context.Context, in MergeRequest) MergeResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return MergeResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+	}
+	if in.Ref == "" || strings.HasPrefix(in.Ref, "-") {
+		return MergeResponse{ExitCode: 1, Error: "ref is required and must not start with '-'", ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+	}
+	if in.FFOnly && in.NoFF {
+		return MergeResponse{ExitCode: 1, Error: "ff_only and no_ff are mutually exclusive", ErrorCode: errcode.InvalidArgument, DurationMs: time.Since(start).Milliseconds()}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	args := []string{"merge", "--no-edit"}
+	if in.FFOnly {
+		args = append(args, "--ff-only")
+	}
+	if in.NoFF {
+		args = append(args, "--no-ff")
+	}
+	if in.Message != "" {
+		args = append(args, "-m", in.Message)
+	}
+	args = append(args, in.Ref)
+	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, path, args, timeout, limit)
+	resp := MergeResponse{
+		Stdout:          stdout,
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      dur,
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	if exit != 0 {
+		resp.Error = "git merge failed"
+		resp.ErrorCode = errcode.ForExit(exit)
+		// unmerged paths are left behind only when the merge stopped on conflicts
+		unmerged, _, _, _, _, _ := run(ctx, path, []string{"diff", "--name-only", "--diff-filter=U", "-z"}, timeout, DefaultMaxIO)
+		for _, f := range strings.Split(unmerged, "\x00") {
+			if f != "" {
+				resp.Conflicts = append(resp.Conflicts, f)
+			}
+		}
+		resp.Conflicted = len(resp.Conflicts) > 0
 	}
-	audit("git.lfs.install", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	audit(ctx, "git.merge", path, args, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
 	return resp
 }
@@ -5,7 +5,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
 )
 
 func TestCloneDisabled(t *testing.T) {
@@ -16,6 +19,38 @@ func TestCloneDisabled(t *testing.T) {
 	}
 }
 
+func TestCloneSparseDryRun(t *testing.T) {
+	t.Setenv("EGRESS", "0")
+	t.Setenv("WORKSPACE", t.TempDir())
+	resp := Clone(context.Background(), CloneRequest{
+		Repo:         "https://example.com/mono.git",
+		Branch:       "main",
+		SingleBranch: true,
+		Sparse:       []string{"svc/a", "lib"},
+		DryRun:       true,
+	})
+	want := "[dry_run] git clone --branch main --single-branch --filter=blob:none --sparse https://example.com/mono.git\n[dry_run] git sparse-checkout set svc/a lib"
+	if resp.ExitCode != 0 || resp.Stdout != want {
+		t.Fatalf("unexpected dry run %+v", resp)
+	}
+	if d := cloneDir("git@example.com:org/mono.git", ""); d != "mono" {
+		t.Fatalf("unexpected clone dir %q", d)
+	}
+}
+
+func TestFetchDisabled(t *testing.T) {
+	t.Setenv("EGRESS", "0")
+	t.Setenv("WORKSPACE", t.TempDir())
+	resp := Fetch(context.Background(), FetchRequest{Path: ".", Prune: true})
+	if resp.ExitCode == 0 {
+		t.Fatalf("expected failure when egress disabled")
+	}
+	dry := Fetch(context.Background(), FetchRequest{Path: ".", Remote: "origin", Prune: true, Tags: true, DryRun: true})
+	if dry.ExitCode != 0 || dry.Stdout != "[dry_run] git fetch --prune --tags origin" {
+		t.Fatalf("unexpected dry run %+v", dry)
+	}
+}
+
 func TestStatusAndCommit(t *testing.T) {
 	root := t.TempDir()
 	t.Setenv("WORKSPACE", root)
@@ -56,3 +91,425 @@ func TestStatusAndCommit(t *testing.T) {
 		t.Fatalf("expected clean repo, got %q", stat.Stdout)
 	}
 }
+
+func TestStatusParsed(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	dir := filepath.Join(root, "repo")
+	gitCmd := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v (%s)", args, err, out)
+		}
+	}
+	if out, err := exec.Command("git", "init", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v (%s)", err, out)
+	}
+	gitCmd("config", "user.email", "test@example.com")
+	gitCmd("config", "user.name", "Test User")
+	for _, name := range []string{"modified.txt", "old.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	gitCmd("add", ".")
+	gitCmd("commit", "-m", "init")
+	if err := os.WriteFile(filepath.Join(dir, "modified.txt"), []byte("changed"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "staged.txt"), []byte("new"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "untracked.txt"), []byte("?"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	gitCmd("add", "staged.txt")
+	gitCmd("mv", "old.txt", "new.txt")
+
+	stat := Status(context.Background(), StatusRequest{Path: dir})
+	if stat.ExitCode != 0 {
+		t.Fatalf("status exit %d: %v", stat.ExitCode, stat.Error)
+	}
+	want := map[string]StatusEntry{
+		"modified.txt":  {Path: "modified.txt", IndexStatus: " ", WorktreeStatus: "M"},
+		"new.txt":       {Path: "new.txt", IndexStatus: "R", WorktreeStatus: " ", Renamed: true, OrigPath: "old.txt"},
+		"staged.txt":    {Path: "staged.txt", IndexStatus: "A", WorktreeStatus: " "},
+		"untracked.txt": {Path: "untracked.txt", IndexStatus: "?", WorktreeStatus: "?"},
+	}
+	if len(stat.Parsed) != len(want) {
+		t.Fatalf("unexpected parsed entries %+v", stat.Parsed)
+	}
+	for _, e := range stat.Parsed {
+		if w, ok := want[e.Path]; !ok || w != e {
+			t.Fatalf("unexpected entry %+v", e)
+		}
+	}
+}
+
+func TestRemote(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	t.Setenv("EGRESS", "0")
+	dir := filepath.Join(root, "repo")
+	if out, err := exec.Command("git", "init", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v (%s)", err, out)
+	}
+	add := Remote(context.Background(), RemoteRequest{Path: dir, Action: "add", Name: "origin", URL: "https://example.com/a.git"})
+	if add.ExitCode != 0 {
+		t.Fatalf("add failed: %+v", add)
+	}
+	set := Remote(context.Background(), RemoteRequest{Path: dir, Action: "set-url", Name: "origin", URL: "https://example.com/b.git"})
+	if set.ExitCode != 0 {
+		t.Fatalf("set-url failed: %+v", set)
+	}
+	list := Remote(context.Background(), RemoteRequest{Path: dir})
+	if list.ExitCode != 0 || len(list.Remotes) != 1 {
+		t.Fatalf("unexpected list %+v", list)
+	}
+	if r := list.Remotes[0]; r.Name != "origin" || r.FetchURL != "https://example.com/b.git" || r.PushURL != "https://example.com/b.git" {
+		t.Fatalf("unexpected remote %+v", r)
+	}
+	rm := Remote(context.Background(), RemoteRequest{Path: dir, Action: "remove", Name: "origin"})
+	if rm.ExitCode != 0 {
+		t.Fatalf("remove failed: %+v", rm)
+	}
+	list = Remote(context.Background(), RemoteRequest{Path: dir})
+	if len(list.Remotes) != 0 {
+		t.Fatalf("expected no remotes, got %+v", list.Remotes)
+	}
+}
+
+func TestCommitAuthorIdentity(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	t.Setenv("HOME", root)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(k, "")
+		os.Unsetenv(k)
+	}
+	dir := filepath.Join(root, "repo")
+	if out, err := exec.Command("git", "init", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v (%s)", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if out, err := exec.Command("git", "-C", dir, "add", "a.txt").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v (%s)", err, out)
+	}
+	resp := Commit(context.Background(), CommitRequest{Path: dir, Message: "init", AuthorName: "Bot", AuthorEmail: "bot@example.com"})
+	if resp.ExitCode != 0 || resp.Commit == "" {
+		t.Fatalf("commit failed: %+v", resp)
+	}
+	out, err := exec.Command("git", "-C", dir, "log", "-1", "--format=%an <%ae>").Output()
+	if err != nil {
+		t.Fatalf("git log: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "Bot <bot@example.com>" {
+		t.Fatalf("unexpected author %q", got)
+	}
+	if out, _ := exec.Command("git", "-C", dir, "config", "user.name").Output(); len(out) != 0 {
+		t.Fatalf("repo config was mutated: %q", out)
+	}
+}
+
+func TestApply(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	dir := filepath.Join(root, "repo")
+	if out, err := exec.Command("git", "init", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v (%s)", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "old.txt"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if out, err := exec.Command("git", "-C", dir, "add", "old.txt").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v (%s)", err, out)
+	}
+	diff := "diff --git a/old.txt b/new.txt\nsimilarity index 100%\nrename from old.txt\nrename to new.txt\n"
+	check := Apply(context.Background(), GitApplyRequest{Path: dir, UnifiedDiff: diff, Check: true})
+	if check.ExitCode != 0 {
+		t.Fatalf("check failed: %+v", check)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.txt")); err != nil {
+		t.Fatalf("check should not modify tree: %v", err)
+	}
+	resp := Apply(context.Background(), GitApplyRequest{Path: dir, UnifiedDiff: diff, Index: true})
+	if resp.ExitCode != 0 {
+		t.Fatalf("apply failed: %+v", resp)
+	}
+	stat := Status(context.Background(), StatusRequest{Path: dir})
+	if len(stat.Parsed) != 1 || stat.Parsed[0].Path != "new.txt" || stat.Parsed[0].IndexStatus != "A" {
+		t.Fatalf("unexpected status %+v", stat.Parsed)
+	}
+}
+
+func TestEgressAllowHosts(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	t.Setenv("EGRESS", "1")
+	t.Setenv("GIT_ALLOW_PUSH", "1")
+	t.Setenv("EGRESS_ALLOW_HOSTS", "github.com")
+	clone := Clone(context.Background(), CloneRequest{Repo: "https://gitlab.com/org/repo.git"})
+	if !strings.Contains(clone.Error, "host not allowed") {
+		t.Fatalf("expected clone to be blocked, got %+v", clone)
+	}
+	dir := filepath.Join(root, "repo")
+	if out, err := exec.Command("git", "init", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v (%s)", err, out)
+	}
+	if out, err := exec.Command("git", "-C", dir, "remote", "add", "origin", "git@gitlab.com:org/repo.git").CombinedOutput(); err != nil {
+		t.Fatalf("git remote add: %v (%s)", err, out)
+	}
+	push := Push(context.Background(), PushRequest{Path: dir, Remote: "origin"})
+	if !strings.Contains(push.Error, "host not allowed: gitlab.com") {
+		t.Fatalf("expected push to be blocked, got %+v", push)
+	}
+	pull := Pull(context.Background(), PullRequest{Path: dir})
+	if !strings.Contains(pull.Error, "host not allowed") {
+		t.Fatalf("expected pull to be blocked, got %+v", pull)
+	}
+
+	// a pushurl on another host is checked, not the allowed fetch URL
+	if out, err := exec.Command("git", "-C", dir, "remote", "set-url", "origin", "https://github.com/org/repo.git").CombinedOutput(); err != nil {
+		t.Fatalf("git remote set-url: %v (%s)", err, out)
+	}
+	if out, err := exec.Command("git", "-C", dir, "config", "remote.origin.pushurl", "https://evil.example/org/repo.git").CombinedOutput(); err != nil {
+		t.Fatalf("git config: %v (%s)", err, out)
+	}
+	push = Push(context.Background(), PushRequest{Path: dir, Remote: "origin"})
+	if !strings.Contains(push.Error, "host not allowed: evil.example") {
+		t.Fatalf("expected push to the pushurl to be blocked, got %+v", push)
+	}
+
+	// with several pushurls every one of them is checked
+	if out, err := exec.Command("git", "-C", dir, "config", "remote.origin.pushurl", "https://github.com/org/repo.git").CombinedOutput(); err != nil {
+		t.Fatalf("git config: %v (%s)", err, out)
+	}
+	if out, err := exec.Command("git", "-C", dir, "config", "--add", "remote.origin.pushurl", "https://evil.example/org/mirror.git").CombinedOutput(); err != nil {
+		t.Fatalf("git config --add: %v (%s)", err, out)
+	}
+	push = Push(context.Background(), PushRequest{Path: dir, Remote: "origin"})
+	if !strings.Contains(push.Error, "host not allowed: evil.example") {
+		t.Fatalf("expected push to the second pushurl to be blocked, got %+v", push)
+	}
+}
+
+// initRepo creates an empty repository under a fresh workspace with a fixed
+// identity, returning its path.
+func initRepo(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	t.Setenv("HOME", root)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(k, "Tester")
+	}
+	for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(k, "tester@example.com")
+	}
+	dir := filepath.Join(root, "repo")
+	gitCmd(t, root, "init", "-q", "-b", "main", dir)
+	return dir
+}
+
+// gitCmd runs git in dir and fails the test on error.
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v (%s)", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func TestShow(t *testing.T) {
+	dir := initRepo(t)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("bee\n"), 0o644)
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "-q", "-m", "first")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("two\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("bees\n"), 0o644)
+	gitCmd(t, dir, "commit", "-q", "-am", "second\n\nmore detail")
+	gitCmd(t, dir, "tag", "-a", "v1", "-m", "release")
+
+	resp := Show(context.Background(), ShowRequest{Path: dir, Ref: "v1", File: "a.txt"})
+	if resp.Error != "" || resp.Type != "tag" || resp.Commit == nil {
+		t.Fatalf("show tag %+v", resp)
+	}
+	c := resp.Commit
+	if c.Subject != "second" || c.Body != "more detail" || c.AuthorEmail != "tester@example.com" || len(c.Parents) != 1 {
+		t.Fatalf("unexpected commit %+v", c)
+	}
+	if !strings.Contains(resp.Diff, "+two") || strings.Contains(resp.Diff, "b.txt") {
+		t.Fatalf("diff not limited to a.txt: %q", resp.Diff)
+	}
+	if resp.Target != "commit" {
+		t.Fatalf("tag target %q", resp.Target)
+	}
+	gitCmd(t, dir, "tag", "-a", "tree-tag", "HEAD^{tree}", "-m", "tree")
+	tree := Show(context.Background(), ShowRequest{Path: dir, Ref: "tree-tag"})
+	if tree.Error != "" || tree.Type != "tag" || tree.Target != "tree" || !strings.Contains(tree.Content, "a.txt") {
+		t.Fatalf("show tag on tree %+v", tree)
+	}
+	if bad := Show(context.Background(), ShowRequest{Path: dir, Ref: "tree-tag", File: "a.txt"}); bad.ErrorCode != errcode.InvalidArgument {
+		t.Fatalf("expected file on tree tag to be rejected %+v", bad)
+	}
+	blob := Show(context.Background(), ShowRequest{Path: dir, Ref: "HEAD~1:a.txt"})
+	if blob.Type != "blob" || blob.Content != "one\n" {
+		t.Fatalf("show blob %+v", blob)
+	}
+	if bad := Show(context.Background(), ShowRequest{Path: dir, Ref: "nope"}); bad.ExitCode == 0 || bad.Error == "" {
+		t.Fatalf("expected failure for unknown ref %+v", bad)
+	}
+	if bad := Show(context.Background(), ShowRequest{Path: dir, Ref: "--output=x"}); bad.ErrorCode != errcode.InvalidArgument {
+		t.Fatalf("expected option-like ref to be rejected %+v", bad)
+	}
+}
+
+func TestBlame(t *testing.T) {
+	dir := initRepo(t)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\ntwo\nthree\n"), 0o644)
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "-q", "-m", "first")
+	first := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD"))
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n2\nthree\n"), 0o644)
+	t.Setenv("GIT_AUTHOR_NAME", "Other")
+	gitCmd(t, dir, "commit", "-q", "-am", "second")
+
+	resp := Blame(context.Background(), BlameRequest{Path: dir, File: "a.txt", StartLine: 2, EndLine: 3})
+	if resp.Error != "" || len(resp.Lines) != 2 {
+		t.Fatalf("blame %+v", resp)
+	}
+	l2, l3 := resp.Lines[0], resp.Lines[1]
+	if l2.Line != 2 || l2.Content != "2" || l2.Author != "Other" || l2.Commit == first {
+		t.Fatalf("line 2 %+v", l2)
+	}
+	if l3.Line != 3 || l3.Content != "three" || l3.Author != "Tester" || l3.Commit != first || l3.Timestamp == "" {
+		t.Fatalf("line 3 %+v", l3)
+	}
+	if bad := Blame(context.Background(), BlameRequest{Path: dir, File: "../outside.txt"}); bad.ErrorCode != errcode.PathEscape {
+		t.Fatalf("expected path escape %+v", bad)
+	}
+}
+
+func TestInit(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	t.Setenv("HOME", root)
+	resp := Init(context.Background(), InitRequest{Path: "new/repo", InitialBranch: "trunk"})
+	if resp.Error != "" || !resp.Created {
+		t.Fatalf("init %+v", resp)
+	}
+	dir := filepath.Join(root, "new", "repo")
+	if head := strings.TrimSpace(gitCmd(t, dir, "symbolic-ref", "HEAD")); head != "refs/heads/trunk" {
+		t.Fatalf("unexpected HEAD %q", head)
+	}
+	if again := Init(context.Background(), InitRequest{Path: "new/repo"}); again.Error != "" || again.Created {
+		t.Fatalf("reinit should not report created %+v", again)
+	}
+	bare := Init(context.Background(), InitRequest{Path: "remote.git", Bare: true})
+	if bare.Error != "" || !bare.Created {
+		t.Fatalf("bare init %+v", bare)
+	}
+	if out := strings.TrimSpace(gitCmd(t, filepath.Join(root, "remote.git"), "rev-parse", "--is-bare-repository")); out != "true" {
+		t.Fatalf("expected bare repo, got %q", out)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	dir := initRepo(t)
+	ctx := context.Background()
+	if resp := Config(ctx, ConfigRequest{Path: dir, Action: "get", Key: "user.name"}); resp.Error != "" || resp.Found {
+		t.Fatalf("unset key %+v", resp)
+	}
+	if resp := Config(ctx, ConfigRequest{Path: dir, Action: "set", Key: "user.name", Value: "Repo Bot"}); resp.Error != "" {
+		t.Fatalf("set %+v", resp)
+	}
+	if resp := Config(ctx, ConfigRequest{Path: dir, Action: "get", Key: "user.name"}); !resp.Found || resp.Value != "Repo Bot" {
+		t.Fatalf("get %+v", resp)
+	}
+	list := Config(ctx, ConfigRequest{Path: dir})
+	if list.Error != "" || list.Entries["user.name"] != "Repo Bot" || list.Entries["core.bare"] != "false" {
+		t.Fatalf("list %+v", list)
+	}
+	if resp := Config(ctx, ConfigRequest{Path: dir, Action: "set", Key: "user.name", Value: "x", Scope: "global"}); resp.ErrorCode != errcode.PolicyBlocked {
+		t.Fatalf("expected global scope to be rejected %+v", resp)
+	}
+	if resp := Config(ctx, ConfigRequest{Path: dir, Action: "set", Key: "--global"}); resp.ErrorCode != errcode.InvalidArgument {
+		t.Fatalf("expected option-like key to be rejected %+v", resp)
+	}
+	for _, key := range []string{"core.fsmonitor", "Core.FSMonitor", "url.https://evil.example/.insteadOf", "remote.origin.pushurl"} {
+		if resp := Config(ctx, ConfigRequest{Path: dir, Action: "set", Key: key, Value: "x"}); resp.ErrorCode != errcode.PolicyBlocked {
+			t.Fatalf("expected %s to be refused %+v", key, resp)
+		}
+	}
+	if resp := Config(ctx, ConfigRequest{Path: dir, Action: "get", Key: "core.fsmonitor"}); resp.Found {
+		t.Fatalf("refused key was written %+v", resp)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dir := initRepo(t)
+	ctx := context.Background()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("base\n"), 0o644)
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "-q", "-m", "base")
+	gitCmd(t, dir, "checkout", "-q", "-b", "feature")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("feature\n"), 0o644)
+	gitCmd(t, dir, "commit", "-q", "-am", "feature")
+	gitCmd(t, dir, "checkout", "-q", "main")
+
+	if resp := Merge(ctx, MergeRequest{Path: dir, Ref: "feature", FFOnly: true}); resp.ExitCode != 0 || resp.Conflicted {
+		t.Fatalf("fast-forward merge %+v", resp)
+	}
+
+	gitCmd(t, dir, "checkout", "-q", "-b", "other", "HEAD~1")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("other\n"), 0o644)
+	gitCmd(t, dir, "commit", "-q", "-am", "other")
+	gitCmd(t, dir, "checkout", "-q", "main")
+	if resp := Merge(ctx, MergeRequest{Path: dir, Ref: "other", FFOnly: true}); resp.ExitCode == 0 || resp.Conflicted {
+		t.Fatalf("ff-only should refuse diverged history without conflicts %+v", resp)
+	}
+	resp := Merge(ctx, MergeRequest{Path: dir, Ref: "other", NoFF: true, Message: "merge other"})
+	if resp.ExitCode == 0 || !resp.Conflicted || len(resp.Conflicts) != 1 || resp.Conflicts[0] != "a.txt" {
+		t.Fatalf("expected conflict on a.txt %+v", resp)
+	}
+	if bad := Merge(ctx, MergeRequest{Path: dir, Ref: "other", FFOnly: true, NoFF: true}); bad.ErrorCode != errcode.InvalidArgument {
+		t.Fatalf("expected conflicting flags to be rejected %+v", bad)
+	}
+}
+
+func TestBranchVerbose(t *testing.T) {
+	dir := initRepo(t)
+	ctx := context.Background()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("base\n"), 0o644)
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "-q", "-m", "base")
+	gitCmd(t, dir, "checkout", "-q", "-b", "feature", "--track", "main")
+	gitCmd(t, dir, "commit", "-q", "--allow-empty", "-m", "feature")
+	gitCmd(t, dir, "checkout", "-q", "main")
+	gitCmd(t, dir, "commit", "-q", "--allow-empty", "-m", "main 1")
+	gitCmd(t, dir, "commit", "-q", "--allow-empty", "-m", "main 2")
+
+	resp := Branch(ctx, BranchRequest{Path: dir, Verbose: true})
+	if resp.Error != "" || len(resp.Branches) != 2 || len(resp.Details) != 2 {
+		t.Fatalf("unexpected branch resp %+v", resp)
+	}
+	want := []BranchInfo{
+		{Name: "feature", Upstream: "main", Ahead: 1, Behind: 2},
+		{Name: "main", Current: true},
+	}
+	for i, b := range resp.Details {
+		if b != want[i] {
+			t.Fatalf("branch %d = %+v, want %+v", i, b, want[i])
+		}
+	}
+	if plain := Branch(ctx, BranchRequest{Path: dir}); plain.Details != nil {
+		t.Fatalf("details without verbose %+v", plain)
+	}
+}
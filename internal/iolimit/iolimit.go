@@ -0,0 +1,44 @@
+// Package iolimit provides the default cap on captured output, applied per
+// stream (stdout and stderr) by the tools that run processes. It is 1 MiB
+// unless MCP_MAX_IO_BYTES sets another positive byte count; a request's own
+// max_bytes still takes precedence.
+//
+// Output is buffered in memory up to the cap, so a tool call can hold about
+// twice the value (one buffer per stream), times the number of calls running
+// concurrently.
+package iolimit
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Fallback is the cap used when MCP_MAX_IO_BYTES is unset or invalid.
+const Fallback = 1 << 20 // 1 MiB
+
+var (
+	once  sync.Once
+	value int
+)
+
+// Default returns the configured per-stream cap in bytes. The environment is
+// read once per process, so an invalid value is reported a single time
+// however many packages ask.
+func Default() int {
+	once.Do(func() { value = parse(os.Getenv("MCP_MAX_IO_BYTES")) })
+	return value
+}
+
+func parse(v string) int {
+	if v == "" {
+		return Fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("ignoring MCP_MAX_IO_BYTES=%q: must be a positive byte count", v)
+		return Fallback
+	}
+	return n
+}
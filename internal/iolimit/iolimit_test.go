@@ -0,0 +1,29 @@
+package iolimit
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		env  string
+		want int
+	}{
+		{"", Fallback},
+		{"4096", 4096},
+		{"0", Fallback},
+		{"-1", Fallback},
+		{"lots", Fallback},
+	} {
+		if got := parse(tc.env); got != tc.want {
+			t.Fatalf("MCP_MAX_IO_BYTES=%q: got %d, want %d", tc.env, got, tc.want)
+		}
+	}
+}
+
+func TestDefaultReadsOnce(t *testing.T) {
+	t.Setenv("MCP_MAX_IO_BYTES", "4096")
+	first := Default()
+	t.Setenv("MCP_MAX_IO_BYTES", "8192")
+	if got := Default(); got != first {
+		t.Fatalf("Default changed from %d to %d after the first call", first, got)
+	}
+}
@@ -5,18 +5,29 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/execx"
 )
 
 const (
-	LogPath         = "/logs/mcp-shell.log"
 	defaultMaxBytes = 1 << 20 // 1 MiB
+	// DefaultTimeout bounds a single conversion when timeout_ms is not set.
+	DefaultTimeout = 5 * time.Minute
 )
 
 func workspaceRoot() string {
@@ -50,38 +61,36 @@ func normalizePath(p string) (string, error) {
 	return p, nil
 }
 
-func audit(rec any) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-	_ = json.NewEncoder(f).Encode(rec)
+func audit(ctx context.Context, rec any) {
+	auditlog.Write(ctx, rec)
 }
 
 // ---- image.convert ----
 
+// ImageOp is one step of an image.convert chain. Ops run in slice order;
+// within one op, auto_orient runs first, then resize, crop, rotate, flip_h,
+// flip_v and quality.
 type ImageOp struct {
-	Resize  string `json:"resize,omitempty"`
-	Crop    string `json:"crop,omitempty"`
-	Format  string `json:"format,omitempty"`
-	Quality int    `json:"quality,omitempty"`
+	Resize     string `json:"resize,omitempty"`
+	Crop       string `json:"crop,omitempty"`
+	Format     string `json:"format,omitempty"`
+	Quality    int    `json:"quality,omitempty"`
+	Rotate     int    `json:"rotate,omitempty"`
+	FlipH      bool   `json:"flip_h,omitempty"`
+	FlipV      bool   `json:"flip_v,omitempty"`
+	AutoOrient bool   `json:"auto_orient,omitempty"`
 }
 
 type ImageConvertRequest struct {
-	SrcPath  string    `json:"src_path"`
-	DestPath string    `json:"dest_path"`
-	Ops      []ImageOp `json:"ops,omitempty"`
+	SrcPath   string    `json:"src_path"`
+	DestPath  string    `json:"dest_path"`
+	Ops       []ImageOp `json:"ops,omitempty"`
+	TimeoutMs int       `json:"timeout_ms,omitempty"`
 }
 
 type ImageConvertResponse struct {
 	DestPath   string `json:"dest_path"`
+	ExitCode   int    `json:"exit_code,omitempty"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
 }
@@ -98,27 +107,41 @@ func ImageConvert(ctx context.Context, in ImageConvertRequest) ImageConvertRespo
 	}
 	args := []string{src}
 	for _, op := range in.Ops {
+		if op.AutoOrient {
+			args = append(args, "-auto-orient")
+		}
 		if op.Resize != "" {
 			args = append(args, "-resize", op.Resize)
 		}
 		if op.Crop != "" {
 			args = append(args, "-crop", op.Crop)
 		}
+		if op.Rotate != 0 {
+			args = append(args, "-rotate", strconv.Itoa(op.Rotate))
+		}
+		if op.FlipH {
+			args = append(args, "-flop")
+		}
+		if op.FlipV {
+			args = append(args, "-flip")
+		}
 		if op.Quality > 0 {
 			args = append(args, "-quality", strconv.Itoa(op.Quality))
 		}
 	}
 	args = append(args, dest)
+	ctx, cancel := execx.WithTimeout(ctx, in.TimeoutMs, DefaultTimeout)
+	defer cancel()
 	cmd := exec.CommandContext(ctx, "convert", args...)
 	var stderr bytes.Buffer
 	cmd.Stdout = io.Discard
 	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return ImageConvertResponse{DurationMs: time.Since(start).Milliseconds(), Error: stderr.String()}
+	if exit, err := execx.Run(ctx, cmd); err != nil {
+		return ImageConvertResponse{ExitCode: exit, DurationMs: time.Since(start).Milliseconds(), Error: execx.ErrorText(err, &stderr)}
 	}
 	resp := ImageConvertResponse{DestPath: dest}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Src        string `json:"src"`
@@ -128,19 +151,327 @@ func ImageConvert(ctx context.Context, in ImageConvertRequest) ImageConvertRespo
 	return resp
 }
 
+// ---- image.metadata ----
+
+type ImageMetadataRequest struct {
+	Path string `json:"path"`
+}
+
+type ImageMetadataResponse struct {
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Format      string `json:"format"`
+	ColorSpace  string `json:"color_space,omitempty"`
+	Orientation int    `json:"orientation,omitempty"`
+	DurationMs  int64  `json:"duration_ms"`
+	Error       string `json:"error,omitempty"`
+}
+
+// identifyFormat asks ImageMagick for dimensions, format, colorspace and the
+// EXIF orientation (1-8) of the first frame.
+const identifyFormat = "%w|%h|%m|%[colorspace]|%[EXIF:Orientation]"
+
+func parseIdentify(out string) (ImageMetadataResponse, error) {
+	fields := strings.Split(strings.TrimSpace(out), "|")
+	if len(fields) < 5 {
+		return ImageMetadataResponse{}, errors.New("unexpected identify output")
+	}
+	w, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return ImageMetadataResponse{}, err
+	}
+	h, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return ImageMetadataResponse{}, err
+	}
+	resp := ImageMetadataResponse{Width: w, Height: h, Format: strings.ToLower(fields[2]), ColorSpace: fields[3]}
+	resp.Orientation, _ = strconv.Atoi(fields[4])
+	return resp, nil
+}
+
+func ImageMetadata(ctx context.Context, in ImageMetadataRequest) ImageMetadataResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return ImageMetadataResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	var resp ImageMetadataResponse
+	if _, lookErr := exec.LookPath("identify"); lookErr == nil {
+		cmd := exec.CommandContext(ctx, "identify", "-format", identifyFormat, path+"[0]")
+		var out, stderr bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return ImageMetadataResponse{DurationMs: time.Since(start).Milliseconds(), Error: stderr.String()}
+		}
+		if resp, err = parseIdentify(out.String()); err != nil {
+			return ImageMetadataResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+	} else {
+		// without ImageMagick, fall back to the stdlib decoders (no EXIF)
+		f, err := os.Open(path)
+		if err != nil {
+			return ImageMetadataResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		cfg, format, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			return ImageMetadataResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		resp = ImageMetadataResponse{Width: cfg.Width, Height: cfg.Height, Format: format}
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path"`
+		DurationMs int64  `json:"duration_ms"`
+		Format     string `json:"format"`
+	}{time.Now().UTC().Format(time.RFC3339), "image.metadata", path, resp.DurationMs, resp.Format})
+	return resp
+}
+
+// ---- image.compose ----
+
+// ComposeRequest overlays either another image (Overlay) or a line of text
+// (Text) on Base and writes the result to Dest.
+type ComposeRequest struct {
+	Base      string  `json:"base"`
+	Overlay   string  `json:"overlay,omitempty"`
+	Text      string  `json:"text,omitempty"`
+	Dest      string  `json:"dest"`
+	Gravity   string  `json:"gravity,omitempty"`   // default southeast
+	Opacity   float64 `json:"opacity,omitempty"`   // 0-1, default 1
+	Margin    int     `json:"margin,omitempty"`    // pixels from the gravity edge
+	FontSize  int     `json:"font_size,omitempty"` // text only, default 24
+	Color     string  `json:"color,omitempty"`     // text only, default white
+	TimeoutMs int     `json:"timeout_ms,omitempty"`
+}
+
+type ComposeResponse struct {
+	DestPath   string `json:"dest_path"`
+	ExitCode   int    `json:"exit_code,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+var gravities = map[string]string{
+	"northwest": "NorthWest", "north": "North", "northeast": "NorthEast",
+	"west": "West", "center": "Center", "east": "East",
+	"southwest": "SouthWest", "south": "South", "southeast": "SouthEast",
+}
+
+// composeArgs builds the convert arguments. The overlay, an image or text
+// rendered on a transparent label, is blended with the dissolve operator so
+// opacity applies to both the same way.
+func composeArgs(base, overlay, dest string, in ComposeRequest) ([]string, error) {
+	if (overlay == "") == (in.Text == "") {
+		return nil, errors.New("exactly one of overlay or text is required")
+	}
+	gravity := "SouthEast"
+	if in.Gravity != "" {
+		g, ok := gravities[strings.ToLower(in.Gravity)]
+		if !ok {
+			return nil, fmt.Errorf("unknown gravity %q", in.Gravity)
+		}
+		gravity = g
+	}
+	opacity := in.Opacity
+	if opacity == 0 {
+		opacity = 1
+	}
+	if opacity < 0 || opacity > 1 {
+		return nil, errors.New("opacity must be between 0 and 1")
+	}
+	if in.Margin < 0 || in.FontSize < 0 {
+		return nil, errors.New("margin and font_size must not be negative")
+	}
+	args := []string{base, "("}
+	if overlay != "" {
+		args = append(args, overlay)
+	} else {
+		size := in.FontSize
+		if size == 0 {
+			size = 24
+		}
+		color := in.Color
+		if color == "" {
+			color = "white"
+		}
+		// label: expands % escapes and reads a file for a leading @
+		text := strings.ReplaceAll(in.Text, "%", "%%")
+		if strings.HasPrefix(text, "@") {
+			text = `\` + text
+		}
+		args = append(args, "-background", "none", "-fill", color, "-pointsize", strconv.Itoa(size), "label:"+text)
+	}
+	args = append(args, ")",
+		"-gravity", gravity,
+		"-geometry", fmt.Sprintf("+%d+%d", in.Margin, in.Margin),
+		"-compose", "dissolve",
+		"-define", "compose:args="+strconv.FormatFloat(opacity*100, 'f', -1, 64),
+		"-composite", dest)
+	return args, nil
+}
+
+func ImageCompose(ctx context.Context, in ComposeRequest) ComposeResponse {
+	start := time.Now()
+	base, err := normalizePath(in.Base)
+	if err != nil {
+		return ComposeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	dest, err := normalizePath(in.Dest)
+	if err != nil {
+		return ComposeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	overlay := ""
+	if in.Overlay != "" {
+		if overlay, err = normalizePath(in.Overlay); err != nil {
+			return ComposeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+	}
+	args, err := composeArgs(base, overlay, dest, in)
+	if err != nil {
+		return ComposeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	ctx, cancel := execx.WithTimeout(ctx, in.TimeoutMs, DefaultTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "convert", args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+	if exit, err := execx.Run(ctx, cmd); err != nil {
+		return ComposeResponse{ExitCode: exit, DurationMs: time.Since(start).Milliseconds(), Error: execx.ErrorText(err, &stderr)}
+	}
+	resp := ComposeResponse{DestPath: dest}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Base       string `json:"base"`
+		Overlay    string `json:"overlay,omitempty"`
+		Text       bool   `json:"text,omitempty"`
+		Dest       string `json:"dest"`
+		DurationMs int64  `json:"duration_ms"`
+	}{time.Now().UTC().Format(time.RFC3339), "image.compose", base, overlay, in.Text != "", dest, resp.DurationMs})
+	return resp
+}
+
+// ---- gif.create ----
+
+// MaxGifFrames bounds how many frames one gif.create call may assemble.
+const MaxGifFrames = 500
+
+// GifRequest takes frames either from SrcGlob, in lexical order, or from
+// Frames in the order given.
+type GifRequest struct {
+	SrcGlob   string   `json:"src_glob,omitempty"`
+	Frames    []string `json:"frames,omitempty"`
+	Dest      string   `json:"dest"`
+	DelayMs   int      `json:"delay_ms,omitempty"` // per frame, default 100
+	Loop      int      `json:"loop,omitempty"`     // 0 loops forever
+	TimeoutMs int      `json:"timeout_ms,omitempty"`
+}
+
+type GifResponse struct {
+	DestPath   string `json:"dest_path"`
+	Frames     int    `json:"frames"`
+	ExitCode   int    `json:"exit_code,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// gifFrames resolves the request's frames to workspace paths.
+func gifFrames(in GifRequest) ([]string, error) {
+	if (in.SrcGlob == "") == (len(in.Frames) == 0) {
+		return nil, errors.New("exactly one of src_glob or frames is required")
+	}
+	var frames []string
+	if in.SrcGlob != "" {
+		pattern, err := normalizePath(in.SrcGlob)
+		if err != nil {
+			return nil, err
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %q", in.SrcGlob)
+		}
+		frames = matches
+	} else {
+		for _, f := range in.Frames {
+			p, err := normalizePath(f)
+			if err != nil {
+				return nil, err
+			}
+			frames = append(frames, p)
+		}
+	}
+	if len(frames) > MaxGifFrames {
+		return nil, fmt.Errorf("%d frames exceeds the limit of %d", len(frames), MaxGifFrames)
+	}
+	return frames, nil
+}
+
+func GifCreate(ctx context.Context, in GifRequest) GifResponse {
+	start := time.Now()
+	dest, err := normalizePath(in.Dest)
+	if err != nil {
+		return GifResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	if in.DelayMs < 0 || in.Loop < 0 {
+		return GifResponse{DurationMs: time.Since(start).Milliseconds(), Error: "delay_ms and loop must not be negative"}
+	}
+	frames, err := gifFrames(in)
+	if err != nil {
+		return GifResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	delay := in.DelayMs
+	if delay == 0 {
+		delay = 100
+	}
+	// -delay takes ticks; a 1000 ticks-per-second suffix makes them milliseconds
+	args := []string{"-delay", strconv.Itoa(delay) + "x1000", "-loop", strconv.Itoa(in.Loop)}
+	args = append(args, frames...)
+	args = append(args, "gif:"+dest)
+	ctx, cancel := execx.WithTimeout(ctx, in.TimeoutMs, DefaultTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "convert", args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+	if exit, err := execx.Run(ctx, cmd); err != nil {
+		return GifResponse{ExitCode: exit, DurationMs: time.Since(start).Milliseconds(), Error: execx.ErrorText(err, &stderr)}
+	}
+	resp := GifResponse{DestPath: dest, Frames: len(frames)}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Dest       string `json:"dest"`
+		Frames     int    `json:"frames"`
+		DurationMs int64  `json:"duration_ms"`
+	}{time.Now().UTC().Format(time.RFC3339), "gif.create", dest, len(frames), resp.DurationMs})
+	return resp
+}
+
 // ---- video.transcode ----
 
 type VideoTranscodeRequest struct {
-	Src      string `json:"src"`
-	Dest     string `json:"dest"`
-	Codec    string `json:"codec,omitempty"`
-	Crf      int    `json:"crf,omitempty"`
-	Start    string `json:"start,omitempty"`
-	Duration string `json:"duration,omitempty"`
+	Src       string `json:"src"`
+	Dest      string `json:"dest"`
+	Codec     string `json:"codec,omitempty"`
+	Crf       int    `json:"crf,omitempty"`
+	Start     string `json:"start,omitempty"`
+	Duration  string `json:"duration,omitempty"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
 }
 
 type VideoTranscodeResponse struct {
 	DestPath   string `json:"dest"`
+	ExitCode   int    `json:"exit_code,omitempty"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
 }
@@ -170,16 +501,18 @@ func VideoTranscode(ctx context.Context, in VideoTranscodeRequest) VideoTranscod
 		args = append(args, "-crf", strconv.Itoa(in.Crf))
 	}
 	args = append(args, dest)
+	ctx, cancel := execx.WithTimeout(ctx, in.TimeoutMs, DefaultTimeout)
+	defer cancel()
 	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
 	var stderr bytes.Buffer
 	cmd.Stdout = io.Discard
 	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return VideoTranscodeResponse{DurationMs: time.Since(start).Milliseconds(), Error: stderr.String()}
+	if exit, err := execx.Run(ctx, cmd); err != nil {
+		return VideoTranscodeResponse{ExitCode: exit, DurationMs: time.Since(start).Milliseconds(), Error: execx.ErrorText(err, &stderr)}
 	}
 	resp := VideoTranscodeResponse{DestPath: dest}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Src        string `json:"src"`
@@ -189,6 +522,317 @@ func VideoTranscode(ctx context.Context, in VideoTranscodeRequest) VideoTranscod
 	return resp
 }
 
+// ---- video.concat ----
+
+type ConcatRequest struct {
+	Srcs      []string `json:"srcs"`
+	Dest      string   `json:"dest"`
+	ReEncode  bool     `json:"re_encode,omitempty"` // transcode instead of copying streams
+	TimeoutMs int      `json:"timeout_ms,omitempty"`
+}
+
+type ConcatResponse struct {
+	DestPath   string `json:"dest"`
+	ExitCode   int    `json:"exit_code,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// concatList renders the input list for ffmpeg's concat demuxer, quoting
+// each path so spaces and quotes in file names survive. Paths must not hold
+// control characters; VideoConcat rejects them before calling it.
+func concatList(paths []string) string {
+	var b strings.Builder
+	for _, p := range paths {
+		b.WriteString("file '" + strings.ReplaceAll(p, "'", `'\''`) + "'\n")
+	}
+	return b.String()
+}
+
+// VideoConcat joins clips end to end. Without ReEncode the streams are
+// copied, which is fast but needs every clip to share codecs and parameters.
+func VideoConcat(ctx context.Context, in ConcatRequest) ConcatResponse {
+	start := time.Now()
+	if len(in.Srcs) < 2 {
+		return ConcatResponse{DurationMs: time.Since(start).Milliseconds(), Error: "at least two srcs are required"}
+	}
+	srcs := make([]string, 0, len(in.Srcs))
+	for _, s := range in.Srcs {
+		// a line break would start a new directive in the list file
+		if strings.IndexFunc(s, unicode.IsControl) >= 0 {
+			return ConcatResponse{DurationMs: time.Since(start).Milliseconds(), Error: fmt.Sprintf("src %q contains control characters", s)}
+		}
+		p, err := normalizePath(s)
+		if err != nil {
+			return ConcatResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		srcs = append(srcs, p)
+	}
+	dest, err := normalizePath(in.Dest)
+	if err != nil {
+		return ConcatResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	list, err := os.CreateTemp("", "concat-*.txt")
+	if err != nil {
+		return ConcatResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	defer os.Remove(list.Name())
+	_, err = list.WriteString(concatList(srcs))
+	if cerr := list.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return ConcatResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	// -safe 0 admits absolute paths; they were confined to the workspace above
+	args := []string{"-y", "-f", "concat", "-safe", "0", "-i", list.Name()}
+	if !in.ReEncode {
+		args = append(args, "-c", "copy")
+	}
+	args = append(args, dest)
+	ctx, cancel := execx.WithTimeout(ctx, in.TimeoutMs, DefaultTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+	if exit, err := execx.Run(ctx, cmd); err != nil {
+		return ConcatResponse{ExitCode: exit, DurationMs: time.Since(start).Milliseconds(), Error: execx.ErrorText(err, &stderr)}
+	}
+	resp := ConcatResponse{DestPath: dest}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string   `json:"ts"`
+		Tool       string   `json:"tool"`
+		Srcs       []string `json:"srcs"`
+		Dest       string   `json:"dest"`
+		ReEncode   bool     `json:"re_encode,omitempty"`
+		DurationMs int64    `json:"duration_ms"`
+	}{time.Now().UTC().Format(time.RFC3339), "video.concat", srcs, dest, in.ReEncode, resp.DurationMs})
+	return resp
+}
+
+// ---- video.metadata ----
+
+type VideoMetadataRequest struct {
+	Path string `json:"path"`
+}
+
+type StreamInfo struct {
+	Index      int    `json:"index"`
+	Type       string `json:"type"`
+	Codec      string `json:"codec"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	FrameRate  string `json:"frame_rate,omitempty"`
+	SampleRate int    `json:"sample_rate,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+	BitRate    int64  `json:"bit_rate,omitempty"`
+}
+
+type VideoMetadataResponse struct {
+	Duration   float64      `json:"duration"`
+	Container  string       `json:"container"`
+	BitRate    int64        `json:"bit_rate,omitempty"`
+	Size       int64        `json:"size,omitempty"`
+	Streams    []StreamInfo `json:"streams"`
+	DurationMs int64        `json:"duration_ms"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// parseFFProbe decodes ffprobe's JSON. ffprobe reports numeric format and
+// stream fields as strings, so they are converted here.
+func parseFFProbe(data []byte) (VideoMetadataResponse, error) {
+	var probe struct {
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+			BitRate    string `json:"bit_rate"`
+			Size       string `json:"size"`
+		} `json:"format"`
+		Streams []struct {
+			Index      int    `json:"index"`
+			CodecType  string `json:"codec_type"`
+			CodecName  string `json:"codec_name"`
+			Width      int    `json:"width"`
+			Height     int    `json:"height"`
+			FrameRate  string `json:"r_frame_rate"`
+			SampleRate string `json:"sample_rate"`
+			Channels   int    `json:"channels"`
+			BitRate    string `json:"bit_rate"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return VideoMetadataResponse{}, err
+	}
+	resp := VideoMetadataResponse{Container: probe.Format.FormatName, Streams: []StreamInfo{}}
+	resp.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	resp.BitRate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+	resp.Size, _ = strconv.ParseInt(probe.Format.Size, 10, 64)
+	for _, st := range probe.Streams {
+		info := StreamInfo{Index: st.Index, Type: st.CodecType, Codec: st.CodecName, Width: st.Width, Height: st.Height, Channels: st.Channels}
+		if st.CodecType == "video" {
+			info.FrameRate = st.FrameRate
+		}
+		info.SampleRate, _ = strconv.Atoi(st.SampleRate)
+		info.BitRate, _ = strconv.ParseInt(st.BitRate, 10, 64)
+		resp.Streams = append(resp.Streams, info)
+	}
+	return resp, nil
+}
+
+func VideoMetadata(ctx context.Context, in VideoMetadataRequest) VideoMetadataResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return VideoMetadataResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return VideoMetadataResponse{DurationMs: time.Since(start).Milliseconds(), Error: stderr.String()}
+	}
+	resp, err := parseFFProbe(out.Bytes())
+	if err != nil {
+		return VideoMetadataResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path"`
+		DurationMs int64  `json:"duration_ms"`
+		Container  string `json:"container"`
+		Streams    int    `json:"streams"`
+	}{time.Now().UTC().Format(time.RFC3339), "video.metadata", path, resp.DurationMs, resp.Container, len(resp.Streams)})
+	return resp
+}
+
+// ---- video.thumbnail ----
+
+type ThumbnailRequest struct {
+	Src   string `json:"src"`
+	Dest  string `json:"dest"`
+	At    string `json:"at,omitempty"`
+	Width int    `json:"width,omitempty"`
+}
+
+type ThumbnailResponse struct {
+	DestPath   string `json:"dest"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+func VideoThumbnail(ctx context.Context, in ThumbnailRequest) ThumbnailResponse {
+	start := time.Now()
+	src, err := normalizePath(in.Src)
+	if err != nil {
+		return ThumbnailResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	dest, err := normalizePath(in.Dest)
+	if err != nil {
+		return ThumbnailResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	if in.Width < 0 {
+		return ThumbnailResponse{DurationMs: time.Since(start).Milliseconds(), Error: "width must be positive"}
+	}
+	args := []string{"-y"}
+	if in.At != "" {
+		args = append(args, "-ss", in.At)
+	}
+	args = append(args, "-i", src, "-frames:v", "1")
+	if in.Width > 0 {
+		// -2 keeps the aspect ratio with an even height
+		args = append(args, "-vf", "scale="+strconv.Itoa(in.Width)+":-2")
+	}
+	args = append(args, dest)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return ThumbnailResponse{DurationMs: time.Since(start).Milliseconds(), Error: stderr.String()}
+	}
+	resp := ThumbnailResponse{DestPath: dest}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Src        string `json:"src"`
+		Dest       string `json:"dest"`
+		At         string `json:"at,omitempty"`
+		DurationMs int64  `json:"duration_ms"`
+	}{time.Now().UTC().Format(time.RFC3339), "video.thumbnail", src, dest, in.At, resp.DurationMs})
+	return resp
+}
+
+// ---- audio.extract ----
+
+type AudioExtractRequest struct {
+	Src     string `json:"src"`
+	Dest    string `json:"dest"`
+	Format  string `json:"format,omitempty"`
+	Bitrate string `json:"bitrate,omitempty"`
+}
+
+type AudioExtractResponse struct {
+	DestPath   string `json:"dest"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// audioCodecs is the allow-list of output formats and their ffmpeg encoders.
+var audioCodecs = map[string]string{
+	"mp3":  "libmp3lame",
+	"wav":  "pcm_s16le",
+	"flac": "flac",
+}
+
+func AudioExtract(ctx context.Context, in AudioExtractRequest) AudioExtractResponse {
+	start := time.Now()
+	src, err := normalizePath(in.Src)
+	if err != nil {
+		return AudioExtractResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	dest, err := normalizePath(in.Dest)
+	if err != nil {
+		return AudioExtractResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	format := strings.ToLower(in.Format)
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(dest)), ".")
+	}
+	codec, ok := audioCodecs[format]
+	if !ok {
+		return AudioExtractResponse{DurationMs: time.Since(start).Milliseconds(), Error: "format must be mp3, wav or flac"}
+	}
+	args := []string{"-y", "-i", src, "-vn", "-acodec", codec}
+	if in.Bitrate != "" {
+		args = append(args, "-b:a", in.Bitrate)
+	}
+	args = append(args, "-f", format, dest)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return AudioExtractResponse{DurationMs: time.Since(start).Milliseconds(), Error: stderr.String()}
+	}
+	resp := AudioExtractResponse{DestPath: dest}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Src        string `json:"src"`
+		Dest       string `json:"dest"`
+		Format     string `json:"format"`
+		DurationMs int64  `json:"duration_ms"`
+	}{time.Now().UTC().Format(time.RFC3339), "audio.extract", src, dest, format, resp.DurationMs})
+	return resp
+}
+
 // ---- ocr.extract ----
 
 type OCRRequest struct {
@@ -200,47 +844,175 @@ type OCRRequest struct {
 type OCRResponse struct {
 	Text       string `json:"text"`
 	Truncated  bool   `json:"truncated"`
+	Pages      int    `json:"pages,omitempty"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
 }
 
+// parseLangList reads `tesseract --list-langs` output, skipping the
+// "List of available languages" header.
+func parseLangList(out string) []string {
+	var langs []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "List of") {
+			continue
+		}
+		langs = append(langs, line)
+	}
+	return langs
+}
+
+// checkLangs verifies every "+"-joined component of lang is installed.
+func checkLangs(ctx context.Context, lang string) error {
+	cmd := exec.CommandContext(ctx, "tesseract", "--list-langs")
+	var out bytes.Buffer
+	// older tesseract releases print the list on stderr
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	available := parseLangList(out.String())
+	for _, l := range strings.Split(lang, "+") {
+		if l == "" {
+			return fmt.Errorf("invalid lang %q", lang)
+		}
+		found := false
+		for _, a := range available {
+			if a == l {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("language %q not installed; available: %s", l, strings.Join(available, ", "))
+		}
+	}
+	return nil
+}
+
+// isPDF sniffs the file header rather than trusting the extension.
+func isPDF(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	return http.DetectContentType(head[:n]) == "application/pdf"
+}
+
+func tesseract(ctx context.Context, path, lang string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "tesseract", path, "stdout", "-l", lang)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.New(stderr.String())
+	}
+	return out.Bytes(), nil
+}
+
+// pdfPageCount reads the page count from pdfinfo.
+func pdfPageCount(ctx context.Context, path string) (int, error) {
+	cmd := exec.CommandContext(ctx, "pdfinfo", path)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, errors.New(stderr.String())
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		var n int
+		if _, err := fmt.Sscanf(strings.TrimSpace(line), "Pages: %d", &n); err == nil {
+			return n, nil
+		}
+	}
+	return 0, errors.New("pdfinfo reported no page count")
+}
+
+// ocrPDF rasterizes and OCRs one page at a time with pdftoppm -f/-l, joining
+// pages with a separator. It stops once the combined text exceeds limit, so
+// pages past that point are never rendered.
+func ocrPDF(ctx context.Context, path, lang string, limit int64) ([]byte, int, error) {
+	count, err := pdfPageCount(ctx, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	tmp, err := os.MkdirTemp("", "mcp-ocr-")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer os.RemoveAll(tmp)
+	var buf bytes.Buffer
+	pages := 0
+	for page := 1; page <= count && int64(buf.Len()) <= limit; page++ {
+		n := strconv.Itoa(page)
+		cmd := exec.CommandContext(ctx, "pdftoppm", "-png", "-r", "300", "-f", n, "-l", n, "-singlefile", path, filepath.Join(tmp, "page"))
+		var stderr bytes.Buffer
+		cmd.Stdout = io.Discard
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, pages, errors.New(stderr.String())
+		}
+		img := filepath.Join(tmp, "page.png")
+		text, err := tesseract(ctx, img, lang)
+		os.Remove(img)
+		if err != nil {
+			return nil, pages, err
+		}
+		pages++
+		if pages > 1 {
+			fmt.Fprintf(&buf, "\n--- page %d ---\n", pages)
+		}
+		buf.Write(text)
+	}
+	return buf.Bytes(), pages, nil
+}
+
 func OCRExtract(ctx context.Context, in OCRRequest) OCRResponse {
 	start := time.Now()
 	path, err := normalizePath(in.Path)
 	if err != nil {
 		return OCRResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
-	args := []string{path, "stdout"}
 	lang := in.Lang
 	if lang == "" {
 		lang = "eng"
 	}
-	args = append(args, "-l", lang)
-	cmd := exec.CommandContext(ctx, "tesseract", args...)
-	var out, stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return OCRResponse{DurationMs: time.Since(start).Milliseconds(), Error: stderr.String()}
+	if err := checkLangs(ctx, lang); err != nil {
+		return OCRResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
-	data := out.Bytes()
 	limit := in.MaxBytes
 	if limit <= 0 {
 		limit = defaultMaxBytes
 	}
+	var data []byte
+	pages := 0
+	if isPDF(path) {
+		data, pages, err = ocrPDF(ctx, path, lang, limit)
+	} else {
+		data, err = tesseract(ctx, path, lang)
+	}
+	if err != nil {
+		return OCRResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
 	truncated := false
 	if int64(len(data)) > limit {
 		data = data[:limit]
 		truncated = true
 	}
-	resp := OCRResponse{Text: string(data), Truncated: truncated}
+	resp := OCRResponse{Text: string(data), Truncated: truncated, Pages: pages}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Path       string `json:"path"`
 		DurationMs int64  `json:"duration_ms"`
 		BytesOut   int    `json:"bytes_out"`
-	}{time.Now().UTC().Format(time.RFC3339), "ocr.extract", path, resp.DurationMs, len(resp.Text)})
+		Pages      int    `json:"pages,omitempty"`
+	}{time.Now().UTC().Format(time.RFC3339), "ocr.extract", path, resp.DurationMs, len(resp.Text), resp.Pages})
 	return resp
 }
@@ -2,6 +2,8 @@ package media
 
 import (
 	"context"
+	"image"
+	"image/png"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -27,6 +29,141 @@ func TestImageConvert(t *testing.T) {
 	}
 }
 
+func TestImageConvertRotate(t *testing.T) {
+	if _, err := exec.LookPath("convert"); err != nil {
+		t.Skip("convert not available", err)
+	}
+	dir := t.TempDir()
+	t.Setenv("WORKSPACE", dir)
+	src := filepath.Join(dir, "wide.png")
+	dest := filepath.Join(dir, "tall.png")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 20, 10))); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	f.Close()
+	resp := ImageConvert(context.Background(), ImageConvertRequest{SrcPath: src, DestPath: dest, Ops: []ImageOp{{AutoOrient: true}, {Rotate: 90, FlipH: true}}})
+	if resp.Error != "" {
+		t.Fatalf("ImageConvert error: %v", resp.Error)
+	}
+	out, err := os.Open(dest)
+	if err != nil {
+		t.Fatalf("open dest: %v", err)
+	}
+	defer out.Close()
+	cfg, err := png.DecodeConfig(out)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if cfg.Width != 10 || cfg.Height != 20 {
+		t.Fatalf("expected 10x20, got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestImageCompose(t *testing.T) {
+	args, err := composeArgs("/w/base.png", "", "/w/out.png", ComposeRequest{Text: "@100% mine", Gravity: "North", Opacity: 0.5})
+	if err != nil {
+		t.Fatalf("composeArgs: %v", err)
+	}
+	joined := strings.Join(args, " ")
+	for _, want := range []string{`label:\@100%% mine`, "-gravity North", "compose:args=50", "-compose dissolve"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("missing %q in %q", want, joined)
+		}
+	}
+	for _, bad := range []ComposeRequest{{}, {Overlay: "a.png", Text: "x"}, {Text: "x", Gravity: "up"}, {Text: "x", Opacity: 2}} {
+		overlay := ""
+		if bad.Overlay != "" {
+			overlay = "/w/a.png"
+		}
+		if _, err := composeArgs("/w/base.png", overlay, "/w/out.png", bad); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+	if _, err := exec.LookPath("convert"); err != nil {
+		t.Skip("convert not available", err)
+	}
+	dir := t.TempDir()
+	t.Setenv("WORKSPACE", dir)
+	for name, size := range map[string]int{"base.png": 40, "logo.png": 10} {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		png.Encode(f, image.NewRGBA(image.Rect(0, 0, size, size)))
+		f.Close()
+	}
+	resp := ImageCompose(context.Background(), ComposeRequest{Base: "base.png", Overlay: "logo.png", Dest: "out.png", Opacity: 0.3})
+	if resp.Error != "" || resp.DestPath != filepath.Join(dir, "out.png") {
+		t.Fatalf("unexpected result %+v", resp)
+	}
+	if resp := ImageCompose(context.Background(), ComposeRequest{Base: "base.png", Overlay: "/etc/passwd", Dest: "out.png"}); resp.Error == "" {
+		t.Fatalf("expected overlay outside the workspace to be rejected")
+	}
+}
+
+func TestGifCreate(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("WORKSPACE", dir)
+	for _, name := range []string{"f2.png", "f1.png"} {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		png.Encode(f, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+		f.Close()
+	}
+	frames, err := gifFrames(GifRequest{SrcGlob: "f*.png"})
+	if err != nil || len(frames) != 2 || filepath.Base(frames[0]) != "f1.png" {
+		t.Fatalf("unexpected frames %v (%v)", frames, err)
+	}
+	if _, err := gifFrames(GifRequest{Frames: []string{"f1.png", "../x.png"}}); err == nil {
+		t.Fatalf("expected frame outside the workspace to be rejected")
+	}
+	many := make([]string, MaxGifFrames+1)
+	for i := range many {
+		many[i] = "f1.png"
+	}
+	if _, err := gifFrames(GifRequest{Frames: many}); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Fatalf("expected frame limit error, got %v", err)
+	}
+	if _, err := exec.LookPath("convert"); err != nil {
+		t.Skip("convert not available", err)
+	}
+	resp := GifCreate(context.Background(), GifRequest{SrcGlob: "f*.png", Dest: "anim.gif", DelayMs: 50})
+	if resp.Error != "" || resp.Frames != 2 {
+		t.Fatalf("unexpected result %+v", resp)
+	}
+}
+
+func TestImageMetadata(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("WORKSPACE", dir)
+	src := filepath.Join(dir, "img.png")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 12, 7))); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	f.Close()
+	resp := ImageMetadata(context.Background(), ImageMetadataRequest{Path: src})
+	if resp.Error != "" {
+		t.Fatalf("ImageMetadata error: %v", resp.Error)
+	}
+	if resp.Width != 12 || resp.Height != 7 || resp.Format != "png" {
+		t.Fatalf("unexpected metadata %+v", resp)
+	}
+	parsed, err := parseIdentify("640|480|JPEG|sRGB|6")
+	if err != nil || parsed.Width != 640 || parsed.Format != "jpeg" || parsed.ColorSpace != "sRGB" || parsed.Orientation != 6 {
+		t.Fatalf("unexpected identify parse %+v %v", parsed, err)
+	}
+}
+
 func TestOCRExtract(t *testing.T) {
 	dir := t.TempDir()
 	t.Setenv("WORKSPACE", dir)
@@ -63,3 +200,143 @@ func TestVideoTranscode(t *testing.T) {
 		t.Fatalf("dest not created: %v", err)
 	}
 }
+
+func TestVideoConcat(t *testing.T) {
+	if got := concatList([]string{"/w/a.mp4", "/w/it's.mp4"}); got != "file '/w/a.mp4'\nfile '/w/it'\\''s.mp4'\n" {
+		t.Fatalf("unexpected list %q", got)
+	}
+	dir := t.TempDir()
+	t.Setenv("WORKSPACE", dir)
+	if resp := VideoConcat(context.Background(), ConcatRequest{Srcs: []string{"a.mp4"}, Dest: "out.mp4"}); resp.Error == "" {
+		t.Fatalf("expected error for a single clip")
+	}
+	if resp := VideoConcat(context.Background(), ConcatRequest{Srcs: []string{"a.mp4", "/etc/passwd"}, Dest: "out.mp4"}); resp.Error == "" {
+		t.Fatalf("expected clip outside the workspace to be rejected")
+	}
+	for _, bad := range []string{"a\nfile /etc/shadow.mp4", "a\rfile http://host/x.mp4", "a\x00.mp4"} {
+		if resp := VideoConcat(context.Background(), ConcatRequest{Srcs: []string{"b.mp4", bad}, Dest: "out.mp4"}); !strings.Contains(resp.Error, "control characters") {
+			t.Fatalf("expected %q to be rejected, got %+v", bad, resp)
+		}
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not available", err)
+	}
+	for _, name := range []string{"a.mp4", "b.mp4"} {
+		if err := exec.Command("ffmpeg", "-f", "lavfi", "-i", "color=c=blue:s=16x16:d=1", filepath.Join(dir, name)).Run(); err != nil {
+			t.Fatalf("create clip: %v", err)
+		}
+	}
+	resp := VideoConcat(context.Background(), ConcatRequest{Srcs: []string{"a.mp4", "b.mp4"}, Dest: "out.mp4"})
+	if resp.Error != "" || resp.DestPath != filepath.Join(dir, "out.mp4") {
+		t.Fatalf("unexpected result %+v", resp)
+	}
+}
+
+func TestVideoMetadata(t *testing.T) {
+	sample := `{"streams":[{"index":0,"codec_name":"h264","codec_type":"video","width":16,"height":16,"r_frame_rate":"25/1","bit_rate":"1200"},{"index":1,"codec_name":"aac","codec_type":"audio","sample_rate":"44100","channels":2,"r_frame_rate":"0/0"}],"format":{"format_name":"mov,mp4,m4a,3gp,3g2,mj2","duration":"1.000000","size":"2048","bit_rate":"16384"}}`
+	parsed, err := parseFFProbe([]byte(sample))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if parsed.Duration != 1 || parsed.Container != "mov,mp4,m4a,3gp,3g2,mj2" || parsed.BitRate != 16384 || parsed.Size != 2048 || len(parsed.Streams) != 2 {
+		t.Fatalf("unexpected format %+v", parsed)
+	}
+	if v := parsed.Streams[0]; v.Codec != "h264" || v.Width != 16 || v.FrameRate != "25/1" || v.BitRate != 1200 {
+		t.Fatalf("unexpected video stream %+v", v)
+	}
+	if a := parsed.Streams[1]; a.Type != "audio" || a.SampleRate != 44100 || a.Channels != 2 || a.FrameRate != "" {
+		t.Fatalf("unexpected audio stream %+v", a)
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not available", err)
+	}
+	dir := t.TempDir()
+	t.Setenv("WORKSPACE", dir)
+	src := filepath.Join(dir, "clip.mp4")
+	if err := exec.Command("ffmpeg", "-f", "lavfi", "-i", "color=c=blue:s=16x16:d=1", src).Run(); err != nil {
+		t.Fatalf("create video: %v", err)
+	}
+	resp := VideoMetadata(context.Background(), VideoMetadataRequest{Path: src})
+	if resp.Error != "" {
+		t.Fatalf("VideoMetadata error: %v", resp.Error)
+	}
+	if len(resp.Streams) == 0 || resp.Streams[0].Width != 16 || resp.Duration <= 0 {
+		t.Fatalf("unexpected metadata %+v", resp)
+	}
+}
+
+func TestVideoThumbnail(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("WORKSPACE", dir)
+	if resp := VideoThumbnail(context.Background(), ThumbnailRequest{Src: "in.mp4", Dest: "/etc/thumb.png"}); !strings.Contains(resp.Error, "escapes workspace") {
+		t.Fatalf("expected workspace error, got %+v", resp)
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not available", err)
+	}
+	src := filepath.Join(dir, "in.mp4")
+	dest := filepath.Join(dir, "thumb.png")
+	if err := exec.Command("ffmpeg", "-f", "lavfi", "-i", "color=c=blue:s=64x32:d=2", src).Run(); err != nil {
+		t.Fatalf("create video: %v", err)
+	}
+	resp := VideoThumbnail(context.Background(), ThumbnailRequest{Src: src, Dest: dest, At: "00:00:01", Width: 32})
+	if resp.Error != "" {
+		t.Fatalf("VideoThumbnail error: %v", resp.Error)
+	}
+	f, err := os.Open(dest)
+	if err != nil {
+		t.Fatalf("thumbnail not created: %v", err)
+	}
+	defer f.Close()
+	cfg, err := png.DecodeConfig(f)
+	if err != nil || cfg.Width != 32 || cfg.Height != 16 {
+		t.Fatalf("unexpected thumbnail %+v %v", cfg, err)
+	}
+}
+
+func TestAudioExtract(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("WORKSPACE", dir)
+	if resp := AudioExtract(context.Background(), AudioExtractRequest{Src: "in.mp4", Dest: "out.ogg"}); !strings.Contains(resp.Error, "format must be") {
+		t.Fatalf("expected format error, got %+v", resp)
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not available", err)
+	}
+	src := filepath.Join(dir, "in.mp4")
+	if err := exec.Command("ffmpeg", "-f", "lavfi", "-i", "color=c=blue:s=16x16:d=1", "-f", "lavfi", "-i", "sine=frequency=440:duration=1", "-shortest", src).Run(); err != nil {
+		t.Fatalf("create video: %v", err)
+	}
+	resp := AudioExtract(context.Background(), AudioExtractRequest{Src: src, Dest: filepath.Join(dir, "out.wav")})
+	if resp.Error != "" {
+		t.Fatalf("AudioExtract error: %v", resp.Error)
+	}
+	if _, err := os.Stat(resp.DestPath); err != nil {
+		t.Fatalf("dest not created: %v", err)
+	}
+}
+
+func TestParseLangList(t *testing.T) {
+	out := "List of available languages in \"/usr/share/tessdata/\" (3):\neng\nfra\nosd\n"
+	langs := parseLangList(out)
+	if strings.Join(langs, ",") != "eng,fra,osd" {
+		t.Fatalf("unexpected langs %v", langs)
+	}
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		t.Skip("tesseract not available", err)
+	}
+	if err := checkLangs(context.Background(), "eng+zz_missing"); err == nil || !strings.Contains(err.Error(), "available:") {
+		t.Fatalf("expected missing language error, got %v", err)
+	}
+}
+
+func TestIsPDF(t *testing.T) {
+	dir := t.TempDir()
+	pdf := filepath.Join(dir, "scan.bin")
+	img := filepath.Join(dir, "scan.pdf")
+	os.WriteFile(pdf, []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj\n"), 0o644)
+	os.WriteFile(img, []byte("\x89PNG\r\n\x1a\n"), 0o644)
+	if !isPDF(pdf) || isPDF(img) {
+		t.Fatalf("unexpected pdf detection")
+	}
+}
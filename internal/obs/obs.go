@@ -2,20 +2,29 @@ package obs
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	stderrors "errors"
+	"fmt"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	mcp "github.com/mark3labs/mcp-go/mcp"
 	server "github.com/mark3labs/mcp-go/server"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
 )
 
 var (
@@ -71,6 +80,16 @@ func init() {
 			defaultRPS = f
 		}
 	}
+	if v := os.Getenv("CLIENT_RPS"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 {
+			clientRPS = f
+		}
+	}
+	if v := os.Getenv("EXPECTED_CLIENTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			expectedClients = n
+		}
+	}
 	if v := os.Getenv("DEFAULT_TIMEOUT_MS"); v != "" {
 		if ms, err := strconv.Atoi(v); err == nil && ms > 0 {
 			defaultTimeout = time.Duration(ms) * time.Millisecond
@@ -80,10 +99,16 @@ func init() {
 	prometheus.MustRegister(calls, errors, timeouts, durations)
 }
 
-func getLimiter(tool string) *rate.Limiter {
-	if lim, ok := rateLimiters.Load(tool); ok {
-		return lim.(*rate.Limiter)
-	}
+// clientRPS, when positive, is the per-client rate applied to calls that
+// carry a client identity (CLIENT_RPS). Otherwise each client gets the tool's
+// rate divided by expectedClients (EXPECTED_CLIENTS, default 2), so no single
+// caller can drain the tool-wide limiter, which still applies either way.
+var (
+	clientRPS       float64
+	expectedClients = 2
+)
+
+func toolRPS(tool string) float64 {
 	rps := defaultRPS
 	envName := "RATE_LIMIT_" + strings.ToUpper(strings.ReplaceAll(tool, ".", "_"))
 	if v := os.Getenv(envName); v != "" {
@@ -91,29 +116,140 @@ func getLimiter(tool string) *rate.Limiter {
 			rps = f
 		}
 	}
-	lim := rate.NewLimiter(rate.Limit(rps), int(rps))
-	rateLimiters.Store(tool, lim)
-	return lim
+	return rps
+}
+
+// clientID identifies the caller by a hash of its Authorization header, the
+// only identity a caller cannot mint freely without credentials. It is empty
+// for stdio and anonymous HTTP calls.
+func clientID(req mcp.CallToolRequest) string {
+	if req.Header == nil {
+		return ""
+	}
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		return "auth:" + hex.EncodeToString(sum[:8])
+	}
+	return ""
+}
+
+func newLimiter(rps float64) *rate.Limiter {
+	burst := int(rps)
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(rps), burst)
+}
+
+// getLimiter returns the per-tool limiter shared by every caller. It caps
+// the tool's total rate whatever per-client limits apply.
+func getLimiter(tool string) *rate.Limiter {
+	if lim, ok := rateLimiters.Load(tool); ok {
+		return lim.(*rate.Limiter)
+	}
+	lim, _ := rateLimiters.LoadOrStore(tool, newLimiter(toolRPS(tool)))
+	return lim.(*rate.Limiter)
 }
 
-// Middleware enforces concurrency, rate limits, default timeouts, and records metrics.
+// Per-client limiters idle for clientLimiterTTL are dropped, and at most
+// maxClientLimiters are kept, evicting the least recently used.
+var (
+	clientLimiterTTL  = 10 * time.Minute
+	maxClientLimiters = 10000
+)
+
+type clientLimiter struct {
+	lim  *rate.Limiter
+	last time.Time
+}
+
+var (
+	clientMu        sync.Mutex
+	clientLimiters  = map[string]*clientLimiter{}
+	clientLastSweep time.Time
+)
+
+// getClientLimiter returns the limiter for tool scoped to client, so that
+// one caller cannot exhaust another's budget.
+func getClientLimiter(tool, client string) *rate.Limiter {
+	key := tool + "\x00" + client
+	now := time.Now()
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	if now.Sub(clientLastSweep) > clientLimiterTTL/10 {
+		for k, cl := range clientLimiters {
+			if now.Sub(cl.last) > clientLimiterTTL {
+				delete(clientLimiters, k)
+			}
+		}
+		clientLastSweep = now
+	}
+	if cl, ok := clientLimiters[key]; ok {
+		cl.last = now
+		return cl.lim
+	}
+	if len(clientLimiters) >= maxClientLimiters {
+		var oldest string
+		for k, cl := range clientLimiters {
+			if oldest == "" || cl.last.Before(clientLimiters[oldest].last) {
+				oldest = k
+			}
+		}
+		delete(clientLimiters, oldest)
+	}
+	rps := toolRPS(tool) / float64(expectedClients)
+	if clientRPS > 0 {
+		rps = clientRPS
+	}
+	cl := &clientLimiter{lim: newLimiter(rps), last: now}
+	clientLimiters[key] = cl
+	return cl.lim
+}
+
+// requestID returns the caller's X-Request-ID header or a fresh UUID.
+func requestID(req mcp.CallToolRequest) string {
+	if req.Header != nil {
+		if id := strings.TrimSpace(req.Header.Get("X-Request-ID")); id != "" {
+			return id
+		}
+	}
+	return uuid.NewString()
+}
+
+// Middleware enforces concurrency, rate limits, default timeouts, records
+// metrics, and opens a span per call when tracing is enabled.
 func Middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
 	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		tool := req.Params.Name
 
-		// rate limit
-		lim := getLimiter(tool)
-		if err := lim.Wait(ctx); err != nil {
+		// correlation id, carried into every audit record and error of this
+		// call, including calls refused before they run
+		reqID := requestID(req)
+		ctx = auditlog.WithRequestID(ctx, reqID)
+		reject := func(err error) (*mcp.CallToolResult, error) {
 			errors.WithLabelValues(tool).Inc()
-			return nil, err
+			return nil, withRequestID(err, reqID)
+		}
+
+		if draining.Load() {
+			return reject(ErrShuttingDown)
+		}
+
+		// rate limit: the caller's own budget, then the tool-wide ceiling
+		if client := clientID(req); client != "" {
+			if err := getClientLimiter(tool, client).Wait(ctx); err != nil {
+				return reject(err)
+			}
+		}
+		if err := getLimiter(tool).Wait(ctx); err != nil {
+			return reject(err)
 		}
 
 		// concurrency
 		select {
 		case sem <- struct{}{}:
 		case <-ctx.Done():
-			errors.WithLabelValues(tool).Inc()
-			return nil, ctx.Err()
+			return reject(ctx.Err())
 		}
 		defer func() { <-sem }()
 
@@ -121,10 +257,29 @@ func Middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
 		ctx2, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 
+		var span trace.Span
+		if tracer != nil {
+			ctx2, span = startSpan(ctx2, req)
+		}
+
 		calls.WithLabelValues(tool).Inc()
 		start := time.Now()
 		res, err := next(ctx2, req)
-		durations.WithLabelValues(tool).Observe(time.Since(start).Seconds())
+		elapsed := time.Since(start)
+		durations.WithLabelValues(tool).Observe(elapsed.Seconds())
+		if span != nil {
+			endSpan(span, res, err, elapsed.Milliseconds())
+		}
+
+		if res != nil {
+			if res.Meta == nil {
+				res.Meta = &mcp.Meta{}
+			}
+			if res.Meta.AdditionalFields == nil {
+				res.Meta.AdditionalFields = map[string]any{}
+			}
+			res.Meta.AdditionalFields["request_id"] = reqID
+		}
 
 		if err != nil {
 			if ctx2.Err() == context.DeadlineExceeded {
@@ -132,7 +287,7 @@ func Middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
 			} else {
 				errors.WithLabelValues(tool).Inc()
 			}
-			return res, err
+			return res, withRequestID(err, reqID)
 		}
 
 		if res != nil && res.StructuredContent != nil {
@@ -155,6 +310,39 @@ func Middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
 	}
 }
 
+// withRequestID appends the call's request id to an error returned in place of
+// a result, so protocol-level errors can be matched to the audit log.
+func withRequestID(err error, reqID string) error {
+	return fmt.Errorf("%w (request_id %s)", err, reqID)
+}
+
+// ErrShuttingDown is returned for calls that arrive after Drain has started.
+var ErrShuttingDown = stderrors.New("server is shutting down")
+
+var draining atomic.Bool
+
+// InFlight returns the number of tool calls currently holding a concurrency
+// slot.
+func InFlight() int {
+	return len(sem)
+}
+
+// Drain stops admitting new tool calls and waits until the in-flight ones
+// finish or ctx is done, returning ctx's error in the latter case.
+func Drain(ctx context.Context) error {
+	draining.Store(true)
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	for InFlight() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+	return nil
+}
+
 // MetricsHandler exposes Prometheus metrics.
 func MetricsHandler() http.Handler {
 	return promhttp.Handler()
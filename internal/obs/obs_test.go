@@ -0,0 +1,220 @@
+package obs
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mcp "github.com/mark3labs/mcp-go/mcp"
+	server "github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+)
+
+func TestMiddlewareCountsServerCalls(t *testing.T) {
+	s := server.NewMCPServer("test", "0", server.WithToolCapabilities(true), server.WithToolHandlerMiddleware(Middleware))
+	s.AddTool(mcp.NewTool("obs.test"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	before := testutil.ToFloat64(calls.WithLabelValues("obs.test"))
+	msg := json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"obs.test","arguments":{}}}`)
+	if resp := s.HandleMessage(context.Background(), msg); resp == nil {
+		t.Fatalf("no response")
+	}
+	if got := testutil.ToFloat64(calls.WithLabelValues("obs.test")); got != before+1 {
+		t.Fatalf("tool_calls_total = %v, want %v", got, before+1)
+	}
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.Contains(string(body), `tool_calls_total{tool="obs.test"}`) {
+		t.Fatalf("metric missing from /metrics output")
+	}
+}
+
+func TestPerClientRateLimit(t *testing.T) {
+	old := clientRPS
+	clientRPS = 1
+	defer func() { clientRPS = old }()
+
+	handler := Middleware(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	call := func(client string) error {
+		req := mcp.CallToolRequest{Header: http.Header{}}
+		req.Params.Name = "obs.ratelimit"
+		req.Header.Set("Authorization", "Bearer "+client)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := handler(ctx, req)
+		return err
+	}
+	if err := call("alice"); err != nil {
+		t.Fatalf("first alice call: %v", err)
+	}
+	if err := call("alice"); err == nil {
+		t.Fatalf("expected alice to be rate limited")
+	}
+	if err := call("bob"); err != nil {
+		t.Fatalf("bob should have a separate budget: %v", err)
+	}
+}
+
+func TestDefaultClientShare(t *testing.T) {
+	t.Setenv("RATE_LIMIT_OBS_SHARE", "2")
+	handler := Middleware(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	call := func(client string) error {
+		req := mcp.CallToolRequest{Header: http.Header{}}
+		req.Params.Name = "obs.share"
+		req.Header.Set("Authorization", "Bearer "+client)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := handler(ctx, req)
+		return err
+	}
+	if err := call("alice"); err != nil {
+		t.Fatalf("first alice call: %v", err)
+	}
+	// without CLIENT_RPS alice only gets half the tool's budget
+	if err := call("alice"); err == nil {
+		t.Fatalf("expected alice to be held to a half share")
+	}
+	if err := call("bob"); err != nil {
+		t.Fatalf("bob was starved by alice: %v", err)
+	}
+}
+
+func TestRateLimitCeiling(t *testing.T) {
+	t.Setenv("RATE_LIMIT_OBS_CEILING", "1")
+	handler := Middleware(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	call := func(header, value string) error {
+		req := mcp.CallToolRequest{Header: http.Header{}}
+		req.Params.Name = "obs.ceiling"
+		req.Header.Set(header, value)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := handler(ctx, req)
+		return err
+	}
+	if err := call("Authorization", "Bearer one"); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	// fresh identities do not bring a fresh tool budget
+	if err := call("Authorization", "Bearer two"); err == nil {
+		t.Fatalf("expected the tool-wide limit to apply across clients")
+	}
+	if err := call("X-Client-ID", "three"); err == nil {
+		t.Fatalf("expected X-Client-ID to be ignored")
+	}
+}
+
+func TestClientLimiterEviction(t *testing.T) {
+	oldTTL, oldMax := clientLimiterTTL, maxClientLimiters
+	defer func() { clientLimiterTTL, maxClientLimiters = oldTTL, oldMax }()
+	clientLimiterTTL, maxClientLimiters = time.Hour, 2
+	clientMu.Lock()
+	clientLimiters = map[string]*clientLimiter{}
+	clientMu.Unlock()
+
+	a := getClientLimiter("obs.evict", "a")
+	getClientLimiter("obs.evict", "b")
+	getClientLimiter("obs.evict", "a")
+	getClientLimiter("obs.evict", "c") // evicts b, the least recently used
+	clientMu.Lock()
+	_, hasB := clientLimiters["obs.evict\x00b"]
+	n := len(clientLimiters)
+	clientMu.Unlock()
+	if hasB || n > 2 || getClientLimiter("obs.evict", "a") != a {
+		t.Fatalf("unexpected eviction: hasB=%v n=%d", hasB, n)
+	}
+
+	clientLimiterTTL = time.Nanosecond
+	clientLastSweep = time.Time{}
+	time.Sleep(time.Millisecond)
+	getClientLimiter("obs.evict", "d")
+	clientMu.Lock()
+	n = len(clientLimiters)
+	clientMu.Unlock()
+	if n != 1 {
+		t.Fatalf("idle limiters not swept: %d left", n)
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	var seen string
+	handler := Middleware(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		seen = auditlog.RequestID(ctx)
+		return mcp.NewToolResultText("ok"), nil
+	})
+	req := mcp.CallToolRequest{Header: http.Header{}}
+	req.Params.Name = "obs.reqid"
+	req.Header.Set("X-Request-ID", "abc-123")
+	res, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	if seen != "abc-123" || res.Meta == nil || res.Meta.AdditionalFields["request_id"] != "abc-123" {
+		t.Fatalf("request id not propagated: ctx=%q meta=%+v", seen, res.Meta)
+	}
+	req.Header = nil
+	if _, err := handler(context.Background(), req); err != nil || len(seen) != 36 {
+		t.Fatalf("expected generated uuid, got %q %v", seen, err)
+	}
+
+	failing := Middleware(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return nil, stderrors.New("boom")
+	})
+	req.Header = http.Header{"X-Request-Id": {"def-456"}}
+	if _, err := failing(context.Background(), req); err == nil || !strings.Contains(err.Error(), "def-456") {
+		t.Fatalf("expected handler error to carry the request id, got %v", err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	defer draining.Store(false)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := Middleware(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		close(started)
+		<-release
+		return mcp.NewToolResultText("ok"), nil
+	})
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "obs.drain"
+	done := make(chan error, 1)
+	go func() {
+		_, err := handler(context.Background(), req)
+		done <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := Drain(ctx); err != context.DeadlineExceeded || InFlight() != 1 {
+		t.Fatalf("expected drain to time out with one call in flight, got %v (%d)", err, InFlight())
+	}
+	late := mcp.CallToolRequest{Header: http.Header{"X-Request-Id": {"late-1"}}}
+	late.Params.Name = "obs.drain"
+	if _, err := handler(context.Background(), late); !stderrors.Is(err, ErrShuttingDown) || !strings.Contains(err.Error(), "late-1") {
+		t.Fatalf("expected new calls to be rejected with their request id, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("in-flight call failed: %v", err)
+	}
+	if err := Drain(context.Background()); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+}
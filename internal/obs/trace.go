@@ -0,0 +1,97 @@
+package obs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	mcp "github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is nil unless InitTracing found an OTLP endpoint; spans are only
+// created when it is set.
+var (
+	tracer     trace.Tracer
+	propagator = propagation.TraceContext{}
+)
+
+// InitTracing installs an OTLP/HTTP span exporter when
+// OTEL_EXPORTER_OTLP_ENDPOINT is set. The returned function flushes and stops
+// the exporter; it is a no-op when tracing is disabled.
+func InitTracing(ctx context.Context, service string) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagator)
+	tracer = tp.Tracer(service)
+	return tp.Shutdown, nil
+}
+
+// metaCarrier reads trace context that clients put in the request _meta.
+type metaCarrier map[string]any
+
+func (m metaCarrier) Get(key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func (m metaCarrier) Set(key, value string) { m[key] = value }
+
+func (m metaCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// startSpan opens a span for the tool call, continuing any trace context
+// sent in the HTTP headers or, failing that, in params._meta.
+func startSpan(ctx context.Context, req mcp.CallToolRequest) (context.Context, trace.Span) {
+	if req.Header != nil {
+		ctx = propagator.Extract(ctx, propagation.HeaderCarrier(req.Header))
+	}
+	if !trace.SpanContextFromContext(ctx).IsValid() && req.Params.Meta != nil {
+		ctx = propagator.Extract(ctx, metaCarrier(req.Params.Meta.AdditionalFields))
+	}
+	return tracer.Start(ctx, req.Params.Name, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// endSpan records the outcome of the call on span and ends it.
+func endSpan(span trace.Span, res *mcp.CallToolResult, err error, durationMs int64) {
+	span.SetAttributes(attribute.Int64("duration_ms", durationMs))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if res != nil && res.StructuredContent != nil {
+		data, _ := json.Marshal(res.StructuredContent)
+		var out struct {
+			ExitCode *int   `json:"exit_code"`
+			Error    string `json:"error"`
+		}
+		if json.Unmarshal(data, &out) == nil {
+			if out.ExitCode != nil {
+				span.SetAttributes(attribute.Int("exit_code", *out.ExitCode))
+			}
+			if out.Error != "" {
+				span.SetAttributes(attribute.String("error", out.Error))
+				span.SetStatus(codes.Error, out.Error)
+			}
+		}
+	}
+	span.End()
+}
@@ -0,0 +1,44 @@
+package obs
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	mcp "github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddlewareSpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	tracer = tp.Tracer("test")
+	defer func() { tracer = nil }()
+
+	handler := Middleware(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultStructured(map[string]any{"exit_code": 2, "error": "boom"}, "x"), nil
+	})
+	req := mcp.CallToolRequest{Header: http.Header{}}
+	req.Params.Name = "shell.exec"
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if _, err := handler(context.Background(), req); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "shell.exec" || span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected span %s trace %s", span.Name(), span.SpanContext().TraceID())
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["exit_code"].AsInt64() != 2 || attrs["error"].AsString() != "boom" {
+		t.Fatalf("unexpected attributes %v", span.Attributes())
+	}
+}
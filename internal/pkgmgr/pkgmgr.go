@@ -9,18 +9,23 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/dryrun"
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
+	"github.com/gaspardpetit/mcp-shell/internal/iolimit"
+	"github.com/gaspardpetit/mcp-shell/internal/pkgpolicy"
 	rt "github.com/gaspardpetit/mcp-shell/internal/runtime"
 )
 
-const (
-	DefaultTimeout = 60 * time.Second
-	DefaultMaxIO   = 1 << 20
-	LogPath        = "/logs/mcp-shell.log"
-)
+const DefaultTimeout = 60 * time.Second
+
+// DefaultMaxIO caps each output stream when a request sets no max_bytes.
+var DefaultMaxIO = iolimit.Default()
 
 // AdminOverride allows package installs even when EGRESS!=1
 var AdminOverride bool
@@ -40,6 +45,47 @@ func workspaceRoot() string {
 	return "/workspace"
 }
 
+func allowOutside() bool {
+	v := os.Getenv("FS_ALLOW_OUTSIDE_WORKSPACE")
+	return v == "1" || strings.EqualFold(v, "true")
+}
+
+func normalizePath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("path is required")
+	}
+	root := workspaceRoot()
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+	p = filepath.Clean(p)
+	if allowOutside() {
+		return p, nil
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("path %q escapes workspace", p)
+	}
+	return p, nil
+}
+
+// requirementsFile resolves a requirements path inside the workspace and
+// checks that it exists.
+func requirementsFile(p string) (string, error) {
+	path, err := normalizePath(p)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("requirements file: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("requirements file %q is a directory", path)
+	}
+	return path, nil
+}
+
 // limitedWriter caps bytes written and marks truncation
 
 type limitedWriter struct {
@@ -98,18 +144,7 @@ func run(ctx context.Context, name string, args []string, timeout time.Duration,
 	return stdoutBuf.String(), stderrBuf.String(), exit, durationMs, stdoutTrunc, stderrTrunc
 }
 
-func audit(tool string, pkgs []string, exit int, durationMs int64, bytesOut int, stdoutTrunc, stderrTrunc bool) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
+func audit(ctx context.Context, tool string, pkgs []string, exit int, durationMs int64, bytesOut int, stdoutTrunc, stderrTrunc bool) {
 	rec := struct {
 		TS              string   `json:"ts"`
 		Tool            string   `json:"tool"`
@@ -129,7 +164,7 @@ func audit(tool string, pkgs []string, exit int, durationMs int64, bytesOut int,
 		stdoutTrunc,
 		stderrTrunc,
 	}
-	_ = json.NewEncoder(f).Encode(rec)
+	auditlog.Write(ctx, rec)
 }
 
 // ---- apt.install ----
@@ -152,15 +187,21 @@ type InstallResponse struct {
 	StdoutTruncated bool     `json:"stdout_truncated"`
 	StderrTruncated bool     `json:"stderr_truncated"`
 	Error           string   `json:"error,omitempty"`
+	ErrorCode       string   `json:"error_code,omitempty"`
 }
 
 func AptInstall(ctx context.Context, in AptInstallRequest) InstallResponse {
 	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
 	if len(in.Packages) == 0 {
 		return InstallResponse{ExitCode: 1, Error: "packages is required"}
 	}
 	if !egressAllowed() {
-		return InstallResponse{ExitCode: 1, Error: "package install disabled"}
+		return InstallResponse{ExitCode: 1, Error: "package install disabled", ErrorCode: errcode.EgressDisabled}
+	}
+	if err := pkgpolicy.Check("apt", in.Packages); err != nil {
+		auditBlocked(ctx, "apt.install", in.Packages, err.Error())
+		return InstallResponse{ExitCode: 1, DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -172,7 +213,7 @@ func AptInstall(ctx context.Context, in AptInstallRequest) InstallResponse {
 	}
 	if in.DryRun {
 		resp := InstallResponse{Installed: in.Packages, ExitCode: 0, DurationMs: time.Since(start).Milliseconds(), Stdout: fmt.Sprintf("[dry_run] apt-get install %s", strings.Join(in.Packages, " "))}
-		audit("apt.install", in.Packages, resp.ExitCode, resp.DurationMs, len(resp.Stdout), false, false)
+		audit(ctx, "apt.install", in.Packages, resp.ExitCode, resp.DurationMs, len(resp.Stdout), false, false)
 		return resp
 	}
 	if in.Update {
@@ -198,27 +239,49 @@ func AptInstall(ctx context.Context, in AptInstallRequest) InstallResponse {
 	} else {
 		resp.Error = "apt install failed"
 	}
-	audit("apt.install", in.Packages, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	audit(ctx, "apt.install", in.Packages, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
 	return resp
 }
 
 // ---- pip.install ----
 
 type PipInstallRequest struct {
-	Packages  []string     `json:"packages"`
-	Venv      *rt.VenvSpec `json:"venv,omitempty"`
-	TimeoutMs int          `json:"timeout_ms,omitempty"`
-	MaxBytes  int64        `json:"max_bytes,omitempty"`
-	DryRun    bool         `json:"dry_run,omitempty"`
+	Packages         []string     `json:"packages"`
+	RequirementsPath string       `json:"requirements_path,omitempty"`
+	Venv             *rt.VenvSpec `json:"venv,omitempty"`
+	TimeoutMs        int          `json:"timeout_ms,omitempty"`
+	MaxBytes         int64        `json:"max_bytes,omitempty"`
+	DryRun           bool         `json:"dry_run,omitempty"`
 }
 
 func PipInstall(ctx context.Context, in PipInstallRequest) InstallResponse {
 	start := time.Now()
-	if len(in.Packages) == 0 {
-		return InstallResponse{ExitCode: 1, Error: "packages is required"}
+	in.DryRun = dryrun.Apply(in.DryRun)
+	if len(in.Packages) == 0 && in.RequirementsPath == "" {
+		return InstallResponse{ExitCode: 1, Error: "packages or requirements_path is required"}
+	}
+	var reqPath string
+	if in.RequirementsPath != "" {
+		p, err := requirementsFile(in.RequirementsPath)
+		if err != nil {
+			return InstallResponse{ExitCode: 1, Error: err.Error()}
+		}
+		reqPath = p
 	}
 	if !egressAllowed() {
-		return InstallResponse{ExitCode: 1, Error: "package install disabled"}
+		return InstallResponse{ExitCode: 1, Error: "package install disabled", ErrorCode: errcode.EgressDisabled}
+	}
+	specs := in.Packages
+	if reqPath != "" && os.Getenv("PKG_ALLOW_LIST") != "" {
+		fromFile, err := pkgpolicy.RequirementSpecs(reqPath)
+		if err != nil {
+			return InstallResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+		specs = append(append([]string{}, specs...), fromFile...)
+	}
+	if err := pkgpolicy.Check("pip", specs); err != nil {
+		auditBlocked(ctx, "pip.install", specs, err.Error())
+		return InstallResponse{ExitCode: 1, DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -228,13 +291,24 @@ func PipInstall(ctx context.Context, in PipInstallRequest) InstallResponse {
 	if in.MaxBytes > 0 {
 		limit = int(in.MaxBytes)
 	}
+	args := []string{"install"}
+	if reqPath != "" {
+		args = append(args, "-r", reqPath)
+	}
+	args = append(args, in.Packages...)
 	if in.DryRun {
-		resp := InstallResponse{Installed: in.Packages, ExitCode: 0, DurationMs: time.Since(start).Milliseconds(), Stdout: fmt.Sprintf("[dry_run] pip install %s", strings.Join(in.Packages, " "))}
-		audit("pip.install", in.Packages, resp.ExitCode, resp.DurationMs, len(resp.Stdout), false, false)
+		resp := InstallResponse{Installed: in.Packages, ExitCode: 0, DurationMs: time.Since(start).Milliseconds(), Stdout: fmt.Sprintf("[dry_run] pip %s", strings.Join(args, " "))}
+		audit(ctx, "pip.install", in.Packages, resp.ExitCode, resp.DurationMs, len(resp.Stdout), false, false)
 		return resp
 	}
 	pipPath := "pip"
 	if in.Venv != nil {
+		// held until pip finishes so python.run cannot use a half-built venv
+		unlock, err := rt.LockVenv(ctx, in.Venv.Name)
+		if err != nil {
+			return InstallResponse{ExitCode: 1, DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		defer unlock()
 		name := in.Venv.Name
 		if name == "" {
 			name = "default"
@@ -245,7 +319,7 @@ func PipInstall(ctx context.Context, in PipInstallRequest) InstallResponse {
 				_, _, exit, _, _, _ := run(ctx, "python3", []string{"-m", "venv", venvPath}, timeout, limit, nil)
 				if exit != 0 {
 					dur := time.Since(start).Milliseconds()
-					audit("pip.install", in.Packages, exit, dur, 0, false, false)
+					audit(ctx, "pip.install", in.Packages, exit, dur, 0, false, false)
 					return InstallResponse{ExitCode: exit, DurationMs: dur, Error: "venv create failed"}
 				}
 			} else {
@@ -254,7 +328,6 @@ func PipInstall(ctx context.Context, in PipInstallRequest) InstallResponse {
 		}
 		pipPath = filepath.Join(venvPath, "bin", "pip")
 	}
-	args := append([]string{"install"}, in.Packages...)
 	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, pipPath, args, timeout, limit, []string{"PIP_DISABLE_PIP_VERSION_CHECK=1"})
 	resp := InstallResponse{
 		Installed:       nil,
@@ -270,7 +343,147 @@ func PipInstall(ctx context.Context, in PipInstallRequest) InstallResponse {
 	} else {
 		resp.Error = "pip install failed"
 	}
-	audit("pip.install", in.Packages, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	audit(ctx, "pip.install", in.Packages, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- pip.uninstall ----
+
+type PipUninstallRequest struct {
+	Packages  []string     `json:"packages"`
+	Venv      *rt.VenvSpec `json:"venv,omitempty"`
+	TimeoutMs int          `json:"timeout_ms,omitempty"`
+	MaxBytes  int64        `json:"max_bytes,omitempty"`
+	DryRun    bool         `json:"dry_run,omitempty"`
+}
+
+type UninstallResponse struct {
+	Removed         []string `json:"removed"`
+	Stdout          string   `json:"stdout"`
+	Stderr          string   `json:"stderr"`
+	ExitCode        int      `json:"exit_code"`
+	DurationMs      int64    `json:"duration_ms"`
+	StdoutTruncated bool     `json:"stdout_truncated"`
+	StderrTruncated bool     `json:"stderr_truncated"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// venvPip returns the pip executable for an existing venv, or plain pip when
+// no venv is requested.
+func venvPip(spec *rt.VenvSpec) (string, error) {
+	if spec == nil {
+		return "pip", nil
+	}
+	name := spec.Name
+	if name == "" {
+		name = "default"
+	}
+	venvPath := filepath.Join(workspaceRoot(), ".venvs", name)
+	if _, err := os.Stat(venvPath); err != nil {
+		return "", errors.New("venv not found")
+	}
+	return filepath.Join(venvPath, "bin", "pip"), nil
+}
+
+func PipUninstall(ctx context.Context, in PipUninstallRequest) UninstallResponse {
+	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
+	if len(in.Packages) == 0 {
+		return UninstallResponse{ExitCode: 1, Error: "packages is required"}
+	}
+	if !egressAllowed() {
+		return UninstallResponse{ExitCode: 1, Error: "package install disabled"}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	args := append([]string{"uninstall", "-y"}, in.Packages...)
+	if in.DryRun {
+		resp := UninstallResponse{Removed: in.Packages, ExitCode: 0, DurationMs: time.Since(start).Milliseconds(), Stdout: fmt.Sprintf("[dry_run] pip %s", strings.Join(args, " "))}
+		audit(ctx, "pip.uninstall", in.Packages, resp.ExitCode, resp.DurationMs, len(resp.Stdout), false, false)
+		return resp
+	}
+	pipPath, err := venvPip(in.Venv)
+	if err != nil {
+		return UninstallResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+	}
+	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, pipPath, args, timeout, limit, []string{"PIP_DISABLE_PIP_VERSION_CHECK=1"})
+	resp := UninstallResponse{
+		Stdout:          stdout,
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      dur,
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	if exit == 0 {
+		resp.Removed = in.Packages
+	} else {
+		resp.Error = "pip uninstall failed"
+	}
+	audit(ctx, "pip.uninstall", in.Packages, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- pip.list ----
+
+type PipListRequest struct {
+	Venv      *rt.VenvSpec `json:"venv,omitempty"`
+	TimeoutMs int          `json:"timeout_ms,omitempty"`
+	MaxBytes  int64        `json:"max_bytes,omitempty"`
+}
+
+type PackageInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type ListResponse struct {
+	Packages        []PackageInfo `json:"packages"`
+	Stderr          string        `json:"stderr"`
+	ExitCode        int           `json:"exit_code"`
+	DurationMs      int64         `json:"duration_ms"`
+	StdoutTruncated bool          `json:"stdout_truncated"`
+	StderrTruncated bool          `json:"stderr_truncated"`
+	Error           string        `json:"error,omitempty"`
+}
+
+// PipList is read-only and therefore not subject to the egress gate.
+func PipList(ctx context.Context, in PipListRequest) ListResponse {
+	start := time.Now()
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	pipPath, err := venvPip(in.Venv)
+	if err != nil {
+		return ListResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+	}
+	args := []string{"list", "--format=json"}
+	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, pipPath, args, timeout, limit, []string{"PIP_DISABLE_PIP_VERSION_CHECK=1"})
+	resp := ListResponse{
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      dur,
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	if exit != 0 {
+		resp.Error = "pip list failed"
+	} else if err := json.Unmarshal([]byte(stdout), &resp.Packages); err != nil {
+		resp.ExitCode = 1
+		resp.Error = fmt.Sprintf("parse pip list: %v", err)
+	}
+	audit(ctx, "pip.list", nil, resp.ExitCode, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
 	return resp
 }
 
@@ -286,11 +499,16 @@ type NpmInstallRequest struct {
 
 func NpmInstall(ctx context.Context, in NpmInstallRequest) InstallResponse {
 	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
 	if len(in.Packages) == 0 {
 		return InstallResponse{ExitCode: 1, Error: "packages is required"}
 	}
 	if !egressAllowed() {
-		return InstallResponse{ExitCode: 1, Error: "package install disabled"}
+		return InstallResponse{ExitCode: 1, Error: "package install disabled", ErrorCode: errcode.EgressDisabled}
+	}
+	if err := pkgpolicy.Check("npm", in.Packages); err != nil {
+		auditBlocked(ctx, "npm.install", in.Packages, err.Error())
+		return InstallResponse{ExitCode: 1, DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -302,7 +520,7 @@ func NpmInstall(ctx context.Context, in NpmInstallRequest) InstallResponse {
 	}
 	if in.DryRun {
 		resp := InstallResponse{Installed: in.Packages, ExitCode: 0, DurationMs: time.Since(start).Milliseconds(), Stdout: fmt.Sprintf("[dry_run] npm install %s", strings.Join(in.Packages, " "))}
-		audit("npm.install", in.Packages, resp.ExitCode, resp.DurationMs, len(resp.Stdout), false, false)
+		audit(ctx, "npm.install", in.Packages, resp.ExitCode, resp.DurationMs, len(resp.Stdout), false, false)
 		return resp
 	}
 	args := []string{"install"}
@@ -325,6 +543,200 @@ func NpmInstall(ctx context.Context, in NpmInstallRequest) InstallResponse {
 	} else {
 		resp.Error = "npm install failed"
 	}
-	audit("npm.install", in.Packages, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	audit(ctx, "npm.install", in.Packages, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- npm.uninstall ----
+
+type NpmUninstallRequest struct {
+	Packages  []string `json:"packages"`
+	Global    bool     `json:"global,omitempty"`
+	TimeoutMs int      `json:"timeout_ms,omitempty"`
+	MaxBytes  int64    `json:"max_bytes,omitempty"`
+	DryRun    bool     `json:"dry_run,omitempty"`
+}
+
+func NpmUninstall(ctx context.Context, in NpmUninstallRequest) UninstallResponse {
+	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
+	if len(in.Packages) == 0 {
+		return UninstallResponse{ExitCode: 1, Error: "packages is required"}
+	}
+	if !egressAllowed() {
+		return UninstallResponse{ExitCode: 1, Error: "package install disabled"}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	args := []string{"uninstall"}
+	if in.Global {
+		args = append(args, "-g")
+	}
+	args = append(args, in.Packages...)
+	if in.DryRun {
+		resp := UninstallResponse{Removed: in.Packages, ExitCode: 0, DurationMs: time.Since(start).Milliseconds(), Stdout: fmt.Sprintf("[dry_run] npm %s", strings.Join(args, " "))}
+		audit(ctx, "npm.uninstall", in.Packages, resp.ExitCode, resp.DurationMs, len(resp.Stdout), false, false)
+		return resp
+	}
+	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, "npm", args, timeout, limit, nil)
+	resp := UninstallResponse{
+		Stdout:          stdout,
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      dur,
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	if exit == 0 {
+		resp.Removed = in.Packages
+	} else {
+		resp.Error = "npm uninstall failed"
+	}
+	audit(ctx, "npm.uninstall", in.Packages, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- npm.list ----
+
+type NpmListRequest struct {
+	Global    bool  `json:"global,omitempty"`
+	TimeoutMs int   `json:"timeout_ms,omitempty"`
+	MaxBytes  int64 `json:"max_bytes,omitempty"`
+}
+
+// parseNpmList extracts top-level dependencies from `npm ls --json` output,
+// sorted by name.
+func parseNpmList(out string) ([]PackageInfo, error) {
+	var tree struct {
+		Dependencies map[string]struct {
+			Version string `json:"version"`
+		} `json:"dependencies"`
+	}
+	if err := json.Unmarshal([]byte(out), &tree); err != nil {
+		return nil, err
+	}
+	pkgs := make([]PackageInfo, 0, len(tree.Dependencies))
+	for name, dep := range tree.Dependencies {
+		pkgs = append(pkgs, PackageInfo{Name: name, Version: dep.Version})
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+	return pkgs, nil
+}
+
+// NpmList is read-only and therefore not subject to the egress gate.
+func NpmList(ctx context.Context, in NpmListRequest) ListResponse {
+	start := time.Now()
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	args := []string{"ls", "--json", "--depth=0"}
+	if in.Global {
+		args = append(args, "-g")
+	}
+	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, "npm", args, timeout, limit, nil)
+	resp := ListResponse{
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      dur,
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	// npm ls exits non-zero for extraneous or missing deps but still prints the tree
+	pkgs, err := parseNpmList(stdout)
+	if err != nil {
+		if exit == 0 {
+			resp.ExitCode = 1
+		}
+		resp.Error = fmt.Sprintf("parse npm ls: %v", err)
+	} else {
+		resp.Packages = pkgs
+		if exit != 0 {
+			resp.Error = "npm ls reported problems"
+		}
+	}
+	audit(ctx, "npm.list", nil, resp.ExitCode, time.Since(start).Milliseconds(), len(stdout)+len(stderr), outTrunc, errTrunc)
+	return resp
+}
+
+// ---- cargo.install ----
+
+type CargoInstallRequest struct {
+	Packages  []string `json:"packages"`
+	Version   string   `json:"version,omitempty"`
+	Locked    bool     `json:"locked,omitempty"`
+	TimeoutMs int      `json:"timeout_ms,omitempty"`
+	MaxBytes  int64    `json:"max_bytes,omitempty"`
+	DryRun    bool     `json:"dry_run,omitempty"`
+}
+
+func CargoInstall(ctx context.Context, in CargoInstallRequest) InstallResponse {
+	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
+	if len(in.Packages) == 0 {
+		return InstallResponse{ExitCode: 1, Error: "packages is required"}
+	}
+	if in.Version != "" && len(in.Packages) > 1 {
+		return InstallResponse{ExitCode: 1, Error: "version requires a single package"}
+	}
+	if !egressAllowed() {
+		return InstallResponse{ExitCode: 1, Error: "package install disabled"}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	args := []string{"install"}
+	if in.Version != "" {
+		args = append(args, "--version", in.Version)
+	}
+	if in.Locked {
+		args = append(args, "--locked")
+	}
+	args = append(args, in.Packages...)
+	if in.DryRun {
+		resp := InstallResponse{Installed: in.Packages, ExitCode: 0, DurationMs: time.Since(start).Milliseconds(), Stdout: fmt.Sprintf("[dry_run] cargo %s", strings.Join(args, " "))}
+		audit(ctx, "cargo.install", in.Packages, resp.ExitCode, resp.DurationMs, len(resp.Stdout), false, false)
+		return resp
+	}
+	stdout, stderr, exit, dur, outTrunc, errTrunc := run(ctx, "cargo", args, timeout, limit, nil)
+	resp := InstallResponse{
+		Installed:       nil,
+		Stdout:          stdout,
+		Stderr:          stderr,
+		ExitCode:        exit,
+		DurationMs:      dur,
+		StdoutTruncated: outTrunc,
+		StderrTruncated: errTrunc,
+	}
+	if exit == 0 {
+		resp.Installed = in.Packages
+	} else {
+		resp.Error = "cargo install failed"
+	}
+	audit(ctx, "cargo.install", in.Packages, exit, dur, len(stdout)+len(stderr), outTrunc, errTrunc)
 	return resp
 }
+
+func auditBlocked(ctx context.Context, tool string, pkgs []string, reason string) {
+	auditlog.Write(ctx, struct {
+		TS       string   `json:"ts"`
+		Tool     string   `json:"tool"`
+		Packages []string `json:"packages"`
+		Blocked  string   `json:"blocked"`
+	}{time.Now().UTC().Format(time.RFC3339), tool, pkgs, reason})
+}
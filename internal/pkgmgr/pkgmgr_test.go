@@ -3,7 +3,12 @@ package pkgmgr
 import (
 	"context"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
 )
 
 func TestAptInstallDryRun(t *testing.T) {
@@ -39,6 +44,94 @@ func TestPipInstallDryRun(t *testing.T) {
 	}
 }
 
+func TestPipInstallRequirements(t *testing.T) {
+	t.Setenv("EGRESS", "0")
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	AdminOverride = true
+	if err := os.WriteFile(filepath.Join(root, "requirements.txt"), []byte("requests\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp := PipInstall(context.Background(), PipInstallRequest{Packages: []string{"rich"}, RequirementsPath: "requirements.txt", DryRun: true})
+	want := "[dry_run] pip install -r " + filepath.Join(root, "requirements.txt") + " rich"
+	if resp.ExitCode != 0 || resp.Stdout != want {
+		t.Fatalf("unexpected dry run %+v", resp)
+	}
+	missing := PipInstall(context.Background(), PipInstallRequest{RequirementsPath: "nope.txt", DryRun: true})
+	if missing.ExitCode == 0 || missing.Error == "" {
+		t.Fatalf("expected error for missing file")
+	}
+	outside := PipInstall(context.Background(), PipInstallRequest{RequirementsPath: "/etc/passwd", DryRun: true})
+	if outside.ExitCode == 0 || !strings.Contains(outside.Error, "escapes workspace") {
+		t.Fatalf("expected workspace error, got %+v", outside)
+	}
+}
+
+func TestInstallAllowList(t *testing.T) {
+	t.Setenv("EGRESS", "0")
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	AdminOverride = true
+	list := filepath.Join(root, "allow.yaml")
+	if err := os.WriteFile(list, []byte("pip: [requests, \"django*\"]\nnpm: [\"@types/*\"]\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	t.Setenv("PKG_ALLOW_LIST", list)
+
+	ok := PipInstall(context.Background(), PipInstallRequest{Packages: []string{"Requests==2.31", "django-rest_framework"}, DryRun: true})
+	if ok.ExitCode != 0 {
+		t.Fatalf("expected allowed packages to pass, got %+v", ok)
+	}
+	blocked := PipInstall(context.Background(), PipInstallRequest{Packages: []string{"requests", "evil"}, DryRun: true})
+	if blocked.ExitCode == 0 || blocked.ErrorCode != errcode.PolicyBlocked || !strings.Contains(blocked.Error, `"evil"`) {
+		t.Fatalf("expected evil to be blocked, got %+v", blocked)
+	}
+	if err := os.WriteFile(filepath.Join(root, "requirements.txt"), []byte("requests\n--index-url https://example.com\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	reqs := PipInstall(context.Background(), PipInstallRequest{RequirementsPath: "requirements.txt", DryRun: true})
+	if reqs.ErrorCode != errcode.PolicyBlocked {
+		t.Fatalf("expected requirements option to be blocked, got %+v", reqs)
+	}
+	if r := NpmInstall(context.Background(), NpmInstallRequest{Packages: []string{"@types/node@20"}, DryRun: true}); r.ExitCode != 0 {
+		t.Fatalf("expected scoped package to pass, got %+v", r)
+	}
+	if r := AptInstall(context.Background(), AptInstallRequest{Packages: []string{"sl"}, DryRun: true}); r.ErrorCode != errcode.PolicyBlocked {
+		t.Fatalf("expected apt to be blocked without entries, got %+v", r)
+	}
+}
+
+func TestPipUninstallAndList(t *testing.T) {
+	t.Setenv("EGRESS", "0")
+	AdminOverride = false
+	resp := PipUninstall(context.Background(), PipUninstallRequest{Packages: []string{"requests"}, DryRun: true})
+	if resp.ExitCode == 0 {
+		t.Fatalf("expected uninstall to be gated")
+	}
+	AdminOverride = true
+	resp = PipUninstall(context.Background(), PipUninstallRequest{Packages: []string{"requests"}, DryRun: true})
+	if resp.ExitCode != 0 || resp.Stdout != "[dry_run] pip uninstall -y requests" {
+		t.Fatalf("unexpected dry run %+v", resp)
+	}
+	if _, err := exec.LookPath("pip"); err != nil {
+		t.Skip("pip not installed")
+	}
+	AdminOverride = false
+	list := PipList(context.Background(), PipListRequest{})
+	if list.ExitCode != 0 {
+		t.Fatalf("pip list failed: %+v", list)
+	}
+	found := false
+	for _, p := range list.Packages {
+		if strings.EqualFold(p.Name, "pip") && p.Version != "" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("pip not listed in %+v", list.Packages)
+	}
+}
+
 func TestNpmInstallDryRun(t *testing.T) {
 	os.Setenv("EGRESS", "0")
 	AdminOverride = true
@@ -50,3 +143,46 @@ func TestNpmInstallDryRun(t *testing.T) {
 		t.Fatalf("unexpected installed %v", resp.Installed)
 	}
 }
+
+func TestNpmUninstallAndList(t *testing.T) {
+	t.Setenv("EGRESS", "0")
+	AdminOverride = true
+	resp := NpmUninstall(context.Background(), NpmUninstallRequest{Packages: []string{"left-pad"}, Global: true, DryRun: true})
+	if resp.ExitCode != 0 || resp.Stdout != "[dry_run] npm uninstall -g left-pad" {
+		t.Fatalf("unexpected dry run %+v", resp)
+	}
+	pkgs, err := parseNpmList(`{"name":"app","dependencies":{"zod":{"version":"3.0.0"},"axios":{"version":"1.2.3"}}}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(pkgs) != 2 || pkgs[0] != (PackageInfo{Name: "axios", Version: "1.2.3"}) || pkgs[1].Name != "zod" {
+		t.Fatalf("unexpected packages %+v", pkgs)
+	}
+	if _, err := exec.LookPath("npm"); err != nil {
+		t.Skip("npm not installed")
+	}
+	AdminOverride = false
+	list := NpmList(context.Background(), NpmListRequest{Global: true})
+	found := false
+	for _, p := range list.Packages {
+		if p.Name == "npm" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("npm not listed in %+v", list)
+	}
+}
+
+func TestCargoInstallDryRun(t *testing.T) {
+	t.Setenv("EGRESS", "0")
+	AdminOverride = false
+	if resp := CargoInstall(context.Background(), CargoInstallRequest{Packages: []string{"ripgrep"}, DryRun: true}); resp.ExitCode == 0 {
+		t.Fatalf("expected cargo install to be gated")
+	}
+	AdminOverride = true
+	resp := CargoInstall(context.Background(), CargoInstallRequest{Packages: []string{"ripgrep"}, Version: "14.1.0", Locked: true, DryRun: true})
+	if resp.ExitCode != 0 || resp.Stdout != "[dry_run] cargo install --version 14.1.0 --locked ripgrep" {
+		t.Fatalf("unexpected dry run %+v", resp)
+	}
+}
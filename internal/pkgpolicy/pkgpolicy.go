@@ -0,0 +1,138 @@
+// Package pkgpolicy enforces PKG_ALLOW_LIST for every path that installs
+// packages: the package manager tools and the packages argument of
+// python.run and node.run.
+package pkgpolicy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
+)
+
+// PKG_ALLOW_LIST names a JSON or YAML file mapping a package manager ("apt",
+// "pip", "npm") to the package names or globs it may install, e.g.
+//
+//	pip: [requests, "django*"]
+//	npm: ["@types/*", lodash]
+//
+// When it is set, every requested package must match an entry for its
+// manager; a manager missing from the file may install nothing. The file is
+// read on each install so edits apply without a restart.
+func allowList() (map[string][]string, error) {
+	file := os.Getenv("PKG_ALLOW_LIST")
+	if file == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("package allow-list: %w", err)
+	}
+	var list map[string][]string
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("package allow-list %s: %w", file, err)
+	}
+	if list == nil {
+		list = map[string][]string{}
+	}
+	return list, nil
+}
+
+var (
+	pipName    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*`)
+	pipNameSep = regexp.MustCompile(`[-_.]+`)
+)
+
+// packageName reduces an install spec to the bare name the allow-list is
+// written in: versions, extras, architectures and npm tags are dropped and
+// pip names are normalized as in PEP 503. It returns "" for specs that do not
+// name a registry package, such as URLs and local paths.
+func packageName(manager, spec string) string {
+	spec = strings.TrimSpace(spec)
+	switch manager {
+	case "pip":
+		if strings.ContainsAny(spec, "/:") {
+			return ""
+		}
+		return strings.ToLower(pipNameSep.ReplaceAllString(pipName.FindString(spec), "-"))
+	case "npm":
+		if strings.ContainsAny(spec, ":") || strings.HasPrefix(spec, ".") || strings.HasPrefix(spec, "/") {
+			return ""
+		}
+		if i := strings.LastIndex(spec, "@"); i > 0 {
+			spec = spec[:i]
+		}
+		return strings.ToLower(spec)
+	case "apt":
+		if i := strings.IndexAny(spec, "=/:"); i >= 0 {
+			spec = spec[:i]
+		}
+		return strings.ToLower(spec)
+	}
+	return spec
+}
+
+// Check returns a POLICY_BLOCKED error naming the first package that the
+// allow-list does not permit for manager ("apt", "pip" or "npm").
+func Check(manager string, specs []string) error {
+	list, err := allowList()
+	if err != nil {
+		return errcode.Wrap(errcode.PolicyBlocked, err)
+	}
+	if list == nil {
+		return nil
+	}
+	for _, spec := range specs {
+		name := packageName(manager, spec)
+		ok := false
+		for _, pattern := range list[manager] {
+			if name != "" && globMatch(strings.ToLower(pattern), name) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return errcode.Errorf(errcode.PolicyBlocked, "package %q is not on the %s allow-list", spec, manager)
+		}
+	}
+	return nil
+}
+
+func globMatch(pattern, name string) bool {
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+// RequirementSpecs lists the packages named in a requirements file so they
+// can be checked against the allow-list. Options such as -r, -e or
+// --index-url are returned as-is and therefore never match.
+func RequirementSpecs(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var specs []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		specs = append(specs, line)
+	}
+	return specs, sc.Err()
+}
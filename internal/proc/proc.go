@@ -3,27 +3,37 @@ package proc
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/creack/pty"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
+	"github.com/gaspardpetit/mcp-shell/internal/iolimit"
 )
 
 const (
 	DefaultTimeout  = 60 * time.Second
-	DefaultMaxIO    = 1 << 20 // 1 MiB
 	DefaultMaxStdin = 1 << 20 // 1 MiB
-	LogPath         = "/logs/mcp-shell.log"
 )
 
+// waitDelay bounds how long output is drained after a process exits.
+const waitDelay = time.Second
+
+// DefaultMaxIO caps the output held for each stream of a spawned process.
+var DefaultMaxIO = iolimit.Default()
+
 type SpawnRequest struct {
 	Cmd  string            `json:"cmd"`
 	Args []string          `json:"args,omitempty"`
@@ -36,6 +46,7 @@ type SpawnResponse struct {
 	Pid        int    `json:"pid,omitempty"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
 }
 
 type StdinRequest struct {
@@ -63,9 +74,39 @@ type WaitResponse struct {
 	Error      string `json:"error,omitempty"`
 }
 
+type ReadRequest struct {
+	Pid               int `json:"pid"`
+	SinceOffset       int `json:"since_offset,omitempty"`
+	StderrSinceOffset int `json:"stderr_since_offset,omitempty"`
+}
+
+type ReadResponse struct {
+	Stdout       string `json:"stdout,omitempty"`
+	Stderr       string `json:"stderr,omitempty"`
+	Offset       int    `json:"offset"`
+	StderrOffset int    `json:"stderr_offset"`
+	Running      bool   `json:"running"`
+	ExitCode     *int   `json:"exit_code,omitempty"`
+	Truncated    bool   `json:"truncated"`
+	DurationMs   int64  `json:"duration_ms"`
+	Error        string `json:"error,omitempty"`
+}
+
+type ResizeRequest struct {
+	Pid  int `json:"pid"`
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+}
+
+type ResizeResponse struct {
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
 type KillRequest struct {
-	Pid    int `json:"pid"`
-	Signal int `json:"signal,omitempty"`
+	Pid        int    `json:"pid"`
+	Signal     int    `json:"signal,omitempty"`
+	SignalName string `json:"signal_name,omitempty"`
 }
 
 type KillResponse struct {
@@ -90,10 +131,12 @@ type ProcInfo struct {
 type process struct {
 	cmd         *exec.Cmd
 	stdin       io.WriteCloser
+	pty         *os.File
 	stdoutBuf   *bytes.Buffer
 	stderrBuf   *bytes.Buffer
 	stdoutTrunc *bool
 	stderrTrunc *bool
+	mu          sync.Mutex // guards the output buffers
 	done        chan struct{}
 	exitCode    int
 	start       time.Time
@@ -106,6 +149,41 @@ var (
 	processes = make(map[int]*process)
 )
 
+// ReapAfter is how long a finished process stays in the registry for
+// proc.wait before the reaper drops it.
+var ReapAfter = 5 * time.Minute
+
+// reap removes p once it has exited and nobody waited for it. Wait deletes
+// entries too, so only the exact process registered under pid is removed.
+func reap(pid int, p *process) {
+	procMu.Lock()
+	if processes[pid] != p {
+		procMu.Unlock()
+		return
+	}
+	delete(processes, pid)
+	procMu.Unlock()
+	audit(context.Background(), struct {
+		TS   string `json:"ts"`
+		Tool string `json:"tool"`
+		PID  int    `json:"pid"`
+		Exit int    `json:"exit"`
+	}{time.Now().UTC().Format(time.RFC3339), "proc.reap", pid, p.exitCode})
+}
+
+// lockedWriter serializes writes so the output buffers can be read while the
+// process is still producing output.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
 type limitedWriter struct {
 	buf       *bytes.Buffer
 	limit     int
@@ -129,6 +207,37 @@ func (w *limitedWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// workspaceRoot returns the directory spawned processes are confined to.
+func workspaceRoot() string {
+	if ws := os.Getenv("WORKSPACE"); ws != "" {
+		return filepath.Clean(ws)
+	}
+	return "/workspace"
+}
+
+func allowOutside() bool {
+	v := os.Getenv("FS_ALLOW_OUTSIDE_WORKSPACE")
+	return v == "1" || strings.EqualFold(v, "true")
+}
+
+// normalizePath resolves a working directory against the workspace root and
+// rejects one outside it unless FS_ALLOW_OUTSIDE_WORKSPACE is set.
+func normalizePath(p string) (string, error) {
+	root := workspaceRoot()
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+	p = filepath.Clean(p)
+	if allowOutside() {
+		return p, nil
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", errcode.Errorf(errcode.PathEscape, "cwd %q escapes workspace", p)
+	}
+	return p, nil
+}
+
 func Spawn(ctx context.Context, in SpawnRequest) SpawnResponse {
 	start := time.Now()
 	if in.Cmd == "" {
@@ -137,9 +246,13 @@ func Spawn(ctx context.Context, in SpawnRequest) SpawnResponse {
 
 	cmd := exec.Command(in.Cmd, in.Args...)
 	if in.Cwd != "" {
-		cmd.Dir = filepath.Clean(in.Cwd)
-	} else if ws := os.Getenv("WORKSPACE"); ws != "" {
-		cmd.Dir = ws
+		dir, err := normalizePath(in.Cwd)
+		if err != nil {
+			return SpawnResponse{Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+		}
+		cmd.Dir = dir
+	} else {
+		cmd.Dir = workspaceRoot()
 	}
 	if len(in.Env) > 0 {
 		env := os.Environ()
@@ -148,14 +261,29 @@ func Spawn(ctx context.Context, in SpawnRequest) SpawnResponse {
 		}
 		cmd.Env = env
 	}
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if !in.TTY {
+		// pty.Start makes the child a session leader, which already gives
+		// it its own process group; Setpgid on top of Setsid fails.
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
 
 	var (
 		stdoutBuf, stderrBuf     bytes.Buffer
 		stdoutTrunc, stderrTrunc bool
-		stdin                    io.WriteCloser
 		err                      error
 	)
+	p := &process{
+		cmd:         cmd,
+		stdoutBuf:   &stdoutBuf,
+		stderrBuf:   &stderrBuf,
+		stdoutTrunc: &stdoutTrunc,
+		stderrTrunc: &stderrTrunc,
+		done:        make(chan struct{}),
+		cwd:         cmd.Dir,
+		tty:         in.TTY,
+	}
+	stdout := &lockedWriter{mu: &p.mu, w: &limitedWriter{buf: &stdoutBuf, limit: DefaultMaxIO, truncated: &stdoutTrunc}}
+	stderr := &lockedWriter{mu: &p.mu, w: &limitedWriter{buf: &stderrBuf, limit: DefaultMaxIO, truncated: &stderrTrunc}}
 
 	if in.TTY {
 		var f *os.File
@@ -163,69 +291,54 @@ func Spawn(ctx context.Context, in SpawnRequest) SpawnResponse {
 		if err != nil {
 			return SpawnResponse{Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
 		}
-		stdin = f
+		p.stdin = f
+		p.pty = f
 		go func() {
-			_, _ = io.Copy(&limitedWriter{buf: &stdoutBuf, limit: DefaultMaxIO, truncated: &stdoutTrunc}, f)
+			_, _ = io.Copy(stdout, f)
 		}()
 	} else {
-		var stdoutPipe, stderrPipe io.ReadCloser
-		stdoutPipe, err = cmd.StdoutPipe()
+		// Writers rather than pipes make cmd.Wait drain all output before
+		// done is closed, so proc.wait never misses the tail.
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		// a backgrounded grandchild can hold the output open forever; give
+		// up on it shortly after the process itself exits
+		cmd.WaitDelay = waitDelay
+		p.stdin, err = cmd.StdinPipe()
 		if err != nil {
 			return SpawnResponse{Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
 		}
-		stderrPipe, err = cmd.StderrPipe()
-		if err != nil {
+		if err = cmd.Start(); err != nil {
 			return SpawnResponse{Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
 		}
-		stdin, err = cmd.StdinPipe()
-		if err != nil {
-			return SpawnResponse{Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
-		}
-		go func() {
-			_, _ = io.Copy(&limitedWriter{buf: &stdoutBuf, limit: DefaultMaxIO, truncated: &stdoutTrunc}, stdoutPipe)
-		}()
-		go func() {
-			_, _ = io.Copy(&limitedWriter{buf: &stderrBuf, limit: DefaultMaxIO, truncated: &stderrTrunc}, stderrPipe)
-		}()
-	}
-
-	if err = cmd.Start(); err != nil {
-		return SpawnResponse{Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
-	}
-
-	p := &process{
-		cmd:         cmd,
-		stdin:       stdin,
-		stdoutBuf:   &stdoutBuf,
-		stderrBuf:   &stderrBuf,
-		stdoutTrunc: &stdoutTrunc,
-		stderrTrunc: &stderrTrunc,
-		done:        make(chan struct{}),
-		start:       time.Now(),
-		cwd:         cmd.Dir,
-		tty:         in.TTY,
 	}
+	p.start = time.Now()
 
 	procMu.Lock()
 	processes[cmd.Process.Pid] = p
 	procMu.Unlock()
 
+	reapAfter := ReapAfter
 	go func() {
 		err := cmd.Wait()
 		exit := 0
-		if err != nil {
-			var ee *exec.ExitError
-			if errors.As(err, &ee) {
-				exit = ee.ExitCode()
-			} else {
-				exit = 1
-			}
+		var ee *exec.ExitError
+		switch {
+		case err == nil:
+		case errors.As(err, &ee):
+			exit = ee.ExitCode()
+		case errors.Is(err, exec.ErrWaitDelay):
+			// the process exited but a descendant kept the output open
+			exit = cmd.ProcessState.ExitCode()
+		default:
+			exit = 1
 		}
 		p.exitCode = exit
 		close(p.done)
+		time.AfterFunc(reapAfter, func() { reap(cmd.Process.Pid, p) })
 	}()
 
-	audit(struct {
+	audit(ctx, struct {
 		TS   string `json:"ts"`
 		Tool string `json:"tool"`
 		Cmd  string `json:"cmd"`
@@ -252,7 +365,7 @@ func Stdin(ctx context.Context, in StdinRequest) StdinResponse {
 	if err != nil {
 		return StdinResponse{BytesWritten: n, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
 	}
-	audit(struct {
+	audit(ctx, struct {
 		TS    string `json:"ts"`
 		Tool  string `json:"tool"`
 		PID   int    `json:"pid"`
@@ -278,16 +391,18 @@ func Wait(ctx context.Context, in WaitRequest) WaitResponse {
 	select {
 	case <-p.done:
 	case <-ctx.Done():
-		return WaitResponse{ExitCode: 124, Stdout: p.stdoutBuf.String(), Stderr: p.stderrBuf.String(), Truncated: *p.stdoutTrunc || *p.stderrTrunc, DurationMs: time.Since(start).Milliseconds(), Error: "timeout"}
+		stdout, stderr, trunc := p.output()
+		return WaitResponse{ExitCode: 124, Stdout: stdout, Stderr: stderr, Truncated: trunc, DurationMs: time.Since(start).Milliseconds(), Error: "timeout"}
 	}
+	stdout, stderr, trunc := p.output()
 	resp := WaitResponse{
 		ExitCode:   p.exitCode,
-		Stdout:     p.stdoutBuf.String(),
-		Stderr:     p.stderrBuf.String(),
-		Truncated:  *p.stdoutTrunc || *p.stderrTrunc,
+		Stdout:     stdout,
+		Stderr:     stderr,
+		Truncated:  trunc,
 		DurationMs: time.Since(start).Milliseconds(),
 	}
-	audit(struct {
+	audit(ctx, struct {
 		TS       string `json:"ts"`
 		Tool     string `json:"tool"`
 		PID      int    `json:"pid"`
@@ -295,11 +410,132 @@ func Wait(ctx context.Context, in WaitRequest) WaitResponse {
 		BytesOut int    `json:"bytes_out"`
 	}{time.Now().UTC().Format(time.RFC3339), "proc.wait", in.Pid, resp.ExitCode, len(resp.Stdout) + len(resp.Stderr)})
 	procMu.Lock()
-	delete(processes, in.Pid)
+	if processes[in.Pid] == p {
+		delete(processes, in.Pid)
+	}
+	procMu.Unlock()
+	return resp
+}
+
+// output returns a snapshot of the captured output.
+func (p *process) output() (stdout, stderr string, truncated bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stdoutBuf.String(), p.stderrBuf.String(), *p.stdoutTrunc || *p.stderrTrunc
+}
+
+// ReadOutput returns the output captured since the given offsets without
+// waiting for the process. Passing the returned offsets back on the next
+// call yields only new output, which lets clients tail a running process.
+func ReadOutput(ctx context.Context, in ReadRequest) ReadResponse {
+	start := time.Now()
+	if in.SinceOffset < 0 || in.StderrSinceOffset < 0 {
+		return ReadResponse{Error: "offsets must not be negative", DurationMs: time.Since(start).Milliseconds()}
+	}
+	procMu.Lock()
+	p := processes[in.Pid]
 	procMu.Unlock()
+	if p == nil {
+		return ReadResponse{Error: "unknown pid", DurationMs: time.Since(start).Milliseconds()}
+	}
+	resp := ReadResponse{Running: true}
+	select {
+	case <-p.done:
+		exit := p.exitCode
+		resp.Running = false
+		resp.ExitCode = &exit
+	default:
+	}
+	p.mu.Lock()
+	resp.Stdout, resp.Offset = tail(p.stdoutBuf.Bytes(), in.SinceOffset)
+	resp.Stderr, resp.StderrOffset = tail(p.stderrBuf.Bytes(), in.StderrSinceOffset)
+	resp.Truncated = *p.stdoutTrunc || *p.stderrTrunc
+	p.mu.Unlock()
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS    string `json:"ts"`
+		Tool  string `json:"tool"`
+		PID   int    `json:"pid"`
+		Bytes int    `json:"bytes"`
+	}{time.Now().UTC().Format(time.RFC3339), "proc.read", in.Pid, len(resp.Stdout) + len(resp.Stderr)})
 	return resp
 }
 
+// tail returns the bytes of buf past offset and the new end offset. An
+// offset beyond the buffer yields nothing.
+func tail(buf []byte, offset int) (string, int) {
+	if offset >= len(buf) {
+		return "", len(buf)
+	}
+	return string(buf[offset:]), len(buf)
+}
+
+// Resize sets the window size of a process spawned with a TTY.
+func Resize(ctx context.Context, in ResizeRequest) ResizeResponse {
+	start := time.Now()
+	if in.Rows <= 0 || in.Cols <= 0 || in.Rows > math.MaxUint16 || in.Cols > math.MaxUint16 {
+		return ResizeResponse{Error: "rows and cols must be between 1 and 65535", DurationMs: time.Since(start).Milliseconds()}
+	}
+	procMu.Lock()
+	p := processes[in.Pid]
+	procMu.Unlock()
+	if p == nil {
+		return ResizeResponse{Error: "unknown pid", DurationMs: time.Since(start).Milliseconds()}
+	}
+	if p.pty == nil {
+		return ResizeResponse{Error: "process has no tty", DurationMs: time.Since(start).Milliseconds()}
+	}
+	if err := pty.Setsize(p.pty, &pty.Winsize{Rows: uint16(in.Rows), Cols: uint16(in.Cols)}); err != nil {
+		return ResizeResponse{Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+	}
+	audit(ctx, struct {
+		TS   string `json:"ts"`
+		Tool string `json:"tool"`
+		PID  int    `json:"pid"`
+		Rows int    `json:"rows"`
+		Cols int    `json:"cols"`
+	}{time.Now().UTC().Format(time.RFC3339), "proc.resize", in.Pid, in.Rows, in.Cols})
+	return ResizeResponse{DurationMs: time.Since(start).Milliseconds()}
+}
+
+// signalNames maps the accepted signal_name values to signals. The SIG
+// prefix is optional.
+var signalNames = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGCONT": syscall.SIGCONT,
+	"SIGSTOP": syscall.SIGSTOP,
+}
+
+// resolveSignal picks the signal to send: name wins over num, and SIGTERM is
+// the default when neither is set.
+func resolveSignal(num int, name string) (syscall.Signal, error) {
+	if name != "" {
+		key := strings.ToUpper(strings.TrimSpace(name))
+		if !strings.HasPrefix(key, "SIG") {
+			key = "SIG" + key
+		}
+		if sig, ok := signalNames[key]; ok {
+			return sig, nil
+		}
+		valid := make([]string, 0, len(signalNames))
+		for k := range signalNames {
+			valid = append(valid, k)
+		}
+		sort.Strings(valid)
+		return 0, fmt.Errorf("unknown signal %q; valid names: %s", name, strings.Join(valid, ", "))
+	}
+	if num != 0 {
+		return syscall.Signal(num), nil
+	}
+	return syscall.SIGTERM, nil
+}
+
 func Kill(ctx context.Context, in KillRequest) KillResponse {
 	start := time.Now()
 	procMu.Lock()
@@ -308,15 +544,15 @@ func Kill(ctx context.Context, in KillRequest) KillResponse {
 	if p == nil || p.cmd.Process == nil {
 		return KillResponse{Error: "unknown pid", DurationMs: time.Since(start).Milliseconds()}
 	}
-	sig := syscall.SIGTERM
-	if in.Signal != 0 {
-		sig = syscall.Signal(in.Signal)
+	sig, err := resolveSignal(in.Signal, in.SignalName)
+	if err != nil {
+		return KillResponse{Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
 	}
-	err := syscall.Kill(-p.cmd.Process.Pid, sig)
+	err = syscall.Kill(-p.cmd.Process.Pid, sig)
 	if err != nil {
 		return KillResponse{Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
 	}
-	audit(struct {
+	audit(ctx, struct {
 		TS     string `json:"ts"`
 		Tool   string `json:"tool"`
 		PID    int    `json:"pid"`
@@ -325,6 +561,59 @@ func Kill(ctx context.Context, in KillRequest) KillResponse {
 	return KillResponse{Killed: true, DurationMs: time.Since(start).Milliseconds()}
 }
 
+type KillAllRequest struct {
+	Signal     int    `json:"signal,omitempty"`
+	SignalName string `json:"signal_name,omitempty"`
+}
+
+type KillAllResponse struct {
+	Killed     []int  `json:"killed"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// KillAll signals the process group of every tracked process that is still
+// running. Entries stay registered so callers can still proc.wait them.
+func KillAll(ctx context.Context, in KillAllRequest) KillAllResponse {
+	start := time.Now()
+	sig, err := resolveSignal(in.Signal, in.SignalName)
+	if err != nil {
+		return KillAllResponse{Killed: []int{}, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+	}
+	procMu.Lock()
+	pids := make([]int, 0, len(processes))
+	for pid, p := range processes {
+		select {
+		case <-p.done:
+			continue
+		default:
+		}
+		pids = append(pids, pid)
+	}
+	procMu.Unlock()
+	sort.Ints(pids)
+	resp := KillAllResponse{Killed: []int{}}
+	var errs []string
+	for _, pid := range pids {
+		if err := syscall.Kill(-pid, sig); err != nil {
+			if !errors.Is(err, syscall.ESRCH) {
+				errs = append(errs, fmt.Sprintf("%d: %v", pid, err))
+			}
+			continue
+		}
+		resp.Killed = append(resp.Killed, pid)
+	}
+	resp.Error = strings.Join(errs, "; ")
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS     string `json:"ts"`
+		Tool   string `json:"tool"`
+		PIDs   []int  `json:"pids"`
+		Signal int    `json:"signal"`
+	}{time.Now().UTC().Format(time.RFC3339), "proc.killall", resp.Killed, int(sig)})
+	return resp
+}
+
 func List(ctx context.Context, _ ListRequest) ListResponse {
 	start := time.Now()
 	procMu.Lock()
@@ -338,7 +627,7 @@ func List(ctx context.Context, _ ListRequest) ListResponse {
 			Cwd:       p.cwd,
 		})
 	}
-	audit(struct {
+	audit(ctx, struct {
 		TS    string `json:"ts"`
 		Tool  string `json:"tool"`
 		Count int    `json:"count"`
@@ -346,17 +635,6 @@ func List(ctx context.Context, _ ListRequest) ListResponse {
 	return res
 }
 
-func audit(rec any) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-	_ = json.NewEncoder(f).Encode(rec)
+func audit(ctx context.Context, rec any) {
+	auditlog.Write(ctx, rec)
 }
@@ -2,12 +2,18 @@ package proc
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
+
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
 )
 
 func TestSpawnStdinWait(t *testing.T) {
+	t.Setenv("WORKSPACE", t.TempDir())
 	ctx := context.Background()
 	resp := Spawn(ctx, SpawnRequest{Cmd: "bash", Args: []string{"-c", "read line; echo hi $line"}})
 	if resp.Error != "" {
@@ -32,7 +38,39 @@ func TestSpawnStdinWait(t *testing.T) {
 	}
 }
 
+func TestSpawnCwd(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	resp := Spawn(ctx, SpawnRequest{Cmd: "pwd", Cwd: "sub"})
+	if resp.Error != "" {
+		t.Fatalf("spawn error: %v", resp.Error)
+	}
+	wresp := Wait(ctx, WaitRequest{Pid: resp.Pid, TimeoutMs: 5000})
+	if strings.TrimSpace(wresp.Stdout) != filepath.Join(root, "sub") {
+		t.Fatalf("unexpected cwd %q", wresp.Stdout)
+	}
+	noCwd := Spawn(ctx, SpawnRequest{Cmd: "pwd"})
+	if out := Wait(ctx, WaitRequest{Pid: noCwd.Pid, TimeoutMs: 5000}).Stdout; strings.TrimSpace(out) != root {
+		t.Fatalf("expected the workspace as default cwd, got %q", out)
+	}
+	escape := Spawn(ctx, SpawnRequest{Cmd: "pwd", Cwd: "/"})
+	if escape.Pid != 0 || escape.ErrorCode != errcode.PathEscape {
+		t.Fatalf("expected PATH_ESCAPE, got %+v", escape)
+	}
+	t.Setenv("FS_ALLOW_OUTSIDE_WORKSPACE", "1")
+	outside := Spawn(ctx, SpawnRequest{Cmd: "pwd", Cwd: "/"})
+	if outside.Error != "" {
+		t.Fatalf("expected override to allow /, got %+v", outside)
+	}
+	Wait(ctx, WaitRequest{Pid: outside.Pid, TimeoutMs: 5000})
+}
+
 func TestKill(t *testing.T) {
+	t.Setenv("WORKSPACE", t.TempDir())
 	ctx := context.Background()
 	resp := Spawn(ctx, SpawnRequest{Cmd: "sleep", Args: []string{"1000"}})
 	if resp.Error != "" {
@@ -53,6 +91,7 @@ func TestKill(t *testing.T) {
 }
 
 func TestList(t *testing.T) {
+	t.Setenv("WORKSPACE", t.TempDir())
 	ctx := context.Background()
 	resp := Spawn(ctx, SpawnRequest{Cmd: "sleep", Args: []string{"1"}})
 	if resp.Error != "" {
@@ -72,3 +111,152 @@ func TestList(t *testing.T) {
 	}
 	_ = Wait(ctx, WaitRequest{Pid: pid, TimeoutMs: int(2 * time.Second.Milliseconds())})
 }
+
+func TestKillAllAndReap(t *testing.T) {
+	t.Setenv("WORKSPACE", t.TempDir())
+	ctx := context.Background()
+	old := ReapAfter
+	ReapAfter = 50 * time.Millisecond
+	defer func() { ReapAfter = old }()
+
+	a := Spawn(ctx, SpawnRequest{Cmd: "sleep", Args: []string{"1000"}})
+	b := Spawn(ctx, SpawnRequest{Cmd: "sleep", Args: []string{"1000"}})
+	if a.Error != "" || b.Error != "" {
+		t.Fatalf("spawn errors: %v %v", a.Error, b.Error)
+	}
+	resp := KillAll(ctx, KillAllRequest{})
+	if resp.Error != "" {
+		t.Fatalf("killall error: %v", resp.Error)
+	}
+	killed := map[int]bool{}
+	for _, pid := range resp.Killed {
+		killed[pid] = true
+	}
+	if !killed[a.Pid] || !killed[b.Pid] {
+		t.Fatalf("expected %d and %d killed, got %v", a.Pid, b.Pid, resp.Killed)
+	}
+	// a is waited on; b is left for the reaper
+	if w := Wait(ctx, WaitRequest{Pid: a.Pid, TimeoutMs: 5000}); w.Error != "" || w.ExitCode == 0 {
+		t.Fatalf("unexpected wait %+v", w)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		procMu.Lock()
+		_, present := processes[b.Pid]
+		procMu.Unlock()
+		if !present {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pid %d was never reaped", b.Pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestReadOutput(t *testing.T) {
+	t.Setenv("WORKSPACE", t.TempDir())
+	ctx := context.Background()
+	resp := Spawn(ctx, SpawnRequest{Cmd: "bash", Args: []string{"-c", "echo one; read line; echo $line"}})
+	if resp.Error != "" {
+		t.Fatalf("spawn error: %v", resp.Error)
+	}
+	pid := resp.Pid
+	defer Kill(ctx, KillRequest{Pid: pid, Signal: int(syscall.SIGKILL)})
+
+	var r ReadResponse
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Stdout == "" && time.Now().Before(deadline) {
+		r = ReadOutput(ctx, ReadRequest{Pid: pid})
+		time.Sleep(20 * time.Millisecond)
+	}
+	if r.Error != "" || r.Stdout != "one\n" || r.Offset != 4 || !r.Running || r.ExitCode != nil {
+		t.Fatalf("unexpected first read %+v", r)
+	}
+	Stdin(ctx, StdinRequest{Pid: pid, Data: "two\n"})
+	if w := Wait(ctx, WaitRequest{Pid: pid, TimeoutMs: 5000}); w.Error != "" {
+		t.Fatalf("wait error: %v", w.Error)
+	}
+	if again := ReadOutput(ctx, ReadRequest{Pid: pid}); again.Error != "unknown pid" {
+		t.Fatalf("expected unknown pid after wait, got %+v", again)
+	}
+	if neg := ReadOutput(ctx, ReadRequest{Pid: pid, SinceOffset: -1}); neg.Error == "" {
+		t.Fatalf("expected error for negative offset")
+	}
+}
+
+func TestResize(t *testing.T) {
+	t.Setenv("WORKSPACE", t.TempDir())
+	ctx := context.Background()
+	resp := Spawn(ctx, SpawnRequest{Cmd: "bash", Args: []string{"-c", "read line; stty size"}, TTY: true})
+	if resp.Error != "" {
+		t.Fatalf("spawn error: %v", resp.Error)
+	}
+	pid := resp.Pid
+	defer Kill(ctx, KillRequest{Pid: pid, Signal: int(syscall.SIGKILL)})
+	if r := Resize(ctx, ResizeRequest{Pid: pid, Rows: 40, Cols: 120}); r.Error != "" {
+		t.Fatalf("resize error: %v", r.Error)
+	}
+	Stdin(ctx, StdinRequest{Pid: pid, Data: "go\n"})
+	deadline := time.Now().Add(5 * time.Second)
+	var out ReadResponse
+	for !strings.Contains(out.Stdout, "40 120") && time.Now().Before(deadline) {
+		out = ReadOutput(ctx, ReadRequest{Pid: pid})
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !strings.Contains(out.Stdout, "40 120") {
+		t.Fatalf("expected resized tty, got %q", out.Stdout)
+	}
+
+	plain := Spawn(ctx, SpawnRequest{Cmd: "sleep", Args: []string{"1000"}})
+	defer Kill(ctx, KillRequest{Pid: plain.Pid, Signal: int(syscall.SIGKILL)})
+	if r := Resize(ctx, ResizeRequest{Pid: plain.Pid, Rows: 40, Cols: 120}); r.Error != "process has no tty" {
+		t.Fatalf("expected no tty error, got %+v", r)
+	}
+}
+
+func TestResolveSignal(t *testing.T) {
+	t.Setenv("WORKSPACE", t.TempDir())
+	cases := []struct {
+		num  int
+		name string
+		want syscall.Signal
+	}{
+		{0, "", syscall.SIGTERM},
+		{9, "", syscall.SIGKILL},
+		{9, "SIGINT", syscall.SIGINT},
+		{0, "hup", syscall.SIGHUP},
+	}
+	for _, c := range cases {
+		got, err := resolveSignal(c.num, c.name)
+		if err != nil || got != c.want {
+			t.Fatalf("resolveSignal(%d, %q) = %v, %v; want %v", c.num, c.name, got, err, c.want)
+		}
+	}
+	if _, err := resolveSignal(0, "SIGBOGUS"); err == nil || !strings.Contains(err.Error(), "SIGTERM") {
+		t.Fatalf("expected error listing valid names, got %v", err)
+	}
+	resp := Spawn(context.Background(), SpawnRequest{Cmd: "sleep", Args: []string{"1000"}})
+	defer Kill(context.Background(), KillRequest{Pid: resp.Pid, Signal: int(syscall.SIGKILL)})
+	if k := Kill(context.Background(), KillRequest{Pid: resp.Pid, SignalName: "SIGINT"}); !k.Killed {
+		t.Fatalf("kill by name failed: %+v", k)
+	}
+	if w := Wait(context.Background(), WaitRequest{Pid: resp.Pid, TimeoutMs: 5000}); w.ExitCode == 0 {
+		t.Fatalf("expected SIGINT exit, got %+v", w)
+	}
+}
+
+func TestSpawnBackgroundedGrandchild(t *testing.T) {
+	t.Setenv("WORKSPACE", t.TempDir())
+	ctx := context.Background()
+	// the sleep inherits stdout and outlives its parent
+	resp := Spawn(ctx, SpawnRequest{Cmd: "sh", Args: []string{"-c", "sleep 30 & echo hi"}})
+	if resp.Error != "" {
+		t.Fatalf("spawn error: %v", resp.Error)
+	}
+	defer syscall.Kill(-resp.Pid, syscall.SIGKILL)
+	w := Wait(ctx, WaitRequest{Pid: resp.Pid, TimeoutMs: 5000})
+	if w.Error != "" || w.ExitCode != 0 || strings.TrimSpace(w.Stdout) != "hi" {
+		t.Fatalf("expected the parent to be reaped, got %+v", w)
+	}
+}
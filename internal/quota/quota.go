@@ -0,0 +1,135 @@
+// Package quota enforces an optional cap on the total size of the workspace,
+// set in bytes with WORKSPACE_QUOTA_BYTES. Usage is measured by walking the
+// workspace and cached for CacheTTL so busy tools do not rescan on every call.
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrExceeded is returned when a write would push the workspace over quota.
+var ErrExceeded = errors.New("quota exceeded")
+
+// CacheTTL is how long a measured usage is reused before the workspace is
+// walked again.
+var CacheTTL = 5 * time.Second
+
+var (
+	mu       sync.Mutex
+	cachedAt time.Time
+	cachedOf string
+	used     int64
+)
+
+func workspaceRoot() string {
+	if ws := os.Getenv("WORKSPACE"); ws != "" {
+		return filepath.Clean(ws)
+	}
+	return "/workspace"
+}
+
+// Limit returns the configured quota in bytes, or 0 when none is set.
+func Limit() int64 {
+	n, err := strconv.ParseInt(os.Getenv("WORKSPACE_QUOTA_BYTES"), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+func measure(root string) int64 {
+	var total int64
+	_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// usage returns the cached workspace usage, refreshing it when stale. Callers
+// hold mu.
+func usage() int64 {
+	root := workspaceRoot()
+	if root != cachedOf || time.Since(cachedAt) > CacheTTL {
+		used = measure(root)
+		cachedAt = time.Now()
+		cachedOf = root
+	}
+	return used
+}
+
+// Remaining returns how many bytes may still be written and whether a quota
+// is in effect at all.
+func Remaining() (int64, bool) {
+	limit := Limit()
+	if limit == 0 {
+		return 0, false
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	left := limit - usage()
+	if left < 0 {
+		left = 0
+	}
+	return left, true
+}
+
+// Reserve checks that n more bytes fit in the quota and, if so, counts them
+// against the cached usage so that back-to-back calls see each other before
+// the next rescan. It is a no-op without a quota or when n <= 0.
+func Reserve(n int64) error {
+	limit := Limit()
+	if limit == 0 || n <= 0 {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if cur := usage(); cur+n > limit {
+		return fmt.Errorf("%w: %d bytes needed, %d of %d in use", ErrExceeded, n, cur, limit)
+	}
+	used += n
+	return nil
+}
+
+// Invalidate drops the cached usage, e.g. after a failed write was removed.
+func Invalidate() {
+	mu.Lock()
+	cachedAt = time.Time{}
+	mu.Unlock()
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// NewWriter wraps w so that every write is reserved against the quota first;
+// a write that does not fit fails with ErrExceeded. Without a quota it
+// returns w unchanged.
+func NewWriter(w io.Writer) io.Writer {
+	if Limit() == 0 {
+		return w
+	}
+	return &writer{w: w}
+}
+
+func (q *writer) Write(p []byte) (int, error) {
+	if err := Reserve(int64(len(p))); err != nil {
+		return 0, err
+	}
+	return q.w.Write(p)
+}
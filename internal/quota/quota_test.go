@@ -0,0 +1,44 @@
+package quota
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReserve(t *testing.T) {
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	t.Setenv("WORKSPACE_QUOTA_BYTES", "")
+	Invalidate()
+	if err := Reserve(1 << 30); err != nil {
+		t.Fatalf("no quota should allow anything: %v", err)
+	}
+
+	t.Setenv("WORKSPACE_QUOTA_BYTES", "10")
+	if err := os.WriteFile(filepath.Join(ws, "a"), []byte("123456"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	Invalidate()
+	if left, ok := Remaining(); !ok || left != 4 {
+		t.Fatalf("Remaining() = %d, %v; want 4, true", left, ok)
+	}
+	if err := Reserve(3); err != nil {
+		t.Fatalf("reserve 3: %v", err)
+	}
+	if err := Reserve(2); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("expected quota exceeded, got %v", err)
+	}
+
+	Invalidate()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if _, err := w.Write([]byte("abcd")); err != nil {
+		t.Fatalf("write within quota: %v", err)
+	}
+	if _, err := w.Write([]byte("e")); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("expected quota exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+// Package rlimit applies per-command resource limits (RLIMIT_AS, RLIMIT_CPU
+// and RLIMIT_FSIZE). Go cannot set rlimits on a child between fork and exec,
+// so the command is started under a bash ulimit prelude that execs it.
+package rlimit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Limits holds the optional caps; zero means unlimited.
+type Limits struct {
+	MaxMemoryMB   int
+	MaxCPUSeconds int
+	MaxFileSizeMB int
+}
+
+// Names reported by Exceeded.
+const (
+	CPU      = "cpu"
+	Memory   = "memory"
+	FileSize = "file_size"
+)
+
+func (l Limits) IsZero() bool {
+	return l.MaxMemoryMB == 0 && l.MaxCPUSeconds == 0 && l.MaxFileSizeMB == 0
+}
+
+func (l Limits) Validate() error {
+	if l.MaxMemoryMB < 0 || l.MaxCPUSeconds < 0 || l.MaxFileSizeMB < 0 {
+		return errors.New("resource limits must be positive")
+	}
+	return nil
+}
+
+// prelude builds the ulimit commands. The CPU hard limit sits one second
+// above the soft limit so the process receives SIGXCPU rather than SIGKILL.
+func (l Limits) prelude() string {
+	var parts []string
+	if l.MaxMemoryMB > 0 {
+		parts = append(parts, fmt.Sprintf("ulimit -v %d", l.MaxMemoryMB*1024))
+	}
+	if l.MaxCPUSeconds > 0 {
+		parts = append(parts, fmt.Sprintf("ulimit -S -t %d", l.MaxCPUSeconds), fmt.Sprintf("ulimit -H -t %d", l.MaxCPUSeconds+1))
+	}
+	if l.MaxFileSizeMB > 0 {
+		// bash counts -f in 1024-byte blocks
+		parts = append(parts, fmt.Sprintf("ulimit -f %d", l.MaxFileSizeMB*1024))
+	}
+	return strings.Join(parts, " && ")
+}
+
+// Wrap returns the program and arguments that run name/args under the
+// limits. With no limits set it returns them unchanged.
+func (l Limits) Wrap(name string, args []string) (string, []string) {
+	if l.IsZero() {
+		return name, args
+	}
+	wrapped := append([]string{"-c", l.prelude() + ` && exec "$@"`, "rlimit", name}, args...)
+	return "bash", wrapped
+}
+
+// memoryErrors are stderr fragments runtimes print when an allocation
+// fails under RLIMIT_AS. Exceeding it does not raise a dedicated signal,
+// and a crash signal alone is no evidence, so these are the only signs.
+var memoryErrors = []string{"MemoryError", "Cannot allocate memory", "out of memory", "std::bad_alloc"}
+
+// Exceeded reports which limit, if any, ended the process. It recognises
+// the process being signalled directly and a shell reporting 128+signal.
+// A signal only counts when the limit it belongs to was set and, for the
+// CPU limit, when the process actually used that much CPU time, so a
+// SIGKILL from a timeout or the OOM killer is not reported as a breach.
+func Exceeded(l Limits, state *os.ProcessState, stderr string) string {
+	if l.IsZero() || state == nil || state.Success() {
+		return ""
+	}
+	var sig syscall.Signal
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok {
+		if ws.Signaled() {
+			sig = ws.Signal()
+		} else if code := ws.ExitStatus(); code > 128 {
+			sig = syscall.Signal(code - 128)
+		}
+	}
+	// rusage ticks are coarse; allow a little slack below the limit
+	cpuUsed := state.UserTime()+state.SystemTime() >= time.Duration(l.MaxCPUSeconds)*time.Second-100*time.Millisecond
+	switch {
+	case l.MaxCPUSeconds > 0 && (sig == syscall.SIGXCPU || sig == syscall.SIGKILL) && cpuUsed:
+		return CPU
+	case l.MaxFileSizeMB > 0 && sig == syscall.SIGXFSZ:
+		return FileSize
+	}
+	if l.MaxMemoryMB > 0 {
+		for _, m := range memoryErrors {
+			if strings.Contains(stderr, m) {
+				return Memory
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package rlimit
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func run(t *testing.T, l Limits, script string) string {
+	t.Helper()
+	name, args := l.Wrap("bash", []string{"-c", script})
+	cmd := exec.Command(name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	_ = cmd.Run()
+	return Exceeded(l, cmd.ProcessState, stderr.String())
+}
+
+func TestWrap(t *testing.T) {
+	name, args := Limits{}.Wrap("python3", []string{"x.py"})
+	if name != "python3" || len(args) != 1 {
+		t.Fatalf("expected passthrough, got %s %v", name, args)
+	}
+	name, args = Limits{MaxMemoryMB: 2, MaxCPUSeconds: 3, MaxFileSizeMB: 4}.Wrap("python3", []string{"x.py"})
+	want := `ulimit -v 2048 && ulimit -S -t 3 && ulimit -H -t 4 && ulimit -f 4096 && exec "$@"`
+	if name != "bash" || args[1] != want || args[3] != "python3" || args[4] != "x.py" {
+		t.Fatalf("unexpected wrap %s %q", name, args)
+	}
+	if err := (Limits{MaxCPUSeconds: -1}).Validate(); err == nil {
+		t.Fatalf("expected validation error")
+	}
+}
+
+func TestExceeded(t *testing.T) {
+	if got := run(t, Limits{MaxCPUSeconds: 1}, "while :; do :; done"); got != CPU {
+		t.Fatalf("expected cpu, got %q", got)
+	}
+	out := filepath.Join(t.TempDir(), "big")
+	if got := run(t, Limits{MaxFileSizeMB: 1}, "head -c 2000000 /dev/zero > "+out); got != FileSize {
+		t.Fatalf("expected file_size, got %q", got)
+	}
+	if got := run(t, Limits{MaxFileSizeMB: 1}, "exit 3"); got != "" {
+		t.Fatalf("plain failure reported as %q", got)
+	}
+	// signals from elsewhere are not limit breaches
+	if got := run(t, Limits{MaxCPUSeconds: 5}, "kill -KILL $$"); got != "" {
+		t.Fatalf("external SIGKILL reported as %q", got)
+	}
+	if got := run(t, Limits{MaxCPUSeconds: 5}, "exit 137"); got != "" {
+		t.Fatalf("exit 137 reported as %q", got)
+	}
+	if got := run(t, Limits{MaxMemoryMB: 512}, "kill -SEGV $$"); got != "" {
+		t.Fatalf("plain crash reported as %q", got)
+	}
+}
@@ -10,16 +10,23 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
-)
 
-const (
-	DefaultTimeout = 60 * time.Second
-	DefaultMaxIO   = 1 << 20 // 1 MiB
-	LogPath        = "/logs/mcp-shell.log"
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
+	"github.com/gaspardpetit/mcp-shell/internal/iolimit"
+	"github.com/gaspardpetit/mcp-shell/internal/pkgpolicy"
+	"github.com/gaspardpetit/mcp-shell/internal/rlimit"
 )
 
+const DefaultTimeout = 60 * time.Second
+
+// DefaultMaxIO caps each output stream when a request sets no max_bytes.
+var DefaultMaxIO = iolimit.Default()
+
 // ---- helpers ----
 
 type limitedWriter struct {
@@ -45,19 +52,8 @@ func (w *limitedWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
-func audit(rec any) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-	_ = json.NewEncoder(f).Encode(rec)
+func audit(ctx context.Context, rec any) {
+	auditlog.Write(ctx, rec)
 }
 
 // workspace root for venvs
@@ -68,6 +64,141 @@ func workspaceRoot() string {
 	return "/workspace"
 }
 
+func allowOutside() bool {
+	v := os.Getenv("FS_ALLOW_OUTSIDE_WORKSPACE")
+	return v == "1" || strings.EqualFold(v, "true")
+}
+
+func normalizePath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("path is required")
+	}
+	root := workspaceRoot()
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+	p = filepath.Clean(p)
+	if allowOutside() {
+		return p, nil
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("path %q escapes workspace", p)
+	}
+	return p, nil
+}
+
+// requirementsFile resolves a requirements path inside the workspace and
+// checks that it exists.
+func requirementsFile(p string) (string, error) {
+	path, err := normalizePath(p)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("requirements file: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("requirements file %q is a directory", path)
+	}
+	return path, nil
+}
+
+// resolveWorkdir maps a workspace-relative directory to an absolute path and
+// creates it if needed.
+func resolveWorkdir(p string) (string, error) {
+	dir, err := normalizePath(p)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// snapshotDir records the modification times of the top-level entries in dir
+// so artifacts can be limited to what a run created or changed.
+func snapshotDir(dir string) map[string]time.Time {
+	snap := map[string]time.Time{}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil {
+			snap[e.Name()] = info.ModTime()
+		}
+	}
+	return snap
+}
+
+// collectArtifacts lists top-level entries of dir that are absent from before
+// or were modified since, skipping the named files.
+func collectArtifacts(dir string, before map[string]time.Time, skip ...string) []Artifact {
+	var artifacts []Artifact
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		skipped := false
+		for _, name := range skip {
+			if e.Name() == name {
+				skipped = true
+				break
+			}
+		}
+		if skipped {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if mt, ok := before[e.Name()]; ok && mt.Equal(info.ModTime()) {
+			continue
+		}
+		artifacts = append(artifacts, Artifact{Path: filepath.Join(dir, e.Name()), Size: info.Size()})
+	}
+	return artifacts
+}
+
+// childEnv merges extra variables onto os.Environ(). When binDir is set it is
+// placed first on PATH so it wins over any PATH supplied in extra. A nil
+// result means the child inherits the parent environment unchanged.
+func childEnv(extra map[string]string, binDir string) []string {
+	if len(extra) == 0 && binDir == "" {
+		return nil
+	}
+	env := os.Environ()
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, fmt.Sprintf("%s=%s", k, extra[k]))
+	}
+	if binDir != "" {
+		path, ok := extra["PATH"]
+		if !ok {
+			path = os.Getenv("PATH")
+		}
+		env = append(env, "PATH="+binDir+string(os.PathListSeparator)+path)
+	}
+	return env
+}
+
+// envKeys returns the sorted variable names for audit records; values are
+// never logged.
+func envKeys(env map[string]string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // ---- python.run ----
 
 type VenvSpec struct {
@@ -81,13 +212,19 @@ type Artifact struct {
 }
 
 type PythonRunRequest struct {
-	Code      string    `json:"code"`
-	Args      []string  `json:"args,omitempty"`
-	Stdin     string    `json:"stdin,omitempty"`
-	Venv      *VenvSpec `json:"venv,omitempty"`
-	Packages  []string  `json:"packages,omitempty"`
-	TimeoutMs int       `json:"timeout_ms,omitempty"`
-	MaxBytes  int64     `json:"max_bytes,omitempty"`
+	Code             string            `json:"code"`
+	Args             []string          `json:"args,omitempty"`
+	Stdin            string            `json:"stdin,omitempty"`
+	Venv             *VenvSpec         `json:"venv,omitempty"`
+	Packages         []string          `json:"packages,omitempty"`
+	RequirementsPath string            `json:"requirements_path,omitempty"`
+	Workdir          string            `json:"workdir,omitempty"`
+	Env              map[string]string `json:"env,omitempty"`
+	TimeoutMs        int               `json:"timeout_ms,omitempty"`
+	MaxBytes         int64             `json:"max_bytes,omitempty"`
+	MaxMemoryMB      int               `json:"max_memory_mb,omitempty"`
+	MaxCPUSeconds    int               `json:"max_cpu_seconds,omitempty"`
+	MaxFileSizeMB    int               `json:"max_file_size_mb,omitempty"`
 }
 
 type RunResponse struct {
@@ -98,7 +235,9 @@ type RunResponse struct {
 	StdoutTruncated bool       `json:"stdout_truncated"`
 	StderrTruncated bool       `json:"stderr_truncated"`
 	Artifacts       []Artifact `json:"artifacts,omitempty"`
+	LimitExceeded   string     `json:"limit_exceeded,omitempty"` // cpu, memory or file_size
 	Error           string     `json:"error,omitempty"`
+	ErrorCode       string     `json:"error_code,omitempty"`
 }
 
 func PythonRun(ctx context.Context, in PythonRunRequest) RunResponse {
@@ -106,6 +245,10 @@ func PythonRun(ctx context.Context, in PythonRunRequest) RunResponse {
 	if in.Code == "" {
 		return RunResponse{ExitCode: 1, Error: "code is required"}
 	}
+	lim := rlimit.Limits{MaxMemoryMB: in.MaxMemoryMB, MaxCPUSeconds: in.MaxCPUSeconds, MaxFileSizeMB: in.MaxFileSizeMB}
+	if err := lim.Validate(); err != nil {
+		return RunResponse{ExitCode: 1, Error: err.Error()}
+	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
 		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
@@ -114,6 +257,17 @@ func PythonRun(ctx context.Context, in PythonRunRequest) RunResponse {
 	if in.MaxBytes > 0 {
 		limit = int(in.MaxBytes)
 	}
+	var reqPath string
+	if in.RequirementsPath != "" {
+		if in.Venv == nil {
+			return RunResponse{ExitCode: 1, Error: "requirements_path requires a venv", DurationMs: time.Since(start).Milliseconds()}
+		}
+		p, err := requirementsFile(in.RequirementsPath)
+		if err != nil {
+			return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		}
+		reqPath = p
+	}
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -122,42 +276,40 @@ func PythonRun(ctx context.Context, in PythonRunRequest) RunResponse {
 	if err != nil {
 		return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
 	}
+	runDir := tmpDir
+	var before map[string]time.Time
+	if in.Workdir != "" {
+		dir, err := resolveWorkdir(in.Workdir)
+		if err != nil {
+			os.RemoveAll(tmpDir)
+			return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		}
+		// the script stays in the temp dir; only the working directory moves
+		defer os.RemoveAll(tmpDir)
+		runDir = dir
+		before = snapshotDir(runDir)
+	}
 	scriptPath := filepath.Join(tmpDir, "script.py")
 	if err := os.WriteFile(scriptPath, []byte(in.Code), 0o700); err != nil {
 		return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
 	}
 
 	pythonBin := "python3"
+	venvBin := ""
 	if in.Venv != nil {
-		name := in.Venv.Name
-		if name == "" {
-			name = "default"
-		}
-		venvPath := filepath.Join(workspaceRoot(), ".venvs", name)
-		if _, err := os.Stat(venvPath); errors.Is(err, os.ErrNotExist) {
-			if in.Venv.CreateIfMissing {
-				if err := exec.CommandContext(ctx, "python3", "-m", "venv", venvPath).Run(); err != nil {
-					return RunResponse{ExitCode: 1, Error: fmt.Sprintf("venv create failed: %v", err), DurationMs: time.Since(start).Milliseconds()}
-				}
-			} else {
-				return RunResponse{ExitCode: 1, Error: "venv not found"}
-			}
-		}
-		if len(in.Packages) > 0 {
-			cmd := exec.CommandContext(ctx, filepath.Join(venvPath, "bin", "python"), append([]string{"-m", "pip", "install"}, in.Packages...)...)
-			var stderr bytes.Buffer
-			cmd.Stdout = io.Discard
-			cmd.Stderr = &stderr
-			if err := cmd.Run(); err != nil {
-				return RunResponse{ExitCode: 1, Error: fmt.Sprintf("pip install: %s", stderr.String()), DurationMs: time.Since(start).Milliseconds()}
-			}
+		dir, unlock, err := prepareVenv(ctx, in.Venv, reqPath, in.Packages)
+		if err != nil {
+			return RunResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
 		}
-		pythonBin = filepath.Join(venvPath, "bin", "python")
+		defer unlock()
+		venvBin = filepath.Join(dir, "bin")
+		pythonBin = filepath.Join(venvBin, "python")
 	}
 
-	args := append([]string{scriptPath}, in.Args...)
-	cmd := exec.CommandContext(ctx, pythonBin, args...)
-	cmd.Dir = tmpDir
+	name, args := lim.Wrap(pythonBin, append([]string{scriptPath}, in.Args...))
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = runDir
+	cmd.Env = childEnv(in.Env, venvBin)
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	if in.Stdin != "" {
 		cmd.Stdin = bytes.NewBufferString(in.Stdin)
@@ -185,18 +337,174 @@ func PythonRun(ctx context.Context, in PythonRunRequest) RunResponse {
 	}
 
 	var artifacts []Artifact
-	entries, _ := os.ReadDir(tmpDir)
-	for _, e := range entries {
-		if e.Name() == "script.py" {
-			continue
+	if runDir == tmpDir {
+		artifacts = collectArtifacts(runDir, nil, "script.py")
+	} else {
+		artifacts = collectArtifacts(runDir, before)
+	}
+
+	resp := RunResponse{
+		Stdout:          stdoutBuf.String(),
+		Stderr:          stderrBuf.String(),
+		ExitCode:        exit,
+		DurationMs:      time.Since(start).Milliseconds(),
+		StdoutTruncated: stdoutTrunc,
+		StderrTruncated: stderrTrunc,
+		Artifacts:       artifacts,
+	}
+	if exit == 124 && resp.Stderr == "" {
+		resp.Stderr = "timed out"
+	}
+	if exit != 124 {
+		resp.LimitExceeded = rlimit.Exceeded(lim, cmd.ProcessState, resp.Stderr)
+	}
+	audit(ctx, struct {
+		TS           string   `json:"ts"`
+		Tool         string   `json:"tool"`
+		Venv         string   `json:"venv,omitempty"`
+		Exit         int      `json:"exit"`
+		DurationMs   int64    `json:"duration_ms"`
+		BytesOut     int      `json:"bytes_out"`
+		Packages     []string `json:"packages,omitempty"`
+		Requirements string   `json:"requirements,omitempty"`
+		EnvKeys      []string `json:"env_keys,omitempty"`
+	}{time.Now().UTC().Format(time.RFC3339), "python.run", func() string {
+		if in.Venv != nil {
+			return in.Venv.Name
+		} else {
+			return ""
 		}
-		info, err := e.Info()
+	}(), exit, resp.DurationMs, len(resp.Stdout) + len(resp.Stderr), in.Packages, reqPath, envKeys(in.Env)})
+	return resp
+}
+
+// ---- node.run ----
+
+type NodeRunRequest struct {
+	Code          string            `json:"code"`
+	Args          []string          `json:"args,omitempty"`
+	Stdin         string            `json:"stdin,omitempty"`
+	Packages      []string          `json:"packages,omitempty"`
+	Workdir       string            `json:"workdir,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+	TimeoutMs     int               `json:"timeout_ms,omitempty"`
+	MaxBytes      int64             `json:"max_bytes,omitempty"`
+	MaxMemoryMB   int               `json:"max_memory_mb,omitempty"`
+	MaxCPUSeconds int               `json:"max_cpu_seconds,omitempty"`
+	MaxFileSizeMB int               `json:"max_file_size_mb,omitempty"`
+}
+
+func NodeRun(ctx context.Context, in NodeRunRequest) RunResponse {
+	start := time.Now()
+	if in.Code == "" {
+		return RunResponse{ExitCode: 1, Error: "code is required"}
+	}
+	lim := rlimit.Limits{MaxMemoryMB: in.MaxMemoryMB, MaxCPUSeconds: in.MaxCPUSeconds, MaxFileSizeMB: in.MaxFileSizeMB}
+	if err := lim.Validate(); err != nil {
+		return RunResponse{ExitCode: 1, Error: err.Error()}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Without a workdir the script runs in a throwaway directory. With one it
+	// runs inside that project: its package.json and lockfile drive npm
+	// install, node_modules is kept for the next run, and the script sits
+	// next to them so require/import resolve against the project.
+	var (
+		runDir     string
+		scriptPath string
+		before     map[string]time.Time
+	)
+	if in.Workdir != "" {
+		dir, err := resolveWorkdir(in.Workdir)
 		if err != nil {
-			continue
+			return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		}
+		runDir = dir
+		before = snapshotDir(runDir)
+		f, err := os.CreateTemp(runDir, ".node-run-*.cjs")
+		if err != nil {
+			return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		}
+		scriptPath = f.Name()
+		defer os.Remove(scriptPath)
+		_, err = f.WriteString(in.Code)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		}
+		_, statErr := os.Stat(filepath.Join(runDir, "package.json"))
+		if len(in.Packages) > 0 || statErr == nil {
+			if err := npmInstall(ctx, runDir, in.Packages); err != nil {
+				return RunResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+			}
+		}
+	} else {
+		tmpDir, err := os.MkdirTemp("", "node-run-*")
+		if err != nil {
+			return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		}
+		runDir = tmpDir
+		scriptPath = filepath.Join(tmpDir, "script.cjs")
+		if err := os.WriteFile(scriptPath, []byte(in.Code), 0o700); err != nil {
+			return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+		}
+		if len(in.Packages) > 0 {
+			npmInit := exec.CommandContext(ctx, "npm", "init", "-y")
+			npmInit.Dir = tmpDir
+			npmInit.Stdout = io.Discard
+			npmInit.Stderr = io.Discard
+			_ = npmInit.Run()
+			if err := npmInstall(ctx, tmpDir, in.Packages); err != nil {
+				return RunResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+			}
 		}
-		artifacts = append(artifacts, Artifact{Path: filepath.Join(tmpDir, e.Name()), Size: info.Size()})
 	}
+	name, args := lim.Wrap("node", append([]string{scriptPath}, in.Args...))
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = runDir
+	cmd.Env = childEnv(in.Env, "")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if in.Stdin != "" {
+		cmd.Stdin = bytes.NewBufferString(in.Stdin)
+	}
+	var stdoutBuf, stderrBuf bytes.Buffer
+	var stdoutTrunc, stderrTrunc bool
+	cmd.Stdout = &limitedWriter{buf: &stdoutBuf, limit: limit, truncated: &stdoutTrunc}
+	cmd.Stderr = &limitedWriter{buf: &stderrBuf, limit: limit, truncated: &stderrTrunc}
 
+	exit := 0
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			if cmd.Process != nil {
+				_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			}
+			exit = 124
+		} else {
+			var ee *exec.ExitError
+			if errors.As(err, &ee) {
+				exit = ee.ExitCode()
+			} else {
+				exit = 1
+			}
+		}
+	}
+	var artifacts []Artifact
+	if in.Workdir == "" {
+		artifacts = collectArtifacts(runDir, nil, "script.js", "node_modules", "package.json", "package-lock.json")
+	} else {
+		artifacts = collectArtifacts(runDir, before, filepath.Base(scriptPath), "node_modules", "package.json", "package-lock.json")
+	}
 	resp := RunResponse{
 		Stdout:          stdoutBuf.String(),
 		Stderr:          stderrBuf.String(),
@@ -209,36 +517,85 @@ func PythonRun(ctx context.Context, in PythonRunRequest) RunResponse {
 	if exit == 124 && resp.Stderr == "" {
 		resp.Stderr = "timed out"
 	}
-	audit(struct {
+	if exit != 124 {
+		resp.LimitExceeded = rlimit.Exceeded(lim, cmd.ProcessState, resp.Stderr)
+	}
+	audit(ctx, struct {
 		TS         string   `json:"ts"`
 		Tool       string   `json:"tool"`
-		Venv       string   `json:"venv,omitempty"`
 		Exit       int      `json:"exit"`
 		DurationMs int64    `json:"duration_ms"`
 		BytesOut   int      `json:"bytes_out"`
 		Packages   []string `json:"packages,omitempty"`
-	}{time.Now().UTC().Format(time.RFC3339), "python.run", func() string {
-		if in.Venv != nil {
-			return in.Venv.Name
-		} else {
-			return ""
-		}
-	}(), exit, resp.DurationMs, len(resp.Stdout) + len(resp.Stderr), in.Packages})
+		Workdir    string   `json:"workdir,omitempty"`
+		EnvKeys    []string `json:"env_keys,omitempty"`
+	}{time.Now().UTC().Format(time.RFC3339), "node.run", exit, resp.DurationMs, len(resp.Stdout) + len(resp.Stderr), in.Packages, in.Workdir, envKeys(in.Env)})
 	return resp
 }
 
-// ---- node.run ----
+// npmInstall runs npm install in dir, adding pkgs when given. With no pkgs it
+// installs whatever the existing package.json and lockfile declare. Either
+// way the packages named are checked against PKG_ALLOW_LIST first.
+func npmInstall(ctx context.Context, dir string, pkgs []string) error {
+	specs := pkgs
+	if len(specs) == 0 && os.Getenv("PKG_ALLOW_LIST") != "" {
+		deps, err := projectDeps(dir)
+		if err != nil {
+			return err
+		}
+		specs = deps
+	}
+	if err := pkgpolicy.Check("npm", specs); err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "npm", append([]string{"install"}, pkgs...)...)
+	cmd.Dir = dir
+	cmd.Stdout = io.Discard
+	var errBuf bytes.Buffer
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("npm install: %s", errBuf.String())
+	}
+	return nil
+}
 
-type NodeRunRequest struct {
+// projectDeps lists the packages a package.json in dir declares.
+func projectDeps(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("package.json: %w", err)
+	}
+	var deps []string
+	for _, key := range []string{"dependencies", "devDependencies", "optionalDependencies", "peerDependencies"} {
+		var m map[string]string
+		if raw, ok := manifest[key]; ok {
+			if err := json.Unmarshal(raw, &m); err != nil {
+				return nil, fmt.Errorf("package.json %s: %w", key, err)
+			}
+		}
+		for name := range m {
+			deps = append(deps, name)
+		}
+	}
+	sort.Strings(deps)
+	return deps, nil
+}
+
+// ---- go.run ----
+
+type GoRunRequest struct {
 	Code      string   `json:"code"`
 	Args      []string `json:"args,omitempty"`
 	Stdin     string   `json:"stdin,omitempty"`
-	Packages  []string `json:"packages,omitempty"`
 	TimeoutMs int      `json:"timeout_ms,omitempty"`
 	MaxBytes  int64    `json:"max_bytes,omitempty"`
 }
 
-func NodeRun(ctx context.Context, in NodeRunRequest) RunResponse {
+func GoRun(ctx context.Context, in GoRunRequest) RunResponse {
 	start := time.Now()
 	if in.Code == "" {
 		return RunResponse{ExitCode: 1, Error: "code is required"}
@@ -254,31 +611,23 @@ func NodeRun(ctx context.Context, in NodeRunRequest) RunResponse {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	tmpDir, err := os.MkdirTemp("", "node-run-*")
+	tmpDir, err := os.MkdirTemp("", "go-run-*")
 	if err != nil {
 		return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
 	}
-	scriptPath := filepath.Join(tmpDir, "script.js")
-	if err := os.WriteFile(scriptPath, []byte(in.Code), 0o700); err != nil {
+	if err := os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte(in.Code), 0o600); err != nil {
 		return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
 	}
-	if len(in.Packages) > 0 {
-		npmInit := exec.CommandContext(ctx, "npm", "init", "-y")
-		npmInit.Dir = tmpDir
-		npmInit.Stdout = io.Discard
-		npmInit.Stderr = io.Discard
-		_ = npmInit.Run()
-		npmInstall := exec.CommandContext(ctx, "npm", append([]string{"install"}, in.Packages...)...)
-		npmInstall.Dir = tmpDir
-		npmInstall.Stdout = io.Discard
-		var errBuf bytes.Buffer
-		npmInstall.Stderr = &errBuf
-		if err := npmInstall.Run(); err != nil {
-			return RunResponse{ExitCode: 1, Error: fmt.Sprintf("npm install: %s", errBuf.String()), DurationMs: time.Since(start).Milliseconds()}
-		}
+	modInit := exec.CommandContext(ctx, "go", "mod", "init", "tmp")
+	modInit.Dir = tmpDir
+	modInit.Stdout = io.Discard
+	var modErr bytes.Buffer
+	modInit.Stderr = &modErr
+	if err := modInit.Run(); err != nil {
+		return RunResponse{ExitCode: 1, Error: fmt.Sprintf("go mod init: %s", modErr.String()), DurationMs: time.Since(start).Milliseconds()}
 	}
-	args := append([]string{scriptPath}, in.Args...)
-	cmd := exec.CommandContext(ctx, "node", args...)
+	args := append([]string{"run", "."}, in.Args...)
+	cmd := exec.CommandContext(ctx, "go", args...)
 	cmd.Dir = tmpDir
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	if in.Stdin != "" {
@@ -305,17 +654,121 @@ func NodeRun(ctx context.Context, in NodeRunRequest) RunResponse {
 			}
 		}
 	}
-	var artifacts []Artifact
-	entries, _ := os.ReadDir(tmpDir)
-	for _, e := range entries {
-		if e.Name() == "script.js" || e.Name() == "node_modules" || e.Name() == "package.json" || e.Name() == "package-lock.json" {
-			continue
+	artifacts := collectArtifacts(tmpDir, nil, "main.go", "go.mod", "go.sum")
+	resp := RunResponse{
+		Stdout:          stdoutBuf.String(),
+		Stderr:          stderrBuf.String(),
+		ExitCode:        exit,
+		DurationMs:      time.Since(start).Milliseconds(),
+		StdoutTruncated: stdoutTrunc,
+		StderrTruncated: stderrTrunc,
+		Artifacts:       artifacts,
+	}
+	if exit == 124 && resp.Stderr == "" {
+		resp.Stderr = "timed out"
+	}
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Exit       int    `json:"exit"`
+		DurationMs int64  `json:"duration_ms"`
+		BytesOut   int    `json:"bytes_out"`
+	}{time.Now().UTC().Format(time.RFC3339), "go.run", exit, resp.DurationMs, len(resp.Stdout) + len(resp.Stderr)})
+	return resp
+}
+
+// ---- deno.run ----
+
+// denoPermissions are the capability names accepted in DenoRunRequest;
+// each maps to --allow-<name>, optionally with a =scope suffix.
+var denoPermissions = map[string]bool{
+	"env": true, "ffi": true, "net": true, "read": true, "run": true, "sys": true, "write": true,
+}
+
+type DenoRunRequest struct {
+	Code        string   `json:"code"`
+	Args        []string `json:"args,omitempty"`
+	Stdin       string   `json:"stdin,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	TimeoutMs   int      `json:"timeout_ms,omitempty"`
+	MaxBytes    int64    `json:"max_bytes,omitempty"`
+}
+
+// denoFlags converts permission entries like "net" or "read=/workspace" into
+// deno --allow-* flags.
+func denoFlags(perms []string) ([]string, error) {
+	var flags []string
+	for _, p := range perms {
+		name, scope, hasScope := strings.Cut(p, "=")
+		if !denoPermissions[name] {
+			return nil, fmt.Errorf("unknown permission %q", p)
 		}
-		info, err := e.Info()
-		if err != nil {
-			continue
+		flag := "--allow-" + name
+		if hasScope {
+			flag += "=" + scope
+		}
+		flags = append(flags, flag)
+	}
+	return flags, nil
+}
+
+func DenoRun(ctx context.Context, in DenoRunRequest) RunResponse {
+	start := time.Now()
+	if in.Code == "" {
+		return RunResponse{ExitCode: 1, Error: "code is required"}
+	}
+	flags, err := denoFlags(in.Permissions)
+	if err != nil {
+		return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+	}
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tmpDir, err := os.MkdirTemp("", "deno-run-*")
+	if err != nil {
+		return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+	}
+	scriptPath := filepath.Join(tmpDir, "script.ts")
+	if err := os.WriteFile(scriptPath, []byte(in.Code), 0o600); err != nil {
+		return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
+	}
+	args := append([]string{"run", "--no-prompt"}, flags...)
+	args = append(args, scriptPath)
+	args = append(args, in.Args...)
+	cmd := exec.CommandContext(ctx, "deno", args...)
+	cmd.Dir = tmpDir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if in.Stdin != "" {
+		cmd.Stdin = bytes.NewBufferString(in.Stdin)
+	}
+	var stdoutBuf, stderrBuf bytes.Buffer
+	var stdoutTrunc, stderrTrunc bool
+	cmd.Stdout = &limitedWriter{buf: &stdoutBuf, limit: limit, truncated: &stdoutTrunc}
+	cmd.Stderr = &limitedWriter{buf: &stderrBuf, limit: limit, truncated: &stderrTrunc}
+
+	exit := 0
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			if cmd.Process != nil {
+				_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			}
+			exit = 124
+		} else {
+			var ee *exec.ExitError
+			if errors.As(err, &ee) {
+				exit = ee.ExitCode()
+			} else {
+				exit = 1
+			}
 		}
-		artifacts = append(artifacts, Artifact{Path: filepath.Join(tmpDir, e.Name()), Size: info.Size()})
 	}
 	resp := RunResponse{
 		Stdout:          stdoutBuf.String(),
@@ -324,31 +777,34 @@ func NodeRun(ctx context.Context, in NodeRunRequest) RunResponse {
 		DurationMs:      time.Since(start).Milliseconds(),
 		StdoutTruncated: stdoutTrunc,
 		StderrTruncated: stderrTrunc,
-		Artifacts:       artifacts,
+		Artifacts:       collectArtifacts(tmpDir, nil, "script.ts"),
 	}
 	if exit == 124 && resp.Stderr == "" {
 		resp.Stderr = "timed out"
 	}
-	audit(struct {
-		TS         string   `json:"ts"`
-		Tool       string   `json:"tool"`
-		Exit       int      `json:"exit"`
-		DurationMs int64    `json:"duration_ms"`
-		BytesOut   int      `json:"bytes_out"`
-		Packages   []string `json:"packages,omitempty"`
-	}{time.Now().UTC().Format(time.RFC3339), "node.run", exit, resp.DurationMs, len(resp.Stdout) + len(resp.Stderr), in.Packages})
+	audit(ctx, struct {
+		TS          string   `json:"ts"`
+		Tool        string   `json:"tool"`
+		Exit        int      `json:"exit"`
+		DurationMs  int64    `json:"duration_ms"`
+		BytesOut    int      `json:"bytes_out"`
+		Permissions []string `json:"permissions,omitempty"`
+	}{time.Now().UTC().Format(time.RFC3339), "deno.run", exit, resp.DurationMs, len(resp.Stdout) + len(resp.Stderr), in.Permissions})
 	return resp
 }
 
 // ---- sh.script.write_and_run ----
 
 type ShRequest struct {
-	Shebang   string            `json:"shebang"`
-	Content   string            `json:"content"`
-	Cwd       string            `json:"cwd,omitempty"`
-	Env       map[string]string `json:"env,omitempty"`
-	TimeoutMs int               `json:"timeout_ms,omitempty"`
-	MaxBytes  int64             `json:"max_bytes,omitempty"`
+	Shebang       string            `json:"shebang"`
+	Content       string            `json:"content"`
+	Cwd           string            `json:"cwd,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+	TimeoutMs     int               `json:"timeout_ms,omitempty"`
+	MaxBytes      int64             `json:"max_bytes,omitempty"`
+	MaxMemoryMB   int               `json:"max_memory_mb,omitempty"`
+	MaxCPUSeconds int               `json:"max_cpu_seconds,omitempty"`
+	MaxFileSizeMB int               `json:"max_file_size_mb,omitempty"`
 }
 
 func ShScriptWriteAndRun(ctx context.Context, in ShRequest) RunResponse {
@@ -356,6 +812,10 @@ func ShScriptWriteAndRun(ctx context.Context, in ShRequest) RunResponse {
 	if in.Shebang == "" || in.Content == "" {
 		return RunResponse{ExitCode: 1, Error: "shebang and content required"}
 	}
+	lim := rlimit.Limits{MaxMemoryMB: in.MaxMemoryMB, MaxCPUSeconds: in.MaxCPUSeconds, MaxFileSizeMB: in.MaxFileSizeMB}
+	if err := lim.Validate(); err != nil {
+		return RunResponse{ExitCode: 1, Error: err.Error()}
+	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
 		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
@@ -364,6 +824,13 @@ func ShScriptWriteAndRun(ctx context.Context, in ShRequest) RunResponse {
 	if in.MaxBytes > 0 {
 		limit = int(in.MaxBytes)
 	}
+	dir := ""
+	if in.Cwd != "" {
+		var err error
+		if dir, err = normalizePath(in.Cwd); err != nil {
+			return RunResponse{ExitCode: 1, Error: err.Error(), ErrorCode: errcode.Of(err), DurationMs: time.Since(start).Milliseconds()}
+		}
+	}
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -376,10 +843,9 @@ func ShScriptWriteAndRun(ctx context.Context, in ShRequest) RunResponse {
 	if err := os.WriteFile(scriptPath, []byte(content), 0o700); err != nil {
 		return RunResponse{ExitCode: 1, Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}
 	}
-	cmd := exec.CommandContext(ctx, scriptPath)
-	if in.Cwd != "" {
-		cmd.Dir = filepath.Clean(in.Cwd)
-	}
+	name, args := lim.Wrap(scriptPath, nil)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
 	if len(in.Env) > 0 {
 		env := os.Environ()
 		for k, v := range in.Env {
@@ -419,7 +885,10 @@ func ShScriptWriteAndRun(ctx context.Context, in ShRequest) RunResponse {
 	if exit == 124 && resp.Stderr == "" {
 		resp.Stderr = "timed out"
 	}
-	audit(struct {
+	if exit != 124 {
+		resp.LimitExceeded = rlimit.Exceeded(lim, cmd.ProcessState, resp.Stderr)
+	}
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Exit       int    `json:"exit"`
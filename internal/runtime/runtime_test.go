@@ -2,8 +2,14 @@ package runtime
 
 import (
 	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
 )
 
 func TestPythonRun(t *testing.T) {
@@ -16,6 +22,47 @@ func TestPythonRun(t *testing.T) {
 	}
 }
 
+func TestPythonRunWorkdir(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	if err := os.MkdirAll(filepath.Join(root, "out"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "out", "old.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp := PythonRun(context.Background(), PythonRunRequest{Code: "open('new.txt','w').write('hi')", Workdir: "out"})
+	if resp.ExitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", resp.ExitCode, resp.Stderr)
+	}
+	want := filepath.Join(root, "out", "new.txt")
+	if len(resp.Artifacts) != 1 || resp.Artifacts[0].Path != want {
+		t.Fatalf("unexpected artifacts %+v", resp.Artifacts)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Fatalf("artifact not kept: %v", err)
+	}
+	bad := PythonRun(context.Background(), PythonRunRequest{Code: "print(1)", Workdir: "../escape"})
+	if bad.ExitCode == 0 {
+		t.Fatalf("expected workspace escape to fail")
+	}
+}
+
+func TestRunEnv(t *testing.T) {
+	py := PythonRun(context.Background(), PythonRunRequest{Code: "import os; print(os.environ['API_BASE'])", Env: map[string]string{"API_BASE": "http://x"}})
+	if py.ExitCode != 0 || strings.TrimSpace(py.Stdout) != "http://x" {
+		t.Fatalf("unexpected python result %+v", py)
+	}
+	node := NodeRun(context.Background(), NodeRunRequest{Code: "console.log(process.env.API_BASE)", Env: map[string]string{"API_BASE": "http://y"}})
+	if node.ExitCode != 0 || strings.TrimSpace(node.Stdout) != "http://y" {
+		t.Fatalf("unexpected node result %+v", node)
+	}
+	env := childEnv(map[string]string{"PATH": "/custom"}, "/venv/bin")
+	if last := env[len(env)-1]; last != "PATH=/venv/bin:/custom" {
+		t.Fatalf("venv bin should lead PATH, got %q", last)
+	}
+}
+
 func TestNodeRun(t *testing.T) {
 	resp := NodeRun(context.Background(), NodeRunRequest{Code: "console.log(1+2)"})
 	if resp.ExitCode != 0 {
@@ -26,6 +73,139 @@ func TestNodeRun(t *testing.T) {
 	}
 }
 
+func TestNodeRunWorkdir(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	mod := filepath.Join(root, "app", "node_modules", "greet")
+	if err := os.MkdirAll(mod, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(mod, "index.js"), []byte("module.exports = n => 'hi ' + n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	code := "require('fs').writeFileSync('out.txt', 'x'); console.log(require('greet')('node'))"
+	resp := NodeRun(context.Background(), NodeRunRequest{Code: code, Workdir: "app"})
+	if resp.ExitCode != 0 || strings.TrimSpace(resp.Stdout) != "hi node" {
+		t.Fatalf("unexpected result %+v", resp)
+	}
+	if len(resp.Artifacts) != 1 || filepath.Base(resp.Artifacts[0].Path) != "out.txt" {
+		t.Fatalf("unexpected artifacts %+v", resp.Artifacts)
+	}
+	entries, _ := os.ReadDir(filepath.Join(root, "app"))
+	if len(entries) != 2 {
+		t.Fatalf("expected only node_modules and out.txt to remain, got %v", entries)
+	}
+}
+
+func TestNodeRunWorkdirESMProject(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	if err := os.MkdirAll(filepath.Join(root, "esm"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "esm", "package.json"), []byte(`{"name":"esm","type":"module"}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// the script stays CommonJS even though the project defaults to ESM
+	resp := NodeRun(context.Background(), NodeRunRequest{Code: "console.log(typeof require)", Workdir: "esm"})
+	if resp.ExitCode != 0 || strings.TrimSpace(resp.Stdout) != "function" {
+		t.Fatalf("unexpected result %+v", resp)
+	}
+}
+
+func TestVenvListRemove(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	if got := VenvList(context.Background(), VenvListRequest{}); got.Error != "" || len(got.Venvs) != 0 {
+		t.Fatalf("expected no venvs, got %+v", got)
+	}
+	site := filepath.Join(root, ".venvs", "tools", "lib", "python3.12", "site-packages")
+	for _, d := range []string{"requests-2.31.0.dist-info", "rich-13.7.0.dist-info", "requests"} {
+		if err := os.MkdirAll(filepath.Join(site, d), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, ".venvs", "tools", "pyvenv.cfg"), nil, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// a run holding the shared lock keeps the venv from being removed
+	unlock, err := RLockVenv(context.Background(), "tools")
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	if rm := VenvRemove(ctx, VenvRemoveRequest{Name: "tools"}); rm.Removed || !strings.Contains(rm.Error, "busy") {
+		t.Fatalf("expected removal to wait for the run, got %+v", rm)
+	}
+	cancel()
+	unlock()
+	list := VenvList(context.Background(), VenvListRequest{})
+	if len(list.Venvs) != 1 || list.Venvs[0].Name != "tools" || list.Venvs[0].Packages != 2 {
+		t.Fatalf("unexpected list %+v", list)
+	}
+	if bad := VenvRemove(context.Background(), VenvRemoveRequest{Name: ".."}); bad.Removed || bad.Error == "" {
+		t.Fatalf("expected invalid name to be rejected, got %+v", bad)
+	}
+	if rm := VenvRemove(context.Background(), VenvRemoveRequest{Name: "tools"}); !rm.Removed {
+		t.Fatalf("expected removal, got %+v", rm)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".venvs", "tools")); !os.IsNotExist(err) {
+		t.Fatalf("venv still present: %v", err)
+	}
+	if again := VenvRemove(context.Background(), VenvRemoveRequest{Name: "tools"}); again.Removed || again.Error == "" {
+		t.Fatalf("expected missing venv error, got %+v", again)
+	}
+}
+
+func TestGoRun(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not installed")
+	}
+	code := `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	_ = os.WriteFile("out.txt", []byte("x"), 0o644)
+	fmt.Println(len(os.Args) - 1)
+}
+`
+	resp := GoRun(context.Background(), GoRunRequest{Code: code, Args: []string{"a", "b"}})
+	if resp.ExitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", resp.ExitCode, resp.Stderr)
+	}
+	if strings.TrimSpace(resp.Stdout) != "2" {
+		t.Fatalf("unexpected stdout %q", resp.Stdout)
+	}
+	if len(resp.Artifacts) != 1 || filepath.Base(resp.Artifacts[0].Path) != "out.txt" {
+		t.Fatalf("unexpected artifacts %+v", resp.Artifacts)
+	}
+}
+
+func TestDenoRun(t *testing.T) {
+	flags, err := denoFlags([]string{"net=example.com", "read"})
+	if err != nil || strings.Join(flags, " ") != "--allow-net=example.com --allow-read" {
+		t.Fatalf("unexpected flags %v (%v)", flags, err)
+	}
+	if _, err := denoFlags([]string{"everything"}); err == nil {
+		t.Fatalf("expected unknown permission error")
+	}
+	if _, err := exec.LookPath("deno"); err != nil {
+		t.Skip("deno not installed")
+	}
+	resp := DenoRun(context.Background(), DenoRunRequest{Code: "const n: number = 1 + 2; console.log(n)"})
+	if resp.ExitCode != 0 || strings.TrimSpace(resp.Stdout) != "3" {
+		t.Fatalf("unexpected result %+v", resp)
+	}
+	denied := DenoRun(context.Background(), DenoRunRequest{Code: "Deno.readTextFileSync('/etc/hostname')"})
+	if denied.ExitCode == 0 {
+		t.Fatalf("expected read without permission to fail")
+	}
+}
+
 func TestShScriptWriteAndRun(t *testing.T) {
 	resp := ShScriptWriteAndRun(context.Background(), ShRequest{Shebang: "/bin/bash", Content: "echo hi"})
 	if resp.ExitCode != 0 {
@@ -34,6 +214,10 @@ func TestShScriptWriteAndRun(t *testing.T) {
 	if strings.TrimSpace(resp.Stdout) != "hi" {
 		t.Fatalf("unexpected stdout %q", resp.Stdout)
 	}
+	t.Setenv("WORKSPACE", t.TempDir())
+	if resp := ShScriptWriteAndRun(context.Background(), ShRequest{Shebang: "/bin/sh", Content: "pwd", Cwd: "/"}); !strings.Contains(resp.Error, "escapes workspace") {
+		t.Fatalf("expected cwd outside the workspace to be refused, got %+v", resp)
+	}
 }
 
 func TestPythonRunError(t *testing.T) {
@@ -45,3 +229,53 @@ func TestPythonRunError(t *testing.T) {
 		t.Fatalf("stderr missing ValueError: %s", resp.Stderr)
 	}
 }
+
+func TestRunResourceLimits(t *testing.T) {
+	ctx := context.Background()
+	resp := PythonRun(ctx, PythonRunRequest{Code: "b = bytearray(512 * 1024 * 1024)\n", MaxMemoryMB: 256})
+	if resp.ExitCode == 0 || resp.LimitExceeded != "memory" {
+		t.Fatalf("expected memory limit, got %+v", resp)
+	}
+	resp = PythonRun(ctx, PythonRunRequest{Code: "while True: pass\n", MaxCPUSeconds: 1, TimeoutMs: 10000})
+	if resp.LimitExceeded != "cpu" {
+		t.Fatalf("expected cpu limit, got %+v", resp)
+	}
+	sh := ShScriptWriteAndRun(ctx, ShRequest{Shebang: "/bin/sh", Content: "head -c 2000000 /dev/zero > " + filepath.Join(t.TempDir(), "big"), MaxFileSizeMB: 1})
+	if sh.LimitExceeded != "file_size" {
+		t.Fatalf("expected file size limit, got %+v", sh)
+	}
+	if ok := PythonRun(ctx, PythonRunRequest{Code: "print('ok')", MaxMemoryMB: 256}); ok.ExitCode != 0 || ok.LimitExceeded != "" {
+		t.Fatalf("unexpected limited run %+v", ok)
+	}
+}
+
+func TestRunPackagesAllowList(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	list := filepath.Join(root, "allow.yaml")
+	if err := os.WriteFile(list, []byte("pip: [requests]\nnpm: [lodash]\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	t.Setenv("PKG_ALLOW_LIST", list)
+	ctx := context.Background()
+
+	py := PythonRun(ctx, PythonRunRequest{Code: "print(1)", Venv: &VenvSpec{Name: "t", CreateIfMissing: true}, Packages: []string{"evil"}})
+	if py.ErrorCode != errcode.PolicyBlocked || !strings.Contains(py.Error, `"evil"`) {
+		t.Fatalf("expected python.run packages to be blocked, got %+v", py)
+	}
+	node := NodeRun(ctx, NodeRunRequest{Code: "1", Packages: []string{"lodash", "evil"}})
+	if node.ErrorCode != errcode.PolicyBlocked || !strings.Contains(node.Error, `"evil"`) {
+		t.Fatalf("expected node.run packages to be blocked, got %+v", node)
+	}
+	// a workdir project's declared dependencies are checked too
+	proj := filepath.Join(root, "proj")
+	if err := os.MkdirAll(proj, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(proj, "package.json"), []byte(`{"dependencies":{"lodash":"^4","evil":"1"}}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if node := NodeRun(ctx, NodeRunRequest{Code: "1", Workdir: "proj"}); node.ErrorCode != errcode.PolicyBlocked {
+		t.Fatalf("expected project dependencies to be blocked, got %+v", node)
+	}
+}
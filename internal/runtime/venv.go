@@ -0,0 +1,247 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gaspardpetit/mcp-shell/internal/pkgpolicy"
+)
+
+// ---- python.venv.list / python.venv.remove ----
+
+func venvsRoot() string {
+	return filepath.Join(workspaceRoot(), ".venvs")
+}
+
+// venvPath returns the directory for the named venv under .venvs, rejecting
+// names that would leave it.
+func venvPath(name string) (string, error) {
+	if name == "" {
+		name = "default"
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid venv name %q", name)
+	}
+	return filepath.Join(venvsRoot(), name), nil
+}
+
+// venvLockRetry is how often a contended venv lock is retried.
+const venvLockRetry = 50 * time.Millisecond
+
+// LockVenv takes an exclusive lock for the named venv so that creating,
+// installing into or removing it is serialized across concurrent calls,
+// including from other processes sharing the workspace. It waits until the
+// lock is free or ctx is done. The returned function releases the lock.
+func LockVenv(ctx context.Context, name string) (func(), error) {
+	return lockVenv(ctx, name, syscall.LOCK_EX)
+}
+
+// RLockVenv takes a shared lock for the named venv, held by runs using it so
+// that VenvRemove waits for them instead of deleting it mid-run.
+func RLockVenv(ctx context.Context, name string) (func(), error) {
+	return lockVenv(ctx, name, syscall.LOCK_SH)
+}
+
+func lockVenv(ctx context.Context, name string, how int) (func(), error) {
+	dir, err := venvPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(venvsRoot(), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(venvsRoot(), "."+filepath.Base(dir)+".lock"), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, fmt.Errorf("venv %q is busy: %w", filepath.Base(dir), ctx.Err())
+		case <-time.After(venvLockRetry):
+		}
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// prepareVenv creates the venv described by spec when allowed and installs
+// the requested packages into it, holding the venv lock throughout so
+// parallel runs sharing a venv neither race on creation nor on pip. It
+// returns holding a shared lock, which the caller releases once the run is
+// over.
+func prepareVenv(ctx context.Context, spec *VenvSpec, reqPath string, pkgs []string) (string, func(), error) {
+	dir, err := setupVenv(ctx, spec, reqPath, pkgs)
+	if err != nil {
+		return "", nil, err
+	}
+	unlock, err := RLockVenv(ctx, spec.Name)
+	if err != nil {
+		return "", nil, err
+	}
+	// the venv may have been removed between the two locks
+	if _, err := os.Stat(filepath.Join(dir, "pyvenv.cfg")); err != nil {
+		unlock()
+		return "", nil, errors.New("venv not found")
+	}
+	return dir, unlock, nil
+}
+
+// checkPipAllowed applies PKG_ALLOW_LIST to the packages and requirements
+// file of a run, as pip.install does.
+func checkPipAllowed(pkgs []string, reqPath string) error {
+	specs := pkgs
+	if reqPath != "" && os.Getenv("PKG_ALLOW_LIST") != "" {
+		fromFile, err := pkgpolicy.RequirementSpecs(reqPath)
+		if err != nil {
+			return err
+		}
+		specs = append(append([]string{}, specs...), fromFile...)
+	}
+	return pkgpolicy.Check("pip", specs)
+}
+
+// setupVenv does the creation and installs of prepareVenv under the
+// exclusive lock.
+func setupVenv(ctx context.Context, spec *VenvSpec, reqPath string, pkgs []string) (string, error) {
+	dir, err := venvPath(spec.Name)
+	if err != nil {
+		return "", err
+	}
+	if err := checkPipAllowed(pkgs, reqPath); err != nil {
+		return "", err
+	}
+	unlock, err := LockVenv(ctx, spec.Name)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if !spec.CreateIfMissing {
+			return "", errors.New("venv not found")
+		}
+		if err := exec.CommandContext(ctx, "python3", "-m", "venv", dir).Run(); err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("venv create failed: %v", err)
+		}
+	}
+	if len(pkgs) > 0 || reqPath != "" {
+		pipArgs := []string{"-m", "pip", "install"}
+		if reqPath != "" {
+			pipArgs = append(pipArgs, "-r", reqPath)
+		}
+		pipArgs = append(pipArgs, pkgs...)
+		cmd := exec.CommandContext(ctx, filepath.Join(dir, "bin", "python"), pipArgs...)
+		var stderr bytes.Buffer
+		cmd.Stdout = io.Discard
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("pip install: %s", stderr.String())
+		}
+	}
+	return dir, nil
+}
+
+type VenvListRequest struct{}
+
+type VenvInfo struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Packages int    `json:"packages"`
+}
+
+type VenvListResponse struct {
+	Venvs      []VenvInfo `json:"venvs"`
+	DurationMs int64      `json:"duration_ms"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// VenvList reports the venvs under .venvs with the number of installed
+// distributions in each, counted from their dist-info directories.
+func VenvList(ctx context.Context, _ VenvListRequest) VenvListResponse {
+	start := time.Now()
+	entries, err := os.ReadDir(venvsRoot())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return VenvListResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	venvs := []VenvInfo{}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(venvsRoot(), e.Name())
+		if _, err := os.Stat(filepath.Join(dir, "pyvenv.cfg")); err != nil {
+			continue
+		}
+		dists, _ := filepath.Glob(filepath.Join(dir, "lib", "python*", "site-packages", "*.dist-info"))
+		venvs = append(venvs, VenvInfo{Name: e.Name(), Path: dir, Packages: len(dists)})
+	}
+	sort.Slice(venvs, func(i, j int) bool { return venvs[i].Name < venvs[j].Name })
+	return VenvListResponse{Venvs: venvs, DurationMs: time.Since(start).Milliseconds()}
+}
+
+type VenvRemoveRequest struct {
+	Name string `json:"name"`
+}
+
+type VenvRemoveResponse struct {
+	Removed    bool   `json:"removed"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// VenvRemove deletes the named venv, waiting for any run that is creating,
+// installing into or running in it to finish first.
+func VenvRemove(ctx context.Context, in VenvRemoveRequest) VenvRemoveResponse {
+	start := time.Now()
+	if in.Name == "" {
+		return VenvRemoveResponse{Error: "name is required"}
+	}
+	dir, err := venvPath(in.Name)
+	if err != nil {
+		return VenvRemoveResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	unlock, err := LockVenv(ctx, in.Name)
+	if err != nil {
+		return VenvRemoveResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	defer unlock()
+	resp := VenvRemoveResponse{}
+	if _, err := os.Stat(dir); err != nil {
+		resp.Error = "venv not found"
+	} else if err := os.RemoveAll(dir); err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Removed = true
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Venv       string `json:"venv"`
+		Removed    bool   `json:"removed"`
+		DurationMs int64  `json:"duration_ms"`
+	}{time.Now().UTC().Format(time.RFC3339), "python.venv.remove", in.Name, resp.Removed, resp.DurationMs})
+	return resp
+}
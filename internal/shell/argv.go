@@ -0,0 +1,197 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/dryrun"
+)
+
+// ArgvRequest runs a program directly with an explicit argument list. Nothing
+// is interpreted by a shell, so arguments cannot inject extra commands.
+type ArgvRequest struct {
+	Cmd       string            `json:"cmd"` // program name or path, required
+	Args      []string          `json:"args,omitempty"`
+	Cwd       string            `json:"cwd,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	TimeoutMs int               `json:"timeout_ms,omitempty"`
+	Stdin     string            `json:"stdin,omitempty"`
+	MaxBytes  int64             `json:"max_bytes,omitempty"` // per stream (stdout/stderr)
+	DryRun    bool              `json:"dry_run,omitempty"`
+}
+
+func matchesAny(res []*regexp.Regexp, lines ...string) bool {
+	for _, re := range res {
+		for _, l := range lines {
+			if re.MatchString(l) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// argvAllowed applies SHELL_EXEC_ALLOW/DENY to the command line as it would
+// be typed (program name plus arguments) and to the same line with the
+// resolved path, so an absolute path cannot sidestep a deny pattern.
+func argvAllowed(resolved string, args []string) bool {
+	rest := ""
+	if len(args) > 0 {
+		rest = " " + strings.Join(args, " ")
+	}
+	short, full := filepath.Base(resolved)+rest, resolved+rest
+	if len(allowPatterns) > 0 && !matchesAny(allowPatterns, short, full) {
+		return false
+	}
+	return !matchesAny(denyPatterns, short, full)
+}
+
+// exitStatus maps the result of cmd.Run to an exit code, killing the process
+// group and returning 124 when ctx hit its deadline.
+func exitStatus(ctx context.Context, cmd *exec.Cmd, runErr error) int {
+	if runErr == nil {
+		return 0
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		if cmd.Process != nil {
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		return 124
+	}
+	var ee *exec.ExitError
+	if errors.As(runErr, &ee) {
+		return ee.ExitCode()
+	}
+	return 1
+}
+
+func ArgvExec(ctx context.Context, in ArgvRequest) ExecResponse {
+	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
+	if in.Cmd == "" {
+		resp := ExecResponse{ExitCode: 127, DurationMs: time.Since(start).Milliseconds(), Error: "cmd is required"}
+		auditArgv(ctx, in, "", resp, "")
+		return resp
+	}
+	resolved, err := exec.LookPath(in.Cmd)
+	if err != nil {
+		resp := ExecResponse{ExitCode: 127, DurationMs: time.Since(start).Milliseconds(), Error: fmt.Sprintf("command not found: %s", in.Cmd)}
+		auditArgv(ctx, in, in.Cmd, resp, "")
+		return resp
+	}
+	if abs, err := filepath.Abs(resolved); err == nil {
+		resolved = abs
+	}
+	if !argvAllowed(resolved, in.Args) {
+		resp := ExecResponse{
+			Stderr:     "command blocked by policy",
+			ExitCode:   126,
+			DurationMs: time.Since(start).Milliseconds(),
+			Error:      "command blocked",
+		}
+		auditArgv(ctx, in, resolved, resp, "")
+		return resp
+	}
+	if in.DryRun {
+		resp := ExecResponse{
+			Stdout:     "[dry_run] would execute: " + strings.Join(append([]string{resolved}, in.Args...), " "),
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		auditArgv(ctx, in, resolved, resp, "")
+		return resp
+	}
+
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, resolved, in.Args...)
+	if cmd.Dir, err = workDir(in.Cwd); err != nil {
+		resp := ExecResponse{ExitCode: 1, DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		auditArgv(ctx, in, resolved, resp, "")
+		return resp
+	}
+	if len(in.Env) > 0 {
+		env := os.Environ()
+		for k, v := range in.Env {
+			env = append(env, fmt.Sprintf("%s=%s", k, v))
+		}
+		cmd.Env = env
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if in.Stdin != "" {
+		stdin := []byte(in.Stdin)
+		if len(stdin) > DefaultMaxStdin {
+			stdin = stdin[:DefaultMaxStdin]
+		}
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var (
+		stdoutBuf, stderrBuf     bytes.Buffer
+		stdoutTrunc, stderrTrunc bool
+	)
+	cmd.Stdout = &limitedWriter{buf: &stdoutBuf, limit: limit, truncated: &stdoutTrunc}
+	cmd.Stderr = &limitedWriter{buf: &stderrBuf, limit: limit, truncated: &stderrTrunc}
+
+	exit := exitStatus(ctx, cmd, cmd.Run())
+	resp := ExecResponse{
+		Stdout:          stdoutBuf.String(),
+		Stderr:          stderrBuf.String(),
+		ExitCode:        exit,
+		DurationMs:      time.Since(start).Milliseconds(),
+		StdoutTruncated: stdoutTrunc,
+		StderrTruncated: stderrTrunc,
+	}
+	if exit == 124 && resp.Stderr == "" {
+		resp.Stderr = "timed out"
+	}
+	auditArgv(ctx, in, resolved, resp, cmd.Dir)
+	return resp
+}
+
+func auditArgv(ctx context.Context, in ArgvRequest, resolved string, out ExecResponse, cwd string) {
+	auditlog.Write(ctx, struct {
+		TS              string   `json:"ts"`
+		Tool            string   `json:"tool"`
+		Cmd             string   `json:"cmd"`
+		Args            []string `json:"args,omitempty"`
+		Cwd             string   `json:"cwd,omitempty"`
+		Exit            int      `json:"exit"`
+		DurationMs      int64    `json:"duration_ms"`
+		BytesOut        int      `json:"bytes_out"`
+		StdoutTruncated bool     `json:"stdout_truncated"`
+		StderrTruncated bool     `json:"stderr_truncated"`
+		TimeoutMs       int      `json:"timeout_ms,omitempty"`
+		DryRun          bool     `json:"dry_run,omitempty"`
+	}{
+		TS:              time.Now().UTC().Format(time.RFC3339),
+		Tool:            "exec.run",
+		Cmd:             resolved,
+		Args:            in.Args,
+		Cwd:             cwd,
+		Exit:            out.ExitCode,
+		DurationMs:      out.DurationMs,
+		BytesOut:        len(out.Stdout) + len(out.Stderr),
+		StdoutTruncated: out.StdoutTruncated,
+		StderrTruncated: out.StderrTruncated,
+		TimeoutMs:       in.TimeoutMs,
+		DryRun:          in.DryRun,
+	})
+}
@@ -0,0 +1,47 @@
+package shell
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+func TestArgvExecNoShell(t *testing.T) {
+	resp := ArgvExec(context.Background(), ArgvRequest{Cmd: "echo", Args: []string{"a; echo b", "$HOME"}})
+	if resp.ExitCode != 0 || resp.Stdout != "a; echo b $HOME\n" {
+		t.Fatalf("arguments were interpreted: %+v", resp)
+	}
+	if resp := ArgvExec(context.Background(), ArgvRequest{Cmd: "sh", Args: []string{"-c", "exit 3"}}); resp.ExitCode != 3 {
+		t.Fatalf("expected exit 3, got %+v", resp)
+	}
+	if resp := ArgvExec(context.Background(), ArgvRequest{Cmd: "sleep", Args: []string{"1"}, TimeoutMs: 100}); resp.ExitCode != 124 {
+		t.Fatalf("expected timeout, got %+v", resp)
+	}
+	if resp := ArgvExec(context.Background(), ArgvRequest{Cmd: "definitely-not-a-command"}); resp.ExitCode != 127 {
+		t.Fatalf("expected 127, got %+v", resp)
+	}
+	if resp := ArgvExec(context.Background(), ArgvRequest{}); resp.ExitCode != 127 || resp.Error != "cmd is required" {
+		t.Fatalf("expected missing cmd error, got %+v", resp)
+	}
+}
+
+func TestArgvExecPolicy(t *testing.T) {
+	oldAllow, oldDeny := allowPatterns, denyPatterns
+	defer func() { allowPatterns, denyPatterns = oldAllow, oldDeny }()
+
+	denyPatterns = []*regexp.Regexp{regexp.MustCompile(`^rm\b`)}
+	for _, cmd := range []string{"rm", "/bin/rm"} {
+		if resp := ArgvExec(context.Background(), ArgvRequest{Cmd: cmd, Args: []string{"-rf", "/nonexistent"}}); resp.ExitCode != 126 {
+			t.Fatalf("%s should be blocked: %+v", cmd, resp)
+		}
+	}
+
+	denyPatterns = nil
+	allowPatterns = []*regexp.Regexp{regexp.MustCompile(`^echo\b`)}
+	if resp := ArgvExec(context.Background(), ArgvRequest{Cmd: "echo", Args: []string{"ok"}}); resp.ExitCode != 0 {
+		t.Fatalf("echo should be allowed: %+v", resp)
+	}
+	if resp := ArgvExec(context.Background(), ArgvRequest{Cmd: "true"}); resp.ExitCode != 126 {
+		t.Fatalf("true is not on the allow-list: %+v", resp)
+	}
+}
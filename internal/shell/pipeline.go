@@ -0,0 +1,216 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gaspardpetit/mcp-shell/internal/rlimit"
+)
+
+// pipelineString renders stages as they would be typed, for dry runs.
+func pipelineString(stages [][]string) string {
+	parts := make([]string, len(stages))
+	for i, s := range stages {
+		parts[i] = strings.Join(s, " ")
+	}
+	return strings.Join(parts, " | ")
+}
+
+// lockedWriter serializes writes from stages that share one stream.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// brokenPipe reports whether a stage was ended by SIGPIPE, which only means
+// a later stage stopped reading (as with `yes | head`) and is not a failure.
+func brokenPipe(cmd *exec.Cmd) bool {
+	if cmd.ProcessState == nil {
+		return false
+	}
+	ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	return ok && ws.Signaled() && ws.Signal() == syscall.SIGPIPE
+}
+
+// runPipeline runs in.Stages without a shell, connecting each stage's stdout
+// to the next stage's stdin. Stdout is the last stage's; stderr is shared by
+// all stages. The exit code is that of the first failing stage, or of the
+// last stage when all succeed.
+func runPipeline(ctx context.Context, in ExecRequest, start time.Time) ExecResponse {
+	fail := func(exit int, msg string) ExecResponse {
+		resp := ExecResponse{ExitCode: exit, DurationMs: time.Since(start).Milliseconds(), Error: msg}
+		_ = audit(ctx, in, resp, "")
+		return resp
+	}
+	if in.Cmd != "" {
+		return fail(1, "set either cmd or stages, not both")
+	}
+	if in.Background {
+		return fail(1, "background is not supported with stages")
+	}
+	resolved := make([]string, len(in.Stages))
+	for i, stage := range in.Stages {
+		if len(stage) == 0 || stage[0] == "" {
+			return fail(127, fmt.Sprintf("stage %d is empty", i))
+		}
+		path, err := exec.LookPath(stage[0])
+		if err != nil {
+			return fail(127, fmt.Sprintf("command not found: %s", stage[0]))
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if !argvAllowed(path, stage[1:]) {
+			resp := ExecResponse{
+				Stderr:     "command blocked by policy",
+				ExitCode:   126,
+				DurationMs: time.Since(start).Milliseconds(),
+				Error:      "command blocked",
+			}
+			_ = audit(ctx, in, resp, "")
+			return resp
+		}
+		resolved[i] = path
+	}
+	if in.DryRun {
+		resp := ExecResponse{
+			Stdout:     "[dry_run] would execute: " + pipelineString(in.Stages),
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		_ = audit(ctx, in, resp, "")
+		return resp
+	}
+
+	timeout := DefaultTimeout
+	if in.TimeoutMs > 0 {
+		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
+	}
+	limit := DefaultMaxIO
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var env []string
+	if len(in.Env) > 0 {
+		env = os.Environ()
+		for k, v := range in.Env {
+			env = append(env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	dir, err := workDir(in.Cwd)
+	if err != nil {
+		return fail(1, err.Error())
+	}
+
+	var (
+		stdoutBuf, stderrBuf     bytes.Buffer
+		stdoutTrunc, stderrTrunc bool
+	)
+	stdout := &lockedWriter{w: &limitedWriter{buf: &stdoutBuf, limit: limit, truncated: &stdoutTrunc}}
+	stderr := &lockedWriter{w: &limitedWriter{buf: &stderrBuf, limit: limit, truncated: &stderrTrunc}}
+	if in.CombineOutput {
+		stderr = stdout
+	}
+
+	lim := in.limits()
+	cmds := make([]*exec.Cmd, len(in.Stages))
+	// parent copies of the pipe ends, closed once the stages have started
+	var ends []*os.File
+	closeEnds := func() {
+		for _, f := range ends {
+			f.Close()
+		}
+		ends = nil
+	}
+	defer closeEnds()
+	for i, stage := range in.Stages {
+		name, args := lim.Wrap(resolved[i], stage[1:])
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Dir = dir
+		cmd.Env = env
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		cmd.Stderr = stderr
+		if i == 0 && in.Stdin != "" {
+			stdin := []byte(in.Stdin)
+			if len(stdin) > DefaultMaxStdin {
+				stdin = stdin[:DefaultMaxStdin]
+			}
+			cmd.Stdin = bytes.NewReader(stdin)
+		}
+		if i > 0 {
+			r, w, err := os.Pipe()
+			if err != nil {
+				return fail(1, err.Error())
+			}
+			ends = append(ends, r, w)
+			cmds[i-1].Stdout = w
+			cmd.Stdin = r
+		}
+		cmds[i] = cmd
+	}
+	cmds[len(cmds)-1].Stdout = stdout
+
+	started := 0
+	var startErr error
+	for _, cmd := range cmds {
+		if startErr = cmd.Start(); startErr != nil {
+			break
+		}
+		started++
+	}
+	closeEnds()
+	if startErr != nil {
+		for _, cmd := range cmds[:started] {
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			_ = cmd.Wait()
+		}
+		return fail(127, startErr.Error())
+	}
+
+	exits := make([]int, len(cmds))
+	for i, cmd := range cmds {
+		exits[i] = exitStatus(ctx, cmd, cmd.Wait())
+	}
+	exit := exits[len(exits)-1]
+	failed := cmds[len(cmds)-1]
+	for i, code := range exits {
+		if code != 0 && !(i < len(cmds)-1 && brokenPipe(cmds[i])) {
+			exit, failed = code, cmds[i]
+			break
+		}
+	}
+
+	resp := ExecResponse{
+		Stdout:          stdoutBuf.String(),
+		Stderr:          stderrBuf.String(),
+		ExitCode:        exit,
+		DurationMs:      time.Since(start).Milliseconds(),
+		StdoutTruncated: stdoutTrunc,
+		StderrTruncated: stderrTrunc,
+	}
+	if exit == 124 && resp.Stderr == "" && !in.CombineOutput {
+		resp.Stderr = "timed out"
+	}
+	if exit != 124 {
+		resp.LimitExceeded = rlimit.Exceeded(lim, failed.ProcessState, resp.Stdout+resp.Stderr)
+	}
+	_ = audit(ctx, in, resp, dir)
+	return resp
+}
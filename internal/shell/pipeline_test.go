@@ -0,0 +1,46 @@
+package shell
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+func TestRunStages(t *testing.T) {
+	ctx := context.Background()
+	resp := Run(ctx, ExecRequest{Stages: [][]string{{"printf", "b\\na\\nb\\n"}, {"sort"}, {"uniq", "-c"}, {"wc", "-l"}}})
+	if resp.Error != "" || resp.ExitCode != 0 || resp.Stdout != "2\n" {
+		t.Fatalf("unexpected pipeline result %+v", resp)
+	}
+	resp = Run(ctx, ExecRequest{Stdin: "it's $HOME\n", Stages: [][]string{{"cat"}, {"tr", "a-z", "A-Z"}}})
+	if resp.Stdout != "IT'S $HOME\n" {
+		t.Fatalf("stdin not piped through: %q", resp.Stdout)
+	}
+	// the first failing stage decides the exit code
+	resp = Run(ctx, ExecRequest{Stages: [][]string{{"sh", "-c", "echo x; exit 3"}, {"cat"}}})
+	if resp.ExitCode != 3 || resp.Stdout != "x\n" {
+		t.Fatalf("expected exit 3, got %+v", resp)
+	}
+	// an upstream stage killed by SIGPIPE is not a failure
+	resp = Run(ctx, ExecRequest{Stages: [][]string{{"yes"}, {"head", "-n", "2"}}})
+	if resp.ExitCode != 0 || resp.Stdout != "y\ny\n" {
+		t.Fatalf("unexpected head result %+v", resp)
+	}
+	if resp := Run(ctx, ExecRequest{Stages: [][]string{{"echo"}, {}}}); resp.ExitCode != 127 || resp.Error == "" {
+		t.Fatalf("expected empty stage error %+v", resp)
+	}
+	if resp := Run(ctx, ExecRequest{Cmd: "echo", Stages: [][]string{{"echo"}}}); resp.Error == "" {
+		t.Fatalf("expected error when cmd and stages are both set")
+	}
+}
+
+func TestRunStagesPolicy(t *testing.T) {
+	oldAllow, oldDeny := allowPatterns, denyPatterns
+	defer func() { allowPatterns, denyPatterns = oldAllow, oldDeny }()
+
+	denyPatterns = []*regexp.Regexp{regexp.MustCompile(`^rm\b`)}
+	resp := Run(context.Background(), ExecRequest{Stages: [][]string{{"echo", "/tmp/x"}, {"xargs"}, {"rm", "-f", "/nonexistent"}}})
+	if resp.ExitCode != 126 {
+		t.Fatalf("rm stage should be blocked: %+v", resp)
+	}
+}
@@ -4,8 +4,6 @@ package shell
 import (
 	"bytes"
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -14,16 +12,24 @@ import (
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/dryrun"
+	"github.com/gaspardpetit/mcp-shell/internal/iolimit"
+	"github.com/gaspardpetit/mcp-shell/internal/proc"
+	"github.com/gaspardpetit/mcp-shell/internal/rlimit"
 )
 
 // Tunables
 const (
 	DefaultTimeout  = 60 * time.Second
-	DefaultMaxIO    = 1 << 20 // 1 MiB per stream (stdout/stderr)
 	DefaultMaxStdin = 1 << 20 // 1 MiB stdin cap
-	LogPath         = "/logs/mcp-shell.log"
 )
 
+// DefaultMaxIO caps each stream (stdout/stderr) when a request sets no
+// max_bytes; see iolimit for MCP_MAX_IO_BYTES.
+var DefaultMaxIO = iolimit.Default()
+
 var (
 	denyPatterns  []*regexp.Regexp
 	allowPatterns []*regexp.Regexp
@@ -76,13 +82,30 @@ func allowed(cmd string) bool {
 }
 
 type ExecRequest struct {
-	Cmd       string            `json:"cmd"` // required
+	Cmd       string            `json:"cmd,omitempty"` // required unless Stages is set
 	Cwd       string            `json:"cwd,omitempty"`
 	Env       map[string]string `json:"env,omitempty"`
 	TimeoutMs int               `json:"timeout_ms,omitempty"`
 	Stdin     string            `json:"stdin,omitempty"`
 	MaxBytes  int64             `json:"max_bytes,omitempty"` // per stream (stdout/stderr)
 	DryRun    bool              `json:"dry_run,omitempty"`
+	// Background spawns the command in the proc registry and returns its
+	// pid at once; output is collected by proc (not capped by MaxBytes)
+	// until proc.wait.
+	Background bool `json:"background,omitempty"`
+	// Optional rlimits for the command (RLIMIT_AS, RLIMIT_CPU, RLIMIT_FSIZE).
+	MaxMemoryMB   int `json:"max_memory_mb,omitempty"`
+	MaxCPUSeconds int `json:"max_cpu_seconds,omitempty"`
+	MaxFileSizeMB int `json:"max_file_size_mb,omitempty"`
+	// CombineOutput merges stderr into stdout in write order, like 2>&1.
+	CombineOutput bool `json:"combine_output,omitempty"`
+	// Stages runs a pipeline without a shell: each entry is the argv of one
+	// stage and its stdout feeds the next stage's stdin. Cmd must be empty.
+	Stages [][]string `json:"stages,omitempty"`
+}
+
+func (in ExecRequest) limits() rlimit.Limits {
+	return rlimit.Limits{MaxMemoryMB: in.MaxMemoryMB, MaxCPUSeconds: in.MaxCPUSeconds, MaxFileSizeMB: in.MaxFileSizeMB}
 }
 
 type ExecResponse struct {
@@ -92,12 +115,18 @@ type ExecResponse struct {
 	DurationMs      int64  `json:"duration_ms"`
 	StdoutTruncated bool   `json:"stdout_truncated"`
 	StderrTruncated bool   `json:"stderr_truncated"`
+	Pid             int    `json:"pid,omitempty"`
+	LimitExceeded   string `json:"limit_exceeded,omitempty"` // cpu, memory or file_size
 	Error           string `json:"error,omitempty"`
 }
 
 func Run(ctx context.Context, in ExecRequest) ExecResponse {
-	if in.Cmd == "" {
-		return ExecResponse{ExitCode: 127, Error: "cmd is required"}
+	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
+	if in.Cmd == "" && len(in.Stages) == 0 {
+		resp := ExecResponse{ExitCode: 127, DurationMs: time.Since(start).Milliseconds(), Error: "cmd or stages is required"}
+		_ = audit(ctx, in, resp, "")
+		return resp
 	}
 
 	timeout := DefaultTimeout
@@ -110,7 +139,13 @@ func Run(ctx context.Context, in ExecRequest) ExecResponse {
 	}
 	stdinCap := DefaultMaxStdin
 
-	start := time.Now()
+	lim := in.limits()
+	if err := lim.Validate(); err != nil {
+		return ExecResponse{ExitCode: 1, DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	if len(in.Stages) > 0 {
+		return runPipeline(ctx, in, start)
+	}
 	if !allowed(in.Cmd) {
 		resp := ExecResponse{
 			Stderr:     "command blocked by policy",
@@ -118,7 +153,7 @@ func Run(ctx context.Context, in ExecRequest) ExecResponse {
 			DurationMs: time.Since(start).Milliseconds(),
 			Error:      "command blocked",
 		}
-		_ = audit(in, resp, "")
+		_ = audit(ctx, in, resp, "")
 		return resp
 	}
 	if in.DryRun {
@@ -127,23 +162,30 @@ func Run(ctx context.Context, in ExecRequest) ExecResponse {
 			ExitCode:   0,
 			DurationMs: time.Since(start).Milliseconds(),
 		}
-		_ = audit(in, resp, "")
+		_ = audit(ctx, in, resp, "")
 		return resp
 	}
 
+	if in.Background {
+		return runBackground(ctx, in, start)
+	}
+
 	// Deadline-bound context for the subprocess
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "bash", "-lc", in.Cmd)
+	name, args := lim.Wrap("bash", []string{"-lc", in.Cmd})
+	cmd := exec.CommandContext(ctx, name, args...)
 
 	// Working directory: default to $WORKSPACE if not provided
-	if in.Cwd != "" {
-		cmd.Dir = filepath.Clean(in.Cwd)
-	} else if ws := os.Getenv("WORKSPACE"); ws != "" {
-		cmd.Dir = ws
+	dir, err := workDir(in.Cwd)
+	if err != nil {
+		resp := ExecResponse{ExitCode: 1, DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		_ = audit(ctx, in, resp, "")
+		return resp
 	}
+	cmd.Dir = dir
 
 	// Merge environment
 	if len(in.Env) > 0 {
@@ -171,29 +213,19 @@ func Run(ctx context.Context, in ExecRequest) ExecResponse {
 		stdoutBuf, stderrBuf     bytes.Buffer
 		stdoutTrunc, stderrTrunc bool
 	)
-	cmd.Stdout = &limitedWriter{buf: &stdoutBuf, limit: limit, truncated: &stdoutTrunc}
-	cmd.Stderr = &limitedWriter{buf: &stderrBuf, limit: limit, truncated: &stderrTrunc}
-
-	exit := 0
-	runErr := cmd.Run()
-	if runErr != nil {
-		// If the context timed out/cancelled, nuke the whole process group
-		// (negative PGID targets the group)
-		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-			if cmd.Process != nil {
-				_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
-			}
-			exit = 124 // conventional timeout code
-		} else {
-			var ee *exec.ExitError
-			if errors.As(runErr, &ee) {
-				exit = ee.ExitCode()
-			} else {
-				exit = 1
-			}
-		}
+	if in.CombineOutput {
+		// the same writer for both streams makes exec share one pipe
+		w := &limitedWriter{buf: &stdoutBuf, limit: limit, truncated: &stdoutTrunc}
+		cmd.Stdout = w
+		cmd.Stderr = w
+	} else {
+		cmd.Stdout = &limitedWriter{buf: &stdoutBuf, limit: limit, truncated: &stdoutTrunc}
+		cmd.Stderr = &limitedWriter{buf: &stderrBuf, limit: limit, truncated: &stderrTrunc}
 	}
 
+	// on timeout the whole process group is killed and 124 returned
+	exit := exitStatus(ctx, cmd, cmd.Run())
+
 	resp := ExecResponse{
 		Stdout:          stdoutBuf.String(),
 		Stderr:          stderrBuf.String(),
@@ -202,11 +234,33 @@ func Run(ctx context.Context, in ExecRequest) ExecResponse {
 		StdoutTruncated: stdoutTrunc,
 		StderrTruncated: stderrTrunc,
 	}
-	if exit == 124 && resp.Stderr == "" {
+	if exit == 124 && resp.Stderr == "" && !in.CombineOutput {
 		resp.Stderr = "timed out"
 	}
+	if exit != 124 {
+		resp.LimitExceeded = rlimit.Exceeded(lim, cmd.ProcessState, resp.Stdout+resp.Stderr)
+	}
+
+	_ = audit(ctx, in, resp, cmd.Dir) // best-effort
+	return resp
+}
 
-	_ = audit(in, resp, cmd.Dir) // best-effort
+// runBackground hands the command to the proc registry so callers can
+// poll it with proc.wait instead of blocking here.
+func runBackground(ctx context.Context, in ExecRequest, start time.Time) ExecResponse {
+	if in.Stdin != "" {
+		resp := ExecResponse{ExitCode: 1, DurationMs: time.Since(start).Milliseconds(), Error: "stdin is not supported with background; use proc.stdin"}
+		_ = audit(ctx, in, resp, "")
+		return resp
+	}
+	name, args := in.limits().Wrap("bash", []string{"-lc", in.Cmd})
+	sp := proc.Spawn(ctx, proc.SpawnRequest{Cmd: name, Args: args, Cwd: in.Cwd, Env: in.Env})
+	resp := ExecResponse{Pid: sp.Pid, DurationMs: time.Since(start).Milliseconds()}
+	if sp.Error != "" {
+		resp.ExitCode = 1
+		resp.Error = sp.Error
+	}
+	_ = audit(ctx, in, resp, in.Cwd)
 	return resp
 }
 
@@ -236,34 +290,57 @@ func (w *limitedWriter) Write(p []byte) (int, error) {
 }
 
 // audit writes a single JSONL line; failures are ignored by design.
-func audit(in ExecRequest, out ExecResponse, cwd string) error {
-	if LogPath == "" {
-		return nil
+func allowOutside() bool {
+	v := os.Getenv("FS_ALLOW_OUTSIDE_WORKSPACE")
+	return v == "1" || strings.EqualFold(v, "true")
+}
+
+// workDir resolves a command's working directory the way proc.spawn does for
+// background commands: relative to $WORKSPACE and confined to it unless
+// FS_ALLOW_OUTSIDE_WORKSPACE is set. Without cwd it is $WORKSPACE, or the
+// server's own directory when that is unset.
+func workDir(cwd string) (string, error) {
+	ws := os.Getenv("WORKSPACE")
+	if cwd == "" {
+		return ws, nil
 	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return nil
+	root := "/workspace"
+	if ws != "" {
+		root = filepath.Clean(ws)
 	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return nil
+	if !filepath.IsAbs(cwd) {
+		cwd = filepath.Join(root, cwd)
+	}
+	cwd = filepath.Clean(cwd)
+	if allowOutside() {
+		return cwd, nil
 	}
-	defer f.Close()
+	if rel, err := filepath.Rel(root, cwd); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("cwd %q escapes workspace", cwd)
+	}
+	return cwd, nil
+}
 
+func audit(ctx context.Context, in ExecRequest, out ExecResponse, cwd string) error {
 	rec := struct {
-		TS              string `json:"ts"`
-		Tool            string `json:"tool"`
-		Cmd             string `json:"cmd"`
-		Cwd             string `json:"cwd,omitempty"`
-		Exit            int    `json:"exit"`
-		DurationMs      int64  `json:"duration_ms"`
-		BytesOut        int    `json:"bytes_out"`
-		StdoutTruncated bool   `json:"stdout_truncated"`
-		StderrTruncated bool   `json:"stderr_truncated"`
-		TimeoutMs       int    `json:"timeout_ms,omitempty"`
+		TS              string     `json:"ts"`
+		Tool            string     `json:"tool"`
+		Cmd             string     `json:"cmd,omitempty"`
+		Stages          [][]string `json:"stages,omitempty"`
+		Cwd             string     `json:"cwd,omitempty"`
+		Exit            int        `json:"exit"`
+		DurationMs      int64      `json:"duration_ms"`
+		BytesOut        int        `json:"bytes_out"`
+		StdoutTruncated bool       `json:"stdout_truncated"`
+		StderrTruncated bool       `json:"stderr_truncated"`
+		TimeoutMs       int        `json:"timeout_ms,omitempty"`
+		Pid             int        `json:"pid,omitempty"`
+		LimitExceeded   string     `json:"limit_exceeded,omitempty"`
 	}{
 		TS:              time.Now().UTC().Format(time.RFC3339),
 		Tool:            "shell.exec",
 		Cmd:             in.Cmd,
+		Stages:          in.Stages,
 		Cwd:             cwd,
 		Exit:            out.ExitCode,
 		DurationMs:      out.DurationMs,
@@ -271,8 +348,10 @@ func audit(in ExecRequest, out ExecResponse, cwd string) error {
 		StdoutTruncated: out.StdoutTruncated,
 		StderrTruncated: out.StderrTruncated,
 		TimeoutMs:       in.TimeoutMs,
+		Pid:             out.Pid,
+		LimitExceeded:   out.LimitExceeded,
 	}
 
-	enc := json.NewEncoder(f)
-	return enc.Encode(rec)
+	auditlog.Write(ctx, rec)
+	return nil
 }
@@ -2,8 +2,12 @@ package shell
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/gaspardpetit/mcp-shell/internal/proc"
 )
 
 func TestRunSuccess(t *testing.T) {
@@ -42,3 +46,75 @@ func TestRunStdoutTruncation(t *testing.T) {
 		t.Fatalf("stdout length %d exceeds limit", len(resp.Stdout))
 	}
 }
+
+func TestRunCombineOutput(t *testing.T) {
+	resp := Run(context.Background(), ExecRequest{Cmd: "echo one; echo two >&2; echo three", CombineOutput: true})
+	// login shells may print profile noise first; only the ordering matters
+	if !strings.HasSuffix(resp.Stdout, "one\ntwo\nthree\n") || resp.Stderr != "" {
+		t.Fatalf("unexpected combined output %+v", resp)
+	}
+	resp = Run(context.Background(), ExecRequest{Cmd: "yes out | head -c 500; yes err | head -c 500 >&2", CombineOutput: true, MaxBytes: 100})
+	if !resp.StdoutTruncated || resp.StderrTruncated || len(resp.Stdout) != 100 {
+		t.Fatalf("unexpected truncation %+v", resp)
+	}
+}
+
+func TestRunBackground(t *testing.T) {
+	t.Setenv("WORKSPACE", t.TempDir())
+	ctx := context.Background()
+	resp := Run(ctx, ExecRequest{Cmd: "sleep 0.2; echo done", Background: true})
+	if resp.Error != "" || resp.Pid == 0 {
+		t.Fatalf("unexpected background resp %+v", resp)
+	}
+	if resp.DurationMs > 150 {
+		t.Fatalf("background run blocked for %dms", resp.DurationMs)
+	}
+	w := proc.Wait(ctx, proc.WaitRequest{Pid: resp.Pid, TimeoutMs: 5000})
+	if w.Error != "" || w.ExitCode != 0 {
+		t.Fatalf("wait failed: %+v", w)
+	}
+	if bad := Run(ctx, ExecRequest{Cmd: "cat", Stdin: "x", Background: true}); bad.Error == "" {
+		t.Fatalf("expected stdin to be rejected in background mode")
+	}
+}
+
+func TestRunResourceLimits(t *testing.T) {
+	resp := Run(context.Background(), ExecRequest{Cmd: "while :; do :; done", MaxCPUSeconds: 1, TimeoutMs: 10000})
+	if resp.LimitExceeded != "cpu" {
+		t.Fatalf("expected cpu limit, got %+v", resp)
+	}
+	dir := t.TempDir()
+	t.Setenv("WORKSPACE", dir)
+	resp = Run(context.Background(), ExecRequest{Cmd: "head -c 2000000 /dev/zero > big", Cwd: dir, MaxFileSizeMB: 1})
+	if resp.LimitExceeded != "file_size" || resp.ExitCode == 0 {
+		t.Fatalf("expected file size limit, got %+v", resp)
+	}
+	if bad := Run(context.Background(), ExecRequest{Cmd: "true", MaxMemoryMB: -1}); bad.Error == "" {
+		t.Fatalf("expected validation error")
+	}
+}
+
+func TestCwdConfinedToWorkspace(t *testing.T) {
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	if err := os.Mkdir(filepath.Join(ws, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	ctx := context.Background()
+	if resp := Run(ctx, ExecRequest{Cmd: "pwd", Cwd: "sub"}); resp.Error != "" || strings.TrimSpace(resp.Stdout) != filepath.Join(ws, "sub") {
+		t.Fatalf("relative cwd: %+v", resp)
+	}
+	if resp := Run(ctx, ExecRequest{Cmd: "pwd", Cwd: "/"}); !strings.Contains(resp.Error, "escapes workspace") {
+		t.Fatalf("expected shell.exec cwd outside the workspace to be refused, got %+v", resp)
+	}
+	if resp := ArgvExec(ctx, ArgvRequest{Cmd: "pwd", Cwd: "../"}); !strings.Contains(resp.Error, "escapes workspace") {
+		t.Fatalf("expected exec.run cwd outside the workspace to be refused, got %+v", resp)
+	}
+	if resp := Run(ctx, ExecRequest{Stages: [][]string{{"pwd"}}, Cwd: "/tmp"}); !strings.Contains(resp.Error, "escapes workspace") {
+		t.Fatalf("expected pipeline cwd outside the workspace to be refused, got %+v", resp)
+	}
+	t.Setenv("FS_ALLOW_OUTSIDE_WORKSPACE", "1")
+	if resp := Run(ctx, ExecRequest{Cmd: "pwd", Cwd: "/"}); resp.Error != "" || strings.TrimSpace(resp.Stdout) != "/" {
+		t.Fatalf("FS_ALLOW_OUTSIDE_WORKSPACE not honoured: %+v", resp)
+	}
+}
@@ -0,0 +1,107 @@
+package sys
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectProject(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	if err := os.WriteFile(filepath.Join(ws, "go.mod"), []byte("module x\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(ws, "package.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(ws, "yarn.lock"), []byte(""), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp := DetectProject(ctx, DetectProjectRequest{Path: "."})
+	if resp.Error != "" || len(resp.Projects) != 2 {
+		t.Fatalf("detect resp %+v", resp)
+	}
+	if resp.Projects[0].PackageManager != "yarn" || resp.Projects[1].Language != "go" {
+		t.Fatalf("unexpected projects %+v", resp.Projects)
+	}
+	if resp := DetectProject(ctx, DetectProjectRequest{Path: "../"}); resp.Error == "" {
+		t.Fatalf("expected error for outside path")
+	}
+}
+
+func TestEnvListGet(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("MCP_TEST_PLAIN", "visible")
+	t.Setenv("MCP_TEST_API_KEY", "hunter2")
+	list := EnvList(ctx, EnvListRequest{})
+	if list.Env["MCP_TEST_PLAIN"] != "visible" || list.Env["MCP_TEST_API_KEY"] != maskedValue {
+		t.Fatalf("unexpected env list values %q %q", list.Env["MCP_TEST_PLAIN"], list.Env["MCP_TEST_API_KEY"])
+	}
+	get := EnvGet(ctx, EnvGetRequest{Name: "MCP_TEST_API_KEY"})
+	if !get.Set || !get.Masked || get.Value == "hunter2" {
+		t.Fatalf("secret leaked: %+v", get)
+	}
+	t.Setenv("github_token", "ghp_x")
+	t.Setenv("MCP_TEST_DB_PASSWD", "hunter2")
+	t.Setenv("MCP_TEST_AWS_SECRET_ACCESS", "hunter2")
+	t.Setenv("MCP_TEST_DATABASE_URL", "postgres://app:hunter2@db:5432/app")
+	t.Setenv("MCP_TEST_HOMEPAGE", "https://example.com/a@b")
+	for _, name := range []string{"github_token", "MCP_TEST_DB_PASSWD", "MCP_TEST_AWS_SECRET_ACCESS", "MCP_TEST_DATABASE_URL"} {
+		if get := EnvGet(ctx, EnvGetRequest{Name: name}); !get.Masked || get.Value != maskedValue {
+			t.Fatalf("%s not masked: %+v", name, get)
+		}
+	}
+	t.Setenv("PWD", "/workspace")
+	t.Setenv("OLDPWD", "/tmp")
+	t.Setenv("KEYBOARD_LAYOUT", "us")
+	t.Setenv("MCP_TEST_MONKEY", "banana")
+	t.Setenv("MCP_TEST_KEYS", "hunter2")
+	for _, name := range []string{"PWD", "OLDPWD", "KEYBOARD_LAYOUT", "MCP_TEST_MONKEY"} {
+		if get := EnvGet(ctx, EnvGetRequest{Name: name}); get.Masked {
+			t.Fatalf("%s masked: %+v", name, get)
+		}
+	}
+	if get := EnvGet(ctx, EnvGetRequest{Name: "MCP_TEST_KEYS"}); !get.Masked {
+		t.Fatalf("plural marker not masked: %+v", get)
+	}
+	if get := EnvGet(ctx, EnvGetRequest{Name: "MCP_TEST_HOMEPAGE"}); get.Masked {
+		t.Fatalf("plain URL masked: %+v", get)
+	}
+	if get := EnvGet(ctx, EnvGetRequest{Name: "MCP_TEST_UNSET"}); get.Set || get.Error != "" {
+		t.Fatalf("unexpected unset result %+v", get)
+	}
+}
+
+func TestSysInfo(t *testing.T) {
+	total, avail := parseMeminfo("MemTotal:       16384 kB\nMemFree:  100 kB\nMemAvailable:    8192 kB\n")
+	if total != 16384*1024 || avail != 8192*1024 {
+		t.Fatalf("unexpected meminfo parse %d %d", total, avail)
+	}
+	t.Setenv("WORKSPACE", t.TempDir())
+	resp := SysInfo(context.Background(), SysInfoRequest{})
+	if resp.Error != "" || resp.DiskTotalBytes == 0 || resp.CPUs < 1 {
+		t.Fatalf("unexpected info %+v", resp)
+	}
+	if _, ok := resp.Tools["git"]; !ok {
+		t.Fatalf("git missing from tool map")
+	}
+}
+
+func TestWhich(t *testing.T) {
+	resp := Which(context.Background(), WhichRequest{Name: "sh", Names: []string{"definitely-not-a-real-binary"}})
+	if resp.Error != "" || len(resp.Results) != 2 {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if !resp.Results[0].Found || !filepath.IsAbs(resp.Results[0].Path) {
+		t.Fatalf("sh not resolved: %+v", resp.Results[0])
+	}
+	if resp.Results[1].Found || len(resp.Missing) != 1 || resp.Missing[0] != "definitely-not-a-real-binary" {
+		t.Fatalf("expected missing binary: %+v", resp)
+	}
+	if resp := Which(context.Background(), WhichRequest{}); resp.Error == "" {
+		t.Fatalf("expected error for empty request")
+	}
+}
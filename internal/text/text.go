@@ -2,17 +2,36 @@ package text
 
 import (
 	"bytes"
+	"cmp"
 	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/dryrun"
+	"github.com/gaspardpetit/mcp-shell/internal/quota"
 )
 
-const LogPath = "/logs/mcp-shell.log"
+const (
+	defaultMaxBytes = 1 << 20  // 1 MiB
+	maxSortInput    = 64 << 20 // 64 MiB, held in memory by text.sort
+)
 
 func workspaceRoot() string {
 	if ws := os.Getenv("WORKSPACE"); ws != "" {
@@ -45,27 +64,38 @@ func normalizePath(p string) (string, error) {
 	return p, nil
 }
 
-func audit(rec any) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-	_ = json.NewEncoder(f).Encode(rec)
+func audit(ctx context.Context, rec any) {
+	auditlog.Write(ctx, rec)
 }
 
 // ---- text.diff
 
 type DiffRequest struct {
-	A    string `json:"a"`
-	B    string `json:"b"`
-	Algo string `json:"algo,omitempty"`
+	A     string `json:"a"`
+	B     string `json:"b"`
+	PathA string `json:"path_a,omitempty"`
+	PathB string `json:"path_b,omitempty"`
+	Algo  string `json:"algo,omitempty"`
+}
+
+// diffSide returns the inline text, or the contents of the workspace file
+// when path is set. Setting both is an error.
+func diffSide(name, inline, path string) (string, error) {
+	if path == "" {
+		return inline, nil
+	}
+	if inline != "" {
+		return "", errors.New("set either " + name + " or path_" + name + ", not both")
+	}
+	p, err := normalizePath(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
 
 type DiffResponse struct {
@@ -76,6 +106,14 @@ type DiffResponse struct {
 
 func Diff(ctx context.Context, in DiffRequest) DiffResponse {
 	start := time.Now()
+	a, err := diffSide("a", in.A, in.PathA)
+	if err != nil {
+		return DiffResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	b, err := diffSide("b", in.B, in.PathB)
+	if err != nil {
+		return DiffResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
 	dir, err := os.MkdirTemp("", "diff")
 	if err != nil {
 		return DiffResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
@@ -83,10 +121,10 @@ func Diff(ctx context.Context, in DiffRequest) DiffResponse {
 	defer os.RemoveAll(dir)
 	aPath := filepath.Join(dir, "a.txt")
 	bPath := filepath.Join(dir, "b.txt")
-	if err := os.WriteFile(aPath, []byte(in.A), 0o644); err != nil {
+	if err := os.WriteFile(aPath, []byte(a), 0o644); err != nil {
 		return DiffResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
-	if err := os.WriteFile(bPath, []byte(in.B), 0o644); err != nil {
+	if err := os.WriteFile(bPath, []byte(b), 0o644); err != nil {
 		return DiffResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
 	}
 	args := []string{"diff", "--no-index", "--unified=3"}
@@ -116,7 +154,7 @@ func Diff(ctx context.Context, in DiffRequest) DiffResponse {
 	}
 	resp := DiffResponse{UnifiedDiff: stdout.String()}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS         string `json:"ts"`
 		Tool       string `json:"tool"`
 		Algo       string `json:"algo"`
@@ -144,6 +182,7 @@ type ApplyPatchResponse struct {
 
 func ApplyPatch(ctx context.Context, in ApplyPatchRequest) ApplyPatchResponse {
 	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
 	path, err := normalizePath(in.Path)
 	if err != nil {
 		return ApplyPatchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
@@ -185,7 +224,7 @@ func ApplyPatch(ctx context.Context, in ApplyPatchRequest) ApplyPatchResponse {
 		}
 	}
 	resp.DurationMs = time.Since(start).Milliseconds()
-	audit(struct {
+	audit(ctx, struct {
 		TS           string `json:"ts"`
 		Tool         string `json:"tool"`
 		Path         string `json:"path"`
@@ -197,3 +236,833 @@ func ApplyPatch(ctx context.Context, in ApplyPatchRequest) ApplyPatchResponse {
 	}{time.Now().UTC().Format(time.RFC3339), "text.apply_patch", path, resp.DurationMs, len(in.UnifiedDiff), resp.HunksApplied, resp.HunksFailed, in.DryRun})
 	return resp
 }
+
+// ---- text.normalize
+
+type NormalizeRequest struct {
+	Path               string `json:"path"`
+	LineEnding         string `json:"line_ending,omitempty"`
+	StripBOM           bool   `json:"strip_bom,omitempty"`
+	EnsureFinalNewline bool   `json:"ensure_final_newline,omitempty"`
+}
+
+type NormalizeResponse struct {
+	LinesChanged int    `json:"lines_changed"`
+	BOMStripped  bool   `json:"bom_stripped"`
+	DurationMs   int64  `json:"duration_ms"`
+	Error        string `json:"error,omitempty"`
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// writeFileAtomic writes data to a temp file beside path and renames it into
+// place. Any growth over the current file size counts against the workspace
+// quota.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	growth := int64(len(data))
+	if info, err := os.Stat(path); err == nil {
+		growth -= info.Size()
+	}
+	if err := quota.Reserve(growth); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		quota.Invalidate()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		quota.Invalidate()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		quota.Invalidate()
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		os.Remove(tmp.Name())
+		quota.Invalidate()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		quota.Invalidate()
+		return err
+	}
+	return nil
+}
+
+func Normalize(ctx context.Context, in NormalizeRequest) NormalizeResponse {
+	start := time.Now()
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return NormalizeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	var eol string
+	switch strings.ToLower(in.LineEnding) {
+	case "":
+	case "lf":
+		eol = "\n"
+	case "crlf":
+		eol = "\r\n"
+	default:
+		return NormalizeResponse{DurationMs: time.Since(start).Milliseconds(), Error: "line_ending must be lf or crlf"}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return NormalizeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return NormalizeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	resp := NormalizeResponse{}
+	body := data
+	if in.StripBOM && bytes.HasPrefix(body, utf8BOM) {
+		body = body[len(utf8BOM):]
+		resp.BOMStripped = true
+	}
+	lines := strings.SplitAfter(string(body), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var out strings.Builder
+	for i, line := range lines {
+		orig := line
+		if i == 0 && resp.BOMStripped {
+			orig = string(utf8BOM) + line
+		}
+		last := i == len(lines)-1
+		content := strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		ending := line[len(content):]
+		if eol != "" && ending != "" {
+			ending = eol
+		}
+		if last && ending == "" && in.EnsureFinalNewline {
+			ending = eol
+			if ending == "" {
+				ending = "\n"
+			}
+		}
+		line = content + ending
+		if line != orig {
+			resp.LinesChanged++
+		}
+		out.WriteString(line)
+	}
+	result := []byte(out.String())
+	if !bytes.Equal(result, data) {
+		if err := writeFileAtomic(path, result, info.Mode().Perm()); err != nil {
+			return NormalizeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS           string `json:"ts"`
+		Tool         string `json:"tool"`
+		Path         string `json:"path"`
+		DurationMs   int64  `json:"duration_ms"`
+		LineEnding   string `json:"line_ending,omitempty"`
+		LinesChanged int    `json:"lines_changed"`
+	}{time.Now().UTC().Format(time.RFC3339), "text.normalize", path, resp.DurationMs, in.LineEnding, resp.LinesChanged})
+	return resp
+}
+
+// ---- text.replace
+
+type ReplaceRequest struct {
+	Path        string `json:"path"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Glob        string `json:"glob,omitempty"`
+	DryRun      bool   `json:"dry_run,omitempty"`
+	// Literal treats Pattern and Replacement as fixed strings, so regexp
+	// metacharacters and $ references have no special meaning.
+	Literal bool `json:"literal,omitempty"`
+	// Count caps the replacements made in each file in literal mode; 0
+	// replaces every occurrence.
+	Count int `json:"count,omitempty"`
+}
+
+type ReplaceFile struct {
+	Path    string `json:"path"`
+	Matches int    `json:"matches"`
+}
+
+type ReplaceResponse struct {
+	Files        []ReplaceFile `json:"files"`
+	Replacements int           `json:"replacements"`
+	DurationMs   int64         `json:"duration_ms"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// replaceTargets lists the regular files under root whose base name matches
+// glob, skipping .git directories.
+func replaceTargets(root, glob string) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if glob != "" {
+			if ok, _ := filepath.Match(glob, d.Name()); !ok {
+				return nil
+			}
+		}
+		files = append(files, p)
+		return nil
+	})
+	return files, err
+}
+
+func Replace(ctx context.Context, in ReplaceRequest) ReplaceResponse {
+	start := time.Now()
+	in.DryRun = dryrun.Apply(in.DryRun)
+	root, err := normalizePath(in.Path)
+	if err != nil {
+		return ReplaceResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	if in.Pattern == "" {
+		return ReplaceResponse{DurationMs: time.Since(start).Milliseconds(), Error: "pattern is required"}
+	}
+	if in.Count < 0 {
+		return ReplaceResponse{DurationMs: time.Since(start).Milliseconds(), Error: "count must not be negative"}
+	}
+	if in.Count > 0 && !in.Literal {
+		return ReplaceResponse{DurationMs: time.Since(start).Milliseconds(), Error: "count requires literal"}
+	}
+	var re *regexp.Regexp
+	if !in.Literal {
+		if re, err = regexp.Compile(in.Pattern); err != nil {
+			return ReplaceResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+	}
+	if in.Glob != "" {
+		if _, err := filepath.Match(in.Glob, ""); err != nil {
+			return ReplaceResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+	}
+	old, repl := []byte(in.Pattern), []byte(in.Replacement)
+	files, err := replaceTargets(root, in.Glob)
+	if err != nil {
+		return ReplaceResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	resp := ReplaceResponse{Files: []ReplaceFile{}}
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return ReplaceResponse{Files: resp.Files, Replacements: resp.Replacements, DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return ReplaceResponse{Files: resp.Files, Replacements: resp.Replacements, DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		// leave binary files alone
+		if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			continue
+		}
+		var n int
+		if in.Literal {
+			n = bytes.Count(data, old)
+			if in.Count > 0 {
+				n = min(n, in.Count)
+			}
+		} else {
+			n = len(re.FindAllIndex(data, -1))
+		}
+		if n == 0 {
+			continue
+		}
+		if !in.DryRun {
+			info, err := os.Stat(f)
+			if err != nil {
+				return ReplaceResponse{Files: resp.Files, Replacements: resp.Replacements, DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			}
+			var out []byte
+			if in.Literal {
+				out = bytes.Replace(data, old, repl, n)
+			} else {
+				out = re.ReplaceAll(data, repl)
+			}
+			if err := writeFileAtomic(f, out, info.Mode().Perm()); err != nil {
+				return ReplaceResponse{Files: resp.Files, Replacements: resp.Replacements, DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+			}
+		}
+		resp.Files = append(resp.Files, ReplaceFile{Path: f, Matches: n})
+		resp.Replacements += n
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS           string `json:"ts"`
+		Tool         string `json:"tool"`
+		Path         string `json:"path"`
+		Pattern      string `json:"pattern"`
+		DurationMs   int64  `json:"duration_ms"`
+		Files        int    `json:"files"`
+		Replacements int    `json:"replacements"`
+		DryRun       bool   `json:"dry_run,omitempty"`
+		Literal      bool   `json:"literal,omitempty"`
+	}{time.Now().UTC().Format(time.RFC3339), "text.replace", root, in.Pattern, resp.DurationMs, len(resp.Files), resp.Replacements, in.DryRun, in.Literal})
+	return resp
+}
+
+// ---- text.wc
+
+type WCRequest struct {
+	Path string `json:"path,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+type WCResponse struct {
+	Lines      int    `json:"lines"`
+	Words      int    `json:"words"`
+	Chars      int    `json:"chars"`
+	Bytes      int    `json:"bytes"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// countText mirrors wc: lines are newline characters, words are runs of
+// non-space, and chars are UTF-8 code points.
+func countText(data []byte) WCResponse {
+	return WCResponse{
+		Lines: bytes.Count(data, []byte("\n")),
+		Words: len(bytes.Fields(data)),
+		Chars: utf8.RuneCount(data),
+		Bytes: len(data),
+	}
+}
+
+func WordCount(ctx context.Context, in WCRequest) WCResponse {
+	start := time.Now()
+	if in.Path != "" && in.Text != "" {
+		return WCResponse{DurationMs: time.Since(start).Milliseconds(), Error: "set either path or text, not both"}
+	}
+	if in.Path == "" {
+		resp := countText([]byte(in.Text))
+		resp.DurationMs = time.Since(start).Milliseconds()
+		return resp
+	}
+	path, err := normalizePath(in.Path)
+	if err != nil {
+		return WCResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return WCResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	resp := countText(data)
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path"`
+		DurationMs int64  `json:"duration_ms"`
+		Bytes      int    `json:"bytes"`
+	}{time.Now().UTC().Format(time.RFC3339), "text.wc", path, resp.DurationMs, resp.Bytes})
+	return resp
+}
+
+// ---- text.jq
+
+type JQRequest struct {
+	Input    string `json:"input,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Query    string `json:"query"`
+	MaxBytes int64  `json:"max_bytes,omitempty"`
+}
+
+type JQResponse struct {
+	Results    []any  `json:"results"`
+	Truncated  bool   `json:"truncated"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// runJQ evaluates query against every JSON value in data (so NDJSON works)
+// and collects all outputs in order, stopping once their encoded size would
+// pass limit bytes.
+func runJQ(ctx context.Context, query string, data []byte, limit int) ([]any, bool, error) {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		return nil, false, fmt.Errorf("query: %w", err)
+	}
+	code, err := gojq.Compile(q)
+	if err != nil {
+		return nil, false, fmt.Errorf("query: %w", err)
+	}
+	results := []any{}
+	size := 0
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var v any
+		if err := dec.Decode(&v); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, false, fmt.Errorf("input: %w", err)
+		}
+		iter := code.RunWithContext(ctx, v)
+		for {
+			out, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, ok := out.(error); ok {
+				var halt *gojq.HaltError
+				if errors.As(err, &halt) && halt.Value() == nil {
+					return results, false, nil
+				}
+				return nil, false, err
+			}
+			b, err := json.Marshal(out)
+			if err != nil {
+				return nil, false, fmt.Errorf("result %d is not valid JSON (NaN and infinite numbers cannot be encoded): %w", len(results)+1, err)
+			}
+			if size += len(b); size > limit {
+				return results, true, nil
+			}
+			results = append(results, out)
+		}
+	}
+	return results, false, nil
+}
+
+func JQ(ctx context.Context, in JQRequest) JQResponse {
+	start := time.Now()
+	if in.Query == "" {
+		return JQResponse{DurationMs: time.Since(start).Milliseconds(), Error: "query is required"}
+	}
+	if in.Path != "" && in.Input != "" {
+		return JQResponse{DurationMs: time.Since(start).Milliseconds(), Error: "set either input or path, not both"}
+	}
+	data := []byte(in.Input)
+	var path string
+	if in.Path != "" {
+		var err error
+		if path, err = normalizePath(in.Path); err != nil {
+			return JQResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		if data, err = os.ReadFile(path); err != nil {
+			return JQResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+	}
+	limit := defaultMaxBytes
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	results, truncated, err := runJQ(ctx, in.Query, data, limit)
+	if err != nil {
+		return JQResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	resp := JQResponse{Results: results, Truncated: truncated}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path,omitempty"`
+		Query      string `json:"query"`
+		DurationMs int64  `json:"duration_ms"`
+		Results    int    `json:"results"`
+	}{time.Now().UTC().Format(time.RFC3339), "text.jq", path, in.Query, resp.DurationMs, len(resp.Results)})
+	return resp
+}
+
+// ---- text.sort
+
+type SortRequest struct {
+	Input      string `json:"input,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Unique     bool   `json:"unique,omitempty"`
+	Numeric    bool   `json:"numeric,omitempty"`
+	Reverse    bool   `json:"reverse,omitempty"`
+	IgnoreCase bool   `json:"ignore_case,omitempty"`
+	MaxBytes   int64  `json:"max_bytes,omitempty"`
+}
+
+type SortResponse struct {
+	Output     string `json:"output"`
+	Lines      int    `json:"lines"`
+	Truncated  bool   `json:"truncated"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+var leadingNumber = regexp.MustCompile(`^\s*[-+]?(\d+(\.\d*)?|\.\d+)`)
+
+// numericKey is the value sort -n would use: the number at the start of the
+// line, or 0 when there is none.
+func numericKey(line string) float64 {
+	m := leadingNumber.FindString(line)
+	if m == "" {
+		return 0
+	}
+	v, _ := strconv.ParseFloat(strings.TrimSpace(m), 64)
+	return v
+}
+
+// sortLines orders lines by the requested key. Lines with equal keys fall
+// back to a plain byte comparison so the result never depends on input order;
+// unique keeps one line per key.
+func sortLines(lines []string, in SortRequest) []string {
+	compareKey := func(a, b string) int {
+		switch {
+		case in.Numeric:
+			return cmp.Compare(numericKey(a), numericKey(b))
+		case in.IgnoreCase:
+			return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+		}
+		return strings.Compare(a, b)
+	}
+	slices.SortFunc(lines, func(a, b string) int {
+		c := compareKey(a, b)
+		if c == 0 {
+			c = strings.Compare(a, b)
+		}
+		if in.Reverse {
+			c = -c
+		}
+		return c
+	})
+	if in.Unique {
+		lines = slices.CompactFunc(lines, func(a, b string) bool { return compareKey(a, b) == 0 })
+	}
+	return lines
+}
+
+func Sort(ctx context.Context, in SortRequest) SortResponse {
+	start := time.Now()
+	if in.Path != "" && in.Input != "" {
+		return SortResponse{DurationMs: time.Since(start).Milliseconds(), Error: "set either input or path, not both"}
+	}
+	data := in.Input
+	var path string
+	if in.Path != "" {
+		p, err := normalizePath(in.Path)
+		if err != nil {
+			return SortResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return SortResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		b, err := io.ReadAll(io.LimitReader(f, maxSortInput+1))
+		f.Close()
+		if err != nil {
+			return SortResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		path, data = p, string(b)
+	}
+	if len(data) > maxSortInput {
+		return SortResponse{DurationMs: time.Since(start).Milliseconds(), Error: fmt.Sprintf("input exceeds %d bytes; sort it with shell.exec instead", maxSortInput)}
+	}
+	if data == "" {
+		return SortResponse{DurationMs: time.Since(start).Milliseconds()}
+	}
+	limit := defaultMaxBytes
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	trailing := strings.HasSuffix(data, "\n")
+	lines := sortLines(strings.Split(strings.TrimSuffix(data, "\n"), "\n"), in)
+	out := strings.Join(lines, "\n")
+	if trailing {
+		out += "\n"
+	}
+	truncated := false
+	if len(out) > limit {
+		// keep whole lines only
+		out = out[:limit]
+		if i := strings.LastIndexByte(out, '\n'); i >= 0 {
+			out = out[:i+1]
+		} else {
+			out = ""
+		}
+		truncated = true
+	}
+	resp := SortResponse{Output: out, Lines: len(lines), Truncated: truncated}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path,omitempty"`
+		DurationMs int64  `json:"duration_ms"`
+		Lines      int    `json:"lines"`
+	}{time.Now().UTC().Format(time.RFC3339), "text.sort", path, resp.DurationMs, resp.Lines})
+	return resp
+}
+
+// ---- text.encode / text.decode
+
+// CodecRequest and CodecResponse are shared by text.encode and text.decode.
+type CodecRequest struct {
+	Input    string `json:"input,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Encoding string `json:"encoding"`
+	MaxBytes int64  `json:"max_bytes,omitempty"`
+}
+
+type CodecResponse struct {
+	Output     string `json:"output"`
+	Truncated  bool   `json:"truncated"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+type (
+	EncodeRequest  = CodecRequest
+	EncodeResponse = CodecResponse
+	DecodeRequest  = CodecRequest
+	DecodeResponse = CodecResponse
+)
+
+// readInput returns inline input or the contents of a workspace file, along
+// with the resolved path (empty for inline input).
+func readInput(input, path string) ([]byte, string, error) {
+	if path != "" && input != "" {
+		return nil, "", errors.New("set either input or path, not both")
+	}
+	if path == "" {
+		return []byte(input), "", nil
+	}
+	p, err := normalizePath(path)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(p)
+	return data, p, err
+}
+
+// encodeChunk returns how many input bytes fit in limit output bytes while
+// keeping the output decodable.
+func encodeChunk(encoding string, limit int) int {
+	if encoding == "hex" {
+		return limit / 2
+	}
+	return limit / 4 * 3
+}
+
+func encodeBytes(encoding string, data []byte) (string, error) {
+	switch encoding {
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data), nil
+	case "base64url":
+		return base64.URLEncoding.EncodeToString(data), nil
+	case "hex":
+		return hex.EncodeToString(data), nil
+	}
+	return "", fmt.Errorf("unsupported encoding %q (want base64, base64url or hex)", encoding)
+}
+
+// decodeBytes ignores whitespace, so wrapped base64 and spaced hex dumps
+// decode, and accepts base64 with or without padding.
+func decodeBytes(encoding string, data []byte) ([]byte, error) {
+	s := strings.Join(strings.Fields(string(data)), "")
+	switch encoding {
+	case "base64", "base64url":
+		enc := base64.StdEncoding
+		if encoding == "base64url" {
+			enc = base64.URLEncoding
+		}
+		if !strings.HasSuffix(s, "=") && len(s)%4 != 0 {
+			enc = enc.WithPadding(base64.NoPadding)
+		}
+		return enc.DecodeString(s)
+	case "hex":
+		return hex.DecodeString(s)
+	}
+	return nil, fmt.Errorf("unsupported encoding %q (want base64, base64url or hex)", encoding)
+}
+
+func Encode(ctx context.Context, in EncodeRequest) EncodeResponse {
+	start := time.Now()
+	encoding := strings.ToLower(in.Encoding)
+	if _, err := encodeBytes(encoding, nil); err != nil {
+		return EncodeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	data, path, err := readInput(in.Input, in.Path)
+	if err != nil {
+		return EncodeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	limit := defaultMaxBytes
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	truncated := false
+	if n := encodeChunk(encoding, limit); len(data) > n {
+		data = data[:n]
+		truncated = true
+	}
+	out, _ := encodeBytes(encoding, data)
+	resp := EncodeResponse{Output: out, Truncated: truncated}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path,omitempty"`
+		Encoding   string `json:"encoding"`
+		DurationMs int64  `json:"duration_ms"`
+		BytesOut   int    `json:"bytes_out"`
+	}{time.Now().UTC().Format(time.RFC3339), "text.encode", path, encoding, resp.DurationMs, len(resp.Output)})
+	return resp
+}
+
+func Decode(ctx context.Context, in DecodeRequest) DecodeResponse {
+	start := time.Now()
+	encoding := strings.ToLower(in.Encoding)
+	data, path, err := readInput(in.Input, in.Path)
+	if err != nil {
+		return DecodeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	out, err := decodeBytes(encoding, data)
+	if err != nil {
+		return DecodeResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	limit := defaultMaxBytes
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	truncated := false
+	if len(out) > limit {
+		out = out[:limit]
+		// do not split a multi-byte character at the cut
+		for len(out) > 0 && !utf8.Valid(out) && len(out) > limit-utf8.UTFMax {
+			out = out[:len(out)-1]
+		}
+		truncated = true
+	}
+	if !utf8.Valid(out) {
+		return DecodeResponse{DurationMs: time.Since(start).Milliseconds(), Error: "decoded data is not valid UTF-8; save binary data with fs.write content_b64 instead"}
+	}
+	resp := DecodeResponse{Output: string(out), Truncated: truncated}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path,omitempty"`
+		Encoding   string `json:"encoding"`
+		DurationMs int64  `json:"duration_ms"`
+		BytesOut   int    `json:"bytes_out"`
+	}{time.Now().UTC().Format(time.RFC3339), "text.decode", path, encoding, resp.DurationMs, len(resp.Output)})
+	return resp
+}
+
+// ---- text.template
+
+type TemplateRequest struct {
+	Template string         `json:"template,omitempty"`
+	Path     string         `json:"path,omitempty"` // template file, instead of template
+	Data     map[string]any `json:"data,omitempty"`
+	OutPath  string         `json:"out_path,omitempty"`
+	MaxBytes int64          `json:"max_bytes,omitempty"`
+}
+
+type TemplateResponse struct {
+	Output     string `json:"output"`
+	OutPath    string `json:"out_path,omitempty"`
+	Truncated  bool   `json:"truncated"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// errOutputLimit stops a template once its output reaches the limit.
+var errOutputLimit = errors.New("output limit reached")
+
+// limitedWriter keeps up to max bytes and fails the write that goes past
+// them, so a runaway template stops instead of filling memory.
+type limitedWriter struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if room := w.max - w.buf.Len(); len(p) > room {
+		w.buf.Write(p[:room])
+		w.truncated = true
+		return room, errOutputLimit
+	}
+	return w.buf.Write(p)
+}
+
+// RenderTemplate executes a Go text/template against Data. A key missing
+// from Data is an error rather than "<no value>", so typos surface instead
+// of ending up in generated files. With OutPath the result is also written
+// atomically. Output past MaxBytes is cut off and reported as Truncated; a
+// truncated result is never written to OutPath.
+func RenderTemplate(ctx context.Context, in TemplateRequest) TemplateResponse {
+	start := time.Now()
+	if in.Template == "" && in.Path == "" {
+		return TemplateResponse{DurationMs: time.Since(start).Milliseconds(), Error: "template or path is required"}
+	}
+	src, path, err := readInput(in.Template, in.Path)
+	if err != nil {
+		return TemplateResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	outPath := ""
+	if in.OutPath != "" {
+		if outPath, err = normalizePath(in.OutPath); err != nil {
+			return TemplateResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+	}
+	name := "template"
+	if path != "" {
+		name = filepath.Base(path)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(src))
+	if err != nil {
+		return TemplateResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	limit := defaultMaxBytes
+	if in.MaxBytes > 0 {
+		limit = int(in.MaxBytes)
+	}
+	w := &limitedWriter{max: limit}
+	if err := tmpl.Execute(w, in.Data); err != nil && !errors.Is(err, errOutputLimit) {
+		return TemplateResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	out := &w.buf
+	if w.truncated && outPath != "" {
+		return TemplateResponse{Output: out.String(), Truncated: true, DurationMs: time.Since(start).Milliseconds(), Error: fmt.Sprintf("output exceeds %d bytes; %s not written", limit, in.OutPath)}
+	}
+	if outPath != "" {
+		perm := os.FileMode(0o644)
+		if info, err := os.Stat(outPath); err == nil {
+			perm = info.Mode().Perm()
+		}
+		if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+			return TemplateResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+		if err := writeFileAtomic(outPath, out.Bytes(), perm); err != nil {
+			return TemplateResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		}
+	}
+	resp := TemplateResponse{Output: out.String(), OutPath: outPath, Truncated: w.truncated}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	audit(ctx, struct {
+		TS         string `json:"ts"`
+		Tool       string `json:"tool"`
+		Path       string `json:"path,omitempty"`
+		OutPath    string `json:"out_path,omitempty"`
+		DurationMs int64  `json:"duration_ms"`
+		BytesOut   int    `json:"bytes_out"`
+	}{time.Now().UTC().Format(time.RFC3339), "text.template", path, outPath, resp.DurationMs, out.Len()})
+	return resp
+}
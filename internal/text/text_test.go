@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -30,3 +31,252 @@ func TestDiffAndPatch(t *testing.T) {
 		t.Fatalf("patched content %q", data)
 	}
 }
+
+func TestDiffPaths(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	os.WriteFile(filepath.Join(ws, "a.txt"), []byte("one\ntwo\n"), 0o644)
+	os.WriteFile(filepath.Join(ws, "b.txt"), []byte("one\nthree\n"), 0o644)
+	fromFiles := Diff(ctx, DiffRequest{PathA: "a.txt", PathB: "b.txt"})
+	fromStrings := Diff(ctx, DiffRequest{A: "one\ntwo\n", B: "one\nthree\n"})
+	// headers name per-call temp files, so compare from the first hunk on
+	hunks := func(d string) string { return d[strings.Index(d, "@@"):] }
+	if fromFiles.Error != "" || !strings.Contains(fromFiles.UnifiedDiff, "@@") || hunks(fromFiles.UnifiedDiff) != hunks(fromStrings.UnifiedDiff) {
+		t.Fatalf("file diff %+v vs %+v", fromFiles, fromStrings)
+	}
+	mixed := Diff(ctx, DiffRequest{PathA: "a.txt", B: "x\n"})
+	if mixed.Error != "" || mixed.UnifiedDiff == "" {
+		t.Fatalf("mixed diff %+v", mixed)
+	}
+	if both := Diff(ctx, DiffRequest{A: "x", PathA: "a.txt"}); both.Error == "" {
+		t.Fatalf("expected error when a and path_a are both set")
+	}
+	if outside := Diff(ctx, DiffRequest{PathA: "/etc/passwd"}); outside.Error == "" {
+		t.Fatalf("expected workspace error")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	path := filepath.Join(ws, "mixed.txt")
+	if err := os.WriteFile(path, []byte("\xEF\xBB\xBFone\r\ntwo\nthree\r\nfour"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp := Normalize(ctx, NormalizeRequest{Path: path, LineEnding: "lf", StripBOM: true, EnsureFinalNewline: true})
+	if resp.Error != "" || resp.LinesChanged != 3 || !resp.BOMStripped {
+		t.Fatalf("normalize resp %+v", resp)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "one\ntwo\nthree\nfour\n" {
+		t.Fatalf("normalized content %q", data)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	files := map[string]string{
+		"a.go":       "foo(1)\nfoo(2)\n",
+		"sub/b.go":   "x := foo(3)\n",
+		"sub/c.txt":  "foo(4)\n",
+		".git/d.go":  "foo(5)\n",
+		"sub/bin.go": "foo(6)\x00",
+	}
+	for name, body := range files {
+		p := filepath.Join(ws, name)
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	dry := Replace(ctx, ReplaceRequest{Path: ".", Pattern: `foo\((\d)\)`, Replacement: "bar($1)", Glob: "*.go", DryRun: true})
+	if dry.Error != "" || dry.Replacements != 3 || len(dry.Files) != 2 {
+		t.Fatalf("dry run resp %+v", dry)
+	}
+	if data, _ := os.ReadFile(filepath.Join(ws, "a.go")); string(data) != files["a.go"] {
+		t.Fatalf("dry run modified file: %q", data)
+	}
+	resp := Replace(ctx, ReplaceRequest{Path: ".", Pattern: `foo\((\d)\)`, Replacement: "bar($1)", Glob: "*.go"})
+	if resp.Error != "" || resp.Replacements != 3 {
+		t.Fatalf("replace resp %+v", resp)
+	}
+	if data, _ := os.ReadFile(filepath.Join(ws, "sub/b.go")); string(data) != "x := bar(3)\n" {
+		t.Fatalf("replaced content %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(ws, "sub/c.txt")); string(data) != files["sub/c.txt"] {
+		t.Fatalf("glob not honored: %q", data)
+	}
+	if bad := Replace(ctx, ReplaceRequest{Path: ".", Pattern: "("}); bad.Error == "" {
+		t.Fatalf("expected regex error")
+	}
+}
+
+func TestReplaceLiteral(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	cfg := filepath.Join(ws, "app.cfg")
+	if err := os.WriteFile(cfg, []byte("version=1.2.3\nmin=1.2.3\nother=1x2y3\nold=1.2.3\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp := Replace(ctx, ReplaceRequest{Path: "app.cfg", Pattern: "1.2.3", Replacement: "$1.3.0", Literal: true, Count: 2})
+	if resp.Error != "" || resp.Replacements != 2 || len(resp.Files) != 1 || resp.Files[0].Matches != 2 {
+		t.Fatalf("literal replace resp %+v", resp)
+	}
+	want := "version=$1.3.0\nmin=$1.3.0\nother=1x2y3\nold=1.2.3\n"
+	if data, _ := os.ReadFile(cfg); string(data) != want {
+		t.Fatalf("literal content %q", data)
+	}
+	if bad := Replace(ctx, ReplaceRequest{Path: "app.cfg", Pattern: "x", Count: 1}); bad.Error == "" {
+		t.Fatalf("expected count without literal to fail")
+	}
+}
+
+func TestWordCount(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	inline := WordCount(ctx, WCRequest{Text: "héllo wörld\nsecond  line\n"})
+	if inline.Error != "" || inline.Lines != 2 || inline.Words != 4 || inline.Chars != 25 || inline.Bytes != 27 {
+		t.Fatalf("inline wc %+v", inline)
+	}
+	os.WriteFile(filepath.Join(ws, "f.txt"), []byte("a b c"), 0o644)
+	file := WordCount(ctx, WCRequest{Path: "f.txt"})
+	if file.Error != "" || file.Lines != 0 || file.Words != 3 || file.Chars != 5 {
+		t.Fatalf("file wc %+v", file)
+	}
+	if both := WordCount(ctx, WCRequest{Path: "f.txt", Text: "x"}); both.Error == "" {
+		t.Fatalf("expected error when path and text are both set")
+	}
+}
+
+func TestJQ(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	resp := JQ(ctx, JQRequest{Input: `{"items":[{"name":"a","n":1},{"name":"b","n":2}]}`, Query: ".items[] | .name"})
+	if resp.Error != "" || len(resp.Results) != 2 || resp.Results[0] != "a" || resp.Results[1] != "b" {
+		t.Fatalf("jq resp %+v", resp)
+	}
+	os.WriteFile(filepath.Join(ws, "rows.ndjson"), []byte("{\"n\":1}\n{\"n\":2}\n"), 0o644)
+	sum := JQ(ctx, JQRequest{Path: "rows.ndjson", Query: ".n * 10"})
+	if sum.Error != "" || len(sum.Results) != 2 || sum.Results[1] != float64(20) {
+		t.Fatalf("ndjson resp %+v", sum)
+	}
+	if bad := JQ(ctx, JQRequest{Input: `{"a":`, Query: "."}); !strings.Contains(bad.Error, "input") {
+		t.Fatalf("expected input error, got %+v", bad)
+	}
+	if bad := JQ(ctx, JQRequest{Input: `{}`, Query: ".["}); !strings.Contains(bad.Error, "query") {
+		t.Fatalf("expected query error, got %+v", bad)
+	}
+	if bad := JQ(ctx, JQRequest{Input: `"x"`, Query: ".a"}); bad.Error == "" {
+		t.Fatalf("expected runtime error")
+	}
+	if bad := JQ(ctx, JQRequest{Input: `1`, Query: "nan, infinite"}); !strings.Contains(bad.Error, "NaN") {
+		t.Fatalf("expected NaN error, got %+v", bad)
+	}
+	if big := JQ(ctx, JQRequest{Input: `null`, Query: "range(1000)", MaxBytes: 10}); !big.Truncated || len(big.Results) != 10 {
+		t.Fatalf("expected 10 results before the cap, got %+v", big)
+	}
+}
+
+func TestSort(t *testing.T) {
+	ctx := context.Background()
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	cases := []struct {
+		req  SortRequest
+		want string
+	}{
+		{SortRequest{Input: "b\na\nc\n"}, "a\nb\nc\n"},
+		{SortRequest{Input: "10\n9\nx\n-1\n2.5"}, "-1\n10\n2.5\n9\nx"},
+		{SortRequest{Input: "10\n9\nx\n-1\n2.5", Numeric: true}, "-1\nx\n2.5\n9\n10"},
+		{SortRequest{Input: "b\nB\na\nb\n", Unique: true, IgnoreCase: true}, "a\nB\n"},
+		{SortRequest{Input: "a\nc\nb\nc\n", Unique: true, Reverse: true}, "c\nb\na\n"},
+	}
+	for _, c := range cases {
+		if resp := Sort(ctx, c.req); resp.Error != "" || resp.Output != c.want {
+			t.Errorf("Sort(%+v) = %q (%s), want %q", c.req, resp.Output, resp.Error, c.want)
+		}
+	}
+	os.WriteFile(filepath.Join(ws, "list.txt"), []byte("z\ny\n"), 0o644)
+	if resp := Sort(ctx, SortRequest{Path: "list.txt"}); resp.Output != "y\nz\n" || resp.Lines != 2 {
+		t.Fatalf("file sort %+v", resp)
+	}
+	if resp := Sort(ctx, SortRequest{Input: "ccc\nbbb\naaa\n", MaxBytes: 9}); !resp.Truncated || resp.Output != "aaa\nbbb\n" || resp.Lines != 3 {
+		t.Fatalf("truncated sort %+v", resp)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("WORKSPACE", t.TempDir())
+	for _, c := range []struct{ enc, want string }{
+		{"base64", "aGk/Pw=="},
+		{"base64url", "aGk_Pw=="},
+		{"hex", "68693f3f"},
+	} {
+		resp := Encode(ctx, EncodeRequest{Input: "hi??", Encoding: c.enc})
+		if resp.Error != "" || resp.Output != c.want {
+			t.Errorf("encode %s = %q (%s), want %q", c.enc, resp.Output, resp.Error, c.want)
+		}
+		back := Decode(ctx, DecodeRequest{Input: resp.Output, Encoding: c.enc})
+		if back.Error != "" || back.Output != "hi??" {
+			t.Errorf("decode %s = %q (%s)", c.enc, back.Output, back.Error)
+		}
+	}
+	if resp := Decode(ctx, DecodeRequest{Input: "aGk\n/Pw", Encoding: "base64"}); resp.Output != "hi??" {
+		t.Errorf("unpadded wrapped base64 = %q (%s)", resp.Output, resp.Error)
+	}
+	if resp := Encode(ctx, EncodeRequest{Input: "abcdef", Encoding: "base64", MaxBytes: 5}); !resp.Truncated || resp.Output != "YWJj" {
+		t.Errorf("truncated encode %+v", resp)
+	}
+	if resp := Decode(ctx, DecodeRequest{Input: "ff00", Encoding: "hex"}); resp.Error == "" {
+		t.Errorf("expected error for binary output")
+	}
+	if resp := Encode(ctx, EncodeRequest{Input: "x", Encoding: "rot13"}); resp.Error == "" {
+		t.Errorf("expected unsupported encoding error")
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	ws := t.TempDir()
+	t.Setenv("WORKSPACE", ws)
+	ctx := context.Background()
+	data := map[string]any{"name": "api", "ports": []any{80, 443}}
+	resp := RenderTemplate(ctx, TemplateRequest{Template: "svc={{.name}}{{range .ports}} {{.}}{{end}}\n", Data: data, OutPath: "out/svc.conf"})
+	if resp.Error != "" || resp.Output != "svc=api 80 443\n" {
+		t.Fatalf("unexpected render %+v", resp)
+	}
+	got, err := os.ReadFile(filepath.Join(ws, "out", "svc.conf"))
+	if err != nil || string(got) != resp.Output {
+		t.Fatalf("unexpected file %q (%v)", got, err)
+	}
+	if resp := RenderTemplate(ctx, TemplateRequest{Template: "{{.missing}}", Data: data}); !strings.Contains(resp.Error, "missing") {
+		t.Fatalf("expected missing key error, got %+v", resp)
+	}
+	if resp := RenderTemplate(ctx, TemplateRequest{Template: "{{.name"}); resp.Error == "" {
+		t.Fatalf("expected parse error")
+	}
+	if resp := RenderTemplate(ctx, TemplateRequest{Template: "x", OutPath: "../escape"}); resp.Error == "" {
+		t.Fatalf("expected out_path outside the workspace to be rejected")
+	}
+	// a runaway template stops at max_bytes
+	huge := `{{range $i := .n}}{{range $.n}}{{range $.n}}xxxxxxxx{{end}}{{end}}{{end}}`
+	big := map[string]any{"n": make([]int, 1000)}
+	resp = RenderTemplate(ctx, TemplateRequest{Template: huge, Data: big, MaxBytes: 10})
+	if resp.Error != "" || !resp.Truncated || resp.Output != "xxxxxxxxxx" {
+		t.Fatalf("expected truncated output, got %+v", resp)
+	}
+	resp = RenderTemplate(ctx, TemplateRequest{Template: huge, Data: big, MaxBytes: 10, OutPath: "big.txt"})
+	if resp.Error == "" || !resp.Truncated {
+		t.Fatalf("expected truncated output not to be written, got %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "big.txt")); !os.IsNotExist(err) {
+		t.Fatalf("truncated output written: %v", err)
+	}
+}
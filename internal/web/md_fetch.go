@@ -1,21 +1,29 @@
 package web
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
-	"crypto/tls"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	markdown "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
 	"github.com/go-shiori/go-readability"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/egress"
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
 )
 
 const (
@@ -31,6 +39,8 @@ type MDFetchRequest struct {
 	AllowInsecureTLS bool   `json:"allow_insecure_tls,omitempty"`
 	RenderJS         bool   `json:"render_js,omitempty"`
 	SaveArtifacts    bool   `json:"save_artifacts,omitempty"`
+	Selector         string `json:"selector,omitempty"`
+	Proxy            string `json:"proxy,omitempty"`
 }
 
 // MDFetchResponse is the output for md.fetch.
@@ -46,21 +56,124 @@ type MDFetchResponse struct {
 		HTMLPath string `json:"html_path,omitempty"`
 		MDPath   string `json:"md_path,omitempty"`
 	} `json:"artifacts,omitempty"`
+	Rendered   bool   `json:"rendered,omitempty"`
+	Warning    string `json:"warning,omitempty"`
 	DurationMs int64  `json:"duration_ms"`
 	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
+}
+
+// browserCandidates are the headless-capable browser binaries tried, in
+// order, when RenderJS is requested.
+var browserCandidates = []string{"chromium", "chromium-browser", "google-chrome", "headless-shell"}
+
+func findBrowser() string {
+	for _, name := range browserCandidates {
+		if p, err := exec.LookPath(name); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// browserNoSandbox reports whether the operator disabled the browser's
+// sandbox with BROWSER_NO_SANDBOX=1, which Chromium needs when run as root.
+func browserNoSandbox() bool {
+	return os.Getenv("BROWSER_NO_SANDBOX") == "1"
+}
+
+// capBuffer keeps the first max bytes written to it and discards the rest,
+// so the browser is never blocked on a full pipe.
+type capBuffer struct {
+	buf bytes.Buffer
+	max int64
+}
+
+func (b *capBuffer) Write(p []byte) (int, error) {
+	if room := b.max - int64(b.buf.Len()); room > 0 {
+		b.buf.Write(p[:min(int64(len(p)), room)])
+	}
+	return len(p), nil
+}
+
+// renderDOM loads target in a headless browser and returns the serialized
+// DOM after scripts have run, keeping at most maxBytes+1 bytes. The browser
+// runs in its own process group, which is killed when ctx expires.
+func renderDOM(ctx context.Context, bin, target string, timeout time.Duration, maxBytes int64, insecure bool, proxy *url.URL) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	args := []string{"--headless", "--disable-gpu", "--dump-dom"}
+	if browserNoSandbox() {
+		args = append(args, "--no-sandbox")
+	}
+	if insecure {
+		args = append(args, "--ignore-certificate-errors")
+	}
+	if proxy != nil {
+		// credentials are refused by the caller; the browser knows socks5 only
+		args = append(args, "--proxy-server="+strings.TrimSuffix(proxy.Scheme, "h")+"://"+proxy.Host)
+	}
+	args = append(args, target)
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	out := &capBuffer{max: maxBytes + 1}
+	cmd.Stdout = out
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, errors.New("render timed out")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("browser: %w", err)
+	}
+	return out.buf.Bytes(), nil
+}
+
+// selectContent bypasses readability and keeps only the nodes matching
+// selector, in document order. The page title is preserved.
+func selectContent(data []byte, selector string) (readability.Article, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err != nil {
+		return readability.Article{}, err
+	}
+	sel := doc.Find(selector)
+	if sel.Length() == 0 {
+		return readability.Article{}, fmt.Errorf("selector %q matched nothing", selector)
+	}
+	var b strings.Builder
+	var outerErr error
+	sel.Each(func(_ int, n *goquery.Selection) {
+		html, err := goquery.OuterHtml(n)
+		if err != nil {
+			outerErr = err
+			return
+		}
+		b.WriteString(html)
+		b.WriteString("\n")
+	})
+	if outerErr != nil {
+		return readability.Article{}, outerErr
+	}
+	return readability.Article{
+		Title:   strings.TrimSpace(doc.Find("title").First().Text()),
+		Content: b.String(),
+	}, nil
 }
 
 // FetchMarkdown retrieves a page and converts the main content to Markdown.
 func FetchMarkdown(ctx context.Context, in MDFetchRequest) MDFetchResponse {
 	start := time.Now()
 	if !egressAllowed() {
-		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "egress disabled"}
-	}
-	if in.RenderJS {
-		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "render_js not supported"}
+		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "egress disabled", ErrorCode: errcode.EgressDisabled}
 	}
 	if in.URL == "" {
-		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "url is required"}
+		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "url is required", ErrorCode: errcode.InvalidArgument}
+	}
+	if err := egress.Check(ctx, "md.fetch", in.URL); err != nil {
+		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	timeout := defaultFetchTimeout
 	if in.TimeoutMs > 0 {
@@ -70,24 +183,49 @@ func FetchMarkdown(ctx context.Context, in MDFetchRequest) MDFetchResponse {
 	if in.MaxBytes > 0 {
 		maxBytes = in.MaxBytes
 	}
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	if in.AllowInsecureTLS {
-		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec
-	}
-	client := &http.Client{Timeout: timeout, Transport: transport}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, in.URL, nil)
+	proxy, err := requestProxy(ctx, "md.fetch", in.Proxy)
 	if err != nil {
-		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	var data []byte
+	var rendered bool
+	var warning string
+	if in.RenderJS && egress.Restricted() {
+		// the browser follows redirects and loads subresources itself, out
+		// of reach of the allow-list
+		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "render_js is not available while EGRESS_ALLOW_HOSTS is set", ErrorCode: errcode.PolicyBlocked}
 	}
-	defer resp.Body.Close()
-	limited := io.LimitReader(resp.Body, maxBytes+1)
-	data, err := io.ReadAll(limited)
-	if err != nil {
-		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	if in.RenderJS {
+		if bin := findBrowser(); bin != "" {
+			if proxy != nil && proxy.User != nil {
+				return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "render_js cannot pass proxy credentials to the browser", ErrorCode: errcode.InvalidArgument}
+			}
+			dom, err := renderDOM(ctx, bin, in.URL, timeout, maxBytes, in.AllowInsecureTLS, proxy)
+			if err != nil {
+				return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+			}
+			data, rendered = dom, true
+		} else {
+			warning = "render_js requested but no headless browser found; used static fetch"
+		}
+	}
+	if !rendered {
+		transport := newTransport(in.AllowInsecureTLS, proxy)
+		client := &http.Client{Timeout: timeout, Transport: transport, CheckRedirect: egress.CheckRedirect("md.fetch")}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, in.URL, nil)
+		if err != nil {
+			return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+		defer resp.Body.Close()
+		limited := io.LimitReader(resp.Body, maxBytes+1)
+		data, err = io.ReadAll(limited)
+		if err != nil {
+			return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
 	}
 	truncated := int64(len(data)) > maxBytes
 	if truncated {
@@ -95,31 +233,38 @@ func FetchMarkdown(ctx context.Context, in MDFetchRequest) MDFetchResponse {
 	}
 	u, err := url.Parse(in.URL)
 	if err != nil {
-		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	var article readability.Article
+	if in.Selector != "" {
+		article, err = selectContent(data, in.Selector)
+	} else {
+		article, err = readability.FromReader(strings.NewReader(string(data)), u)
 	}
-	doc, err := readability.FromReader(strings.NewReader(string(data)), u)
 	if err != nil {
-		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	converter := markdown.NewConverter("", true, nil)
-	md, err := converter.ConvertString(doc.Content)
+	md, err := converter.ConvertString(article.Content)
 	if err != nil {
-		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return MDFetchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
-	if doc.Title != "" && !strings.Contains(md, doc.Title) {
-		md = "# " + doc.Title + "\n\n" + md
+	if article.Title != "" && !strings.Contains(md, article.Title) {
+		md = "# " + article.Title + "\n\n" + md
 	}
 	out := MDFetchResponse{
-		Title:        doc.Title,
-		Byline:       doc.Byline,
-		SiteName:     doc.SiteName,
+		Title:        article.Title,
+		Byline:       article.Byline,
+		SiteName:     article.SiteName,
 		Markdown:     md,
 		Truncated:    truncated,
+		Rendered:     rendered,
+		Warning:      warning,
 		DurationMs:   time.Since(start).Milliseconds(),
 		CanonicalURL: in.URL,
 	}
-	if doc.PublishedTime != nil {
-		out.Published = doc.PublishedTime.Format(time.RFC3339)
+	if article.PublishedTime != nil {
+		out.Published = article.PublishedTime.Format(time.RFC3339)
 	}
 	if in.SaveArtifacts {
 		cacheDir := filepath.Join(workspaceRoot(), ".cache", "web")
@@ -135,28 +280,18 @@ func FetchMarkdown(ctx context.Context, in MDFetchRequest) MDFetchResponse {
 			MDPath   string `json:"md_path,omitempty"`
 		}{HTMLPath: htmlPath, MDPath: mdPath}
 	}
-	auditMDFetch(in, out)
+	auditMDFetch(ctx, in, out)
 	return out
 }
 
-func auditMDFetch(in MDFetchRequest, out MDFetchResponse) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
+func auditMDFetch(ctx context.Context, in MDFetchRequest, out MDFetchResponse) {
 	rec := struct {
 		TS       string `json:"ts"`
 		Tool     string `json:"tool"`
 		URL      string `json:"url"`
 		Duration int64  `json:"duration_ms"`
 		Trunc    bool   `json:"truncated"`
-	}{time.Now().UTC().Format(time.RFC3339), "md.fetch", in.URL, out.DurationMs, out.Truncated}
-	_ = json.NewEncoder(f).Encode(rec)
+		Rendered bool   `json:"rendered,omitempty"`
+	}{time.Now().UTC().Format(time.RFC3339), "md.fetch", in.URL, out.DurationMs, out.Truncated, out.Rendered}
+	auditlog.Write(ctx, rec)
 }
@@ -5,8 +5,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
 )
 
 func TestFetchMarkdown(t *testing.T) {
@@ -38,3 +42,100 @@ func TestFetchMarkdown(t *testing.T) {
 		t.Fatalf("md artifact not found")
 	}
 }
+
+func TestFetchMarkdownRenderJS(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	t.Setenv("WORKSPACE", t.TempDir())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>Static</title></head><body><article><p>Static page body text.</p></article></body></html>`))
+	}))
+	defer srv.Close()
+
+	// no browser on PATH: static fetch with a warning
+	t.Setenv("PATH", t.TempDir())
+	resp := FetchMarkdown(context.Background(), MDFetchRequest{URL: srv.URL, RenderJS: true})
+	if resp.Error != "" || resp.Rendered || resp.Warning == "" || !strings.Contains(resp.Markdown, "Static page body") {
+		t.Fatalf("unexpected fallback result %+v", resp)
+	}
+
+	// a stub browser stands in for chromium --dump-dom
+	bin := t.TempDir()
+	stub := "#!/bin/sh\necho '<html><head><title>Rendered</title></head><body><article><p>Rendered by script content.</p></article></body></html>'\n"
+	if err := os.WriteFile(filepath.Join(bin, "chromium"), []byte(stub), 0o755); err != nil {
+		t.Fatalf("write stub: %v", err)
+	}
+	t.Setenv("PATH", bin)
+	resp = FetchMarkdown(context.Background(), MDFetchRequest{URL: srv.URL, RenderJS: true})
+	if resp.Error != "" || !resp.Rendered || !strings.Contains(resp.Markdown, "Rendered by script") {
+		t.Fatalf("unexpected rendered result %+v", resp)
+	}
+}
+
+func TestFetchMarkdownRenderJSHardening(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	t.Setenv("WORKSPACE", t.TempDir())
+	bin := t.TempDir()
+	argsFile := filepath.Join(bin, "args")
+	stub := "#!/bin/sh\necho \"$@\" > " + argsFile + "\necho '<html><body><article><p>Rendered text here.</p></article></body></html>'\n"
+	if err := os.WriteFile(filepath.Join(bin, "chromium"), []byte(stub), 0o755); err != nil {
+		t.Fatalf("write stub: %v", err)
+	}
+	t.Setenv("PATH", bin+":/usr/bin:/bin")
+	ctx := context.Background()
+
+	// the sandbox stays on unless the operator opts out
+	if resp := FetchMarkdown(ctx, MDFetchRequest{URL: "http://example.invalid/", RenderJS: true}); resp.Error != "" {
+		t.Fatalf("render failed %+v", resp)
+	}
+	if args, _ := os.ReadFile(argsFile); strings.Contains(string(args), "--no-sandbox") {
+		t.Fatalf("sandbox disabled by default: %s", args)
+	}
+	t.Setenv("BROWSER_NO_SANDBOX", "1")
+	FetchMarkdown(ctx, MDFetchRequest{URL: "http://example.invalid/", RenderJS: true})
+	if args, _ := os.ReadFile(argsFile); !strings.Contains(string(args), "--no-sandbox") {
+		t.Fatalf("expected --no-sandbox when opted in: %s", args)
+	}
+
+	// a hung browser and its helpers are killed at the deadline
+	hang := "#!/bin/sh\nsleep 30 &\nsleep 30\n"
+	if err := os.WriteFile(filepath.Join(bin, "chromium"), []byte(hang), 0o755); err != nil {
+		t.Fatalf("write stub: %v", err)
+	}
+	start := time.Now()
+	if resp := FetchMarkdown(ctx, MDFetchRequest{URL: "http://example.invalid/", RenderJS: true, TimeoutMs: 200}); !strings.Contains(resp.Error, "timed out") {
+		t.Fatalf("expected timeout %+v", resp)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("render took %s after the deadline", d)
+	}
+
+	// the browser cannot be held to the allow-list
+	t.Setenv("EGRESS_ALLOW_HOSTS", "example.invalid")
+	if resp := FetchMarkdown(ctx, MDFetchRequest{URL: "http://example.invalid/", RenderJS: true}); resp.ErrorCode != errcode.PolicyBlocked {
+		t.Fatalf("expected render_js to be refused with an allow-list, got %+v", resp)
+	}
+}
+
+func TestFetchMarkdownSelector(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	t.Setenv("WORKSPACE", t.TempDir())
+	html := `<html><head><title>Docs</title></head><body><nav>Menu junk</nav><div class="content"><h2>Install</h2><p>Run make.</p></div><div class="content"><p>Second block.</p></div></body></html>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(html))
+	}))
+	defer srv.Close()
+	resp := FetchMarkdown(context.Background(), MDFetchRequest{URL: srv.URL, Selector: "div.content"})
+	if resp.Error != "" {
+		t.Fatalf("unexpected error: %v", resp.Error)
+	}
+	if !strings.Contains(resp.Markdown, "Run make.") || !strings.Contains(resp.Markdown, "Second block.") || strings.Contains(resp.Markdown, "Menu junk") {
+		t.Fatalf("unexpected markdown %q", resp.Markdown)
+	}
+	if resp.Title != "Docs" {
+		t.Fatalf("unexpected title %q", resp.Title)
+	}
+	miss := FetchMarkdown(context.Background(), MDFetchRequest{URL: srv.URL, Selector: "#missing"})
+	if !strings.Contains(miss.Error, "matched nothing") {
+		t.Fatalf("expected no-match error, got %+v", miss)
+	}
+}
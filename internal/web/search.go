@@ -3,12 +3,15 @@ package web
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
 )
 
 // SearchRequest defines parameters for the web.search tool.
@@ -20,8 +23,14 @@ type SearchRequest struct {
 	TimeRange  string   `json:"time_range,omitempty"`
 	Language   string   `json:"language,omitempty"`
 	TimeoutMs  int      `json:"timeout_ms,omitempty"`
+	Retries    int      `json:"retries,omitempty"` // extra attempts on 429 and 5xx
 }
 
+const (
+	maxSearchRetries = 5
+	maxSearchBackoff = 8 * time.Second
+)
+
 // SearchResult represents a single search hit.
 type SearchResult struct {
 	Title     string `json:"title"`
@@ -36,16 +45,17 @@ type SearchResponse struct {
 	Results    []SearchResult `json:"results"`
 	DurationMs int64          `json:"duration_ms"`
 	Error      string         `json:"error,omitempty"`
+	ErrorCode  string         `json:"error_code,omitempty"`
 }
 
 // Search performs a SearxNG query and returns normalized results.
 func Search(ctx context.Context, in SearchRequest) SearchResponse {
 	start := time.Now()
 	if !egressAllowed() {
-		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "egress disabled"}
+		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "egress disabled", ErrorCode: errcode.EgressDisabled}
 	}
 	if strings.TrimSpace(in.Query) == "" {
-		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "query is required"}
+		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "query is required", ErrorCode: errcode.InvalidArgument}
 	}
 	base := os.Getenv("SEARXNG_BASE")
 	if base == "" {
@@ -56,7 +66,7 @@ func Search(ctx context.Context, in SearchRequest) SearchResponse {
 	}
 	u, err := url.Parse(base)
 	if err != nil {
-		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "invalid searxng base url"}
+		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: "invalid searxng base url", ErrorCode: errcode.Failed}
 	}
 	u.Path = "/search"
 	q := u.Query()
@@ -86,16 +96,43 @@ func Search(ctx context.Context, in SearchRequest) SearchResponse {
 	if in.TimeoutMs > 0 {
 		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
-	if err != nil {
-		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
-	}
-	client := &http.Client{Timeout: timeout}
-	resp, err := client.Do(req)
-	if err != nil {
-		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	// the timeout covers every attempt and the waits between them
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	retries := min(in.Retries, maxSearchRetries)
+	client := &http.Client{}
+	var resp *http.Response
+	attempts := 0
+	for {
+		attempts++
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+		resp, err = client.Do(req)
+		if err != nil {
+			return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+		if (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500) || attempts > retries {
+			break
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		// back off exponentially, but never past the caller's deadline
+		select {
+		case <-ctx.Done():
+			out := SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: ctx.Err().Error(), ErrorCode: errcode.Of(ctx.Err())}
+			auditSearch(ctx, in, out, attempts)
+			return out
+		case <-time.After(min(RetryBackoff<<(attempts-1), maxSearchBackoff)):
+		}
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		out := SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: resp.Status, ErrorCode: errcode.Failed}
+		auditSearch(ctx, in, out, attempts)
+		return out
+	}
 	var body struct {
 		Results []struct {
 			Title     string `json:"title"`
@@ -106,7 +143,7 @@ func Search(ctx context.Context, in SearchRequest) SearchResponse {
 		} `json:"results"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
-		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return SearchResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	limit := in.NumResults
 	if limit <= 0 || limit > len(body.Results) {
@@ -124,28 +161,19 @@ func Search(ctx context.Context, in SearchRequest) SearchResponse {
 		})
 	}
 	out.DurationMs = time.Since(start).Milliseconds()
-	auditSearch(in, out)
+	auditSearch(ctx, in, out, attempts)
 	return out
 }
 
-func auditSearch(in SearchRequest, out SearchResponse) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
+func auditSearch(ctx context.Context, in SearchRequest, out SearchResponse, attempts int) {
 	rec := struct {
 		TS       string `json:"ts"`
 		Tool     string `json:"tool"`
 		Query    string `json:"query"`
 		Results  int    `json:"results"`
 		Duration int64  `json:"duration_ms"`
-	}{time.Now().UTC().Format(time.RFC3339), "web.search", in.Query, len(out.Results), out.DurationMs}
-	_ = json.NewEncoder(f).Encode(rec)
+		Attempts int    `json:"attempts"`
+		Error    string `json:"error,omitempty"`
+	}{time.Now().UTC().Format(time.RFC3339), "web.search", in.Query, len(out.Results), out.DurationMs, attempts, out.Error}
+	auditlog.Write(ctx, rec)
 }
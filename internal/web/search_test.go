@@ -6,6 +6,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
 )
 
 func TestSearch(t *testing.T) {
@@ -35,3 +38,55 @@ func TestSearch(t *testing.T) {
 		t.Fatalf("unexpected title: %s", resp.Results[0].Title)
 	}
 }
+
+func TestSearchRetries(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	RetryBackoff = time.Millisecond
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"results":[{"title":"ok","url":"https://example.com"}]}`))
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("SEARXNG_URL", srv.URL)
+	if resp := Search(context.Background(), SearchRequest{Query: "x"}); resp.ErrorCode != errcode.Failed || calls != 1 {
+		t.Fatalf("expected a single failing attempt by default, got %+v after %d calls", resp, calls)
+	}
+	calls = 0
+	resp := Search(context.Background(), SearchRequest{Query: "x", Retries: 2})
+	if resp.Error != "" || len(resp.Results) != 1 || calls != 3 {
+		t.Fatalf("unexpected result %+v after %d calls", resp, calls)
+	}
+}
+
+func TestSearchRetryLimits(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	old := RetryBackoff
+	defer func() { RetryBackoff = old }()
+	RetryBackoff = time.Millisecond
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	t.Setenv("SEARXNG_URL", srv.URL)
+	if resp := Search(context.Background(), SearchRequest{Query: "x", Retries: 1000}); resp.Error == "" || calls != maxSearchRetries+1 {
+		t.Fatalf("expected retries to be capped, got %+v after %d calls", resp, calls)
+	}
+
+	// the timeout bounds the whole retry loop, not each attempt
+	RetryBackoff = time.Second
+	begin := time.Now()
+	resp := Search(context.Background(), SearchRequest{Query: "x", Retries: 3, TimeoutMs: 100})
+	if resp.ErrorCode != errcode.Timeout || time.Since(begin) > 900*time.Millisecond {
+		t.Fatalf("expected a timeout within the deadline, got %+v after %v", resp, time.Since(begin))
+	}
+}
@@ -1,28 +1,46 @@
 package web
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/http/cookiejar"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
+
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/egress"
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
+	"github.com/gaspardpetit/mcp-shell/internal/quota"
 )
 
 const (
 	DefaultTimeout       = 60 * time.Second
 	DefaultMaxBody int64 = 1 << 20 // 1 MiB
-	LogPath              = "/logs/mcp-shell.log"
 )
 
+// RetryBackoff is the fixed delay between http.request retry attempts and
+// the initial, doubling delay between web.search attempts.
+var RetryBackoff = 500 * time.Millisecond
+
+var errTooManyRedirects = errors.New("too many redirects")
+
 func egressAllowed() bool {
 	return os.Getenv("EGRESS") == "1"
 }
@@ -37,7 +55,7 @@ func workspaceRoot() string {
 
 func normalizePath(p string) (string, error) {
 	if p == "" {
-		return "", errors.New("dest_path is required")
+		return "", errcode.Wrap(errcode.InvalidArgument, errors.New("dest_path is required"))
 	}
 	root := workspaceRoot()
 	if !filepath.IsAbs(p) {
@@ -46,11 +64,61 @@ func normalizePath(p string) (string, error) {
 	p = filepath.Clean(p)
 	rel, err := filepath.Rel(root, p)
 	if err != nil || strings.HasPrefix(rel, "..") {
-		return "", errors.New("path escapes workspace")
+		return "", errcode.Wrap(errcode.PathEscape, errors.New("path escapes workspace"))
 	}
 	return p, nil
 }
 
+// parseProxy validates a proxy URL. net/http dials http, https and SOCKS5
+// proxies itself. It treats socks5 and socks5h alike: both hand the target
+// host name to the proxy, which resolves it.
+func parseProxy(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, errcode.Errorf(errcode.InvalidArgument, "invalid proxy url: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, errcode.Errorf(errcode.InvalidArgument, "unsupported proxy scheme %q (want http, https, socks5 or socks5h)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errcode.Errorf(errcode.InvalidArgument, "proxy url %q has no host", raw)
+	}
+	return u, nil
+}
+
+// requestProxy parses a caller-supplied proxy and applies the egress
+// allow-list to its host: every request is sent through it, so an
+// unlisted proxy would see traffic meant only for allowed hosts. An empty
+// raw yields nil, leaving the environment's proxy settings in effect.
+func requestProxy(ctx context.Context, tool, raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := parseProxy(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := egress.Check(ctx, tool, u.String()); err != nil {
+		return nil, errcode.Wrap(errcode.EgressDisabled, fmt.Errorf("proxy: %w", err))
+	}
+	return u, nil
+}
+
+// newTransport clones the default transport, optionally skipping TLS
+// verification and routing through proxy instead of the environment's.
+func newTransport(insecure bool, proxy *url.URL) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec
+	}
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return transport
+}
+
 // ---- http.request ----
 
 type HTTPRequest struct {
@@ -62,6 +130,56 @@ type HTTPRequest struct {
 	TimeoutMs        int               `json:"timeout_ms,omitempty"`
 	MaxBytes         int64             `json:"max_bytes,omitempty"`
 	AllowInsecureTLS bool              `json:"allow_insecure_tls,omitempty"`
+	MaxRedirects     int               `json:"max_redirects,omitempty"`
+	Retries          int               `json:"retries,omitempty"`
+	FormFields       map[string]string `json:"form_fields,omitempty"`
+	FormFiles        map[string]string `json:"form_files,omitempty"`
+	SessionID        string            `json:"session_id,omitempty"`
+	// SaveToPath streams the body into a workspace file instead of
+	// returning it, without the max_bytes cap.
+	SaveToPath string `json:"save_to_path,omitempty"`
+	// BasicAuthUser/BasicAuthPass or BearerToken set Authorization unless
+	// Headers already carries one. They are never written to the audit log.
+	BasicAuthUser string `json:"basic_auth_user,omitempty"`
+	BasicAuthPass string `json:"basic_auth_pass,omitempty"`
+	BearerToken   string `json:"bearer_token,omitempty"`
+	Proxy         string `json:"proxy,omitempty"` // http(s):// or socks5(h):// URL; overrides HTTP_PROXY
+}
+
+// authScheme names the credential helper in use, for validation and audit.
+func (in HTTPRequest) authScheme() string {
+	switch {
+	case in.BasicAuthUser != "" || in.BasicAuthPass != "":
+		return "basic"
+	case in.BearerToken != "":
+		return "bearer"
+	}
+	return ""
+}
+
+// setAuth applies the credential helpers to req unless an Authorization
+// header was given explicitly.
+func setAuth(req *http.Request, in HTTPRequest) {
+	if req.Header.Get("Authorization") != "" {
+		return
+	}
+	switch in.authScheme() {
+	case "basic":
+		req.SetBasicAuth(in.BasicAuthUser, in.BasicAuthPass)
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+in.BearerToken)
+	}
+}
+
+// Cookie is a cookie set by an http.request response.
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	HttpOnly bool   `json:"http_only,omitempty"`
 }
 
 type HTTPResponse struct {
@@ -70,20 +188,109 @@ type HTTPResponse struct {
 	Body       string              `json:"body,omitempty"`
 	BodyB64    string              `json:"body_b64,omitempty"`
 	Truncated  bool                `json:"truncated"`
+	Attempts   int                 `json:"attempts"`
+	Cookies    []Cookie            `json:"cookies,omitempty"`
+	SavedPath  string              `json:"saved_path,omitempty"`
+	Size       int64               `json:"size,omitempty"`
+	Sha256     string              `json:"sha256,omitempty"`
 	DurationMs int64               `json:"duration_ms"`
 	Error      string              `json:"error,omitempty"`
+	ErrorCode  string              `json:"error_code,omitempty"`
+}
+
+// sessions maps SessionID to the cookie jar shared by requests using it.
+var sessions sync.Map
+
+func sessionJar(id string) http.CookieJar {
+	if id == "" {
+		return nil
+	}
+	if jar, ok := sessions.Load(id); ok {
+		return jar.(http.CookieJar)
+	}
+	jar, _ := cookiejar.New(nil)
+	actual, _ := sessions.LoadOrStore(id, jar)
+	return actual.(http.CookieJar)
+}
+
+func responseCookies(resp *http.Response) []Cookie {
+	var out []Cookie
+	for _, c := range resp.Cookies() {
+		ck := Cookie{Name: c.Name, Value: c.Value, Domain: c.Domain, Path: c.Path, Secure: c.Secure, HttpOnly: c.HttpOnly}
+		if !c.Expires.IsZero() {
+			ck.Expires = c.Expires.UTC().Format(time.RFC3339)
+		}
+		out = append(out, ck)
+	}
+	return out
+}
+
+// checkRedirect builds a CheckRedirect policy: 0 keeps net/http's default,
+// a negative value returns the first response without following it, and a
+// positive value fails once that many redirects have been followed. Every
+// followed hop is also checked against the egress allow-list.
+func checkRedirect(tool string, max int) func(*http.Request, []*http.Request) error {
+	switch {
+	case max < 0:
+		return func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	case max > 0:
+		allowed := egress.CheckRedirect(tool)
+		return func(req *http.Request, via []*http.Request) error {
+			if len(via) > max {
+				return fmt.Errorf("%w: stopped after %d", errTooManyRedirects, max)
+			}
+			return allowed(req, via)
+		}
+	}
+	return egress.CheckRedirect(tool)
+}
+
+// multipartBody streams a multipart/form-data body through a pipe so files
+// are never held in memory. It returns the reader and its Content-Type.
+func multipartBody(fields, files map[string]string) (io.Reader, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		err := func() error {
+			for k, v := range fields {
+				if err := mw.WriteField(k, v); err != nil {
+					return err
+				}
+			}
+			for field, path := range files {
+				f, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				part, err := mw.CreateFormFile(field, filepath.Base(path))
+				if err == nil {
+					_, err = io.Copy(part, f)
+				}
+				f.Close()
+				if err != nil {
+					return err
+				}
+			}
+			return mw.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+	return pr, mw.FormDataContentType()
 }
 
 func HTTPRequestTool(ctx context.Context, in HTTPRequest) HTTPResponse {
 	start := time.Now()
 	if !egressAllowed() {
-		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: "egress disabled"}
+		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: "egress disabled", ErrorCode: errcode.EgressDisabled}
 	}
 	if in.Method == "" {
 		in.Method = http.MethodGet
 	}
 	if in.URL == "" {
-		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: "url is required"}
+		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: "url is required", ErrorCode: errcode.InvalidArgument}
+	}
+	if err := egress.Check(ctx, "http.request", in.URL); err != nil {
+		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
@@ -93,59 +300,186 @@ func HTTPRequestTool(ctx context.Context, in HTTPRequest) HTTPResponse {
 	if in.MaxBytes > 0 {
 		limit = in.MaxBytes
 	}
-	var bodyReader io.Reader
+	var body []byte
 	if in.Body != "" && in.BodyB64 != "" {
-		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: "body and body_b64 are mutually exclusive"}
+		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: "body and body_b64 are mutually exclusive", ErrorCode: errcode.InvalidArgument}
+	}
+	multipartForm := len(in.FormFields) > 0 || len(in.FormFiles) > 0
+	if multipartForm && (in.Body != "" || in.BodyB64 != "") {
+		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: "body and form fields are mutually exclusive", ErrorCode: errcode.InvalidArgument}
+	}
+	formFiles := map[string]string{}
+	for field, p := range in.FormFiles {
+		if p == "" {
+			return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: fmt.Sprintf("form file %q has no path", field), ErrorCode: errcode.InvalidArgument}
+		}
+		path, err := normalizePath(p)
+		if err != nil {
+			return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: fmt.Sprintf("form file %q is not a readable file", p), ErrorCode: errcode.InvalidArgument}
+		}
+		formFiles[field] = path
+	}
+	if in.BearerToken != "" && in.authScheme() == "basic" {
+		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: "basic auth and bearer_token are mutually exclusive", ErrorCode: errcode.InvalidArgument}
+	}
+	savePath := ""
+	if in.SaveToPath != "" {
+		p, err := normalizePath(in.SaveToPath)
+		if err != nil {
+			return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+		savePath = p
 	}
 	if in.Body != "" {
-		bodyReader = strings.NewReader(in.Body)
+		body = []byte(in.Body)
 	} else if in.BodyB64 != "" {
 		b, err := base64.StdEncoding.DecodeString(in.BodyB64)
 		if err != nil {
-			return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: "invalid body_b64"}
+			return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: "invalid body_b64", ErrorCode: errcode.InvalidArgument}
 		}
-		bodyReader = strings.NewReader(string(b))
+		body = b
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, in.Method, in.URL, bodyReader)
+	proxy, err := requestProxy(ctx, "http.request", in.Proxy)
 	if err != nil {
-		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
-	}
-	for k, v := range in.Headers {
-		req.Header.Set(k, v)
-	}
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	if in.AllowInsecureTLS {
-		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec
+		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
-	client := &http.Client{Transport: transport}
-	resp, err := client.Do(req)
-	if err != nil {
-		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	transport := newTransport(in.AllowInsecureTLS, proxy)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	client := &http.Client{Transport: transport, CheckRedirect: checkRedirect("http.request", in.MaxRedirects), Jar: sessionJar(in.SessionID)}
+	var resp *http.Response
+	attempts := 0
+	for {
+		attempts++
+		var bodyReader io.Reader
+		contentType := ""
+		if multipartForm {
+			bodyReader, contentType = multipartBody(in.FormFields, formFiles)
+		} else if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, in.Method, in.URL, bodyReader)
+		if err != nil {
+			return HTTPResponse{Attempts: attempts, DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+		for k, v := range in.Headers {
+			req.Header.Set(k, v)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		setAuth(req, in)
+		resp, err = client.Do(req)
+		// only connection failures and 5xx responses are worth retrying
+		retryable := (err != nil && ctx.Err() == nil && !errors.Is(err, errTooManyRedirects) && !errors.Is(err, egress.ErrHostNotAllowed)) ||
+			(err == nil && resp.StatusCode >= 500)
+		if !retryable || attempts > in.Retries {
+			if err != nil {
+				return HTTPResponse{Attempts: attempts, DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+			}
+			break
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return HTTPResponse{Attempts: attempts, DurationMs: time.Since(start).Milliseconds(), Error: ctx.Err().Error(), ErrorCode: errcode.Of(ctx.Err())}
+		case <-time.After(RetryBackoff):
+		}
 	}
 	defer resp.Body.Close()
+	if savePath != "" {
+		size, sum, err := saveBody(savePath, resp.Body)
+		if err != nil {
+			return HTTPResponse{Status: resp.StatusCode, Attempts: attempts, DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+		out := HTTPResponse{Status: resp.StatusCode, Headers: resp.Header, Attempts: attempts, Cookies: responseCookies(resp), SavedPath: savePath, Size: size, Sha256: sum}
+		out.DurationMs = time.Since(start).Milliseconds()
+		auditHTTPRequest(ctx, in, out, int(size))
+		return out
+	}
 	limited := io.LimitReader(resp.Body, limit+1)
 	data, err := io.ReadAll(limited)
 	if err != nil {
-		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return HTTPResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	truncated := int64(len(data)) > limit
 	if truncated {
 		data = data[:int(limit)]
 	}
-	out := HTTPResponse{Status: resp.StatusCode, Headers: resp.Header, Truncated: truncated}
+	out := HTTPResponse{Status: resp.StatusCode, Headers: resp.Header, Truncated: truncated, Attempts: attempts, Cookies: responseCookies(resp)}
 	if utf8.Valid(data) {
 		out.Body = string(data)
 	} else {
 		out.BodyB64 = base64.StdEncoding.EncodeToString(data)
 	}
 	out.DurationMs = time.Since(start).Milliseconds()
-	auditHTTPRequest(in, out, len(data))
+	auditHTTPRequest(ctx, in, out, len(data))
 	return out
 }
 
+// saveBody streams r into a temp file beside path, hashing as it goes, and
+// renames it into place so a failed transfer never leaves a partial file.
+// Writes count against the workspace quota.
+func saveBody(path string, r io.Reader) (int64, string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return 0, "", err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(quota.NewWriter(tmp), hash), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		if errors.Is(err, quota.ErrExceeded) {
+			quota.Invalidate()
+		}
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ---- http.session.clear ----
+
+type SessionClearRequest struct {
+	SessionID string `json:"session_id"`
+}
+
+type SessionClearResponse struct {
+	Cleared    bool   `json:"cleared"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
+}
+
+// ClearSession drops the cookie jar for a SessionID. Clearing an unknown
+// session is not an error; Cleared reports whether one existed.
+func ClearSession(ctx context.Context, in SessionClearRequest) SessionClearResponse {
+	start := time.Now()
+	if in.SessionID == "" {
+		return SessionClearResponse{DurationMs: time.Since(start).Milliseconds(), Error: "session_id is required", ErrorCode: errcode.InvalidArgument}
+	}
+	_, existed := sessions.LoadAndDelete(in.SessionID)
+	return SessionClearResponse{Cleared: existed, DurationMs: time.Since(start).Milliseconds()}
+}
+
 // ---- web.download ----
 
 type DownloadRequest struct {
@@ -154,85 +488,235 @@ type DownloadRequest struct {
 	ExpectedSHA256   string `json:"expected_sha256,omitempty"`
 	TimeoutMs        int    `json:"timeout_ms,omitempty"`
 	AllowInsecureTLS bool   `json:"allow_insecure_tls,omitempty"`
+	Resume           bool   `json:"resume,omitempty"`
+	BytesRange       string `json:"bytes_range,omitempty"`
+	// FilenameFromHeader treats an existing directory DestPath as the target
+	// folder and names the file after Content-Disposition or the final URL.
+	// An existing file of that name is only replaced with Overwrite.
+	FilenameFromHeader bool `json:"filename_from_header,omitempty"`
+	Overwrite          bool `json:"overwrite,omitempty"`
+	// ExpectedContentType is matched against the Content-Type header, or the
+	// type sniffed from the body when the server sends none.
+	ExpectedContentType string `json:"expected_content_type,omitempty"` // prefix, e.g. "application/pdf" or "image/"
+	Proxy               string `json:"proxy,omitempty"`
 }
 
 type DownloadResponse struct {
-	Path       string `json:"path"`
-	Size       int64  `json:"size"`
-	Sha256     string `json:"sha256"`
-	DurationMs int64  `json:"duration_ms"`
-	Error      string `json:"error,omitempty"`
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	Sha256      string `json:"sha256"`
+	Resumed     bool   `json:"resumed,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	DurationMs  int64  `json:"duration_ms"`
+	Error       string `json:"error,omitempty"`
+	ErrorCode   string `json:"error_code,omitempty"`
 }
 
 func Download(ctx context.Context, in DownloadRequest) DownloadResponse {
 	start := time.Now()
 	if !egressAllowed() {
-		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: "egress disabled"}
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: "egress disabled", ErrorCode: errcode.EgressDisabled}
 	}
 	if in.URL == "" || in.DestPath == "" {
-		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: "url and dest_path are required"}
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: "url and dest_path are required", ErrorCode: errcode.InvalidArgument}
+	}
+	if in.Resume && in.BytesRange != "" {
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: "resume and bytes_range are mutually exclusive", ErrorCode: errcode.InvalidArgument}
+	}
+	if err := egress.Check(ctx, "web.download", in.URL); err != nil {
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	dest, err := normalizePath(in.DestPath)
 	if err != nil {
-		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	proxy, err := requestProxy(ctx, "web.download", in.Proxy)
+	if err != nil {
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	transport := newTransport(in.AllowInsecureTLS, proxy)
+	destDir := ""
+	if in.FilenameFromHeader {
+		if info, err := os.Stat(dest); err == nil && info.IsDir() {
+			destDir = dest
+		}
 	}
 	timeout := DefaultTimeout
 	if in.TimeoutMs > 0 {
 		timeout = time.Duration(in.TimeoutMs) * time.Millisecond
 	}
+	var offset int64
+	if in.Resume && destDir == "" {
+		if info, err := os.Stat(dest); err == nil && info.Mode().IsRegular() {
+			offset = info.Size()
+		}
+	}
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, in.URL, nil)
 	if err != nil {
-		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	if in.AllowInsecureTLS {
-		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	} else if in.BytesRange != "" {
+		req.Header.Set("Range", "bytes="+in.BytesRange)
 	}
-	client := &http.Client{Transport: transport}
+	client := &http.Client{Transport: transport, CheckRedirect: egress.CheckRedirect("web.download")}
 	resp, err := client.Do(req)
 	if err != nil {
-		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	defer resp.Body.Close()
+	appendMode := false
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// the local file already holds everything the server has
+		resp.Body.Close()
+		return finishDownload(ctx, in, dest, "", start, true)
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		appendMode = true
+	case offset > 0 && resp.StatusCode < 400:
+		auditResumeFallback(ctx, in, dest, offset, resp.StatusCode)
+	case in.BytesRange != "" && resp.StatusCode != http.StatusPartialContent && resp.StatusCode < 400:
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: fmt.Sprintf("server ignored range request (status %d)", resp.StatusCode), ErrorCode: errcode.Failed}
+	}
 	if resp.StatusCode >= 400 {
-		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: resp.Status}
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: resp.Status, ErrorCode: errcode.Failed}
+	}
+	var body io.Reader = resp.Body
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if contentType == "" && in.ExpectedContentType != "" {
+		if appendMode {
+			// the type is decided by the start of the file already on disk
+			contentType = sniffFile(dest)
+		} else {
+			br := bufio.NewReader(resp.Body)
+			head, _ := br.Peek(512)
+			contentType = sniffType(head)
+			body = br
+		}
+	}
+	if err := checkContentType(in.ExpectedContentType, contentType); err != nil {
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Failed}
+	}
+	if destDir != "" {
+		if dest, err = normalizePath(filepath.Join(destDir, downloadFilename(resp))); err != nil {
+			return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+		if _, err := os.Lstat(dest); err == nil && !in.Overwrite {
+			return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: fmt.Sprintf("%s already exists; set overwrite to replace it", dest), ErrorCode: errcode.AlreadyExists}
+		}
+	}
+	if remaining, ok := quota.Remaining(); ok && resp.ContentLength > remaining {
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: fmt.Sprintf("%v: download is %d bytes, %d available", quota.ErrExceeded, resp.ContentLength, remaining), ErrorCode: errcode.QuotaExceeded}
+	}
+	if !appendMode {
+		// stream to a temp file and rename, so a failed download leaves any
+		// existing file untouched
+		if _, _, err := saveBody(dest, body); err != nil {
+			return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+		}
+		return finishDownload(ctx, in, dest, contentType, start, false)
 	}
-	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	if _, err := io.Copy(quota.NewWriter(f), body); err != nil {
+		f.Close()
+		if errors.Is(err, quota.ErrExceeded) {
+			quota.Invalidate()
+		}
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	if err := f.Close(); err != nil {
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	return finishDownload(ctx, in, dest, contentType, start, appendMode)
+}
+
+// downloadFilename picks a local name for a response: the Content-Disposition
+// filename when present, else the last segment of the final URL after
+// redirects. Directory components are stripped so the name stays in place.
+func downloadFilename(resp *http.Response) string {
+	name := ""
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		name = params["filename"]
+	}
+	if name == "" && resp.Request != nil {
+		name = path.Base(resp.Request.URL.Path)
+	}
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == ".." || name == "/" || name == "" {
+		return "download"
+	}
+	return name
+}
+
+// sniffType returns the media type http.DetectContentType sees in head.
+func sniffType(head []byte) string {
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	return contentType
+}
+
+// sniffFile sniffs the media type from the first bytes of the file at path.
+func sniffFile(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	return sniffType(head[:n])
+}
+
+// checkContentType enforces ExpectedContentType as a case-insensitive prefix.
+func checkContentType(expected, contentType string) error {
+	if expected != "" && !strings.HasPrefix(contentType, strings.ToLower(expected)) {
+		return fmt.Errorf("unexpected content type %q", contentType)
 	}
-	f, err := os.Create(dest)
+	return nil
+}
+
+// finishDownload hashes the complete file on disk so resumed downloads are
+// verified end to end, then checks ExpectedSHA256 and audits. Without a
+// Content-Type header the type is sniffed from the file's first bytes.
+func finishDownload(ctx context.Context, in DownloadRequest, dest, contentType string, start time.Time, resumed bool) DownloadResponse {
+	f, err := os.Open(dest)
 	if err != nil {
-		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
 	}
 	defer f.Close()
 	hash := sha256.New()
-	size, err := io.Copy(io.MultiWriter(f, hash), resp.Body)
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	hash.Write(head[:n])
+	size, err := io.Copy(hash, f)
 	if err != nil {
-		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Of(err)}
+	}
+	size += int64(n)
+	if contentType == "" && n > 0 {
+		contentType = sniffType(head[:n])
+	}
+	if err := checkContentType(in.ExpectedContentType, contentType); err != nil {
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: err.Error(), ErrorCode: errcode.Failed}
 	}
 	sum := hex.EncodeToString(hash.Sum(nil))
 	if in.ExpectedSHA256 != "" && !strings.EqualFold(sum, in.ExpectedSHA256) {
-		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: "sha256 mismatch"}
+		return DownloadResponse{DurationMs: time.Since(start).Milliseconds(), Error: "sha256 mismatch", ErrorCode: errcode.Failed}
 	}
-	out := DownloadResponse{Path: dest, Size: size, Sha256: sum, DurationMs: time.Since(start).Milliseconds()}
-	auditDownload(in, out)
+	out := DownloadResponse{Path: dest, Size: size, Sha256: sum, Resumed: resumed, ContentType: contentType, DurationMs: time.Since(start).Milliseconds()}
+	auditDownload(ctx, in, out)
 	return out
 }
 
-func auditHTTPRequest(in HTTPRequest, out HTTPResponse, bytesOut int) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
+func auditHTTPRequest(ctx context.Context, in HTTPRequest, out HTTPResponse, bytesOut int) {
 	rec := struct {
 		TS        string `json:"ts"`
 		Tool      string `json:"tool"`
@@ -242,22 +726,13 @@ func auditHTTPRequest(in HTTPRequest, out HTTPResponse, bytesOut int) {
 		Duration  int64  `json:"duration_ms"`
 		BytesOut  int    `json:"bytes_out"`
 		Truncated bool   `json:"truncated"`
-	}{time.Now().UTC().Format(time.RFC3339), "http.request", in.Method, in.URL, out.Status, out.DurationMs, bytesOut, out.Truncated}
-	_ = json.NewEncoder(f).Encode(rec)
+		Attempts  int    `json:"attempts"`
+		Auth      string `json:"auth,omitempty"` // scheme only; credentials are never logged
+	}{time.Now().UTC().Format(time.RFC3339), "http.request", in.Method, in.URL, out.Status, out.DurationMs, bytesOut, out.Truncated, out.Attempts, in.authScheme()}
+	auditlog.Write(ctx, rec)
 }
 
-func auditDownload(in DownloadRequest, out DownloadResponse) {
-	if LogPath == "" {
-		return
-	}
-	if err := os.MkdirAll(filepath.Dir(LogPath), 0o755); err != nil {
-		return
-	}
-	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer f.Close()
+func auditDownload(ctx context.Context, in DownloadRequest, out DownloadResponse) {
 	rec := struct {
 		TS       string `json:"ts"`
 		Tool     string `json:"tool"`
@@ -265,7 +740,22 @@ func auditDownload(in DownloadRequest, out DownloadResponse) {
 		Dest     string `json:"dest"`
 		Size     int64  `json:"size"`
 		Sha256   string `json:"sha256"`
+		Resumed  bool   `json:"resumed,omitempty"`
+		Type     string `json:"content_type,omitempty"`
 		Duration int64  `json:"duration_ms"`
-	}{time.Now().UTC().Format(time.RFC3339), "web.download", in.URL, out.Path, out.Size, out.Sha256, out.DurationMs}
-	_ = json.NewEncoder(f).Encode(rec)
+	}{time.Now().UTC().Format(time.RFC3339), "web.download", in.URL, out.Path, out.Size, out.Sha256, out.Resumed, out.ContentType, out.DurationMs}
+	auditlog.Write(ctx, rec)
+}
+
+func auditResumeFallback(ctx context.Context, in DownloadRequest, dest string, offset int64, status int) {
+	rec := struct {
+		TS     string `json:"ts"`
+		Tool   string `json:"tool"`
+		URL    string `json:"url"`
+		Dest   string `json:"dest"`
+		Offset int64  `json:"offset"`
+		Status int    `json:"status"`
+		Event  string `json:"event"`
+	}{time.Now().UTC().Format(time.RFC3339), "web.download", in.URL, dest, offset, status, "range ignored, restarting download"}
+	auditlog.Write(ctx, rec)
 }
@@ -1,14 +1,21 @@
 package web
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
 )
 
 func TestHTTPRequestTool(t *testing.T) {
@@ -32,6 +39,176 @@ func TestHTTPRequestTool(t *testing.T) {
 	}
 }
 
+func TestHTTPRequestSaveToPath(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Kind", "blob")
+		w.Write(data)
+	}))
+	defer srv.Close()
+	resp := HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL, MaxBytes: 10, SaveToPath: "out/blob.bin"})
+	sum := sha256.Sum256(data)
+	if resp.Error != "" || resp.Status != 200 || resp.Body != "" || resp.Truncated {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if resp.SavedPath != filepath.Join(root, "out", "blob.bin") || resp.Size != int64(len(data)) || resp.Sha256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("unexpected saved file %+v", resp)
+	}
+	if resp.Headers["X-Kind"][0] != "blob" {
+		t.Fatalf("headers not kept: %v", resp.Headers)
+	}
+	got, err := os.ReadFile(resp.SavedPath)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("saved content mismatch (%v)", err)
+	}
+	if resp := HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL, SaveToPath: "../escape"}); resp.ErrorCode != errcode.PathEscape {
+		t.Fatalf("expected PATH_ESCAPE, got %+v", resp)
+	}
+}
+
+func TestHTTPRequestAuth(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	if resp := HTTPRequestTool(ctx, HTTPRequest{URL: srv.URL, BasicAuthUser: "ann", BasicAuthPass: "s3cret"}); resp.Body != "Basic YW5uOnMzY3JldA==" {
+		t.Fatalf("unexpected basic auth %q", resp.Body)
+	}
+	if resp := HTTPRequestTool(ctx, HTTPRequest{URL: srv.URL, BearerToken: "tok"}); resp.Body != "Bearer tok" {
+		t.Fatalf("unexpected bearer auth %q", resp.Body)
+	}
+	explicit := HTTPRequestTool(ctx, HTTPRequest{URL: srv.URL, BearerToken: "tok", Headers: map[string]string{"authorization": "Token x"}})
+	if explicit.Body != "Token x" {
+		t.Fatalf("explicit header should win, got %q", explicit.Body)
+	}
+	if resp := HTTPRequestTool(ctx, HTTPRequest{URL: srv.URL, BasicAuthUser: "ann", BearerToken: "tok"}); resp.ErrorCode != errcode.InvalidArgument {
+		t.Fatalf("expected conflicting auth to be rejected, got %+v", resp)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	t.Setenv("WORKSPACE", t.TempDir())
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "via proxy %s", r.URL)
+	}))
+	defer proxy.Close()
+	ctx := context.Background()
+	resp := HTTPRequestTool(ctx, HTTPRequest{URL: "http://upstream.invalid/x", Proxy: proxy.URL})
+	if resp.Error != "" || resp.Body != "via proxy http://upstream.invalid/x" {
+		t.Fatalf("unexpected proxied response %+v", resp)
+	}
+	dl := Download(ctx, DownloadRequest{URL: "http://upstream.invalid/f", DestPath: "f.txt", Proxy: proxy.URL})
+	if dl.Error != "" || dl.Size != int64(len("via proxy http://upstream.invalid/f")) {
+		t.Fatalf("unexpected proxied download %+v", dl)
+	}
+	for _, bad := range []string{"ftp://proxy:21", "socks5://", "://nope"} {
+		if resp := HTTPRequestTool(ctx, HTTPRequest{URL: "http://upstream.invalid/", Proxy: bad}); resp.ErrorCode != errcode.InvalidArgument {
+			t.Fatalf("expected %q to be rejected, got %+v", bad, resp)
+		}
+	}
+	if u, err := parseProxy("socks5h://user:pw@127.0.0.1:1080"); err != nil || u.Host != "127.0.0.1:1080" {
+		t.Fatalf("unexpected socks5 parse %v (%v)", u, err)
+	}
+	// the proxy host is subject to the allow-list like the target
+	t.Setenv("EGRESS_ALLOW_HOSTS", "upstream.invalid")
+	if resp := HTTPRequestTool(ctx, HTTPRequest{URL: "http://upstream.invalid/x", Proxy: proxy.URL}); resp.ErrorCode != errcode.EgressDisabled {
+		t.Fatalf("expected unlisted proxy to be refused, got %+v", resp)
+	}
+	if dl := Download(ctx, DownloadRequest{URL: "http://upstream.invalid/f", DestPath: "g.txt", Proxy: proxy.URL}); dl.ErrorCode != errcode.EgressDisabled {
+		t.Fatalf("expected unlisted proxy to be refused, got %+v", dl)
+	}
+	if md := FetchMarkdown(ctx, MDFetchRequest{URL: "http://upstream.invalid/x", Proxy: proxy.URL}); md.Error == "" {
+		t.Fatalf("expected unlisted proxy to be refused for md.fetch")
+	}
+}
+
+func TestHTTPRequestRedirectsAndRetries(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	RetryBackoff = time.Millisecond
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			calls++
+			if calls < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			http.Redirect(w, r, "/flaky", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	resp := HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL + "/flaky", Retries: 3})
+	if resp.Status != 200 || resp.Attempts != 3 || resp.Body != "ok" {
+		t.Fatalf("unexpected retry result %+v", resp)
+	}
+	calls = 0
+	resp = HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL + "/flaky", Retries: 1})
+	if resp.Status != 503 || resp.Attempts != 2 {
+		t.Fatalf("expected final 503 after 2 attempts, got %+v", resp)
+	}
+	resp = HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL + "/start", MaxRedirects: -1})
+	if resp.Status != http.StatusFound {
+		t.Fatalf("expected redirect not followed, got %+v", resp)
+	}
+	resp = HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL + "/loop", MaxRedirects: 2, Retries: 2})
+	if resp.Error == "" || resp.Attempts != 1 {
+		t.Fatalf("expected redirect limit error without retry, got %+v", resp)
+	}
+}
+
+func TestHTTPRequestMultipart(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	if err := os.WriteFile(filepath.Join(root, "report.txt"), []byte("file body"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("parse multipart: %v", err)
+			return
+		}
+		f, hdr, err := r.FormFile("upload")
+		if err != nil {
+			t.Errorf("form file: %v", err)
+			return
+		}
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		fmt.Fprintf(w, "%s|%s|%s", r.FormValue("name"), hdr.Filename, data)
+	}))
+	defer srv.Close()
+	resp := HTTPRequestTool(context.Background(), HTTPRequest{
+		Method:     "POST",
+		URL:        srv.URL,
+		FormFields: map[string]string{"name": "q3"},
+		FormFiles:  map[string]string{"upload": "report.txt"},
+	})
+	if resp.Error != "" || resp.Body != "q3|report.txt|file body" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	bad := HTTPRequestTool(context.Background(), HTTPRequest{Method: "POST", URL: srv.URL, Body: "x", FormFields: map[string]string{"a": "b"}})
+	if bad.Error == "" {
+		t.Fatalf("expected error when body and form are both set")
+	}
+	escape := HTTPRequestTool(context.Background(), HTTPRequest{Method: "POST", URL: srv.URL, FormFiles: map[string]string{"f": "/etc/passwd"}})
+	if escape.Error == "" {
+		t.Fatalf("expected error for file outside workspace")
+	}
+}
+
 func TestDownload(t *testing.T) {
 	t.Setenv("EGRESS", "1")
 	t.Setenv("WORKSPACE", t.TempDir())
@@ -54,3 +231,197 @@ func TestDownload(t *testing.T) {
 		t.Fatalf("sha mismatch")
 	}
 }
+
+func TestDownloadFailureKeepsExistingFile(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	t.Setenv("WORKSPACE", t.TempDir())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// promise more than is sent so the body ends early
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("partial"))
+	}))
+	defer srv.Close()
+	dest := filepath.Join(workspaceRoot(), "keep.txt")
+	if err := os.WriteFile(dest, []byte("original"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resp := Download(context.Background(), DownloadRequest{URL: srv.URL, DestPath: dest})
+	if resp.Error == "" {
+		t.Fatalf("expected a truncated body to fail: %+v", resp)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != "original" {
+		t.Fatalf("existing file clobbered: %q", got)
+	}
+	if entries, _ := os.ReadDir(workspaceRoot()); len(entries) != 1 {
+		t.Fatalf("temp file left behind: %v", entries)
+	}
+}
+
+func TestDownloadFilenameAndType(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/export":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="../report.csv"`)
+			w.Write([]byte("a,b\n"))
+		case "/latest":
+			http.Redirect(w, r, "/files/tool-1.2.tar.gz", http.StatusFound)
+		case "/untyped":
+			w.Header()["Content-Type"] = nil
+			w.Write([]byte("%PDF-1.4\n"))
+		default:
+			w.Write([]byte{0x1f, 0x8b, 0x08, 0x00})
+		}
+	}))
+	defer srv.Close()
+	if err := os.Mkdir(filepath.Join(root, "dl"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	resp := Download(context.Background(), DownloadRequest{URL: srv.URL + "/export", DestPath: "dl", FilenameFromHeader: true, ExpectedContentType: "text/"})
+	if resp.Error != "" || resp.Path != filepath.Join(root, "dl", "report.csv") || resp.ContentType != "text/csv" {
+		t.Fatalf("unexpected result %+v", resp)
+	}
+	resp = Download(context.Background(), DownloadRequest{URL: srv.URL + "/export", DestPath: "dl", FilenameFromHeader: true})
+	if resp.ErrorCode != errcode.AlreadyExists {
+		t.Fatalf("expected existing header filename to be kept, got %+v", resp)
+	}
+	resp = Download(context.Background(), DownloadRequest{URL: srv.URL + "/export", DestPath: "dl", FilenameFromHeader: true, Overwrite: true})
+	if resp.Error != "" || resp.Path != filepath.Join(root, "dl", "report.csv") {
+		t.Fatalf("unexpected overwrite result %+v", resp)
+	}
+	resp = Download(context.Background(), DownloadRequest{URL: srv.URL + "/latest", DestPath: "dl", FilenameFromHeader: true})
+	if resp.Error != "" || resp.Path != filepath.Join(root, "dl", "tool-1.2.tar.gz") || resp.ContentType != "application/x-gzip" {
+		t.Fatalf("unexpected redirect result %+v", resp)
+	}
+	resp = Download(context.Background(), DownloadRequest{URL: srv.URL + "/export", DestPath: "dl/x.pdf", ExpectedContentType: "application/pdf"})
+	if resp.Error == "" {
+		t.Fatalf("expected content type mismatch")
+	}
+	if _, err := os.Stat(filepath.Join(root, "dl", "x.pdf")); !os.IsNotExist(err) {
+		t.Fatalf("mismatched download should not be written: %v", err)
+	}
+
+	// without a Content-Type header the body is sniffed
+	resp = Download(context.Background(), DownloadRequest{URL: srv.URL + "/untyped", DestPath: "dl/y.pdf", ExpectedContentType: "application/pdf"})
+	if resp.Error != "" || resp.ContentType != "application/pdf" {
+		t.Fatalf("unexpected sniffed result %+v", resp)
+	}
+	resp = Download(context.Background(), DownloadRequest{URL: srv.URL + "/untyped", DestPath: "dl/z.png", ExpectedContentType: "image/"})
+	if !strings.Contains(resp.Error, "unexpected content type") {
+		t.Fatalf("expected sniffed type mismatch, got %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(root, "dl", "z.png")); !os.IsNotExist(err) {
+		t.Fatalf("mismatched download should not be written: %v", err)
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+	data := []byte("0123456789abcdefghij")
+	ignoreRange := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ignoreRange {
+			w.Write(data)
+			return
+		}
+		http.ServeContent(w, r, "blob", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+	sum := sha256.Sum256(data)
+	dest := filepath.Join(root, "blob")
+	if err := os.WriteFile(dest, data[:7], 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp := Download(context.Background(), DownloadRequest{URL: srv.URL, DestPath: "blob", Resume: true, ExpectedSHA256: hex.EncodeToString(sum[:])})
+	if resp.Error != "" || !resp.Resumed || resp.Size != int64(len(data)) {
+		t.Fatalf("unexpected resume result %+v", resp)
+	}
+
+	// a complete file gets 416, and the expected type is still enforced
+	resp = Download(context.Background(), DownloadRequest{URL: srv.URL, DestPath: "blob", Resume: true, ExpectedContentType: "image/"})
+	if !strings.Contains(resp.Error, "unexpected content type") {
+		t.Fatalf("expected type mismatch on complete file, got %+v", resp)
+	}
+
+	ignoreRange = true
+	if err := os.WriteFile(dest, data[:5], 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp = Download(context.Background(), DownloadRequest{URL: srv.URL, DestPath: "blob", Resume: true, ExpectedSHA256: hex.EncodeToString(sum[:])})
+	if resp.Error != "" || resp.Resumed || resp.Size != int64(len(data)) {
+		t.Fatalf("unexpected fallback result %+v", resp)
+	}
+
+	ignoreRange = false
+	resp = Download(context.Background(), DownloadRequest{URL: srv.URL, DestPath: "part", BytesRange: "2-4"})
+	got, _ := os.ReadFile(filepath.Join(root, "part"))
+	if resp.Error != "" || string(got) != "234" {
+		t.Fatalf("unexpected range result %+v (%q)", resp, got)
+	}
+}
+
+func TestEgressAllowHosts(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	t.Setenv("WORKSPACE", t.TempDir())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/away" {
+			http.Redirect(w, r, "http://blocked.invalid/", http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	t.Setenv("EGRESS_ALLOW_HOSTS", "127.0.0.1")
+	if resp := HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL}); resp.Error != "" {
+		t.Fatalf("allowed host rejected: %v", resp.Error)
+	}
+	resp := HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL + "/away", Retries: 2})
+	if !strings.Contains(resp.Error, "host not allowed") || resp.Attempts != 1 {
+		t.Fatalf("expected redirect to be blocked, got %+v", resp)
+	}
+	t.Setenv("EGRESS_ALLOW_HOSTS", "*.example.com")
+	if resp := HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL}); !strings.Contains(resp.Error, "host not allowed") {
+		t.Fatalf("expected http.request to be blocked, got %+v", resp)
+	}
+	if resp := Download(context.Background(), DownloadRequest{URL: srv.URL, DestPath: "x"}); !strings.Contains(resp.Error, "host not allowed") {
+		t.Fatalf("expected web.download to be blocked, got %+v", resp)
+	}
+	if resp := FetchMarkdown(context.Background(), MDFetchRequest{URL: srv.URL}); !strings.Contains(resp.Error, "host not allowed") {
+		t.Fatalf("expected md.fetch to be blocked, got %+v", resp)
+	}
+}
+
+func TestHTTPRequestSession(t *testing.T) {
+	t.Setenv("EGRESS", "1")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "abc", Path: "/"})
+			return
+		}
+		if c, err := r.Cookie("sid"); err == nil {
+			w.Write([]byte(c.Value))
+		}
+	}))
+	defer srv.Close()
+	login := HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL + "/login", SessionID: "s1"})
+	if len(login.Cookies) != 1 || login.Cookies[0].Name != "sid" || login.Cookies[0].Value != "abc" {
+		t.Fatalf("unexpected cookies %+v", login.Cookies)
+	}
+	if resp := HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL + "/me", SessionID: "s1"}); resp.Body != "abc" {
+		t.Fatalf("session cookie not sent, body %q", resp.Body)
+	}
+	if resp := HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL + "/me", SessionID: "s2"}); resp.Body != "" {
+		t.Fatalf("sessions should be isolated, body %q", resp.Body)
+	}
+	if cleared := ClearSession(context.Background(), SessionClearRequest{SessionID: "s1"}); !cleared.Cleared {
+		t.Fatalf("expected session to be cleared")
+	}
+	if resp := HTTPRequestTool(context.Background(), HTTPRequest{URL: srv.URL + "/me", SessionID: "s1"}); resp.Body != "" {
+		t.Fatalf("cleared session still sent cookie, body %q", resp.Body)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -15,7 +16,10 @@ import (
 	server "github.com/mark3labs/mcp-go/server"
 
 	"github.com/gaspardpetit/mcp-shell/internal/archive"
+	"github.com/gaspardpetit/mcp-shell/internal/auditlog"
+	"github.com/gaspardpetit/mcp-shell/internal/data"
 	"github.com/gaspardpetit/mcp-shell/internal/doc"
+	"github.com/gaspardpetit/mcp-shell/internal/dryrun"
 	"github.com/gaspardpetit/mcp-shell/internal/fs"
 	"github.com/gaspardpetit/mcp-shell/internal/git"
 	"github.com/gaspardpetit/mcp-shell/internal/media"
@@ -24,6 +28,7 @@ import (
 	"github.com/gaspardpetit/mcp-shell/internal/proc"
 	rt "github.com/gaspardpetit/mcp-shell/internal/runtime"
 	"github.com/gaspardpetit/mcp-shell/internal/shell"
+	"github.com/gaspardpetit/mcp-shell/internal/sys"
 	"github.com/gaspardpetit/mcp-shell/internal/text"
 	"github.com/gaspardpetit/mcp-shell/internal/web"
 )
@@ -41,9 +46,35 @@ func main() {
 	basePath := flag.String("base-path", "/mcp", "Base path for HTTP/SSE endpoints")
 	baseURL := flag.String("base-url", "", "Public base URL (SSE only, optional)")
 	allowPkg := flag.Bool("allow-pkg", false, "Allow package installation tools even when EGRESS=0")
+	selftest := flag.Bool("selftest", false, "Probe external dependencies at startup and log a capability report")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "Grace period for in-flight tool calls on SIGTERM before connections are closed")
+	enabledTools := flag.String("enabled-tools", os.Getenv("MCP_ENABLED_TOOLS"), "Comma-separated tool names or glob patterns to register (default: all)")
+	dryRun := flag.Bool("dry-run", envBool("MCP_DRY_RUN"), "Force dry_run on every tool that supports it, whatever the request says")
 	flag.Parse()
 
+	if *transport == "stdio" && auditlog.Path() == "-" {
+		// audit lines on stdout would corrupt the JSON-RPC stream
+		log.Fatalf("MCP_AUDIT_LOG=- writes to stdout and cannot be used with --transport=stdio")
+	}
 	pkgmgr.AdminOverride = *allowPkg
+	dryrun.Force(*dryRun)
+	if *dryRun {
+		log.Printf("*** DRY-RUN MODE: tools with a dry_run argument only report what they would do; other mutating tools are refused ***")
+	}
+
+	// ---- selftest (also enforced whenever REQUIRED_TOOLS is set)
+	if *selftest || len(requiredTools()) > 0 {
+		if err := runSelftest(); err != nil {
+			log.Fatalf("selftest failed: %v", err)
+		}
+	}
+
+	// ---- tracing (only when OTEL_EXPORTER_OTLP_ENDPOINT is set)
+	shutdownTracing, err := obs.InitTracing(context.Background(), buildName)
+	if err != nil {
+		log.Fatalf("tracing: %v", err)
+	}
+	defer func() { _ = shutdownTracing(context.Background()) }()
 
 	// ---- server
 	s := server.NewMCPServer(
@@ -54,6 +85,7 @@ func main() {
 		server.WithRecovery(),
 		server.WithToolHandlerMiddleware(obs.Middleware),
 	)
+	tools := newToolRegistry(s, parseToolPatterns(*enabledTools))
 
 	// tool definition
 	tool := mcp.NewTool(
@@ -65,7 +97,19 @@ func main() {
 		resp := shell.Run(ctx, args)
 		return mcp.NewToolResultStructured(resp, "shell.exec result"), nil
 	})
-	s.AddTool(tool, handler)
+	tools.AddTool(tool, handler)
+
+	// exec.run
+	execTool := mcp.NewTool(
+		"exec.run",
+		mcp.WithDescription("Run a program with an explicit argument list, without a shell"),
+		mcp.WithInputSchema[shell.ArgvRequest](),
+	)
+	execHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args shell.ArgvRequest) (*mcp.CallToolResult, error) {
+		resp := shell.ArgvExec(ctx, args)
+		return mcp.NewToolResultStructured(resp, "exec.run result"), nil
+	})
+	tools.AddTool(execTool, execHandler)
 
 	// python.run
 	pyTool := mcp.NewTool(
@@ -77,7 +121,31 @@ func main() {
 		resp := rt.PythonRun(ctx, args)
 		return mcp.NewToolResultStructured(resp, "python.run result"), nil
 	})
-	s.AddTool(pyTool, pyHandler)
+	tools.AddTool(pyTool, pyHandler)
+
+	// python.venv.list
+	venvListTool := mcp.NewTool(
+		"python.venv.list",
+		mcp.WithDescription("List Python virtual environments in the workspace"),
+		mcp.WithInputSchema[rt.VenvListRequest](),
+	)
+	venvListHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args rt.VenvListRequest) (*mcp.CallToolResult, error) {
+		resp := rt.VenvList(ctx, args)
+		return mcp.NewToolResultStructured(resp, "python.venv.list result"), nil
+	})
+	tools.AddTool(venvListTool, venvListHandler)
+
+	// python.venv.remove
+	venvRemoveTool := mcp.NewTool(
+		"python.venv.remove",
+		mcp.WithDescription("Delete a Python virtual environment from the workspace"),
+		mcp.WithInputSchema[rt.VenvRemoveRequest](),
+	)
+	venvRemoveHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args rt.VenvRemoveRequest) (*mcp.CallToolResult, error) {
+		resp := rt.VenvRemove(ctx, args)
+		return mcp.NewToolResultStructured(resp, "python.venv.remove result"), nil
+	})
+	tools.AddTool(venvRemoveTool, venvRemoveHandler)
 
 	// node.run
 	nodeTool := mcp.NewTool(
@@ -89,7 +157,31 @@ func main() {
 		resp := rt.NodeRun(ctx, args)
 		return mcp.NewToolResultStructured(resp, "node.run result"), nil
 	})
-	s.AddTool(nodeTool, nodeHandler)
+	tools.AddTool(nodeTool, nodeHandler)
+
+	// go.run
+	goTool := mcp.NewTool(
+		"go.run",
+		mcp.WithDescription("Compile and run a Go program"),
+		mcp.WithInputSchema[rt.GoRunRequest](),
+	)
+	goHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args rt.GoRunRequest) (*mcp.CallToolResult, error) {
+		resp := rt.GoRun(ctx, args)
+		return mcp.NewToolResultStructured(resp, "go.run result"), nil
+	})
+	tools.AddTool(goTool, goHandler)
+
+	// deno.run
+	denoTool := mcp.NewTool(
+		"deno.run",
+		mcp.WithDescription("Execute TypeScript/JavaScript with Deno under explicit permissions"),
+		mcp.WithInputSchema[rt.DenoRunRequest](),
+	)
+	denoHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args rt.DenoRunRequest) (*mcp.CallToolResult, error) {
+		resp := rt.DenoRun(ctx, args)
+		return mcp.NewToolResultStructured(resp, "deno.run result"), nil
+	})
+	tools.AddTool(denoTool, denoHandler)
 
 	// sh.script.write_and_run
 	shTool := mcp.NewTool(
@@ -101,7 +193,7 @@ func main() {
 		resp := rt.ShScriptWriteAndRun(ctx, args)
 		return mcp.NewToolResultStructured(resp, "sh.script.write_and_run result"), nil
 	})
-	s.AddTool(shTool, shHandler)
+	tools.AddTool(shTool, shHandler)
 
 	// package management tools
 	aptTool := mcp.NewTool(
@@ -113,7 +205,7 @@ func main() {
 		resp := pkgmgr.AptInstall(ctx, args)
 		return mcp.NewToolResultStructured(resp, "apt.install result"), nil
 	})
-	s.AddTool(aptTool, aptHandler)
+	tools.AddTool(aptTool, aptHandler)
 
 	pipTool := mcp.NewTool(
 		"pip.install",
@@ -124,7 +216,29 @@ func main() {
 		resp := pkgmgr.PipInstall(ctx, args)
 		return mcp.NewToolResultStructured(resp, "pip.install result"), nil
 	})
-	s.AddTool(pipTool, pipHandler)
+	tools.AddTool(pipTool, pipHandler)
+
+	pipUninstallTool := mcp.NewTool(
+		"pip.uninstall",
+		mcp.WithDescription("Uninstall Python packages via pip"),
+		mcp.WithInputSchema[pkgmgr.PipUninstallRequest](),
+	)
+	pipUninstallHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args pkgmgr.PipUninstallRequest) (*mcp.CallToolResult, error) {
+		resp := pkgmgr.PipUninstall(ctx, args)
+		return mcp.NewToolResultStructured(resp, "pip.uninstall result"), nil
+	})
+	tools.AddTool(pipUninstallTool, pipUninstallHandler)
+
+	pipListTool := mcp.NewTool(
+		"pip.list",
+		mcp.WithDescription("List installed Python packages"),
+		mcp.WithInputSchema[pkgmgr.PipListRequest](),
+	)
+	pipListHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args pkgmgr.PipListRequest) (*mcp.CallToolResult, error) {
+		resp := pkgmgr.PipList(ctx, args)
+		return mcp.NewToolResultStructured(resp, "pip.list result"), nil
+	})
+	tools.AddTool(pipListTool, pipListHandler)
 
 	npmTool := mcp.NewTool(
 		"npm.install",
@@ -135,7 +249,40 @@ func main() {
 		resp := pkgmgr.NpmInstall(ctx, args)
 		return mcp.NewToolResultStructured(resp, "npm.install result"), nil
 	})
-	s.AddTool(npmTool, npmHandler)
+	tools.AddTool(npmTool, npmHandler)
+
+	npmUninstallTool := mcp.NewTool(
+		"npm.uninstall",
+		mcp.WithDescription("Uninstall Node.js packages via npm"),
+		mcp.WithInputSchema[pkgmgr.NpmUninstallRequest](),
+	)
+	npmUninstallHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args pkgmgr.NpmUninstallRequest) (*mcp.CallToolResult, error) {
+		resp := pkgmgr.NpmUninstall(ctx, args)
+		return mcp.NewToolResultStructured(resp, "npm.uninstall result"), nil
+	})
+	tools.AddTool(npmUninstallTool, npmUninstallHandler)
+
+	npmListTool := mcp.NewTool(
+		"npm.list",
+		mcp.WithDescription("List installed Node.js packages"),
+		mcp.WithInputSchema[pkgmgr.NpmListRequest](),
+	)
+	npmListHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args pkgmgr.NpmListRequest) (*mcp.CallToolResult, error) {
+		resp := pkgmgr.NpmList(ctx, args)
+		return mcp.NewToolResultStructured(resp, "npm.list result"), nil
+	})
+	tools.AddTool(npmListTool, npmListHandler)
+
+	cargoTool := mcp.NewTool(
+		"cargo.install",
+		mcp.WithDescription("Install Rust crates via cargo"),
+		mcp.WithInputSchema[pkgmgr.CargoInstallRequest](),
+	)
+	cargoHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args pkgmgr.CargoInstallRequest) (*mcp.CallToolResult, error) {
+		resp := pkgmgr.CargoInstall(ctx, args)
+		return mcp.NewToolResultStructured(resp, "cargo.install result"), nil
+	})
+	tools.AddTool(cargoTool, cargoHandler)
 
 	// filesystem tools
 	// fs.list
@@ -148,7 +295,7 @@ func main() {
 		resp := fs.List(ctx, args)
 		return mcp.NewToolResultStructured(resp, "fs.list result"), nil
 	})
-	s.AddTool(fsListTool, fsListHandler)
+	tools.AddTool(fsListTool, fsListHandler)
 
 	// fs.stat
 	fsStatTool := mcp.NewTool(
@@ -160,7 +307,7 @@ func main() {
 		resp := fs.Stat(ctx, args)
 		return mcp.NewToolResultStructured(resp, "fs.stat result"), nil
 	})
-	s.AddTool(fsStatTool, fsStatHandler)
+	tools.AddTool(fsStatTool, fsStatHandler)
 
 	// fs.read
 	fsReadTool := mcp.NewTool(
@@ -172,7 +319,7 @@ func main() {
 		resp := fs.Read(ctx, args)
 		return mcp.NewToolResultStructured(resp, "fs.read result"), nil
 	})
-	s.AddTool(fsReadTool, fsReadHandler)
+	tools.AddTool(fsReadTool, fsReadHandler)
 
 	// fs.read_b64
 	fsReadB64Tool := mcp.NewTool(
@@ -184,7 +331,19 @@ func main() {
 		resp := fs.ReadB64(ctx, args)
 		return mcp.NewToolResultStructured(resp, "fs.read_b64 result"), nil
 	})
-	s.AddTool(fsReadB64Tool, fsReadB64Handler)
+	tools.AddTool(fsReadB64Tool, fsReadB64Handler)
+
+	// fs.read_lines
+	fsReadLinesTool := mcp.NewTool(
+		"fs.read_lines",
+		mcp.WithDescription("Read a range of numbered lines from a text file"),
+		mcp.WithInputSchema[fs.ReadLinesRequest](),
+	)
+	fsReadLinesHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args fs.ReadLinesRequest) (*mcp.CallToolResult, error) {
+		resp := fs.ReadLines(ctx, args)
+		return mcp.NewToolResultStructured(resp, "fs.read_lines result"), nil
+	})
+	tools.AddTool(fsReadLinesTool, fsReadLinesHandler)
 
 	// fs.write
 	fsWriteTool := mcp.NewTool(
@@ -196,7 +355,7 @@ func main() {
 		resp := fs.Write(ctx, args)
 		return mcp.NewToolResultStructured(resp, "fs.write result"), nil
 	})
-	s.AddTool(fsWriteTool, fsWriteHandler)
+	tools.AddTool(fsWriteTool, fsWriteHandler)
 
 	// fs.remove
 	fsRemoveTool := mcp.NewTool(
@@ -208,7 +367,7 @@ func main() {
 		resp := fs.Remove(ctx, args)
 		return mcp.NewToolResultStructured(resp, "fs.remove result"), nil
 	})
-	s.AddTool(fsRemoveTool, fsRemoveHandler)
+	tools.AddTool(fsRemoveTool, fsRemoveHandler)
 
 	// fs.mkdir
 	fsMkdirTool := mcp.NewTool(
@@ -220,7 +379,19 @@ func main() {
 		resp := fs.Mkdir(ctx, args)
 		return mcp.NewToolResultStructured(resp, "fs.mkdir result"), nil
 	})
-	s.AddTool(fsMkdirTool, fsMkdirHandler)
+	tools.AddTool(fsMkdirTool, fsMkdirHandler)
+
+	// fs.chown
+	fsChownTool := mcp.NewTool(
+		"fs.chown",
+		mcp.WithDescription("Change the owner of a file or directory tree (requires root)"),
+		mcp.WithInputSchema[fs.ChownRequest](),
+	)
+	fsChownHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args fs.ChownRequest) (*mcp.CallToolResult, error) {
+		resp := fs.Chown(ctx, args)
+		return mcp.NewToolResultStructured(resp, "fs.chown result"), nil
+	})
+	tools.AddTool(fsChownTool, fsChownHandler)
 
 	// fs.move
 	fsMoveTool := mcp.NewTool(
@@ -232,7 +403,7 @@ func main() {
 		resp := fs.Move(ctx, args)
 		return mcp.NewToolResultStructured(resp, "fs.move result"), nil
 	})
-	s.AddTool(fsMoveTool, fsMoveHandler)
+	tools.AddTool(fsMoveTool, fsMoveHandler)
 
 	// fs.copy
 	fsCopyTool := mcp.NewTool(
@@ -244,7 +415,7 @@ func main() {
 		resp := fs.Copy(ctx, args)
 		return mcp.NewToolResultStructured(resp, "fs.copy result"), nil
 	})
-	s.AddTool(fsCopyTool, fsCopyHandler)
+	tools.AddTool(fsCopyTool, fsCopyHandler)
 
 	// fs.search
 	fsSearchTool := mcp.NewTool(
@@ -256,7 +427,7 @@ func main() {
 		resp := fs.Search(ctx, args)
 		return mcp.NewToolResultStructured(resp, "fs.search result"), nil
 	})
-	s.AddTool(fsSearchTool, fsSearchHandler)
+	tools.AddTool(fsSearchTool, fsSearchHandler)
 
 	// fs.hash
 	fsHashTool := mcp.NewTool(
@@ -268,7 +439,43 @@ func main() {
 		resp := fs.Hash(ctx, args)
 		return mcp.NewToolResultStructured(resp, "fs.hash result"), nil
 	})
-	s.AddTool(fsHashTool, fsHashHandler)
+	tools.AddTool(fsHashTool, fsHashHandler)
+
+	// fs.hash_many
+	fsHashManyTool := mcp.NewTool(
+		"fs.hash_many",
+		mcp.WithDescription("Compute checksums for all matching files under a directory in parallel"),
+		mcp.WithInputSchema[fs.HashManyRequest](),
+	)
+	fsHashManyHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args fs.HashManyRequest) (*mcp.CallToolResult, error) {
+		resp := fs.HashMany(ctx, args)
+		return mcp.NewToolResultStructured(resp, "fs.hash_many result"), nil
+	})
+	tools.AddTool(fsHashManyTool, fsHashManyHandler)
+
+	// fs.compare
+	fsCompareTool := mcp.NewTool(
+		"fs.compare",
+		mcp.WithDescription("Compare two files byte for byte"),
+		mcp.WithInputSchema[fs.CompareRequest](),
+	)
+	fsCompareHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args fs.CompareRequest) (*mcp.CallToolResult, error) {
+		resp := fs.Compare(ctx, args)
+		return mcp.NewToolResultStructured(resp, "fs.compare result"), nil
+	})
+	tools.AddTool(fsCompareTool, fsCompareHandler)
+
+	// fs.glob
+	fsGlobTool := mcp.NewTool(
+		"fs.glob",
+		mcp.WithDescription("Find files under a directory matching a ** glob pattern"),
+		mcp.WithInputSchema[fs.GlobRequest](),
+	)
+	fsGlobHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args fs.GlobRequest) (*mcp.CallToolResult, error) {
+		resp := fs.Glob(ctx, args)
+		return mcp.NewToolResultStructured(resp, "fs.glob result"), nil
+	})
+	tools.AddTool(fsGlobTool, fsGlobHandler)
 
 	// archive.zip
 	archiveZipTool := mcp.NewTool(
@@ -280,7 +487,7 @@ func main() {
 		resp := archive.Zip(ctx, args)
 		return mcp.NewToolResultStructured(resp, "archive.zip result"), nil
 	})
-	s.AddTool(archiveZipTool, archiveZipHandler)
+	tools.AddTool(archiveZipTool, archiveZipHandler)
 
 	// archive.unzip
 	archiveUnzipTool := mcp.NewTool(
@@ -292,7 +499,7 @@ func main() {
 		resp := archive.Unzip(ctx, args)
 		return mcp.NewToolResultStructured(resp, "archive.unzip result"), nil
 	})
-	s.AddTool(archiveUnzipTool, archiveUnzipHandler)
+	tools.AddTool(archiveUnzipTool, archiveUnzipHandler)
 
 	// archive.tar
 	archiveTarTool := mcp.NewTool(
@@ -304,7 +511,7 @@ func main() {
 		resp := archive.Tar(ctx, args)
 		return mcp.NewToolResultStructured(resp, "archive.tar result"), nil
 	})
-	s.AddTool(archiveTarTool, archiveTarHandler)
+	tools.AddTool(archiveTarTool, archiveTarHandler)
 
 	// archive.untar
 	archiveUntarTool := mcp.NewTool(
@@ -316,7 +523,19 @@ func main() {
 		resp := archive.Untar(ctx, args)
 		return mcp.NewToolResultStructured(resp, "archive.untar result"), nil
 	})
-	s.AddTool(archiveUntarTool, archiveUntarHandler)
+	tools.AddTool(archiveUntarTool, archiveUntarHandler)
+
+	// archive.extract_file
+	archiveExtractTool := mcp.NewTool(
+		"archive.extract_file",
+		mcp.WithDescription("Extract a single entry from a zip or tar archive"),
+		mcp.WithInputSchema[archive.ExtractFileRequest](),
+	)
+	archiveExtractHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args archive.ExtractFileRequest) (*mcp.CallToolResult, error) {
+		resp := archive.ExtractFile(ctx, args)
+		return mcp.NewToolResultStructured(resp, "archive.extract_file result"), nil
+	})
+	tools.AddTool(archiveExtractTool, archiveExtractHandler)
 
 	// text.diff
 	textDiffTool := mcp.NewTool(
@@ -328,7 +547,7 @@ func main() {
 		resp := text.Diff(ctx, args)
 		return mcp.NewToolResultStructured(resp, "text.diff result"), nil
 	})
-	s.AddTool(textDiffTool, textDiffHandler)
+	tools.AddTool(textDiffTool, textDiffHandler)
 
 	// text.apply_patch
 	textPatchTool := mcp.NewTool(
@@ -340,7 +559,115 @@ func main() {
 		resp := text.ApplyPatch(ctx, args)
 		return mcp.NewToolResultStructured(resp, "text.apply_patch result"), nil
 	})
-	s.AddTool(textPatchTool, textPatchHandler)
+	tools.AddTool(textPatchTool, textPatchHandler)
+
+	// text.normalize
+	textNormalizeTool := mcp.NewTool(
+		"text.normalize",
+		mcp.WithDescription("Normalize line endings, BOM, and final newline of a file in place"),
+		mcp.WithInputSchema[text.NormalizeRequest](),
+	)
+	textNormalizeHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args text.NormalizeRequest) (*mcp.CallToolResult, error) {
+		resp := text.Normalize(ctx, args)
+		return mcp.NewToolResultStructured(resp, "text.normalize result"), nil
+	})
+	tools.AddTool(textNormalizeTool, textNormalizeHandler)
+
+	// text.replace
+	textReplaceTool := mcp.NewTool(
+		"text.replace",
+		mcp.WithDescription("Regex find/replace across a file or directory"),
+		mcp.WithInputSchema[text.ReplaceRequest](),
+	)
+	textReplaceHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args text.ReplaceRequest) (*mcp.CallToolResult, error) {
+		resp := text.Replace(ctx, args)
+		return mcp.NewToolResultStructured(resp, "text.replace result"), nil
+	})
+	tools.AddTool(textReplaceTool, textReplaceHandler)
+
+	// text.wc
+	textWCTool := mcp.NewTool(
+		"text.wc",
+		mcp.WithDescription("Count lines, words, characters and bytes of a file or text"),
+		mcp.WithInputSchema[text.WCRequest](),
+	)
+	textWCHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args text.WCRequest) (*mcp.CallToolResult, error) {
+		resp := text.WordCount(ctx, args)
+		return mcp.NewToolResultStructured(resp, "text.wc result"), nil
+	})
+	tools.AddTool(textWCTool, textWCHandler)
+
+	// text.jq
+	textJQTool := mcp.NewTool(
+		"text.jq",
+		mcp.WithDescription("Query JSON with a jq expression"),
+		mcp.WithInputSchema[text.JQRequest](),
+	)
+	textJQHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args text.JQRequest) (*mcp.CallToolResult, error) {
+		resp := text.JQ(ctx, args)
+		return mcp.NewToolResultStructured(resp, "text.jq result"), nil
+	})
+	tools.AddTool(textJQTool, textJQHandler)
+
+	// text.sort
+	textSortTool := mcp.NewTool(
+		"text.sort",
+		mcp.WithDescription("Sort lines of a file or text, optionally numeric, reversed or de-duplicated"),
+		mcp.WithInputSchema[text.SortRequest](),
+	)
+	textSortHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args text.SortRequest) (*mcp.CallToolResult, error) {
+		resp := text.Sort(ctx, args)
+		return mcp.NewToolResultStructured(resp, "text.sort result"), nil
+	})
+	tools.AddTool(textSortTool, textSortHandler)
+
+	// text.encode
+	textEncodeTool := mcp.NewTool(
+		"text.encode",
+		mcp.WithDescription("Encode text or a file as base64, base64url or hex"),
+		mcp.WithInputSchema[text.EncodeRequest](),
+	)
+	textEncodeHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args text.EncodeRequest) (*mcp.CallToolResult, error) {
+		resp := text.Encode(ctx, args)
+		return mcp.NewToolResultStructured(resp, "text.encode result"), nil
+	})
+	tools.AddTool(textEncodeTool, textEncodeHandler)
+
+	// text.decode
+	textDecodeTool := mcp.NewTool(
+		"text.decode",
+		mcp.WithDescription("Decode base64, base64url or hex text back to UTF-8"),
+		mcp.WithInputSchema[text.DecodeRequest](),
+	)
+	textDecodeHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args text.DecodeRequest) (*mcp.CallToolResult, error) {
+		resp := text.Decode(ctx, args)
+		return mcp.NewToolResultStructured(resp, "text.decode result"), nil
+	})
+	tools.AddTool(textDecodeTool, textDecodeHandler)
+
+	// text.template
+	textTemplateTool := mcp.NewTool(
+		"text.template",
+		mcp.WithDescription("Render a Go text/template with data, optionally writing the result to a file"),
+		mcp.WithInputSchema[text.TemplateRequest](),
+	)
+	textTemplateHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args text.TemplateRequest) (*mcp.CallToolResult, error) {
+		resp := text.RenderTemplate(ctx, args)
+		return mcp.NewToolResultStructured(resp, "text.template result"), nil
+	})
+	tools.AddTool(textTemplateTool, textTemplateHandler)
+
+	// data.convert
+	dataConvertTool := mcp.NewTool(
+		"data.convert",
+		mcp.WithDescription("Validate JSON or YAML, or convert between them"),
+		mcp.WithInputSchema[data.DataConvertRequest](),
+	)
+	dataConvertHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args data.DataConvertRequest) (*mcp.CallToolResult, error) {
+		resp := data.Convert(ctx, args)
+		return mcp.NewToolResultStructured(resp, "data.convert result"), nil
+	})
+	tools.AddTool(dataConvertTool, dataConvertHandler)
 
 	// doc.convert
 	docConvertTool := mcp.NewTool(
@@ -352,7 +679,7 @@ func main() {
 		resp := doc.Convert(ctx, args)
 		return mcp.NewToolResultStructured(resp, "doc.convert result"), nil
 	})
-	s.AddTool(docConvertTool, docConvertHandler)
+	tools.AddTool(docConvertTool, docConvertHandler)
 
 	// pdf.extract_text
 	pdfExtractTool := mcp.NewTool(
@@ -364,7 +691,43 @@ func main() {
 		resp := doc.ExtractText(ctx, args)
 		return mcp.NewToolResultStructured(resp, "pdf.extract_text result"), nil
 	})
-	s.AddTool(pdfExtractTool, pdfExtractHandler)
+	tools.AddTool(pdfExtractTool, pdfExtractHandler)
+
+	// pdf.split
+	pdfSplitTool := mcp.NewTool(
+		"pdf.split",
+		mcp.WithDescription("Split a PDF into one file per page range"),
+		mcp.WithInputSchema[doc.SplitRequest](),
+	)
+	pdfSplitHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args doc.SplitRequest) (*mcp.CallToolResult, error) {
+		resp := doc.Split(ctx, args)
+		return mcp.NewToolResultStructured(resp, "pdf.split result"), nil
+	})
+	tools.AddTool(pdfSplitTool, pdfSplitHandler)
+
+	// pdf.merge
+	pdfMergeTool := mcp.NewTool(
+		"pdf.merge",
+		mcp.WithDescription("Merge several PDFs into one"),
+		mcp.WithInputSchema[doc.MergeRequest](),
+	)
+	pdfMergeHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args doc.MergeRequest) (*mcp.CallToolResult, error) {
+		resp := doc.Merge(ctx, args)
+		return mcp.NewToolResultStructured(resp, "pdf.merge result"), nil
+	})
+	tools.AddTool(pdfMergeTool, pdfMergeHandler)
+
+	// pdf.to_images
+	pdfImagesTool := mcp.NewTool(
+		"pdf.to_images",
+		mcp.WithDescription("Rasterize PDF pages to PNG or JPEG images"),
+		mcp.WithInputSchema[doc.ToImagesRequest](),
+	)
+	pdfImagesHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args doc.ToImagesRequest) (*mcp.CallToolResult, error) {
+		resp := doc.ToImages(ctx, args)
+		return mcp.NewToolResultStructured(resp, "pdf.to_images result"), nil
+	})
+	tools.AddTool(pdfImagesTool, pdfImagesHandler)
 
 	// spreadsheet.to_csv
 	sheetCSVTool := mcp.NewTool(
@@ -376,7 +739,19 @@ func main() {
 		resp := doc.SpreadsheetToCSV(ctx, args)
 		return mcp.NewToolResultStructured(resp, "spreadsheet.to_csv result"), nil
 	})
-	s.AddTool(sheetCSVTool, sheetCSVHandler)
+	tools.AddTool(sheetCSVTool, sheetCSVHandler)
+
+	// spreadsheet.to_json
+	sheetJSONTool := mcp.NewTool(
+		"spreadsheet.to_json",
+		mcp.WithDescription("Convert a spreadsheet sheet to JSON rows keyed by the header row"),
+		mcp.WithInputSchema[doc.ToJSONRequest](),
+	)
+	sheetJSONHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args doc.ToJSONRequest) (*mcp.CallToolResult, error) {
+		resp := doc.SpreadsheetToJSON(ctx, args)
+		return mcp.NewToolResultStructured(resp, "spreadsheet.to_json result"), nil
+	})
+	tools.AddTool(sheetJSONTool, sheetJSONHandler)
 
 	// doc.metadata
 	docMetaTool := mcp.NewTool(
@@ -388,7 +763,7 @@ func main() {
 		resp := doc.Metadata(ctx, args)
 		return mcp.NewToolResultStructured(resp, "doc.metadata result"), nil
 	})
-	s.AddTool(docMetaTool, docMetaHandler)
+	tools.AddTool(docMetaTool, docMetaHandler)
 	// image.convert
 	imgConvTool := mcp.NewTool(
 		"image.convert",
@@ -399,7 +774,43 @@ func main() {
 		resp := media.ImageConvert(ctx, args)
 		return mcp.NewToolResultStructured(resp, "image.convert result"), nil
 	})
-	s.AddTool(imgConvTool, imgConvHandler)
+	tools.AddTool(imgConvTool, imgConvHandler)
+
+	// image.metadata
+	imgMetaTool := mcp.NewTool(
+		"image.metadata",
+		mcp.WithDescription("Read image dimensions, format, colorspace and EXIF orientation"),
+		mcp.WithInputSchema[media.ImageMetadataRequest](),
+	)
+	imgMetaHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args media.ImageMetadataRequest) (*mcp.CallToolResult, error) {
+		resp := media.ImageMetadata(ctx, args)
+		return mcp.NewToolResultStructured(resp, "image.metadata result"), nil
+	})
+	tools.AddTool(imgMetaTool, imgMetaHandler)
+
+	// image.compose
+	imgComposeTool := mcp.NewTool(
+		"image.compose",
+		mcp.WithDescription("Overlay an image or text watermark onto an image"),
+		mcp.WithInputSchema[media.ComposeRequest](),
+	)
+	imgComposeHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args media.ComposeRequest) (*mcp.CallToolResult, error) {
+		resp := media.ImageCompose(ctx, args)
+		return mcp.NewToolResultStructured(resp, "image.compose result"), nil
+	})
+	tools.AddTool(imgComposeTool, imgComposeHandler)
+
+	// gif.create
+	gifTool := mcp.NewTool(
+		"gif.create",
+		mcp.WithDescription("Assemble image frames into an animated GIF"),
+		mcp.WithInputSchema[media.GifRequest](),
+	)
+	gifHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args media.GifRequest) (*mcp.CallToolResult, error) {
+		resp := media.GifCreate(ctx, args)
+		return mcp.NewToolResultStructured(resp, "gif.create result"), nil
+	})
+	tools.AddTool(gifTool, gifHandler)
 
 	// video.transcode
 	videoTool := mcp.NewTool(
@@ -411,7 +822,55 @@ func main() {
 		resp := media.VideoTranscode(ctx, args)
 		return mcp.NewToolResultStructured(resp, "video.transcode result"), nil
 	})
-	s.AddTool(videoTool, videoHandler)
+	tools.AddTool(videoTool, videoHandler)
+
+	// video.metadata
+	videoMetaTool := mcp.NewTool(
+		"video.metadata",
+		mcp.WithDescription("Inspect a media file's duration, container and streams via ffprobe"),
+		mcp.WithInputSchema[media.VideoMetadataRequest](),
+	)
+	videoMetaHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args media.VideoMetadataRequest) (*mcp.CallToolResult, error) {
+		resp := media.VideoMetadata(ctx, args)
+		return mcp.NewToolResultStructured(resp, "video.metadata result"), nil
+	})
+	tools.AddTool(videoMetaTool, videoMetaHandler)
+
+	// video.concat
+	concatTool := mcp.NewTool(
+		"video.concat",
+		mcp.WithDescription("Join video clips end to end"),
+		mcp.WithInputSchema[media.ConcatRequest](),
+	)
+	concatHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args media.ConcatRequest) (*mcp.CallToolResult, error) {
+		resp := media.VideoConcat(ctx, args)
+		return mcp.NewToolResultStructured(resp, "video.concat result"), nil
+	})
+	tools.AddTool(concatTool, concatHandler)
+
+	// video.thumbnail
+	videoThumbTool := mcp.NewTool(
+		"video.thumbnail",
+		mcp.WithDescription("Grab a single frame from a video"),
+		mcp.WithInputSchema[media.ThumbnailRequest](),
+	)
+	videoThumbHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args media.ThumbnailRequest) (*mcp.CallToolResult, error) {
+		resp := media.VideoThumbnail(ctx, args)
+		return mcp.NewToolResultStructured(resp, "video.thumbnail result"), nil
+	})
+	tools.AddTool(videoThumbTool, videoThumbHandler)
+
+	// audio.extract
+	audioTool := mcp.NewTool(
+		"audio.extract",
+		mcp.WithDescription("Extract the audio track of a media file to mp3, wav or flac"),
+		mcp.WithInputSchema[media.AudioExtractRequest](),
+	)
+	audioHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args media.AudioExtractRequest) (*mcp.CallToolResult, error) {
+		resp := media.AudioExtract(ctx, args)
+		return mcp.NewToolResultStructured(resp, "audio.extract result"), nil
+	})
+	tools.AddTool(audioTool, audioHandler)
 
 	// ocr.extract
 	ocrTool := mcp.NewTool(
@@ -423,7 +882,7 @@ func main() {
 		resp := media.OCRExtract(ctx, args)
 		return mcp.NewToolResultStructured(resp, "ocr.extract result"), nil
 	})
-	s.AddTool(ocrTool, ocrHandler)
+	tools.AddTool(ocrTool, ocrHandler)
 
 	// git.clone
 	cloneTool := mcp.NewTool(
@@ -435,7 +894,7 @@ func main() {
 		resp := git.Clone(ctx, args)
 		return mcp.NewToolResultStructured(resp, "git.clone result"), nil
 	})
-	s.AddTool(cloneTool, cloneHandler)
+	tools.AddTool(cloneTool, cloneHandler)
 
 	statusTool := mcp.NewTool(
 		"git.status",
@@ -446,7 +905,7 @@ func main() {
 		resp := git.Status(ctx, args)
 		return mcp.NewToolResultStructured(resp, "git.status result"), nil
 	})
-	s.AddTool(statusTool, statusHandler)
+	tools.AddTool(statusTool, statusHandler)
 
 	commitTool := mcp.NewTool(
 		"git.commit",
@@ -457,7 +916,7 @@ func main() {
 		resp := git.Commit(ctx, args)
 		return mcp.NewToolResultStructured(resp, "git.commit result"), nil
 	})
-	s.AddTool(commitTool, commitHandler)
+	tools.AddTool(commitTool, commitHandler)
 
 	pullTool := mcp.NewTool(
 		"git.pull",
@@ -468,7 +927,18 @@ func main() {
 		resp := git.Pull(ctx, args)
 		return mcp.NewToolResultStructured(resp, "git.pull result"), nil
 	})
-	s.AddTool(pullTool, pullHandler)
+	tools.AddTool(pullTool, pullHandler)
+
+	fetchTool := mcp.NewTool(
+		"git.fetch",
+		mcp.WithDescription("Fetch remote refs without merging"),
+		mcp.WithInputSchema[git.FetchRequest](),
+	)
+	fetchHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args git.FetchRequest) (*mcp.CallToolResult, error) {
+		resp := git.Fetch(ctx, args)
+		return mcp.NewToolResultStructured(resp, "git.fetch result"), nil
+	})
+	tools.AddTool(fetchTool, fetchHandler)
 
 	pushTool := mcp.NewTool(
 		"git.push",
@@ -479,7 +949,7 @@ func main() {
 		resp := git.Push(ctx, args)
 		return mcp.NewToolResultStructured(resp, "git.push result"), nil
 	})
-	s.AddTool(pushTool, pushHandler)
+	tools.AddTool(pushTool, pushHandler)
 
 	checkoutTool := mcp.NewTool(
 		"git.checkout",
@@ -490,7 +960,7 @@ func main() {
 		resp := git.Checkout(ctx, args)
 		return mcp.NewToolResultStructured(resp, "git.checkout result"), nil
 	})
-	s.AddTool(checkoutTool, checkoutHandler)
+	tools.AddTool(checkoutTool, checkoutHandler)
 
 	branchTool := mcp.NewTool(
 		"git.branch",
@@ -501,7 +971,7 @@ func main() {
 		resp := git.Branch(ctx, args)
 		return mcp.NewToolResultStructured(resp, "git.branch result"), nil
 	})
-	s.AddTool(branchTool, branchHandler)
+	tools.AddTool(branchTool, branchHandler)
 
 	tagTool := mcp.NewTool(
 		"git.tag",
@@ -512,7 +982,84 @@ func main() {
 		resp := git.Tag(ctx, args)
 		return mcp.NewToolResultStructured(resp, "git.tag result"), nil
 	})
-	s.AddTool(tagTool, tagHandler)
+	tools.AddTool(tagTool, tagHandler)
+
+	remoteTool := mcp.NewTool(
+		"git.remote",
+		mcp.WithDescription("List or manage git remotes"),
+		mcp.WithInputSchema[git.RemoteRequest](),
+	)
+	remoteHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args git.RemoteRequest) (*mcp.CallToolResult, error) {
+		resp := git.Remote(ctx, args)
+		return mcp.NewToolResultStructured(resp, "git.remote result"), nil
+	})
+	tools.AddTool(remoteTool, remoteHandler)
+
+	gitConfigTool := mcp.NewTool(
+		"git.config",
+		mcp.WithDescription("Get, set or list repository-local git config"),
+		mcp.WithInputSchema[git.ConfigRequest](),
+	)
+	gitConfigHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args git.ConfigRequest) (*mcp.CallToolResult, error) {
+		resp := git.Config(ctx, args)
+		return mcp.NewToolResultStructured(resp, "git.config result"), nil
+	})
+	tools.AddTool(gitConfigTool, gitConfigHandler)
+
+	gitMergeTool := mcp.NewTool(
+		"git.merge",
+		mcp.WithDescription("Merge a branch or commit into the current branch, reporting conflicts"),
+		mcp.WithInputSchema[git.MergeRequest](),
+	)
+	gitMergeHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args git.MergeRequest) (*mcp.CallToolResult, error) {
+		resp := git.Merge(ctx, args)
+		return mcp.NewToolResultStructured(resp, "git.merge result"), nil
+	})
+	tools.AddTool(gitMergeTool, gitMergeHandler)
+
+	gitInitTool := mcp.NewTool(
+		"git.init",
+		mcp.WithDescription("Create a new git repository, creating the directory if needed"),
+		mcp.WithInputSchema[git.InitRequest](),
+	)
+	gitInitHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args git.InitRequest) (*mcp.CallToolResult, error) {
+		resp := git.Init(ctx, args)
+		return mcp.NewToolResultStructured(resp, "git.init result"), nil
+	})
+	tools.AddTool(gitInitTool, gitInitHandler)
+
+	gitShowTool := mcp.NewTool(
+		"git.show",
+		mcp.WithDescription("Show a commit's metadata and diff, or the content of a blob or tree"),
+		mcp.WithInputSchema[git.ShowRequest](),
+	)
+	gitShowHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args git.ShowRequest) (*mcp.CallToolResult, error) {
+		resp := git.Show(ctx, args)
+		return mcp.NewToolResultStructured(resp, "git.show result"), nil
+	})
+	tools.AddTool(gitShowTool, gitShowHandler)
+
+	gitBlameTool := mcp.NewTool(
+		"git.blame",
+		mcp.WithDescription("Attribute each line of a file to the commit and author that last changed it"),
+		mcp.WithInputSchema[git.BlameRequest](),
+	)
+	gitBlameHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args git.BlameRequest) (*mcp.CallToolResult, error) {
+		resp := git.Blame(ctx, args)
+		return mcp.NewToolResultStructured(resp, "git.blame result"), nil
+	})
+	tools.AddTool(gitBlameTool, gitBlameHandler)
+
+	gitApplyTool := mcp.NewTool(
+		"git.apply",
+		mcp.WithDescription("Apply a git-format diff inside a repository"),
+		mcp.WithInputSchema[git.GitApplyRequest](),
+	)
+	gitApplyHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args git.GitApplyRequest) (*mcp.CallToolResult, error) {
+		resp := git.Apply(ctx, args)
+		return mcp.NewToolResultStructured(resp, "git.apply result"), nil
+	})
+	tools.AddTool(gitApplyTool, gitApplyHandler)
 
 	lfsTool := mcp.NewTool(
 		"git.lfs.install",
@@ -523,7 +1070,7 @@ func main() {
 		resp := git.LFSInstall(ctx, args)
 		return mcp.NewToolResultStructured(resp, "git.lfs.install result"), nil
 	})
-	s.AddTool(lfsTool, lfsHandler)
+	tools.AddTool(lfsTool, lfsHandler)
 
 	// http.request
 	httpTool := mcp.NewTool(
@@ -535,7 +1082,18 @@ func main() {
 		resp := web.HTTPRequestTool(ctx, args)
 		return mcp.NewToolResultStructured(resp, "http.request result"), nil
 	})
-	s.AddTool(httpTool, httpHandler)
+	tools.AddTool(httpTool, httpHandler)
+
+	sessionClearTool := mcp.NewTool(
+		"http.session.clear",
+		mcp.WithDescription("Clear cookies stored for an http.request session"),
+		mcp.WithInputSchema[web.SessionClearRequest](),
+	)
+	sessionClearHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args web.SessionClearRequest) (*mcp.CallToolResult, error) {
+		resp := web.ClearSession(ctx, args)
+		return mcp.NewToolResultStructured(resp, "http.session.clear result"), nil
+	})
+	tools.AddTool(sessionClearTool, sessionClearHandler)
 
 	// web.download
 	dlTool := mcp.NewTool(
@@ -547,7 +1105,7 @@ func main() {
 		resp := web.Download(ctx, args)
 		return mcp.NewToolResultStructured(resp, "web.download result"), nil
 	})
-	s.AddTool(dlTool, dlHandler)
+	tools.AddTool(dlTool, dlHandler)
 
 	// web.search
 	searchTool := mcp.NewTool(
@@ -559,7 +1117,7 @@ func main() {
 		resp := web.Search(ctx, args)
 		return mcp.NewToolResultStructured(resp, "web.search result"), nil
 	})
-	s.AddTool(searchTool, searchHandler)
+	tools.AddTool(searchTool, searchHandler)
 
 	// md.fetch
 	mdTool := mcp.NewTool(
@@ -571,7 +1129,7 @@ func main() {
 		resp := web.FetchMarkdown(ctx, args)
 		return mcp.NewToolResultStructured(resp, "md.fetch result"), nil
 	})
-	s.AddTool(mdTool, mdHandler)
+	tools.AddTool(mdTool, mdHandler)
 
 	// proc.spawn
 	spawnTool := mcp.NewTool(
@@ -583,7 +1141,7 @@ func main() {
 		resp := proc.Spawn(ctx, args)
 		return mcp.NewToolResultStructured(resp, "proc.spawn result"), nil
 	})
-	s.AddTool(spawnTool, spawnHandler)
+	tools.AddTool(spawnTool, spawnHandler)
 
 	stdinTool := mcp.NewTool(
 		"proc.stdin",
@@ -594,7 +1152,7 @@ func main() {
 		resp := proc.Stdin(ctx, args)
 		return mcp.NewToolResultStructured(resp, "proc.stdin result"), nil
 	})
-	s.AddTool(stdinTool, stdinHandler)
+	tools.AddTool(stdinTool, stdinHandler)
 
 	waitTool := mcp.NewTool(
 		"proc.wait",
@@ -605,7 +1163,29 @@ func main() {
 		resp := proc.Wait(ctx, args)
 		return mcp.NewToolResultStructured(resp, "proc.wait result"), nil
 	})
-	s.AddTool(waitTool, waitHandler)
+	tools.AddTool(waitTool, waitHandler)
+
+	readTool := mcp.NewTool(
+		"proc.read",
+		mcp.WithDescription("Read output produced by a spawned process since the given offsets without waiting"),
+		mcp.WithInputSchema[proc.ReadRequest](),
+	)
+	readHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args proc.ReadRequest) (*mcp.CallToolResult, error) {
+		resp := proc.ReadOutput(ctx, args)
+		return mcp.NewToolResultStructured(resp, "proc.read result"), nil
+	})
+	tools.AddTool(readTool, readHandler)
+
+	resizeTool := mcp.NewTool(
+		"proc.resize",
+		mcp.WithDescription("Resize the terminal of a process spawned with tty"),
+		mcp.WithInputSchema[proc.ResizeRequest](),
+	)
+	resizeHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args proc.ResizeRequest) (*mcp.CallToolResult, error) {
+		resp := proc.Resize(ctx, args)
+		return mcp.NewToolResultStructured(resp, "proc.resize result"), nil
+	})
+	tools.AddTool(resizeTool, resizeHandler)
 
 	killTool := mcp.NewTool(
 		"proc.kill",
@@ -616,7 +1196,18 @@ func main() {
 		resp := proc.Kill(ctx, args)
 		return mcp.NewToolResultStructured(resp, "proc.kill result"), nil
 	})
-	s.AddTool(killTool, killHandler)
+	tools.AddTool(killTool, killHandler)
+
+	killAllTool := mcp.NewTool(
+		"proc.killall",
+		mcp.WithDescription("Signal every tracked process group"),
+		mcp.WithInputSchema[proc.KillAllRequest](),
+	)
+	killAllHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args proc.KillAllRequest) (*mcp.CallToolResult, error) {
+		resp := proc.KillAll(ctx, args)
+		return mcp.NewToolResultStructured(resp, "proc.killall result"), nil
+	})
+	tools.AddTool(killAllTool, killAllHandler)
 
 	listTool := mcp.NewTool(
 		"proc.list",
@@ -627,7 +1218,69 @@ func main() {
 		resp := proc.List(ctx, args)
 		return mcp.NewToolResultStructured(resp, "proc.list result"), nil
 	})
-	s.AddTool(listTool, listHandler)
+	tools.AddTool(listTool, listHandler)
+
+	// sys.detect_project
+	detectTool := mcp.NewTool(
+		"sys.detect_project",
+		mcp.WithDescription("Detect the languages and build tooling of a project directory"),
+		mcp.WithInputSchema[sys.DetectProjectRequest](),
+	)
+	detectHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args sys.DetectProjectRequest) (*mcp.CallToolResult, error) {
+		resp := sys.DetectProject(ctx, args)
+		return mcp.NewToolResultStructured(resp, "sys.detect_project result"), nil
+	})
+	tools.AddTool(detectTool, detectHandler)
+
+	// sys.info
+	sysInfoTool := mcp.NewTool(
+		"sys.info",
+		mcp.WithDescription("Report workspace disk space, memory, CPU count and which optional tools are installed"),
+		mcp.WithInputSchema[sys.SysInfoRequest](),
+	)
+	sysInfoHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args sys.SysInfoRequest) (*mcp.CallToolResult, error) {
+		resp := sys.SysInfo(ctx, args)
+		return mcp.NewToolResultStructured(resp, "sys.info result"), nil
+	})
+	tools.AddTool(sysInfoTool, sysInfoHandler)
+
+	// sys.which
+	whichTool := mcp.NewTool(
+		"sys.which",
+		mcp.WithDescription("Resolve program names to absolute paths on PATH without running a shell"),
+		mcp.WithInputSchema[sys.WhichRequest](),
+	)
+	whichHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args sys.WhichRequest) (*mcp.CallToolResult, error) {
+		resp := sys.Which(ctx, args)
+		return mcp.NewToolResultStructured(resp, "sys.which result"), nil
+	})
+	tools.AddTool(whichTool, whichHandler)
+
+	// env.list
+	envListTool := mcp.NewTool(
+		"env.list",
+		mcp.WithDescription("List the server environment with secret values masked"),
+		mcp.WithInputSchema[sys.EnvListRequest](),
+	)
+	envListHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args sys.EnvListRequest) (*mcp.CallToolResult, error) {
+		resp := sys.EnvList(ctx, args)
+		return mcp.NewToolResultStructured(resp, "env.list result"), nil
+	})
+	tools.AddTool(envListTool, envListHandler)
+
+	// env.get
+	envGetTool := mcp.NewTool(
+		"env.get",
+		mcp.WithDescription("Get one environment variable; secret values are masked"),
+		mcp.WithInputSchema[sys.EnvGetRequest](),
+	)
+	envGetHandler := mcp.NewTypedToolHandler(func(ctx context.Context, req mcp.CallToolRequest, args sys.EnvGetRequest) (*mcp.CallToolResult, error) {
+		resp := sys.EnvGet(ctx, args)
+		return mcp.NewToolResultStructured(resp, "env.get result"), nil
+	})
+	tools.AddTool(envGetTool, envGetHandler)
+
+	tools.logSkipped()
 
 	// ---- context & signals
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -654,9 +1307,10 @@ func main() {
 		mux.Handle(sse.CompleteSsePath(), sse.SSEHandler())
 		mux.Handle(sse.CompleteMessagePath(), sse.MessageHandler())
 
-		// Health and metrics endpoints
+		// Health, metrics and tool manifest endpoints
 		addHealthRoutes(mux, *basePath, "sse")
 		mux.Handle("/metrics", obs.MetricsHandler())
+		mux.Handle(*basePath+"/tools", tools.manifestHandler())
 
 		srv := &http.Server{
 			Addr:    *addr,
@@ -669,7 +1323,7 @@ func main() {
 			}
 		}()
 		<-ctx.Done()
-		_ = srv.Shutdown(context.Background())
+		shutdown(srv, *shutdownTimeout)
 		return
 
 	case "http":
@@ -684,6 +1338,7 @@ func main() {
 		// Built-in health lives at /mcp/health; we also expose /healthz
 		addHealthRoutes(mux, *basePath, "http")
 		mux.Handle("/metrics", obs.MetricsHandler())
+		mux.Handle(*basePath+"/tools", tools.manifestHandler())
 
 		srv := &http.Server{
 			Addr:    *addr,
@@ -696,7 +1351,7 @@ func main() {
 			}
 		}()
 		<-ctx.Done()
-		_ = srv.Shutdown(context.Background())
+		shutdown(srv, *shutdownTimeout)
 		return
 
 	default:
@@ -704,6 +1359,36 @@ func main() {
 	}
 }
 
+// shutdown stops admitting tool calls, waits up to grace for the running ones
+// to finish, then closes the HTTP server, forcibly if the grace period ran out.
+// envBool reads a boolean environment variable such as MCP_DRY_RUN, accepting
+// the forms strconv.ParseBool does. Unset or invalid values are false.
+func envBool(name string) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("ignoring %s=%q: %v", name, v, err)
+	}
+	return b
+}
+
+func shutdown(srv *http.Server, grace time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if n := obs.InFlight(); n > 0 {
+		log.Printf("shutting down: waiting up to %s for %d in-flight tool call(s)", grace, n)
+	}
+	if err := obs.Drain(ctx); err != nil {
+		log.Printf("shutdown grace period expired with %d tool call(s) still running", obs.InFlight())
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		_ = srv.Close()
+	}
+}
+
 func addHealthRoutes(mux *http.ServeMux, basePath, transport string) {
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		writeHealth(w, transport)
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// selftestBinaries lists the external programs the registered tools rely on.
+var selftestBinaries = []string{
+	"git",
+	"rg",
+	"pandoc",
+	"libreoffice",
+	"ffmpeg",
+	"tesseract",
+	"python3",
+	"node",
+	"npm",
+}
+
+// requiredTools parses the comma-separated REQUIRED_TOOLS environment variable.
+func requiredTools() []string {
+	var out []string
+	for _, name := range strings.Split(os.Getenv("REQUIRED_TOOLS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// runSelftest probes each external dependency, logs a capability report, and
+// returns an error when any binary listed in REQUIRED_TOOLS is missing.
+func runSelftest() error {
+	required := requiredTools()
+	probe := append([]string{}, selftestBinaries...)
+	for _, name := range required {
+		found := false
+		for _, b := range probe {
+			if b == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			probe = append(probe, name)
+		}
+	}
+	available := map[string]bool{}
+	for _, name := range probe {
+		if path, err := exec.LookPath(name); err == nil {
+			available[name] = true
+			log.Printf("selftest: %-12s ok (%s)", name, path)
+		} else {
+			log.Printf("selftest: %-12s missing", name)
+		}
+	}
+	var missing []string
+	for _, name := range required {
+		if !available[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("required tools missing: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
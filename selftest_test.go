@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelftest(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "git"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	t.Setenv("PATH", bin)
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	t.Setenv("REQUIRED_TOOLS", "git")
+	if err := runSelftest(); err != nil {
+		t.Fatalf("selftest with git present: %v", err)
+	}
+	report := buf.String()
+	if !strings.Contains(report, "git          ok ("+filepath.Join(bin, "git")+")") || !strings.Contains(report, "pandoc       missing") {
+		t.Fatalf("unexpected report:\n%s", report)
+	}
+
+	buf.Reset()
+	t.Setenv("REQUIRED_TOOLS", " git, pandoc ,custom-tool")
+	err := runSelftest()
+	if err == nil || err.Error() != "required tools missing: pandoc, custom-tool" {
+		t.Fatalf("expected missing tools error, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "custom-tool  missing") {
+		t.Fatalf("extra required tool not probed:\n%s", buf.String())
+	}
+}
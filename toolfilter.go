@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gaspardpetit/mcp-shell/internal/dryrun"
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
+	mcp "github.com/mark3labs/mcp-go/mcp"
+	server "github.com/mark3labs/mcp-go/server"
+)
+
+// toolRegistry wraps the MCP server so that only tools matching the
+// operator's allow-list are registered.
+type toolRegistry struct {
+	s        *server.MCPServer
+	patterns []string
+	skipped  []string
+	tools    []mcp.Tool
+}
+
+// parseToolPatterns splits a comma-separated list of tool names or glob
+// patterns such as "fs.*".
+func parseToolPatterns(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func newToolRegistry(s *server.MCPServer, patterns []string) *toolRegistry {
+	return &toolRegistry{s: s, patterns: patterns}
+}
+
+// enabled reports whether name matches the allow-list. An empty list
+// enables every tool.
+func (r *toolRegistry) enabled(name string) bool {
+	if len(r.patterns) == 0 {
+		return true
+	}
+	for _, p := range r.patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTool registers the tool unless it is filtered out.
+func (r *toolRegistry) AddTool(tool mcp.Tool, handler server.ToolHandlerFunc) {
+	if !r.enabled(tool.Name) {
+		r.skipped = append(r.skipped, tool.Name)
+		return
+	}
+	r.s.AddTool(tool, dryRunGuard(tool.Name, handler))
+	r.tools = append(r.tools, tool)
+}
+
+// logSkipped reports the tools left out by the allow-list.
+func (r *toolRegistry) logSkipped() {
+	if len(r.skipped) > 0 {
+		log.Printf("tools disabled by allow-list: %s", strings.Join(r.skipped, ", "))
+	}
+}
+
+// manifestHandler serves the registered tools with their descriptions and
+// input schemas, so clients can be generated without an MCP session.
+func (r *toolRegistry) manifestHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"name":    buildName,
+			"version": buildVersion,
+			"tools":   r.tools,
+		})
+	})
+}
+
+// dryRunSafe lists the tools that may run while the server-wide dry-run mode
+// is on: read-only tools, and tools that take a dry_run argument and honour
+// the forced mode themselves. Every other tool is refused, so a newly added
+// mutating tool fails closed until it is listed here. A nil predicate allows
+// every call; otherwise only calls for which it returns true are allowed, e.g.
+// http.request unless it saves to a file.
+var dryRunSafe = map[string]func(args map[string]any) bool{
+	// honour dry_run themselves
+	"shell.exec":       nil,
+	"exec.run":         nil,
+	"apt.install":      nil,
+	"pip.install":      nil,
+	"pip.uninstall":    nil,
+	"npm.install":      nil,
+	"npm.uninstall":    nil,
+	"cargo.install":    nil,
+	"fs.write":         nil,
+	"fs.remove":        nil,
+	"archive.zip":      nil,
+	"archive.tar":      nil,
+	"text.apply_patch": nil,
+	"text.replace":     nil,
+	"git.clone":        nil,
+	"git.commit":       nil,
+	"git.pull":         nil,
+	"git.fetch":        nil,
+	"git.push":         nil,
+	"git.lfs.install":  nil,
+
+	// read-only
+	"python.venv.list":    nil,
+	"pip.list":            nil,
+	"npm.list":            nil,
+	"fs.list":             nil,
+	"fs.stat":             nil,
+	"fs.read":             nil,
+	"fs.read_b64":         nil,
+	"fs.read_lines":       nil,
+	"fs.search":           nil,
+	"fs.hash":             nil,
+	"fs.hash_many":        nil,
+	"fs.compare":          nil,
+	"fs.glob":             nil,
+	"text.diff":           nil,
+	"text.wc":             nil,
+	"text.jq":             nil,
+	"text.sort":           nil,
+	"text.encode":         nil,
+	"text.decode":         nil,
+	"data.convert":        nil,
+	"pdf.extract_text":    nil,
+	"spreadsheet.to_csv":  nil,
+	"spreadsheet.to_json": nil,
+	"doc.metadata":        nil,
+	"image.metadata":      nil,
+	"video.metadata":      nil,
+	"ocr.extract":         nil,
+	"git.status":          nil,
+	"git.show":            nil,
+	"git.blame":           nil,
+	"web.search":          nil,
+	"proc.wait":           nil,
+	"proc.read":           nil,
+	"proc.list":           nil,
+	"sys.detect_project":  nil,
+	"sys.info":            nil,
+	"sys.which":           nil,
+	"env.list":            nil,
+	"env.get":             nil,
+
+	// read-only unless asked to write
+	"archive.extract_file": func(a map[string]any) bool { return argString(a, "dest") == "" },
+	"text.template":        func(a map[string]any) bool { return argString(a, "out_path") == "" },
+	"git.branch":           func(a map[string]any) bool { return argString(a, "name") == "" || argBool(a, "list") },
+	"git.tag":              func(a map[string]any) bool { return argString(a, "name") == "" || argBool(a, "list") },
+	"git.remote":           func(a map[string]any) bool { act := argString(a, "action"); return act == "" || act == "list" },
+	"git.config":           func(a map[string]any) bool { return argString(a, "action") != "set" },
+	"git.apply":            func(a map[string]any) bool { return argBool(a, "check") },
+	"http.request":         func(a map[string]any) bool { return argString(a, "save_to_path") == "" },
+	"md.fetch":             func(a map[string]any) bool { return !argBool(a, "save_artifacts") },
+}
+
+// dryRunGuard refuses calls to name with POLICY_BLOCKED while the server-wide
+// dry-run mode is on, unless dryRunSafe allows them.
+func dryRunGuard(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	safe, listed := dryRunSafe[name]
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if dryrun.Forced() && (!listed || (safe != nil && !safe(req.GetArguments()))) {
+			resp := map[string]any{
+				"error":       name + " has no dry_run mode and is refused while the server runs with --dry-run",
+				"error_code":  errcode.PolicyBlocked,
+				"duration_ms": 0,
+			}
+			return mcp.NewToolResultStructured(resp, name+" result"), nil
+		}
+		return handler(ctx, req)
+	}
+}
+
+func argString(args map[string]any, key string) string {
+	s, _ := args[key].(string)
+	return s
+}
+
+func argBool(args map[string]any, key string) bool {
+	b, _ := args[key].(bool)
+	return b
+}
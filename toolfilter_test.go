@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mcp "github.com/mark3labs/mcp-go/mcp"
+	server "github.com/mark3labs/mcp-go/server"
+
+	"github.com/gaspardpetit/mcp-shell/internal/dryrun"
+	"github.com/gaspardpetit/mcp-shell/internal/errcode"
+)
+
+func callTool(t *testing.T, s *server.MCPServer, name string, args map[string]any) string {
+	t.Helper()
+	params, _ := json.Marshal(map[string]any{"name": name, "arguments": args})
+	msg := json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":` + string(params) + `}`)
+	out, err := json.Marshal(s.HandleMessage(context.Background(), msg))
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+	return string(out)
+}
+
+func TestDryRunGuard(t *testing.T) {
+	s := server.NewMCPServer("test", "0", server.WithToolCapabilities(true))
+	reg := newToolRegistry(s, nil)
+	ran := map[string]bool{}
+	handler := func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ran[req.Params.Name] = true
+		return mcp.NewToolResultText("ok"), nil
+	}
+	reg.AddTool(mcp.NewTool("fake.mutate"), handler)
+	reg.AddTool(mcp.NewTool("fs.stat"), handler)
+	reg.AddTool(mcp.NewTool("http.request"), handler)
+
+	dryrun.Force(true)
+	defer dryrun.Force(false)
+
+	if out := callTool(t, s, "fake.mutate", nil); !strings.Contains(out, errcode.PolicyBlocked) || ran["fake.mutate"] {
+		t.Fatalf("unlisted tool not refused: %s", out)
+	}
+	if out := callTool(t, s, "fs.stat", nil); strings.Contains(out, errcode.PolicyBlocked) || !ran["fs.stat"] {
+		t.Fatalf("read-only tool refused: %s", out)
+	}
+	if out := callTool(t, s, "http.request", map[string]any{"save_to_path": "x"}); !strings.Contains(out, errcode.PolicyBlocked) || ran["http.request"] {
+		t.Fatalf("writing http.request not refused: %s", out)
+	}
+	if out := callTool(t, s, "http.request", nil); strings.Contains(out, errcode.PolicyBlocked) || !ran["http.request"] {
+		t.Fatalf("plain http.request refused: %s", out)
+	}
+
+	dryrun.Force(false)
+	if out := callTool(t, s, "fake.mutate", nil); strings.Contains(out, errcode.PolicyBlocked) || !ran["fake.mutate"] {
+		t.Fatalf("tool refused outside dry-run mode: %s", out)
+	}
+}
+
+func TestManifestHandler(t *testing.T) {
+	s := server.NewMCPServer("test", "0", server.WithToolCapabilities(true))
+	reg := newToolRegistry(s, []string{"fs.*"})
+	handler := func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	}
+	reg.AddTool(mcp.NewTool("fs.stat", mcp.WithDescription("stat a path")), handler)
+	reg.AddTool(mcp.NewTool("proc.spawn"), handler)
+
+	rec := httptest.NewRecorder()
+	reg.manifestHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/mcp/tools", nil))
+	var manifest struct {
+		Name  string     `json:"name"`
+		Tools []mcp.Tool `json:"tools"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &manifest); err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+	if manifest.Name != buildName || len(manifest.Tools) != 1 || manifest.Tools[0].Name != "fs.stat" || manifest.Tools[0].Description != "stat a path" {
+		t.Fatalf("unexpected manifest: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	reg.manifestHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp/tools", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodGet {
+		t.Fatalf("POST got %d %v", rec.Code, rec.Header())
+	}
+}